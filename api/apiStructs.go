@@ -2,7 +2,12 @@ package api
 
 import (
 	"encoding/json"
+
+	"github.com/pegnet/pegnet/networkMiner"
+	"github.com/pegnet/pegnet/node"
 	"github.com/pegnet/pegnet/opr"
+	"github.com/pegnet/pegnet/polling"
+	"github.com/pegnet/pegnet/staking"
 )
 
 func MapToObject(source interface{}, dst interface{}) error {
@@ -36,6 +41,29 @@ type PerformanceParameters struct {
 	DigitalID  string     `json:"miner_id,omitempty"`
 }
 
+type PriceHistoryParameters struct {
+	BlockRange BlockRange `json:"block_range"`
+	Asset      string     `json:"asset"`
+}
+
+type PoolSharesParameters struct {
+	BlockRange BlockRange `json:"block_range"`
+}
+
+type PayoutsParameters struct {
+	BlockRange BlockRange `json:"block_range"`
+	Address    string     `json:"address"` // The FA coinbase address, or its PEG address
+}
+
+type OprsByCoinbaseParameters struct {
+	BlockRange BlockRange `json:"block_range"`
+	Address    string     `json:"address"` // The FA coinbase address
+}
+
+type StakeStatusParameters struct {
+	Blocks int `json:"blocks"` // The number of graded blocks to report on
+}
+
 // -------------------------------------------------------------
 // Responses
 
@@ -68,6 +96,49 @@ type PerformanceResult struct {
 	GradingPlacements    map[string]int64 `json:"grading_placements"`
 }
 
+type PriceHistoryResult struct {
+	BlockRange BlockRange       `json:"block_range"`
+	Asset      string           `json:"asset"`
+	Prices     []opr.PricePoint `json:"prices"`
+}
+
+type PoolSharesResult struct {
+	BlockRange BlockRange               `json:"block_range"`
+	Report     *networkMiner.PoolReport `json:"report"`
+}
+
+type PayoutsResult struct {
+	BlockRange BlockRange    `json:"block_range"`
+	Address    string        `json:"address"`
+	Total      int64         `json:"total"`
+	Payouts    []node.Payout `json:"payouts"`
+}
+
+type BurnsResult struct {
+	Address string      `json:"address"`
+	Total   int64       `json:"total"`
+	Burns   []node.Burn `json:"burns"`
+}
+
+type AddressBalancesResult struct {
+	Address  string         `json:"address"`
+	Balances []node.Balance `json:"balances"`
+}
+
+type WinnersResult struct {
+	Height  int64                    `json:"height"`
+	Winners []*opr.OraclePriceRecord `json:"winners"`
+}
+
+type DataSourceHealthResult struct {
+	Sources []polling.SourceHealth `json:"sources"`
+}
+
+type StakeStatusResult struct {
+	Statuses []*staking.SPRStatus     `json:"statuses"`
+	Accounts []staking.AddressAccount `json:"accounts"`
+}
+
 // -------------------------------------------------------------
 // Miscellaneous helper structs that appear in both requests and responses
 
@@ -5,10 +5,12 @@ package api
 
 import (
 	"strconv"
+	"strings"
 
-	"github.com/FactomProject/factom"
 	"github.com/pegnet/pegnet/common"
 	"github.com/pegnet/pegnet/opr"
+	"github.com/pegnet/pegnet/polling"
+	"github.com/pegnet/pegnet/staking"
 )
 
 // -------------------------------------------------------------
@@ -76,7 +78,7 @@ func (a *APIServer) getPerformance(params interface{}) (*PerformanceResult, *Err
 		gradingPlacements[i] = 0
 	}
 	for i := start; i <= end; i++ {
-		block := a.Grader.OprBlockByHeight(i)
+		block := a.OPRs.OprBlockByHeight(i)
 		if block == nil {
 			continue
 		}
@@ -137,12 +139,260 @@ func (a *APIServer) getPerformance(params interface{}) (*PerformanceResult, *Err
 	return result, nil
 }
 
+func (a *APIServer) getPriceHistory(params interface{}) (*PriceHistoryResult, *Error) {
+	priceParams := new(PriceHistoryParameters)
+	err := MapToObject(params, priceParams)
+	if err != nil {
+		return nil, NewJSONDecodingError()
+	}
+
+	// Parameter validation
+	asset := strings.ToUpper(priceParams.Asset)
+	if !common.AssetListContains(common.AllAssets, asset) {
+		return nil, NewInvalidParametersError()
+	}
+	start, end, apiErr := resolveRange(priceParams.BlockRange)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	prices, err := a.OPRs.PriceHistory(asset, start, end)
+	if err != nil {
+		return nil, NewInternalError()
+	}
+
+	result := &PriceHistoryResult{
+		BlockRange: BlockRange{Start: &start, End: &end},
+		Asset:      asset,
+		Prices:     prices,
+	}
+	return result, nil
+}
+
+// resolveRange turns a block range into absolute heights. A negative start is that
+// many blocks behind the leader height, and the range ends at the leader height if
+// it has no end.
+func resolveRange(r BlockRange) (int64, int64, *Error) {
+	if r.Start == nil {
+		return 0, 0, NewInvalidParametersError()
+	}
+
+	start := *r.Start
+	var end int64
+	if start < 0 || r.End == nil {
+		leaderHeight := getLeaderHeight()
+		if start < 0 {
+			start = leaderHeight + start
+			if start < 0 {
+				return 0, 0, NewInvalidParametersError() // Computed a negative height from relative start
+			}
+		}
+		end = leaderHeight
+	}
+	if r.End != nil {
+		end = *r.End
+	}
+
+	if start > end {
+		return 0, 0, NewInvalidParametersError()
+	}
+	return start, end, nil
+}
+
+// getDataSourceHealth returns the health of the data sources polled by this node.
+// Nodes that do not mine have no data sources, so the list is empty.
+func (a *APIServer) getDataSourceHealth() *DataSourceHealthResult {
+	result := &DataSourceHealthResult{Sources: []polling.SourceHealth{}}
+	if opr.PollingDataSource != nil && opr.PollingDataSource.Health != nil {
+		result.Sources = opr.PollingDataSource.Health.Report()
+	}
+	return result
+}
+
+// getStakeStatus returns how the sprs of the staker's coinbase addresses did in the
+// last graded spr blocks. Only a staking node can answer it.
+func (a *APIServer) getStakeStatus(params interface{}) (*StakeStatusResult, *Error) {
+	if a.SPRGrader == nil {
+		return nil, NewMethodNotFoundError()
+	}
+	statusParams := &StakeStatusParameters{Blocks: 1}
+	if params != nil {
+		if err := MapToObject(params, statusParams); err != nil || statusParams.Blocks < 1 {
+			return nil, NewInvalidParametersError()
+		}
+	}
+
+	coinbases, _ := staking.StakingAddresses(a.config)
+	result := &StakeStatusResult{Statuses: a.SPRGrader.Status(coinbases, statusParams.Blocks)}
+	if result.Statuses == nil {
+		result.Statuses = []*staking.SPRStatus{}
+	}
+	result.Accounts = []staking.AddressAccount{}
+	if a.Accounts != nil {
+		result.Accounts = a.Accounts.Accounts()
+	}
+	return result, nil
+}
+
+// getPoolShares splits the rewards of the pool over a range of blocks by the work of
+// each netminer. Only a net coordinator can answer it.
+func (a *APIServer) getPoolShares(params interface{}) (*PoolSharesResult, *Error) {
+	if a.PoolShares == nil {
+		return nil, NewMethodNotFoundError()
+	}
+	sharesParams := new(PoolSharesParameters)
+	err := MapToObject(params, sharesParams)
+	if err != nil {
+		return nil, NewJSONDecodingError()
+	}
+
+	start, end, apiErr := resolveRange(sharesParams.BlockRange)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	report, err := a.PoolShares.Report(start, end)
+	if err != nil {
+		return nil, NewInternalError()
+	}
+
+	result := &PoolSharesResult{
+		BlockRange: BlockRange{Start: &start, End: &end},
+		Report:     report,
+	}
+	return result, nil
+}
+
+// getPayouts returns the mining rewards of a coinbase address over a range of blocks.
+// Only a node with a node database can answer it.
+func (a *APIServer) getPayouts(params interface{}) (*PayoutsResult, *Error) {
+	if a.Node == nil {
+		return nil, NewMethodNotFoundError()
+	}
+	payoutParams := new(PayoutsParameters)
+	err := MapToObject(params, payoutParams)
+	if err != nil {
+		return nil, NewJSONDecodingError()
+	}
+
+	if payoutParams.Address == "" {
+		return nil, NewInvalidParametersError()
+	}
+	start, end, apiErr := resolveRange(payoutParams.BlockRange)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	payouts, err := a.Node.Payouts(payoutParams.Address, start, end)
+	if err != nil {
+		return nil, NewInternalError()
+	}
+
+	result := &PayoutsResult{
+		BlockRange: BlockRange{Start: &start, End: &end},
+		Address:    payoutParams.Address,
+		Payouts:    payouts,
+	}
+	for _, p := range payouts {
+		result.Total += p.Amount
+	}
+	return result, nil
+}
+
+// getOprsByCoinbase returns the oprs of a coinbase address over a range of blocks.
+// Only a node with a node database can answer it.
+func (a *APIServer) getOprsByCoinbase(params interface{}) (*GenericResult, *Error) {
+	if a.Node == nil {
+		return nil, NewMethodNotFoundError()
+	}
+	coinbaseParams := new(OprsByCoinbaseParameters)
+	err := MapToObject(params, coinbaseParams)
+	if err != nil {
+		return nil, NewJSONDecodingError()
+	}
+	if coinbaseParams.Address == "" {
+		return nil, NewInvalidParametersError()
+	}
+	start, end, apiErr := resolveRange(coinbaseParams.BlockRange)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return &GenericResult{OPRs: a.Node.OprsByCoinbase(coinbaseParams.Address, start, end)}, nil
+}
+
+// getBurns returns the burns that credited a pFCT address. Only a node with a node
+// database can answer it.
+func (a *APIServer) getBurns(params interface{}) (*BurnsResult, *Error) {
+	if a.Node == nil {
+		return nil, NewMethodNotFoundError()
+	}
+	genericParams := new(GenericParameters)
+	err := MapToObject(params, genericParams)
+	if err != nil {
+		return nil, NewJSONDecodingError()
+	} else if genericParams.Address == nil {
+		return nil, NewInvalidParametersError()
+	}
+
+	burns, err := a.Node.Burns(*genericParams.Address)
+	if err != nil {
+		return nil, NewInternalError()
+	}
+	result := &BurnsResult{Address: *genericParams.Address, Burns: burns}
+	for _, b := range burns {
+		result.Total += b.Amount
+	}
+	return result, nil
+}
+
+// getAddressBalances returns the balance of every asset of a coinbase address, FA or
+// any of its pegnet addresses. Only a node with a node database can answer it.
+func (a *APIServer) getAddressBalances(params interface{}) (*AddressBalancesResult, *Error) {
+	if a.Node == nil {
+		return nil, NewMethodNotFoundError()
+	}
+	genericParams := new(GenericParameters)
+	err := MapToObject(params, genericParams)
+	if err != nil {
+		return nil, NewJSONDecodingError()
+	} else if genericParams.Address == nil {
+		return nil, NewInvalidParametersError()
+	}
+
+	balances, err := a.Node.Balances(*genericParams.Address)
+	if err != nil {
+		return nil, NewInternalError()
+	}
+	return &AddressBalancesResult{Address: *genericParams.Address, Balances: balances}, nil
+}
+
+// getWinnersByHeight returns the paid oprs of the block at a height, by place. Only a
+// node with a node database can answer it.
+func (a *APIServer) getWinnersByHeight(params interface{}) (*WinnersResult, *Error) {
+	if a.Node == nil {
+		return nil, NewMethodNotFoundError()
+	}
+	genericParams := new(GenericParameters)
+	err := MapToObject(params, genericParams)
+	if err != nil {
+		return nil, NewJSONDecodingError()
+	} else if genericParams.Height == nil {
+		return nil, NewInvalidParametersError()
+	}
+
+	winners, err := a.Node.Winners(*genericParams.Height)
+	if err != nil {
+		return nil, NewInternalError()
+	}
+	return &WinnersResult{Height: *genericParams.Height, Winners: winners}, nil
+}
+
 // -------------------------------------------------------------
 // Somewhat temporary, might not remain
 
 func (a *APIServer) getCurrentOPRs() (*GenericResult, *Error) {
 	height := getLeaderHeight()
-	records := a.Grader.OprBlockByHeight(height)
+	records := a.OPRs.OprBlockByHeight(height)
 	return &GenericResult{OPRBlock: records}, nil
 }
 
@@ -155,7 +405,7 @@ func (a *APIServer) getOprByHash(params interface{}) (*GenericResult, *Error) {
 	} else if genericParams.Hash == "" {
 		return nil, NewInvalidParametersError()
 	}
-	record := a.Grader.OprByHash(genericParams.Hash)
+	record := a.OPRs.OprByHash(genericParams.Hash)
 	return &GenericResult{OPR: &record}, nil
 }
 
@@ -168,7 +418,7 @@ func (a *APIServer) getOprByShortHash(params interface{}) (*GenericResult, *Erro
 	} else if genericParams.Hash == "" {
 		return nil, NewInvalidParametersError()
 	}
-	record := a.Grader.OprByShortHash(genericParams.Hash)
+	record := a.OPRs.OprByShortHash(genericParams.Hash)
 	return &GenericResult{OPR: &record}, nil
 }
 
@@ -181,7 +431,7 @@ func (a *APIServer) getOprsByDigitalID(params interface{}) (*GenericResult, *Err
 	} else if genericParams.DigitalID == "" {
 		return nil, NewInvalidParametersError()
 	}
-	records := a.Grader.OprsByDigitalID(genericParams.DigitalID)
+	records := a.OPRs.OprsByDigitalID(genericParams.DigitalID)
 	return &GenericResult{OPRs: records}, nil
 }
 
@@ -195,7 +445,7 @@ func (a *APIServer) getOPRsByHeight(params interface{}) (*GenericResult, *Error)
 	} else if genericParams.Height == nil {
 		return nil, NewInvalidParametersError()
 	}
-	oprBlock := a.Grader.OprBlockByHeight(*genericParams.Height)
+	oprBlock := a.OPRs.OprBlockByHeight(*genericParams.Height)
 	return &GenericResult{OPRBlock: oprBlock}, nil
 }
 
@@ -218,7 +468,7 @@ func (a *APIServer) getBalance(params interface{}) (*GenericResult, *Error) {
 // getWinners returns the current 10 winners entry shorthashes from the last recorded block
 func (a *APIServer) getWinners() []string {
 	height := getLeaderHeight()
-	currentOPRS := a.Grader.OprBlockByHeight(height)
+	currentOPRS := a.OPRs.OprBlockByHeight(height)
 	record := currentOPRS.OPRs[0]
 	return record.WinPreviousOPR
 }
@@ -230,7 +480,7 @@ func (a *APIServer) getWinner() string {
 
 // getLeaderHeight helper function, cleaner than using the factom monitor
 func getLeaderHeight() int64 {
-	heights, err := factom.GetHeights()
+	heights, err := common.DefaultFactomClient.GetHeights()
 	if err != nil {
 		return 0
 	}
@@ -10,17 +10,35 @@ import (
 
 	"github.com/pegnet/pegnet/balances"
 	"github.com/pegnet/pegnet/mining"
+	"github.com/pegnet/pegnet/networkMiner"
+	"github.com/pegnet/pegnet/node"
 	"github.com/pegnet/pegnet/opr"
+	"github.com/pegnet/pegnet/staking"
 	log "github.com/sirupsen/logrus"
 	"github.com/zpatrick/go-config"
 )
 
+// OPRSource is where the api reads the graded oprs from. It is the grader, or the node
+// database if the grader writes into one.
+type OPRSource interface {
+	OprBlockByHeight(dbht int64) *opr.OprBlock
+	OprsByDigitalID(did string) []opr.OraclePriceRecord
+	OprByHash(hash string) opr.OraclePriceRecord
+	OprByShortHash(shorthash string) opr.OraclePriceRecord
+	PriceHistory(asset string, start, end int64) ([]opr.PricePoint, error)
+}
+
 // APIServer as the base handler
 type APIServer struct {
 	Statistics *mining.GlobalStatTracker
 	Server     *http.Server
 	Grader     *opr.QuickGrader
+	OPRs       OPRSource
+	Node       *node.NodeDatabase // Only set when the grader writes the node database
 	Balances   *balances.BalanceTracker
+	SPRGrader  *staking.SPRGrader         // Only set when staking
+	Accounts   *staking.StakerAccounts    // Only set when staking
+	PoolShares *networkMiner.ShareTracker // Only set when coordinating netminers
 	Mux        *http.ServeMux
 	config     *config.Config
 }
@@ -33,12 +51,21 @@ func NewApiServer(grader *opr.QuickGrader, balances *balances.BalanceTracker, co
 	s.Server.Handler = corsHeader(mux)
 	s.Mux = mux
 	s.Grader = grader
+	if grader != nil {
+		s.OPRs = grader
+	}
 	s.Balances = balances
 	s.config = config
 
 	return s
 }
 
+// UseNodeDatabase reads the oprs from the node database, rather than the grader
+func (s *APIServer) UseNodeDatabase(n *node.NodeDatabase) {
+	s.Node = n
+	s.OPRs = n
+}
+
 func corsHeader(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -82,12 +109,44 @@ func (h *APIServer) apiHandler(w http.ResponseWriter, r *http.Request) {
 	// enable cors
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
+	if !h.serves(request.Method) {
+		Respond(w, PostResponse{Err: NewMethodNotFoundError()})
+		return
+	}
+
 	var result interface{}
 	var apiError *Error
 	switch request.Method {
 	case "performance":
 		result, apiError = h.getPerformance(request.Params)
 
+	case "price-history":
+		result, apiError = h.getPriceHistory(request.Params)
+
+	case "datasource-health":
+		result = h.getDataSourceHealth()
+
+	case "stake-status":
+		result, apiError = h.getStakeStatus(request.Params)
+
+	case "pool-shares":
+		result, apiError = h.getPoolShares(request.Params)
+
+	case "payouts":
+		result, apiError = h.getPayouts(request.Params)
+
+	case "oprs-by-coinbase":
+		result, apiError = h.getOprsByCoinbase(request.Params)
+
+	case "burns":
+		result, apiError = h.getBurns(request.Params)
+
+	case "address-balances":
+		result, apiError = h.getAddressBalances(request.Params)
+
+	case "winners-by-height":
+		result, apiError = h.getWinnersByHeight(request.Params)
+
 	case "all-oprs":
 		// TODO: This is not thread safe. This call could be exceedingly large too
 		// 		I think it should be tossed
@@ -127,7 +186,7 @@ func (h *APIServer) apiHandler(w http.ResponseWriter, r *http.Request) {
 	// Failing method - shorthash needs to be fixed
 	case "winning-opr":
 		winner := h.getWinner()
-		winningOPR := h.Grader.OprByShortHash(winner)
+		winningOPR := h.OPRs.OprByShortHash(winner)
 		result = &GenericResult{OPR: &winningOPR}
 
 	default:
@@ -143,6 +202,34 @@ func (h *APIServer) apiHandler(w http.ResponseWriter, r *http.Request) {
 	Respond(w, response)
 }
 
+// oprMethods are the methods that read the graded oprs
+var oprMethods = map[string]bool{
+	"performance":      true,
+	"price-history":    true,
+	"current-oprs":     true,
+	"oprs-by-height":   true,
+	"oprs-by-id":       true,
+	"opr-by-hash":      true,
+	"opr-by-shorthash": true,
+	"winners":          true,
+	"winner":           true,
+	"winning-opr":      true,
+}
+
+// serves is false for the methods that need a part of the node the server was not given,
+// like the staker api, which only has the spr grader
+func (h *APIServer) serves(method string) bool {
+	switch {
+	case oprMethods[method]:
+		return h.OPRs != nil
+	case method == "all-oprs":
+		return h.Grader != nil
+	case method == "balance":
+		return h.Balances != nil
+	}
+	return true
+}
+
 func Respond(w http.ResponseWriter, response PostResponse) {
 	err := json.NewEncoder(w).Encode(response)
 	if err != nil {
@@ -14,11 +14,15 @@ type BalanceTracker struct {
 	// assetname => { RCD-hash => balance }
 	Balances map[string]map[[32]byte]int64
 	sync.Mutex
+
+	// changed holds the balances modified since the last call to TakeChanges
+	changed map[string]map[[32]byte]bool
 }
 
 func NewBalanceTracker() *BalanceTracker {
 	b := new(BalanceTracker)
 	b.Balances = make(map[string]map[[32]byte]int64)
+	b.changed = make(map[string]map[[32]byte]bool)
 
 	return b
 }
@@ -54,6 +58,7 @@ func (b *BalanceTracker) AddToBalance(address string, value int64) (err error) {
 		return fmt.Errorf("result would be less than zero %d-%d", prev, -value)
 	}
 	b.Balances[prefix][addressBytes] = prev + value
+	b.markChanged(prefix, addressBytes)
 
 	//log.WithFields(log.Fields{
 	//	"address":       address,
@@ -98,3 +103,56 @@ func (b *BalanceTracker) DiagnosticAssetHumanReadablePEGBalances(prefix string)
 	r["all"] = fmt.Sprintf("%d", total)
 	return r
 }
+
+func (b *BalanceTracker) markChanged(prefix string, adr [32]byte) {
+	if b.changed == nil {
+		b.changed = make(map[string]map[[32]byte]bool)
+	}
+	if _, ok := b.changed[prefix]; !ok {
+		b.changed[prefix] = make(map[[32]byte]bool)
+	}
+	b.changed[prefix][adr] = true
+}
+
+// TakeChanges returns the current value of every balance modified since the
+// last call, and resets the set of modified balances.
+func (b *BalanceTracker) TakeChanges() map[string]map[[32]byte]int64 {
+	b.Lock()
+	defer b.Unlock()
+	changes := make(map[string]map[[32]byte]int64)
+	for prefix, adrs := range b.changed {
+		changes[prefix] = make(map[[32]byte]int64)
+		for adr := range adrs {
+			changes[prefix][adr] = b.Balances[prefix][adr]
+		}
+	}
+	b.changed = make(map[string]map[[32]byte]bool)
+	return changes
+}
+
+// Copy returns a copy of all balances
+func (b *BalanceTracker) Copy() map[string]map[[32]byte]int64 {
+	b.Lock()
+	defer b.Unlock()
+	return copyBalances(b.Balances)
+}
+
+// Reset replaces all balances with the given ones, and discards any
+// modifications not yet taken.
+func (b *BalanceTracker) Reset(balances map[string]map[[32]byte]int64) {
+	b.Lock()
+	defer b.Unlock()
+	b.Balances = copyBalances(balances)
+	b.changed = make(map[string]map[[32]byte]bool)
+}
+
+func copyBalances(balances map[string]map[[32]byte]int64) map[string]map[[32]byte]int64 {
+	c := make(map[string]map[[32]byte]int64)
+	for prefix, adrs := range balances {
+		c[prefix] = make(map[[32]byte]int64)
+		for adr, bal := range adrs {
+			c[prefix][adr] = bal
+		}
+	}
+	return c
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 
-	"github.com/FactomProject/factom"
 	"github.com/pegnet/pegnet/common"
 	"github.com/zpatrick/go-config"
 )
@@ -12,11 +11,18 @@ import (
 type BurnTracking struct {
 	FctDbht  int64
 	Balances *BalanceTracker
+	Factom   common.FactomClient
+
+	// Checkpoint is called after every synced fblock, if set
+	Checkpoint func() error
+	// Burned is called for every burn, with the pFCT it credits, if set
+	Burned func(height int64, txid, address string, amount int64) error
 }
 
 func NewBurnTracking(balanceTracker *BalanceTracker) *BurnTracking {
 	b := new(BurnTracking)
 	b.Balances = balanceTracker
+	b.Factom = common.DefaultFactomClient
 
 	return b
 }
@@ -31,66 +37,110 @@ func (b *BurnTracking) UpdateBurns(c *config.Config, startBlock int64) error {
 		b.FctDbht = startBlock
 	}
 
-	heights, err := factom.GetHeights()
+	heights, err := b.Factom.GetHeights()
 	if err != nil {
 		return err
 	}
 
 	for i := b.FctDbht + 1; i < heights.DirectoryBlockHeight; i++ {
 		deltas := make(map[string]int64)
-
-		fc, _, err := factom.GetFBlockByHeight(i)
+		err := b.blockBurns(network, i, func(txid, pFct string, credit int64) error {
+			deltas[pFct] += credit
+			if b.Burned != nil && credit > 0 {
+				return b.Burned(i, txid, pFct, credit)
+			}
+			return nil
+		})
 		if err != nil {
 			return err
 		}
-		if fc == nil {
-			return fmt.Errorf("fblock is nil")
-		}
 
-		for _, txid := range fc.Transactions {
-			txInterface, err := factom.GetTransaction(txid.TxID)
-			if err != nil {
+		// Process them as a block
+		for pFct, delta := range deltas {
+			_ = b.Balances.AddToBalance(pFct, delta)
+		}
+		b.FctDbht = i
+		if b.Checkpoint != nil {
+			if err := b.Checkpoint(); err != nil {
 				return err
 			}
+		}
+	}
+	return nil
+}
 
-			txData, err := json.Marshal(txInterface.FactoidTransaction)
-			if err != nil {
-				return err
+// ScanBurns calls burned for every burn in the fblocks after start, up to and including
+// end, without touching the balances. It finds the burns of blocks that were already
+// synced.
+func (b *BurnTracking) ScanBurns(c *config.Config, start, end int64, burned func(height int64, txid, address string, amount int64) error) error {
+	network, err := common.LoadConfigNetwork(c)
+	if err != nil {
+		return err
+	}
+	for i := start + 1; i <= end; i++ {
+		err := b.blockBurns(network, i, func(txid, pFct string, credit int64) error {
+			if credit > 0 {
+				return burned(i, txid, pFct, credit)
 			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			tx := new(FactoidTransaction)
-			err = json.Unmarshal(txData, tx)
-			if err != nil {
-				return err
-			}
+// blockBurns calls burned for every burn in the fblock at the height, with the pFCT
+// address and the amount it credits
+func (b *BurnTracking) blockBurns(network string, height int64, burned func(txid, pFct string, credit int64) error) error {
+	fc, _, err := b.Factom.GetFBlockByHeight(height)
+	if err != nil {
+		return err
+	}
+	if fc == nil {
+		return fmt.Errorf("fblock is nil")
+	}
 
-			// Is this a burn?
-			if len(tx.Outecs) == 1 && tx.Outecs[0].Useraddress == common.BurnAddresses[network] && tx.Outecs[0].Amount == 0 {
-				// The output is a burn. Let's check some other properties
-				if len(tx.Outputs) > 0 || len(tx.Inputs) > 1 {
-					continue // must only have 1 output, and 1 input, being the burn
-				}
-
-				burnAmt := tx.Inputs[0].Amount
-				pFct, err := common.ConvertFCTtoPegNetAsset(network, "FCT", tx.Inputs[0].Useraddress)
-				if err != nil {
-					return err
-				}
-				if network == common.MainNetwork {
-					deltas[pFct] += int64(burnAmt)
-
-				} else if network == common.TestNetwork {
-					deltas[pFct] += int64(burnAmt) * 1000
-				}
+	for _, txid := range fc.Transactions {
+		txInterface, err := b.Factom.GetTransaction(txid.TxID)
+		if err != nil {
+			return err
+		}
 
-			}
+		txData, err := json.Marshal(txInterface.FactoidTransaction)
+		if err != nil {
+			return err
 		}
 
-		// Process them as a block
-		for pFct, delta := range deltas {
-			_ = b.Balances.AddToBalance(pFct, delta)
+		tx := new(FactoidTransaction)
+		err = json.Unmarshal(txData, tx)
+		if err != nil {
+			return err
+		}
+
+		// Is this a burn?
+		if len(tx.Outecs) == 1 && tx.Outecs[0].Useraddress == common.BurnAddresses[network] && tx.Outecs[0].Amount == 0 {
+			// The output is a burn. Let's check some other properties
+			if len(tx.Outputs) > 0 || len(tx.Inputs) > 1 {
+				continue // must only have 1 output, and 1 input, being the burn
+			}
+
+			burnAmt := tx.Inputs[0].Amount
+			pFct, err := common.ConvertFCTtoPegNetAsset(network, "FCT", tx.Inputs[0].Useraddress)
+			if err != nil {
+				return err
+			}
+			credit := int64(0)
+			if network == common.MainNetwork {
+				credit = int64(burnAmt)
+			} else if network == common.TestNetwork {
+				credit = int64(burnAmt) * 1000
+			}
+			if err := burned(txid.TxID, pFct, credit); err != nil {
+				return err
+			}
 		}
-		b.FctDbht = i
 	}
 	return nil
 }
@@ -0,0 +1,203 @@
+package balances
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/pegnet/pegnet/database"
+)
+
+// CheckpointCompactInterval is the number of checkpoints written before they are
+// folded into a full snapshot of the balances
+const CheckpointCompactInterval = 1000
+
+var (
+	snapshotKey   = []byte("snapshot")
+	checkpointKey = []byte("checkpoint")
+)
+
+// SyncHeights are the heights up to which each source of balance updates
+// has been applied
+type SyncHeights struct {
+	Payouts      int64 // The last opr block with its miner rewards paid
+	Burns        int64 // BurnTracking.FctDbht
+	Transactions int64 // TransactionTracking.Dbht
+
+	// Applied is TransactionTracking.Applied, the transaction batches in the replay
+	// window. Replay protection has to survive a restart.
+	Applied map[string]int64
+}
+
+// BalanceCheckpoint is a single write to the database. A checkpoint holds the
+// balances changed since the previous checkpoint, a snapshot holds all of them.
+type BalanceCheckpoint struct {
+	Sequence uint64
+	Heights  SyncHeights
+	Balances map[string]map[[32]byte]int64
+}
+
+// BalanceStore persists the balance tracker to the database.
+// Every block is written as a single checkpoint record with the balances it changed
+// and the sync heights after it. The checkpoint is added to the batch the block is
+// written in, so a block is either entirely on disk or not at all.
+// Every CheckpointCompactInterval checkpoints are folded into a snapshot.
+type BalanceStore struct {
+	DB database.IDatabase
+
+	// Written is called with the balances changed by each checkpoint, and with all of
+	// them once they are loaded, if set
+	Written func(balances map[string]map[[32]byte]int64) error
+
+	// sequence is the last checkpoint written, snapshot is the
+	// last checkpoint included in the snapshot
+	sequence uint64
+	snapshot uint64
+}
+
+func NewBalanceStore(db database.IDatabase) *BalanceStore {
+	s := new(BalanceStore)
+	s.DB = db
+
+	return s
+}
+
+// Checkpoint adds the balances changed since the last checkpoint, along with the given
+// sync heights, to the batch. If the batch is not written, Load has to be called to go
+// back to the last checkpoint on disk.
+func (s *BalanceStore) Checkpoint(batch *database.Batch, b *BalanceTracker, heights SyncHeights) error {
+	cp := BalanceCheckpoint{
+		Sequence: s.sequence + 1,
+		Heights:  heights,
+		Balances: b.TakeChanges(),
+	}
+	data, err := database.Encode(cp)
+	if err != nil {
+		return err
+	}
+	batch.Put(database.BUCKET_BALANCES, CheckpointKey(cp.Sequence), data)
+	s.sequence = cp.Sequence
+	if s.Written != nil {
+		if err := s.Written(cp.Balances); err != nil {
+			return err
+		}
+	}
+
+	if s.sequence-s.snapshot >= CheckpointCompactInterval {
+		return s.compact(batch, b, heights)
+	}
+	return nil
+}
+
+// compact adds all balances as the new snapshot to the batch, and removes the
+// checkpoints it replaces in the same write
+func (s *BalanceStore) compact(batch *database.Batch, b *BalanceTracker, heights SyncHeights) error {
+	snap := BalanceCheckpoint{
+		Sequence: s.sequence,
+		Heights:  heights,
+		Balances: b.Copy(),
+	}
+	data, err := database.Encode(snap)
+	if err != nil {
+		return err
+	}
+	batch.Put(database.BUCKET_BALANCES, snapshotKey, data)
+	for seq := s.snapshot + 1; seq <= snap.Sequence; seq++ {
+		batch.Delete(database.BUCKET_BALANCES, CheckpointKey(seq))
+	}
+	s.snapshot = snap.Sequence
+	return nil
+}
+
+// Load replaces the balances in the tracker with the last persisted state and
+// returns the heights it was synced to. If nothing was persisted, the tracker
+// is emptied and the heights are all 0.
+func (s *BalanceStore) Load(b *BalanceTracker) (SyncHeights, error) {
+	snap, compacted, err := s.replay(math.MaxInt64)
+	if err != nil {
+		return SyncHeights{}, err
+	}
+
+	b.Reset(snap.Balances)
+	s.snapshot = compacted
+	s.sequence = snap.Sequence
+	if s.Written != nil {
+		if err := s.Written(snap.Balances); err != nil {
+			return SyncHeights{}, err
+		}
+	}
+	return snap.Heights, nil
+}
+
+// SnapshotAt returns the balances as they were once the opr block at the height was paid
+// out, as a snapshot. The burns and transactions in it are the ones synced by then. The
+// checkpoints before the last snapshot are folded into it, so the height can not be
+// before the snapshot.
+func (s *BalanceStore) SnapshotAt(height int64) (*BalanceCheckpoint, error) {
+	snap, _, err := s.replay(height)
+	if err != nil {
+		return nil, err
+	}
+	if snap.Heights.Payouts > height {
+		return nil, fmt.Errorf("the balances before height %d are compacted", snap.Heights.Payouts)
+	}
+	return snap, nil
+}
+
+// replay merges the snapshot with the checkpoints written after it, up to the last one
+// with the payouts of the height. The sequence of the result is the last checkpoint
+// merged, compacted is the last checkpoint in the snapshot on disk.
+func (s *BalanceStore) replay(height int64) (snap *BalanceCheckpoint, compacted uint64, err error) {
+	snap = &BalanceCheckpoint{Balances: make(map[string]map[[32]byte]int64)}
+	data, err := s.DB.Get(database.BUCKET_BALANCES, snapshotKey)
+	if err != nil && err != database.ErrNotFound {
+		return nil, 0, err
+	}
+	if err == nil {
+		if err := database.Decode(snap, data); err != nil {
+			return nil, 0, err
+		}
+	}
+	compacted = snap.Sequence
+
+	// Replay the checkpoints written after the snapshot
+	for {
+		data, err := s.DB.Get(database.BUCKET_BALANCES, CheckpointKey(snap.Sequence+1))
+		if err == database.ErrNotFound {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var cp BalanceCheckpoint
+		if err := database.Decode(&cp, data); err != nil {
+			return nil, 0, err
+		}
+		if cp.Heights.Payouts > height {
+			break
+		}
+		for prefix, adrs := range cp.Balances {
+			if _, ok := snap.Balances[prefix]; !ok {
+				snap.Balances[prefix] = make(map[[32]byte]int64)
+			}
+			for adr, bal := range adrs {
+				snap.Balances[prefix][adr] = bal
+			}
+		}
+		snap.Heights = cp.Heights
+		snap.Sequence++
+	}
+	return snap, compacted, nil
+}
+
+// SnapshotKey is the key of the snapshot of all balances
+func SnapshotKey() []byte {
+	return append([]byte{}, snapshotKey...)
+}
+
+func CheckpointKey(sequence uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, sequence)
+	return append(append([]byte{}, checkpointKey...), buf...)
+}
@@ -0,0 +1,80 @@
+package balances_test
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/pegnet/pegnet/balances"
+	"github.com/pegnet/pegnet/database"
+)
+
+func TestBalanceStore_Checkpoints(t *testing.T) {
+	db := database.NewMapDb()
+	store := NewBalanceStore(db)
+	tracker := NewBalanceTracker()
+	alice, bob := newTestWallet(), newTestWallet()
+
+	// Write enough blocks to compact at least once, and leave some checkpoints after it
+	blocks := int64(CheckpointCompactInterval + 10)
+	for i := int64(1); i <= blocks; i++ {
+		_ = tracker.AddToBalance(alice.peg("PEG"), 1)
+		if i%2 == 0 {
+			_ = tracker.AddToBalance(bob.peg("USD"), 2)
+		}
+		batch := database.NewBatch()
+		if err := store.Checkpoint(batch, tracker, SyncHeights{Payouts: i, Burns: i + 1, Transactions: i + 2}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Write(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The compacted checkpoints are gone
+	if _, err := db.Get(database.BUCKET_BALANCES, CheckpointKey(1)); err != database.ErrNotFound {
+		t.Errorf("exp compacted checkpoint to be deleted, found err %v", err)
+	}
+
+	// The balances once an earlier block was paid, as far back as the snapshot
+	snap, err := store.SnapshotAt(blocks - 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := NewBalanceTracker()
+	at.Reset(snap.Balances)
+	if bal := at.GetBalance(alice.peg("PEG")); snap.Heights.Payouts != blocks-5 || bal != blocks-5 {
+		t.Errorf("exp the balances at %d, found %d at %d", blocks-5, bal, snap.Heights.Payouts)
+	}
+	if _, err := store.SnapshotAt(5); err == nil {
+		t.Error("exp an error for balances before the snapshot")
+	}
+
+	// A block that fails partway is rolled back
+	_ = tracker.AddToBalance(alice.peg("PEG"), 1000)
+
+	restored := NewBalanceTracker()
+	for _, b := range []*BalanceTracker{restored, tracker} {
+		heights, err := NewBalanceStore(db).Load(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if heights.Payouts != blocks || heights.Burns != blocks+1 || heights.Transactions != blocks+2 {
+			t.Errorf("unexpected heights %v", heights)
+		}
+		if bal := b.GetBalance(alice.peg("PEG")); bal != blocks {
+			t.Errorf("exp alice to have %d, found %d", blocks, bal)
+		}
+		if bal := b.GetBalance(bob.peg("USD")); bal != blocks {
+			t.Errorf("exp bob to have %d, found %d", blocks, bal)
+		}
+	}
+
+	// Nothing written yet
+	heights, err := NewBalanceStore(database.NewMapDb()).Load(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(heights, SyncHeights{}) || restored.GetBalance(alice.peg("PEG")) != 0 {
+		t.Errorf("exp an empty store to load no balances")
+	}
+}
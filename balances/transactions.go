@@ -0,0 +1,487 @@
+package balances
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/modules/conversions"
+	"github.com/pegnet/pegnet/modules/transactionid"
+	log "github.com/sirupsen/logrus"
+	"github.com/zpatrick/go-config"
+)
+
+const (
+	// TransactionTimestampWindow is how far a transaction batch timestamp can be from
+	// the directory block timestamp it is included in. This prevents replaying old entries.
+	TransactionTimestampWindow = 12 * time.Hour
+
+	// TransactionReplayBlocks is the number of blocks we remember applied entry hashes for.
+	// This covers the timestamp window on both sides.
+	TransactionReplayBlocks = 2 * 12 * 6
+)
+
+var tLog = log.WithField("id", "transactions")
+
+// IRateProvider gives the graded asset rates for a given height.
+// The rates are in 1e-8 USD, the same as the assets in an opr.
+type IRateProvider interface {
+	// GradedRates returns nil if the height has no graded rates
+	GradedRates(height int64) map[string]uint64
+}
+
+// TransactionTracking syncs the PegNet transaction chain, and applies the transfers and
+// conversions to the balances.
+type TransactionTracking struct {
+	Dbht     int64 // The last directory block height synced
+	ChainID  string
+	Network  string
+	Balances *BalanceTracker
+	Rates    IRateProvider
+	Factom   common.FactomClient
+
+	// Checkpoint is called after every synced directory block, if set
+	Checkpoint func() error
+
+	// applied is the entry hashes applied in the last TransactionReplayBlocks blocks
+	//	Key -> Entryhash
+	//	Value -> Height applied
+	applied map[string]int64
+}
+
+func NewTransactionTracking(c *config.Config, balanceTracker *BalanceTracker, rates IRateProvider) *TransactionTracking {
+	t := new(TransactionTracking)
+	network, err := common.LoadConfigNetwork(c)
+	common.CheckAndPanic(err)
+	protocol, err := c.String("Miner.Protocol")
+	common.CheckAndPanic(err)
+
+	t.Network = network
+	t.ChainID = hex.EncodeToString(common.ComputeChainIDFromStrings([]string{protocol, network, common.TransactionChainTag}))
+	t.Balances = balanceTracker
+	t.Rates = rates
+	t.Factom = common.DefaultFactomClient
+
+	return t
+}
+
+// Applied returns the entry hashes applied in the replay window, and the heights
+// they were applied at
+func (t *TransactionTracking) Applied() map[string]int64 {
+	applied := make(map[string]int64, len(t.applied))
+	for entryhash, h := range t.applied {
+		applied[entryhash] = h
+	}
+	return applied
+}
+
+// Restore sets the synced height and the entry hashes applied before it, as they
+// were checkpointed. Entries out of the replay window of the height are dropped.
+func (t *TransactionTracking) Restore(dbht int64, applied map[string]int64) {
+	t.Dbht = dbht
+	t.applied = make(map[string]int64)
+	for entryhash, h := range applied {
+		if h >= dbht-TransactionReplayBlocks {
+			t.applied[entryhash] = h
+		}
+	}
+}
+
+// UpdateTransactions walks the directory blocks from our last synced height and applies
+// every transaction batch found in the transaction chain.
+func (t *TransactionTracking) UpdateTransactions(startBlock int64) error {
+	if t.Dbht == 0 {
+		t.Dbht = startBlock
+	}
+
+	heights, err := t.Factom.GetHeights()
+	if err != nil {
+		return err
+	}
+
+	for i := t.Dbht + 1; i < heights.DirectoryBlockHeight; i++ {
+		dblock, _, err := t.Factom.GetDBlockByHeight(i)
+		if err != nil {
+			return err
+		}
+		if dblock == nil {
+			return fmt.Errorf("dblock is nil")
+		}
+
+		var entries []*factom.Entry
+		for _, ent := range dblock.DBEntries {
+			if ent.ChainID != t.ChainID {
+				continue
+			}
+			entries, err = t.Factom.GetAllEBlockEntries(ent.KeyMR)
+			if err != nil {
+				return err
+			}
+		}
+
+		timestamp := time.Unix(int64(dblock.Header.Timestamp)*60, 0)
+		t.ApplyTransactionBlock(i, timestamp, entries)
+		t.Dbht = i
+		if t.Checkpoint != nil {
+			if err := t.Checkpoint(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyTransactionBlock applies all the transaction batches at a given height.
+// Invalid batches are logged and skipped. Transfers and conversions out of PEG are applied
+// in entry order, conversions into PEG are limited by the conversion supply and paid
+// at the end of the block.
+func (t *TransactionTracking) ApplyTransactionBlock(height int64, timestamp time.Time, entries []*factom.Entry) {
+	if t.applied == nil {
+		t.applied = make(map[string]int64)
+	}
+	rates := t.Rates.GradedRates(height)
+	supply := conversions.NewConversionSupply(conversions.PerBlock)
+	pending := make(map[string]*pendingConversion)
+
+	for _, entry := range entries {
+		entryhash := hex.EncodeToString(entry.Hash())
+		fLog := tLog.WithFields(log.Fields{"dbht": height, "entryhash": entryhash})
+		if _, ok := t.applied[entryhash]; ok {
+			fLog.Warn("transaction batch replayed")
+			continue
+		}
+
+		batch, err := ParseTransactionBatch(entry)
+		if err != nil {
+			fLog.WithError(err).Debug("invalid transaction batch")
+			continue
+		}
+
+		if err := batch.ValidTimestamp(timestamp); err != nil {
+			fLog.WithError(err).Debug("invalid transaction batch")
+			continue
+		}
+
+		if err := t.applyBatch(batch, rates, supply, pending); err != nil {
+			fLog.WithError(err).Debug("transaction batch rejected")
+			continue
+		}
+		t.applied[entryhash] = height
+	}
+
+	// Conversions into PEG share the supply of the block
+	payouts := supply.Payouts()
+	for txid, p := range pending {
+		yield := payouts[txid]
+		if err := t.Balances.AddToBalance(p.pegAddress, int64(yield)); err != nil {
+			tLog.WithError(err).WithField("txid", txid).Error("failed to pay conversion")
+		}
+
+		refund := conversions.Refund(p.input.Amount, int64(yield), p.inputRate, p.pegRate)
+		if refund > 0 {
+			if err := t.Balances.AddToBalance(p.inputAddress, refund); err != nil {
+				tLog.WithError(err).WithField("txid", txid).Error("failed to refund conversion")
+			}
+		}
+	}
+
+	// Forget entries that are out of the replay window
+	for entryhash, h := range t.applied {
+		if h < height-TransactionReplayBlocks {
+			delete(t.applied, entryhash)
+		}
+	}
+}
+
+type pendingConversion struct {
+	input        TransactionInput
+	inputAddress string
+	pegAddress   string
+	inputRate    uint64
+	pegRate      uint64
+}
+
+// applyBatch applies the batch to the balances. A batch is atomic, if any transaction
+// in the batch is invalid, no balances are changed.
+func (t *TransactionTracking) applyBatch(batch *TransactionBatch, rates map[string]uint64, supply *conversions.ConversionSupplySet, pending map[string]*pendingConversion) error {
+	debits := make(map[string]int64)
+	credits := make(map[string]int64)
+	conversionRequests := make(map[string]*pendingConversion)
+	pegRequests := make(map[string]uint64)
+
+	for i, tx := range batch.Transactions {
+		inputAddress, err := common.ConvertFCTtoPegNetAsset(t.Network, tx.Input.Asset(), tx.Input.Address)
+		if err != nil {
+			return err
+		}
+		debits[inputAddress] += tx.Input.Amount
+
+		if !tx.IsConversion() {
+			for _, transfer := range tx.Transfers {
+				output, err := common.ConvertFCTtoPegNetAsset(t.Network, tx.Input.Asset(), transfer.Address)
+				if err != nil {
+					return err
+				}
+				credits[output] += transfer.Amount
+			}
+			continue
+		}
+
+		// Conversions need the rates of both assets at this height
+		if rates == nil {
+			return fmt.Errorf("no graded rates at this height")
+		}
+		fromRate, toRate := rates[tx.Input.Asset()], rates[tx.ConversionAsset()]
+		output, err := common.ConvertFCTtoPegNetAsset(t.Network, tx.ConversionAsset(), tx.Input.Address)
+		if err != nil {
+			return err
+		}
+		amount, err := conversions.Convert(tx.Input.Amount, fromRate, toRate)
+		if err != nil {
+			return err
+		}
+
+		if tx.ConversionAsset() != "PEG" {
+			credits[output] += amount
+			continue
+		}
+
+		// Conversions into PEG are limited by the supply
+		txid := transactionid.FormatTxID(i, hex.EncodeToString(batch.EntryHash))
+		pegRequests[txid] = uint64(amount)
+		conversionRequests[txid] = &pendingConversion{
+			input:        tx.Input,
+			inputAddress: inputAddress,
+			pegAddress:   output,
+			inputRate:    fromRate,
+			pegRate:      toRate,
+		}
+	}
+
+	// Check all the inputs can be covered before touching any balance
+	for address, amt := range debits {
+		if bal := t.Balances.GetBalance(address); bal < amt {
+			return fmt.Errorf("insufficient balance for %s, has %d, needs %d", address, bal, amt)
+		}
+	}
+
+	for address, amt := range debits {
+		if err := t.Balances.AddToBalance(address, -amt); err != nil {
+			return err
+		}
+	}
+	for address, amt := range credits {
+		if err := t.Balances.AddToBalance(address, amt); err != nil {
+			return err
+		}
+	}
+	for txid, amt := range pegRequests {
+		if err := supply.AddConversion(txid, amt); err != nil {
+			return err
+		}
+		pending[txid] = conversionRequests[txid]
+	}
+	return nil
+}
+
+// TransactionBatch is a single entry in the transaction chain. Every input in the
+// batch must be signed by the owner of the input address.
+//	ExtIDs:
+//		[0]			Timestamp (unix seconds as a string)
+//		[1+2n]		RCD of input n
+//		[2+2n]		Signature of input n
+//	Content: (json)
+//		version
+//		transactions
+type TransactionBatch struct {
+	Version      uint8         `json:"version"`
+	Transactions []Transaction `json:"transactions"`
+
+	EntryHash []byte    `json:"-"`
+	Timestamp time.Time `json:"-"`
+}
+
+// Transaction is either a transfer of an asset to other addresses, or a conversion
+// of an asset to a different asset into the same address.
+type Transaction struct {
+	Input      TransactionInput      `json:"input"`
+	Transfers  []TransactionTransfer `json:"transfers,omitempty"`
+	Conversion string                `json:"conversion,omitempty"`
+}
+
+type TransactionInput struct {
+	Address string `json:"address"`
+	Amount  int64  `json:"amount"`
+	Type    string `json:"type"`
+}
+
+type TransactionTransfer struct {
+	Address string `json:"address"`
+	Amount  int64  `json:"amount"`
+}
+
+// ParseTransactionBatch parses and validates a transaction chain entry.
+// All signatures are verified.
+func ParseTransactionBatch(entry *factom.Entry) (*TransactionBatch, error) {
+	if len(entry.ExtIDs) < 3 || len(entry.ExtIDs)%2 != 1 {
+		return nil, fmt.Errorf("invalid extid count")
+	}
+
+	sec, err := strconv.ParseInt(string(entry.ExtIDs[0]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp")
+	}
+
+	batch := new(TransactionBatch)
+	if err := json.Unmarshal(entry.Content, batch); err != nil {
+		return nil, err
+	}
+	batch.EntryHash = entry.Hash()
+	batch.Timestamp = time.Unix(sec, 0)
+
+	if batch.Version != 1 {
+		return nil, fmt.Errorf("version %d not supported", batch.Version)
+	}
+	if len(batch.Transactions) == 0 {
+		return nil, fmt.Errorf("no transactions")
+	}
+	if (len(entry.ExtIDs)-1)/2 != len(batch.Transactions) {
+		return nil, fmt.Errorf("found %d signatures for %d transactions", (len(entry.ExtIDs)-1)/2, len(batch.Transactions))
+	}
+
+	for i, tx := range batch.Transactions {
+		if err := tx.Validate(); err != nil {
+			return nil, fmt.Errorf("transaction %d : %s", i, err.Error())
+		}
+
+		rcd, sig := entry.ExtIDs[1+2*i], entry.ExtIDs[2+2*i]
+		if err := VerifyTransactionSignature(i, entry.ExtIDs[0], entry.ChainID, entry.Content, rcd, sig, tx.Input.Address); err != nil {
+			return nil, fmt.Errorf("transaction %d : %s", i, err.Error())
+		}
+	}
+
+	return batch, nil
+}
+
+// ValidTimestamp ensures the batch was created around the time of the directory block
+func (b *TransactionBatch) ValidTimestamp(dblock time.Time) error {
+	diff := dblock.Sub(b.Timestamp)
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > TransactionTimestampWindow {
+		return fmt.Errorf("timestamp %s outside of window", b.Timestamp)
+	}
+	return nil
+}
+
+// Validate checks the amounts and assets of the transaction. It does not check balances.
+func (tx *Transaction) Validate() error {
+	if tx.Input.Amount <= 0 {
+		return fmt.Errorf("input amount must be greater than 0")
+	}
+	if !common.AssetListContains(common.AllAssets, tx.Input.Asset()) {
+		return fmt.Errorf("%s is not a valid asset", tx.Input.Type)
+	}
+	if !factom.IsValidAddress(tx.Input.Address) || tx.Input.Address[:2] != "FA" {
+		return fmt.Errorf("invalid input address")
+	}
+
+	if tx.IsConversion() {
+		if len(tx.Transfers) > 0 {
+			return fmt.Errorf("a conversion cannot have transfers")
+		}
+		if !common.AssetListContains(common.AllAssets, tx.ConversionAsset()) {
+			return fmt.Errorf("%s is not a valid asset", tx.Conversion)
+		}
+		if tx.ConversionAsset() == tx.Input.Asset() {
+			return fmt.Errorf("cannot convert an asset to itself")
+		}
+		return nil
+	}
+
+	if len(tx.Transfers) == 0 {
+		return fmt.Errorf("no transfers or conversion")
+	}
+	var total int64
+	for _, transfer := range tx.Transfers {
+		if transfer.Amount <= 0 {
+			return fmt.Errorf("transfer amount must be greater than 0")
+		}
+		if !factom.IsValidAddress(transfer.Address) || transfer.Address[:2] != "FA" {
+			return fmt.Errorf("invalid transfer address")
+		}
+		total += transfer.Amount
+		if total < 0 {
+			return fmt.Errorf("transfer amounts overflow")
+		}
+	}
+	if total != tx.Input.Amount {
+		return fmt.Errorf("transfers total %d, input is %d", total, tx.Input.Amount)
+	}
+	return nil
+}
+
+func (tx *Transaction) IsConversion() bool {
+	return tx.Conversion != ""
+}
+
+// ConversionAsset is the asset ticker the input is converted into
+func (tx *Transaction) ConversionAsset() string {
+	return assetFromType(tx.Conversion)
+}
+
+// Asset is the asset ticker of the input, so "pUSD" is "USD"
+func (i *TransactionInput) Asset() string {
+	return assetFromType(i.Type)
+}
+
+func assetFromType(t string) string {
+	if t == "PEG" {
+		return t
+	}
+	return strings.TrimPrefix(t, "p")
+}
+
+// VerifyTransactionSignature verifies the signature of a single input. The signed data is
+//	sha512(index | timestamp | chainid | content)
+// and the rcd must belong to the input address.
+func VerifyTransactionSignature(index int, timestamp []byte, chainID string, content, rcd, sig []byte, address string) error {
+	if len(rcd) != 33 || rcd[0] != 0x01 {
+		return fmt.Errorf("invalid rcd")
+	}
+	if len(sig) != 64 {
+		return fmt.Errorf("invalid signature length")
+	}
+
+	raw, err := common.ConvertFCTtoRaw(address)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(common.ComputeRCDFromPubkey(rcd[1:]), raw) {
+		return fmt.Errorf("rcd does not match the input address")
+	}
+
+	if err := primitives.VerifySignature(TransactionSigningData(index, timestamp, chainID, content), rcd[1:], sig); err != nil {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// TransactionSigningData is the data the input at the index needs to sign
+func TransactionSigningData(index int, timestamp []byte, chainID string, content []byte) []byte {
+	chain, _ := hex.DecodeString(chainID)
+	data := append([]byte(strconv.Itoa(index)), timestamp...)
+	data = append(data, chain...)
+	data = append(data, content...)
+	sum := sha512.Sum512(data)
+	return sum[:]
+}
@@ -0,0 +1,202 @@
+package balances_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/primitives"
+	. "github.com/pegnet/pegnet/balances"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+)
+
+type testRates map[int64]map[string]uint64
+
+func (r testRates) GradedRates(height int64) map[string]uint64 {
+	return r[height]
+}
+
+type testWallet struct {
+	key     *primitives.PrivateKey
+	address string
+}
+
+func newTestWallet() *testWallet {
+	w := new(testWallet)
+	w.key = primitives.RandomPrivateKey()
+	w.address = common.ConvertRawToFCT(common.ComputeRCDFromPubkey(w.key.Public()))
+	return w
+}
+
+func (w *testWallet) peg(asset string) string {
+	adr, err := common.ConvertFCTtoPegNetAsset(common.MainNetwork, asset, w.address)
+	if err != nil {
+		panic(err)
+	}
+	return adr
+}
+
+// newBatchEntry creates a transaction entry signed by the wallets, one wallet per transaction
+func newBatchEntry(t *testing.T, chainID string, timestamp time.Time, txs []Transaction, signers ...*testWallet) *factom.Entry {
+	content, err := json.Marshal(TransactionBatch{Version: 1, Transactions: txs})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := new(factom.Entry)
+	e.ChainID = chainID
+	e.Content = content
+	ts := []byte(fmt.Sprintf("%d", timestamp.Unix()))
+	e.ExtIDs = [][]byte{ts}
+	for i, w := range signers {
+		sig := w.key.Sign(TransactionSigningData(i, ts, chainID, content))
+		e.ExtIDs = append(e.ExtIDs, append([]byte{0x01}, w.key.Public()...), sig.Bytes())
+	}
+	return e
+}
+
+func newTestTracking(rates testRates) *TransactionTracking {
+	t := new(TransactionTracking)
+	t.ChainID = "cffce0f409ebba4ed236d49d89c70e4bd1f1367d86402a3363366683265a242d"
+	t.Network = common.MainNetwork
+	t.Balances = NewBalanceTracker()
+	t.Rates = rates
+	return t
+}
+
+func TestTransactionTracking_Transfers(t *testing.T) {
+	tracker := newTestTracking(testRates{})
+	alice, bob := newTestWallet(), newTestWallet()
+	now := time.Now()
+
+	if err := tracker.Balances.AddToBalance(alice.peg("USD"), 100*1e8); err != nil {
+		t.Fatal(err)
+	}
+
+	transfer := func(amt int64) Transaction {
+		return Transaction{
+			Input:     TransactionInput{Address: alice.address, Amount: amt, Type: "pUSD"},
+			Transfers: []TransactionTransfer{{Address: bob.address, Amount: amt}},
+		}
+	}
+
+	entries := []*factom.Entry{
+		// Valid
+		newBatchEntry(t, tracker.ChainID, now, []Transaction{transfer(10 * 1e8)}, alice),
+		// Signed by the wrong key
+		newBatchEntry(t, tracker.ChainID, now, []Transaction{transfer(10 * 1e8)}, bob),
+		// Stale timestamp
+		newBatchEntry(t, tracker.ChainID, now.Add(-24*time.Hour), []Transaction{transfer(10 * 1e8)}, alice),
+		// Second tx overdraws, so the whole batch fails
+		newBatchEntry(t, tracker.ChainID, now, []Transaction{transfer(50 * 1e8), transfer(50 * 1e8)}, alice, alice),
+	}
+
+	tracker.ApplyTransactionBlock(10, now, entries)
+
+	if bal := tracker.Balances.GetBalance(alice.peg("USD")); bal != 90*1e8 {
+		t.Errorf("exp alice to have %d, found %d", int64(90*1e8), bal)
+	}
+	if bal := tracker.Balances.GetBalance(bob.peg("USD")); bal != 10*1e8 {
+		t.Errorf("exp bob to have %d, found %d", int64(10*1e8), bal)
+	}
+
+	// Replaying the same entry is ignored
+	tracker.ApplyTransactionBlock(11, now, entries[:1])
+	if bal := tracker.Balances.GetBalance(bob.peg("USD")); bal != 10*1e8 {
+		t.Errorf("exp bob to have %d, found %d", int64(10*1e8), bal)
+	}
+}
+
+func TestTransactionTracking_Conversions(t *testing.T) {
+	rates := testRates{
+		10: {"USD": 1e8, "PEG": 1e6, "XBT": 10000 * 1e8},
+	}
+	tracker := newTestTracking(rates)
+	alice, bob := newTestWallet(), newTestWallet()
+	now := time.Now()
+
+	_ = tracker.Balances.AddToBalance(alice.peg("USD"), 1000*1e8)
+	_ = tracker.Balances.AddToBalance(bob.peg("USD"), 1000*1e8)
+
+	convert := func(w *testWallet, amt int64, to string) Transaction {
+		return Transaction{
+			Input:      TransactionInput{Address: w.address, Amount: amt, Type: "pUSD"},
+			Conversion: to,
+		}
+	}
+
+	// No rates at height 9, so the conversion fails
+	tracker.ApplyTransactionBlock(9, now, []*factom.Entry{
+		newBatchEntry(t, tracker.ChainID, now, []Transaction{convert(alice, 100*1e8, "pXBT")}, alice),
+	})
+	if bal := tracker.Balances.GetBalance(alice.peg("USD")); bal != 1000*1e8 {
+		t.Errorf("exp no conversion without rates, found %d", bal)
+	}
+
+	tracker.ApplyTransactionBlock(10, now, []*factom.Entry{
+		newBatchEntry(t, tracker.ChainID, now, []Transaction{convert(alice, 100*1e8, "pXBT")}, alice),
+		// Each requests 900 USD -> 90,000 PEG. The supply is 5000 PEG, so each gets half
+		newBatchEntry(t, tracker.ChainID, now, []Transaction{convert(alice, 900*1e8, "PEG")}, alice),
+		newBatchEntry(t, tracker.ChainID, now, []Transaction{convert(bob, 900*1e8, "PEG")}, bob),
+	})
+
+	if bal := tracker.Balances.GetBalance(alice.peg("XBT")); bal != 1e6 {
+		t.Errorf("exp alice to have %d pXBT, found %d", int64(1e6), bal)
+	}
+
+	// 2500 PEG is 25 USD, the other 875 USD is refunded
+	for w, exp := range map[*testWallet]int64{alice: 875 * 1e8, bob: 975 * 1e8} {
+		if bal := tracker.Balances.GetBalance(w.peg("PEG")); bal != 2500*1e8 {
+			t.Errorf("exp %d PEG, found %d", int64(2500*1e8), bal)
+		}
+		if bal := tracker.Balances.GetBalance(w.peg("USD")); bal != exp {
+			t.Errorf("exp %d pUSD, found %d", exp, bal)
+		}
+	}
+}
+
+func TestTransactionTracking_ReplayAfterRestart(t *testing.T) {
+	tracker := newTestTracking(testRates{})
+	alice, bob := newTestWallet(), newTestWallet()
+	now := time.Now()
+
+	if err := tracker.Balances.AddToBalance(alice.peg("USD"), 100*1e8); err != nil {
+		t.Fatal(err)
+	}
+	entry := newBatchEntry(t, tracker.ChainID, now, []Transaction{{
+		Input:     TransactionInput{Address: alice.address, Amount: 10 * 1e8, Type: "pUSD"},
+		Transfers: []TransactionTransfer{{Address: bob.address, Amount: 10 * 1e8}},
+	}}, alice)
+	tracker.ApplyTransactionBlock(10, now, []*factom.Entry{entry})
+	tracker.Dbht = 10
+
+	db := database.NewMapDb()
+	batch := database.NewBatch()
+	if err := NewBalanceStore(db).Checkpoint(batch, tracker.Balances, SyncHeights{Transactions: tracker.Dbht, Applied: tracker.Applied()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restart, and the batch is replayed in the next block
+	restarted := newTestTracking(testRates{})
+	heights, err := NewBalanceStore(db).Load(restarted.Balances)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.Restore(heights.Transactions, heights.Applied)
+	restarted.ApplyTransactionBlock(11, now, []*factom.Entry{entry})
+	if bal := restarted.Balances.GetBalance(bob.peg("USD")); bal != 10*1e8 {
+		t.Errorf("exp bob to have %d, found %d", int64(10*1e8), bal)
+	}
+
+	// Entries out of the replay window are not restored
+	restarted.Restore(10+TransactionReplayBlocks+1, heights.Applied)
+	if len(restarted.Applied()) != 0 {
+		t.Errorf("exp the applied entries to be pruned, found %d", len(restarted.Applied()))
+	}
+}
@@ -0,0 +1,298 @@
+// Package budget keeps the entry credits of an EC address topped up. It tracks how many
+// entry credits are burned per block, forecasts how long the balance lasts, and buys
+// more from a factoid address through walletd when the balance runs low.
+package budget
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+	log "github.com/sirupsen/logrus"
+	"github.com/zpatrick/go-config"
+)
+
+// BlocksPerDay is the number of factom blocks in a day, at 10 minutes a block
+const BlocksPerDay = 144
+
+// Burn is the entry credits burned in a block
+type Burn struct {
+	Height int64
+	Amount int64
+}
+
+// Purchase is a buy of entry credits
+type Purchase struct {
+	Time      time.Time
+	Height    int64
+	ECAddress string
+	Amount    int64
+	TxID      string
+}
+
+// Status is the balance of the EC address, and how long it lasts at the burn rate
+type Status struct {
+	Balance       int64   `json:"balance"`
+	BurnPerBlock  float64 `json:"burnperblock"`
+	DaysRemaining float64 `json:"daysremaining"` // +Inf if nothing is burned
+	BoughtToday   int64   `json:"boughttoday"`   // Bought with the factoid address in the last 24 hours
+	DailyCap      int64   `json:"dailycap"`
+}
+
+// ECBudget tracks the entry credits of an EC address, buying more when the balance
+// falls below the threshold. The miner and staker check it once a block, before they
+// write their records.
+type ECBudget struct {
+	Factom    common.FactomClient
+	ECAddress string
+	// FCTAddress pays for the entry credits. It is blank if entry credits are never bought.
+	FCTAddress string
+	// Ledger has what the factoid address bought. It is shared with every budget in the
+	// process paying with the address, and is the ledger of the FCTAddress if nil.
+	Ledger *Ledger
+
+	Threshold int64 // Entry credits are bought when the balance is below the threshold
+	Amount    int64 // The entry credits to buy at a time
+	DailyCap  int64 // The most entry credits this process buys with the factoid address in 24 hours, 0 for no cap
+
+	// Now is the clock the daily cap is kept with
+	Now func() time.Time
+
+	burns   []Burn // The last BlocksPerDay blocks
+	height  int64  // The height of the last check
+	balance int64  // The balance at the last check
+	bought  int64  // Bought since the last check
+
+	sync.Mutex
+}
+
+func NewECBudget(factom common.FactomClient, ecAddress string) *ECBudget {
+	b := new(ECBudget)
+	b.Factom = factom
+	b.ECAddress = ecAddress
+	b.Now = time.Now
+	b.height = -1
+	return b
+}
+
+// NewECBudgetFromConfig makes the budget for the EC address at the config key, such as
+// "Miner.ECAddress", with the settings of the EntryCredits section
+func NewECBudgetFromConfig(c *config.Config, ecAddressKey string, factom common.FactomClient) (*ECBudget, error) {
+	ecAddress, err := c.String(ecAddressKey)
+	if err != nil {
+		return nil, err
+	}
+	b := NewECBudget(factom, ecAddress)
+
+	// The section is optional, configs from before it never buy entry credits
+	b.FCTAddress, _ = c.String(common.ConfigECBuyAddress)
+	if b.FCTAddress == "" {
+		return b, nil
+	}
+	b.Ledger = LedgerOf(b.FCTAddress)
+	if b.Threshold, err = configInt(c, common.ConfigECBuyThreshold); err != nil {
+		return nil, err
+	}
+	if b.Amount, err = configInt(c, common.ConfigECBuyAmount); err != nil {
+		return nil, err
+	}
+	if b.Amount <= 0 {
+		return nil, fmt.Errorf("%s has to be more than 0", common.ConfigECBuyAmount)
+	}
+	if b.DailyCap, err = configInt(c, common.ConfigECDailyBuyCap); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Load persists the purchases of the factoid address in the database, and restores the
+// ones it already has, so the daily cap holds across restarts
+func (b *ECBudget) Load(db database.IDatabase) error {
+	b.Lock()
+	defer b.Unlock()
+	if b.FCTAddress == "" {
+		return nil // Nothing is bought
+	}
+	return b.ledger().Load(db)
+}
+
+func (b *ECBudget) ledger() *Ledger {
+	if b.Ledger == nil {
+		b.Ledger = LedgerOf(b.FCTAddress)
+	}
+	return b.Ledger
+}
+
+func configInt(c *config.Config, key string) (int64, error) {
+	v, err := c.Int(key)
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 {
+		return 0, fmt.Errorf("%s can not be negative", key)
+	}
+	return int64(v), nil
+}
+
+// Check is called once a block, with the height of the block. It records the entry
+// credits burned since the last check, and buys more if the balance is below the
+// threshold. The status is logged at info, with the days the balance lasts at the
+// burn rate. It returns the balance, including any entry credits it bought.
+func (b *ECBudget) Check(height int64) (int64, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	balance, err := b.Factom.GetECBalance(b.ECAddress)
+	if err != nil {
+		return 0, err
+	}
+
+	if b.height >= 0 && height > b.height {
+		burn := b.balance + b.bought - balance
+		if burn < 0 {
+			burn = 0 // Entry credits from elsewhere
+		}
+		b.burns = append(b.burns, Burn{Height: height, Amount: burn})
+		if len(b.burns) > BlocksPerDay {
+			b.burns = b.burns[len(b.burns)-BlocksPerDay:]
+		}
+	}
+	b.height, b.balance, b.bought = height, balance, 0
+
+	if b.FCTAddress != "" && balance < b.Threshold {
+		bought, err := b.buy(height)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"ec":      b.ECAddress,
+				"fct":     b.FCTAddress,
+				"balance": balance,
+			}).Error("failed to buy entry credits")
+		}
+		b.bought = bought
+	}
+
+	status := b.status(balance + b.bought)
+	log.WithFields(log.Fields{
+		"ec":             b.ECAddress,
+		"height":         height,
+		"balance":        status.Balance,
+		"burn_per_block": fmt.Sprintf("%.2f", status.BurnPerBlock),
+		"days_remaining": fmt.Sprintf("%.1f", status.DaysRemaining),
+		"bought_today":   status.BoughtToday,
+	}).Info("entry credit budget")
+	return status.Balance, nil
+}
+
+// buy buys the amount of entry credits, or as much of it as the daily cap allows. The
+// ledger is locked throughout, so budgets sharing it can not both spend the same cap.
+func (b *ECBudget) buy(height int64) (int64, error) {
+	l := b.ledger()
+	l.Lock()
+	defer l.Unlock()
+	if err := l.prune(b.Now()); err != nil {
+		return 0, err
+	}
+
+	amount := b.Amount
+	if b.DailyCap > 0 {
+		if left := b.DailyCap - l.boughtSince(b.Now().Add(-24*time.Hour)); left < amount {
+			amount = left
+		}
+		if amount <= 0 {
+			log.WithFields(log.Fields{
+				"ec":       b.ECAddress,
+				"dailycap": b.DailyCap,
+			}).Warn("not buying entry credits, the daily cap is spent")
+			return 0, nil
+		}
+	}
+
+	rate, err := b.Factom.GetECRate()
+	if err != nil {
+		return 0, err
+	}
+	fct, err := b.Factom.GetFactoidBalance(b.FCTAddress)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(fct) < uint64(amount)*rate {
+		return 0, fmt.Errorf("%s has %d factoshis, %d entry credits cost %d", b.FCTAddress, fct, amount, uint64(amount)*rate)
+	}
+
+	txid, err := b.Factom.BuyExactEC(b.FCTAddress, b.ECAddress, uint64(amount))
+	if err != nil {
+		return 0, err
+	}
+	p := Purchase{Time: b.Now(), Height: height, ECAddress: b.ECAddress, Amount: amount, TxID: txid}
+	if err := l.add(p); err != nil {
+		// The entry credits are bought, we just might buy more than the cap after a restart
+		log.WithError(err).WithField("txid", txid).Error("failed to save the entry credit purchase")
+	}
+	log.WithFields(log.Fields{
+		"ec":     b.ECAddress,
+		"fct":    b.FCTAddress,
+		"amount": amount,
+		"rate":   rate,
+		"txid":   txid,
+	}).Info("bought entry credits")
+	return amount, nil
+}
+
+// boughtToday is the entry credits bought with the factoid address in the last 24 hours
+func (b *ECBudget) boughtToday() int64 {
+	if b.FCTAddress == "" {
+		return 0
+	}
+	l := b.ledger()
+	l.Lock()
+	defer l.Unlock()
+	return l.boughtSince(b.Now().Add(-24 * time.Hour))
+}
+
+// BurnRate is the average entry credits burned per block, over the last day of checks
+func (b *ECBudget) BurnRate() float64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.burnRate()
+}
+
+func (b *ECBudget) burnRate() float64 {
+	if len(b.burns) == 0 {
+		return 0
+	}
+	var total int64
+	for _, burn := range b.burns {
+		total += burn.Amount
+	}
+	return float64(total) / float64(len(b.burns))
+}
+
+// Status returns the balance at the last check, and the forecast of how long it lasts
+func (b *ECBudget) Status() Status {
+	b.Lock()
+	defer b.Unlock()
+	return b.status(b.balance + b.bought)
+}
+
+func (b *ECBudget) status(balance int64) Status {
+	s := Status{Balance: balance, BurnPerBlock: b.burnRate(), BoughtToday: b.boughtToday(), DailyCap: b.DailyCap}
+	s.DaysRemaining = math.Inf(1)
+	if s.BurnPerBlock > 0 {
+		s.DaysRemaining = float64(balance) / (s.BurnPerBlock * BlocksPerDay)
+	}
+	return s
+}
+
+// Purchases returns the entry credits bought with the factoid address that count
+// towards the daily cap, for this and any other EC address
+func (b *ECBudget) Purchases() []Purchase {
+	b.Lock()
+	defer b.Unlock()
+	if b.FCTAddress == "" {
+		return nil
+	}
+	return b.ledger().Purchases()
+}
@@ -0,0 +1,175 @@
+package budget_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factom"
+	. "github.com/pegnet/pegnet/budget"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+)
+
+func TestECBudget_Check(t *testing.T) {
+	chain := common.NewFakeFactomClient(100)
+	ec, _ := factom.GetECAddress("Es2XT3jSxi1xqrDvS5JERM3W3jh1awRHuyoahn3hbQLyfEi1jvbq")
+	fa, _ := factom.GetFactoidAddress("Fs3E9gV6DXsYzf7Fqx1fVBQPQXV695eP3k5XbmHEZVRLkMdD9qCK")
+	chain.AddECAddress(ec, 100)
+	chain.AddFactoidAddress(fa)
+	chain.SetFactoidBalance(fa.String(), 1e9)
+
+	now := time.Now()
+	b := NewECBudget(chain, ec.String())
+	b.FCTAddress = fa.String()
+	b.Threshold, b.Amount, b.DailyCap = 50, 100, 150
+	b.Now = func() time.Time { return now }
+
+	// spend sets the balance as if the entry credits were burned
+	spend := func(ecs int64) {
+		bal, _ := chain.GetECBalance(ec.String())
+		chain.AddECAddress(ec, bal-ecs)
+	}
+	check := func(height, exp int64) {
+		t.Helper()
+		bal, err := b.Check(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bal != exp {
+			t.Errorf("height %d: exp a balance of %d, found %d", height, exp, bal)
+		}
+		if found, _ := chain.GetECBalance(ec.String()); found != exp {
+			t.Errorf("height %d: exp %d ecs on chain, found %d", height, exp, found)
+		}
+	}
+
+	check(1, 100) // Above the threshold
+	if s := b.Status(); !math.IsInf(s.DaysRemaining, 1) {
+		t.Errorf("exp no forecast without burns, found %f days", s.DaysRemaining)
+	}
+
+	spend(60)
+	check(2, 140) // 40 is below the threshold, so 100 are bought
+	if fct, _ := chain.GetFactoidBalance(fa.String()); fct != 1e9-100*1000 {
+		t.Errorf("exp 100 ecs worth of factoids to be spent, found %d left", fct)
+	}
+
+	spend(110)
+	check(3, 80) // Only 50 more fit in the daily cap
+	if rate := b.BurnRate(); rate != 85 {
+		t.Errorf("exp a burn rate of 85, found %f", rate)
+	}
+	s := b.Status()
+	if exp := 80 / (85.0 * BlocksPerDay); s.DaysRemaining != exp {
+		t.Errorf("exp %f days remaining, found %f", exp, s.DaysRemaining)
+	}
+	if s.BoughtToday != 150 {
+		t.Errorf("exp 150 bought today, found %d", s.BoughtToday)
+	}
+
+	spend(70)
+	check(4, 10) // The cap is spent
+
+	now = now.Add(25 * time.Hour)
+	check(5, 110) // A new day
+	if p := b.Purchases(); len(p) != 1 || p[0].Height != 5 || p[0].TxID == "" || p[0].ECAddress != ec.String() {
+		t.Errorf("exp only the purchase at height 5 to count, found %v", p)
+	}
+}
+
+func TestECBudget_Restart(t *testing.T) {
+	chain := common.NewFakeFactomClient(100)
+	ec, _ := factom.GetECAddress("Es2XT3jSxi1xqrDvS5JERM3W3jh1awRHuyoahn3hbQLyfEi1jvbq")
+	fa, _ := factom.GetFactoidAddress("Fs3E9gV6DXsYzf7Fqx1fVBQPQXV695eP3k5XbmHEZVRLkMdD9qCK")
+	chain.AddECAddress(ec, 0)
+	chain.AddFactoidAddress(fa)
+	chain.SetFactoidBalance(fa.String(), 1e9)
+	db := database.NewMapDb()
+
+	now := time.Now()
+	newBudget := func() *ECBudget {
+		b := NewECBudget(chain, ec.String())
+		b.FCTAddress = fa.String()
+		b.Ledger = &Ledger{FCTAddress: fa.String()} // As if the process restarted
+		b.Threshold, b.Amount, b.DailyCap = 50, 100, 150
+		b.Now = func() time.Time { return now }
+		if err := b.Load(db); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	if bal, _ := newBudget().Check(1); bal != 100 {
+		t.Fatalf("exp 100 to be bought, found a balance of %d", bal)
+	}
+
+	// After the restart, only what is left of the cap is bought
+	chain.AddECAddress(ec, 0)
+	b := newBudget()
+	if p := b.Purchases(); len(p) != 1 || p[0].Amount != 100 {
+		t.Errorf("exp the purchase to be restored, found %v", p)
+	}
+	if bal, _ := b.Check(2); bal != 50 {
+		t.Errorf("exp 50 to be bought, found a balance of %d", bal)
+	}
+
+	// A day later, the purchases are dropped
+	now = now.Add(25 * time.Hour)
+	chain.AddECAddress(ec, 0)
+	if bal, _ := newBudget().Check(3); bal != 100 {
+		t.Errorf("exp 100 to be bought, found a balance of %d", bal)
+	}
+	if p := newBudget().Purchases(); len(p) != 1 || p[0].Height != 3 {
+		t.Errorf("exp only the purchase at height 3 to be kept, found %v", p)
+	}
+}
+
+func TestECBudget_SharedLedger(t *testing.T) {
+	chain := common.NewFakeFactomClient(100)
+	fa, _ := factom.GetFactoidAddress("Fs3E9gV6DXsYzf7Fqx1fVBQPQXV695eP3k5XbmHEZVRLkMdD9qCK")
+	chain.AddFactoidAddress(fa)
+	chain.SetFactoidBalance(fa.String(), 1e9)
+
+	// The miner and the staker pay with the same factoid address
+	ledger := &Ledger{FCTAddress: fa.String()}
+	var budgets []*ECBudget
+	for i := 0; i < 2; i++ {
+		sec := make([]byte, 32)
+		sec[0] = byte(i + 1)
+		ec, _ := factom.MakeECAddress(sec)
+		chain.AddECAddress(ec, 0)
+		b := NewECBudget(chain, ec.String())
+		b.FCTAddress, b.Ledger = fa.String(), ledger
+		b.Threshold, b.Amount, b.DailyCap = 50, 100, 150
+		budgets = append(budgets, b)
+	}
+
+	if bal, _ := budgets[0].Check(1); bal != 100 {
+		t.Errorf("exp 100 to be bought, found a balance of %d", bal)
+	}
+	if bal, _ := budgets[1].Check(1); bal != 50 {
+		t.Errorf("exp what is left of the shared cap to be bought, found a balance of %d", bal)
+	}
+	if s := budgets[1].Status(); s.BoughtToday != 150 {
+		t.Errorf("exp 150 bought with the factoid address, found %d", s.BoughtToday)
+	}
+	if LedgerOf(fa.String()) != LedgerOf(fa.String()) {
+		t.Error("exp one ledger per factoid address")
+	}
+}
+
+func TestECBudget_NoFCTAddress(t *testing.T) {
+	chain := common.NewFakeFactomClient(100)
+	ec, _ := factom.GetECAddress("Es2XT3jSxi1xqrDvS5JERM3W3jh1awRHuyoahn3hbQLyfEi1jvbq")
+	chain.AddECAddress(ec, 10)
+
+	b := NewECBudget(chain, ec.String())
+	b.Threshold, b.Amount = 50, 100
+	if bal, err := b.Check(1); err != nil || bal != 10 {
+		t.Errorf("exp nothing to be bought without a factoid address, found %d %v", bal, err)
+	}
+	if len(b.Purchases()) != 0 {
+		t.Error("exp no purchases")
+	}
+}
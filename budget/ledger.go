@@ -0,0 +1,135 @@
+package budget
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pegnet/pegnet/database"
+)
+
+// Ledger has the entry credits bought with a factoid address. The daily cap is kept per
+// factoid address within a process. The miner and the staker run as separate processes
+// with their own databases, so each of them buys up to the daily cap.
+type Ledger struct {
+	FCTAddress string
+	// DB is where the purchases are persisted, if set, so the daily cap holds across
+	// restarts. Load restores them.
+	DB database.IDatabase
+
+	purchases []Purchase // Ordered by time
+	sync.Mutex
+}
+
+var ledgers = make(map[string]*Ledger)
+var ledgersLock sync.Mutex
+
+// LedgerOf returns the ledger of the factoid address, shared by every budget in the
+// process paying with it
+func LedgerOf(fctAddress string) *Ledger {
+	ledgersLock.Lock()
+	defer ledgersLock.Unlock()
+	l, ok := ledgers[fctAddress]
+	if !ok {
+		l = &Ledger{FCTAddress: fctAddress}
+		ledgers[fctAddress] = l
+	}
+	return l
+}
+
+// Load persists the purchases in the database, and restores the ones it already has
+func (l *Ledger) Load(db database.IDatabase) error {
+	l.Lock()
+	defer l.Unlock()
+	l.DB = db
+
+	known := make(map[string]bool)
+	for _, p := range l.purchases {
+		known[p.TxID] = true
+	}
+	iter := db.IteratePrefix(database.BUCKET_EC_PURCHASES, []byte(l.FCTAddress))
+	defer iter.Release()
+	for iter.Next() {
+		var p Purchase
+		if err := database.Decode(&p, iter.Value()); err != nil {
+			return err
+		}
+		if !known[p.TxID] {
+			l.purchases = append(l.purchases, p)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	sort.SliceStable(l.purchases, func(i, j int) bool {
+		return l.purchases[i].Time.Before(l.purchases[j].Time)
+	})
+
+	// Anything bought before we had the database is written now
+	for _, p := range l.purchases {
+		if err := l.save(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add records a purchase. The ledger has to be locked.
+func (l *Ledger) add(p Purchase) error {
+	l.purchases = append(l.purchases, p)
+	return l.save(p)
+}
+
+func (l *Ledger) save(p Purchase) error {
+	if l.DB == nil {
+		return nil
+	}
+	data, err := database.Encode(p)
+	if err != nil {
+		return err
+	}
+	return l.DB.Put(database.BUCKET_EC_PURCHASES, purchaseKey(l.FCTAddress, p), data)
+}
+
+func purchaseKey(fctAddress string, p Purchase) []byte {
+	return append([]byte(fctAddress), p.TxID...)
+}
+
+// prune drops the purchases that no longer count towards the daily cap. The ledger
+// has to be locked.
+func (l *Ledger) prune(now time.Time) error {
+	since := now.Add(-24 * time.Hour)
+	keep := l.purchases[:0]
+	batch := database.NewBatch()
+	for _, p := range l.purchases {
+		if p.Time.After(since) {
+			keep = append(keep, p)
+		} else {
+			batch.Delete(database.BUCKET_EC_PURCHASES, purchaseKey(l.FCTAddress, p))
+		}
+	}
+	l.purchases = keep
+	if l.DB == nil {
+		return nil
+	}
+	return l.DB.Write(batch)
+}
+
+// boughtSince is the entry credits bought after the time. The ledger has to be locked.
+func (l *Ledger) boughtSince(since time.Time) int64 {
+	var total int64
+	for _, p := range l.purchases {
+		if p.Time.After(since) {
+			total += p.Amount
+		}
+	}
+	return total
+}
+
+// Purchases returns the entry credits bought that count towards the daily cap, for any
+// EC address. Older ones are dropped with the next purchase.
+func (l *Ledger) Purchases() []Purchase {
+	l.Lock()
+	defer l.Unlock()
+	return append([]Purchase{}, l.purchases...)
+}
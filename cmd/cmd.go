@@ -5,12 +5,15 @@ package cmd
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/pegnet/pegnet/database"
@@ -22,9 +25,11 @@ import (
 	"github.com/pegnet/pegnet/common"
 	"github.com/pegnet/pegnet/mining"
 	"github.com/pegnet/pegnet/networkMiner"
+	"github.com/pegnet/pegnet/node"
 	"github.com/pegnet/pegnet/opr"
 	"github.com/pegnet/pegnet/polling"
 	"github.com/spf13/cobra"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 var (
@@ -36,11 +41,23 @@ func init() {
 	// Add commands to the root cmd
 	RootCmd.AddCommand(getEncoding)
 	RootCmd.AddCommand(newAddress)
+	grader.Flags().String("replay", "", "Grade the opr chain from an export file instead of factomd, and exit")
+	grader.Flags().String("export", "", "Export the opr chain from factomd to a file for --replay, and exit. Files ending in .gz are gzipped")
 	RootCmd.AddCommand(grader)
 	RootCmd.AddCommand(networkCoordinator)
 	RootCmd.AddCommand(networkMinerCmd)
+	datasources.Flags().Bool("health", false, "Show the health of the data sources used by the running miner")
 	RootCmd.AddCommand(datasources)
+	stakeStatus.Flags().Int("blocks", 1, "The number of graded SPR blocks to show")
+	staker.AddCommand(stakeStatus)
 	RootCmd.AddCommand(staker)
+	RootCmd.AddCommand(nodeCmd)
+	dbMigrate.Flags().String("path", "", "Migrate the leveldb at this path, like the staker database, instead of the miner database")
+	dbCmd.AddCommand(dbMigrate)
+	dbExport.Flags().Int64("height", 0, "The height of the opr chain eblock to export at (default is the synced height)")
+	dbCmd.AddCommand(dbExport)
+	dbCmd.AddCommand(dbImport)
+	RootCmd.AddCommand(dbCmd)
 
 	decode.AddCommand(decodeEntry)
 	decode.AddCommand(decodeEblock)
@@ -62,6 +79,13 @@ func init() {
 		"(negative numbers are ignored)")
 	RootCmd.AddCommand(getPerformance)
 	RootCmd.AddCommand(getBalance)
+
+	getPriceHistory.Flags().Int64Var(&blockRangeStart, "start", -1, "First block in the block range requested "+
+		"(negative numbers are interpreted relative to current block head)")
+	getPriceHistory.Flags().Int64Var(&blockRangeEnd, "end", -1, "Last block in the block range requested "+
+		"(negative numbers are ignored)")
+	getPriceHistory.Flags().String("format", "csv", "Output format of the price history. <csv|json>")
+	RootCmd.AddCommand(getPriceHistory)
 }
 
 var getEncoding = &cobra.Command{
@@ -229,10 +253,15 @@ var datasources = &cobra.Command{
 		"correctly. It will also help you ensure you have redudent data sources. " +
 		"This command can also provide all datasources, and what assets they support. As well as the " +
 		"opposite; given an asset what datasources include it.",
-	Example:   "pegnet datasources FCT\npegnet datasources CoinMarketCap",
+	Example:   "pegnet datasources FCT\npegnet datasources CoinMarketCap\npegnet datasources --health",
 	Args:      CombineCobraArgs(CustomArgOrderValidationBuilder(false, ArgValidatorAssetOrExchange)),
 	ValidArgs: append(common.AssetsV5, polling.AllDataSourcesList()...),
 	Run: func(cmd *cobra.Command, args []string) {
+		if health, _ := cmd.Flags().GetBool("health"); health {
+			printDataSourceHealth(cmd)
+			return
+		}
+
 		ValidateConfig(Config) // Will fatal log if it fails
 
 		// User selected a data source or asset
@@ -288,10 +317,53 @@ var datasources = &cobra.Command{
 	},
 }
 
+// printDataSourceHealth asks the running miner for the health of its data sources
+func printDataSourceHealth(cmd *cobra.Command) {
+	req := api.PostRequest{Method: "datasource-health"}
+	response, err := api.SendRequest(&req)
+	if err != nil {
+		CmdErrorf(cmd, "Failed to make request: %v\n", err)
+	}
+	if response.Err != nil {
+		CmdErrorf(cmd, "%s\n", response.Err.Reason)
+	}
+
+	var health api.DataSourceHealthResult
+	err = api.MapToObject(response.Res, &health)
+	if err != nil {
+		CmdError(cmd, err)
+	}
+	if len(health.Sources) == 0 {
+		fmt.Println("The node has not polled any data sources")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tREQUESTS\tERRORS\tERROR RATE\tLATENCY\tSTALE RATE\tDEVIATION\tSTATUS")
+	for _, s := range health.Sources {
+		status := "ok"
+		if s.Demoted {
+			status = fmt.Sprintf("demoted until %s: %s", s.DemotedUntil.Format("15:04:05"), s.Reason)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.2f\t%s\t%.2f\t%.2f%%\t%s\n", s.Name, s.Requests, s.Errors,
+			s.ErrorRate, s.Latency.Round(time.Millisecond), s.StaleRate, s.Deviation, status)
+	}
+	_ = w.Flush()
+}
+
 // TODO: Flesh this out, just using it for testing the miner
 var grader = &cobra.Command{
 	Use: "grader ",
 	Run: func(cmd *cobra.Command, args []string) {
+		if path, _ := cmd.Flags().GetString("export"); path != "" {
+			exportOPRChain(cmd, path)
+			return
+		}
+		if path, _ := cmd.Flags().GetString("replay"); path != "" {
+			replayOPRChain(cmd, path)
+			return
+		}
+
 		opr.InitLX()
 		ValidateConfig(Config) // Will fatal log if it fails
 
@@ -318,6 +390,59 @@ var grader = &cobra.Command{
 	},
 }
 
+// configOPRChain returns the network and the opr chain of the config
+func configOPRChain(cmd *cobra.Command) (network string, chainid string) {
+	network, err := common.LoadConfigNetwork(Config)
+	if err != nil {
+		CmdErrorf(cmd, "failed to load the network: %s\n", err.Error())
+	}
+	protocol, err := Config.String("Miner.Protocol")
+	if err != nil {
+		CmdErrorf(cmd, "failed to load the protocol: %s\n", err.Error())
+	}
+	return network, hex.EncodeToString(common.ComputeChainIDFromStrings([]string{protocol, network, common.OPRChainTag}))
+}
+
+// exportOPRChain writes every eblock and entry of the opr chain to the file
+func exportOPRChain(cmd *cobra.Command, path string) {
+	network, chainid := configOPRChain(cmd)
+	w, err := opr.CreateChainExport(path, opr.ChainExportHeader{ChainID: chainid, Network: network})
+	if err != nil {
+		CmdErrorf(cmd, "failed to create the export: %s\n", err.Error())
+	}
+	err = opr.ExportChain(w)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		CmdErrorf(cmd, "failed to export the opr chain: %s\n", err.Error())
+	}
+	fmt.Printf("Exported the opr chain %s to %s\n", chainid, path)
+}
+
+// replayOPRChain grades the opr chain in the export file, and writes the oprblocks
+// to the miner database
+func replayOPRChain(cmd *cobra.Command, path string) {
+	export, err := opr.OpenChainExport(path)
+	if err != nil {
+		CmdErrorf(cmd, "failed to open the export: %s\n", err.Error())
+	}
+	defer export.Close()
+
+	db := OpenDB(Config)
+	defer db.Close()
+
+	r, err := opr.NewReplayer(Config, db)
+	if err != nil {
+		CmdErrorf(cmd, "failed to create the replayer: %s\n", err.Error())
+	}
+	count, err := r.Replay(export)
+	if err != nil {
+		CmdErrorf(cmd, "replay failed after %d eblocks: %s\n", count, err.Error())
+	}
+	fmt.Printf("Replayed %d eblocks from %s\n", count, path)
+}
+
 var staker = &cobra.Command{
 	Use: "stake ",
 	Run: func(cmd *cobra.Command, args []string) {
@@ -328,15 +453,110 @@ var staker = &cobra.Command{
 
 		// Services
 		monitor := LaunchFactomMonitor(Config)
+		sprGrader := LaunchSPRGrader(Config, monitor, ctx)
+		LaunchStakerResults(Config, sprGrader, ctx)
 
 		// This is a blocking call
-		coord_s := LaunchStaker(Config, ctx, monitor)
+		coord_s := LaunchStaker(Config, ctx, monitor, sprGrader)
 
 		// Calling cancel() will cancel the staker
 		var _, _ = cancel, coord_s
 	},
 }
 
+var nodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "Syncs the opr and spr chains and serves the api and control panel, without mining",
+	Long: "Grades the opr and spr chains, tracks the burns and balances, and keeps the node database " +
+		"up to date. The api and control panel are served as they are with the miner. " +
+		"A node does not write any records, so it needs no identity or EC address.",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		common.GlobalExitHandler.AddCancel(cancel)
+		b := balances.NewBalanceTracker()
+
+		ValidateNodeConfig(Config) // Will fatal log if it fails
+
+		// Services
+		monitor := LaunchFactomMonitor(Config)
+		grader := LaunchGrader(Config, monitor, b, ctx, false)
+		if _, ok := grader.BlockStore.(*node.IndexedBlockStore); !ok {
+			LaunchNodeDatabase(Config, grader) // A node always indexes
+		}
+		go grader.Run(monitor, ctx)
+		sprGrader := LaunchSPRGrader(Config, monitor, ctx)
+
+		statTracker := LaunchStatistics(Config, ctx)
+		apiserver := LaunchAPI(Config, statTracker, grader, b, false)
+		apiserver.SPRGrader = sprGrader
+		ListenAPI(Config, apiserver)
+		LaunchControlPanel(Config, ctx, monitor, statTracker, b)
+
+		// Runs until the exit handler exits
+		<-ctx.Done()
+	},
+}
+
+var stakeStatus = &cobra.Command{
+	Use:   "status [--blocks N]",
+	Short: "Shows how the SPRs of the running staker did in the last graded blocks",
+	Long: "Asks the running staker what each of its coinbase addresses has written and spent, " +
+		"and how their SPRs did in the last graded SPR blocks. " +
+		"An SPR that is not included was either not submitted, or was rejected by the grader. " +
+		"The distance is how far the SPR's prices are from the average of the winners, on average.",
+	Run: func(cmd *cobra.Command, args []string) {
+		// The staker serves its api on its own port
+		if !cmd.Flags().Changed("pegnethost") {
+			port, err := Config.Int(common.ConfigStakerAPIPort)
+			if err != nil {
+				CmdError(cmd, err)
+			}
+			api.APIHost = fmt.Sprintf("localhost:%d", port)
+		}
+
+		blocks, _ := cmd.Flags().GetInt("blocks")
+		req := api.PostRequest{Method: "stake-status", Params: api.StakeStatusParameters{Blocks: blocks}}
+		response, err := api.SendRequest(&req)
+		if err != nil {
+			CmdErrorf(cmd, "Failed to make request: %v\n", err)
+		}
+		if response.Err != nil {
+			CmdErrorf(cmd, "%s\n", response.Err.Reason)
+		}
+
+		var status api.StakeStatusResult
+		err = api.MapToObject(response.Res, &status)
+		if err != nil {
+			CmdError(cmd, err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		if len(status.Accounts) > 0 {
+			fmt.Fprintln(w, "COINBASE\tWRITTEN\tFAILED\tEC SPENT\tLAST HEIGHT")
+			for _, a := range status.Accounts {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", a.CoinbaseAddress, a.Written, a.Failed, a.ECSpent, a.LastHeight)
+			}
+			fmt.Fprintln(w)
+		}
+		if len(status.Statuses) == 0 {
+			_ = w.Flush()
+			fmt.Println("The staker has not graded any SPR blocks")
+			return
+		}
+
+		fmt.Fprintln(w, "HEIGHT\tCOINBASE\tINCLUDED\tRANK\tGRADE\tDISTANCE\tPAYOUT")
+		for _, s := range status.Statuses {
+			if !s.Included {
+				fmt.Fprintf(w, "%d\t%s\tno\t-\t-\t-\t-\n", s.Dbht, s.CoinbaseAddress)
+				continue
+			}
+			fmt.Fprintf(w, "%d\t%s\tyes\t%d\t%.6f\t%.4f%%\t%.8f\n", s.Dbht, s.CoinbaseAddress,
+				s.Position+1, s.Grade, s.Distance*100, float64(s.Payout)/1e8)
+		}
+		_ = w.Flush()
+	},
+}
+
 // -------------------------------------------------------------
 // RPC Wrapper Commands
 
@@ -403,6 +623,63 @@ var getBalance = &cobra.Command{
 	},
 }
 
+var getPriceHistory = &cobra.Command{
+	Use:   "pricehistory <asset> [--start START_BLOCK] [--end END_BLOCK] [--format csv|json]",
+	Short: "Returns the graded consensus price of an asset over a range of blocks.",
+	Long: "The consensus price of an asset is the price reported by the top graded OPR of a block. " +
+		"This command returns that price for every graded block in the range, as a csv or json.",
+	Example: "pegnet pricehistory XAU --start=-2000\npegnet pricehistory XBT --start=210000 --end=210144 --format=json",
+	Args:    CombineCobraArgs(CustomArgOrderValidationBuilder(true, ArgValidatorAsset)),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		format = strings.ToLower(format)
+		if format != "csv" && format != "json" {
+			CmdErrorf(cmd, "%s is not a valid format, use csv or json\n", format)
+		}
+
+		blockRange := api.BlockRange{Start: &blockRangeStart}
+		if blockRangeEnd > 0 {
+			blockRange.End = &blockRangeEnd
+		}
+		req := api.PostRequest{
+			Method: "price-history",
+			Params: api.PriceHistoryParameters{
+				BlockRange: blockRange,
+				Asset:      strings.ToUpper(args[0]),
+			},
+		}
+
+		if format == "json" {
+			sendRequestAndPrintResults(&req)
+			return
+		}
+
+		response, err := api.SendRequest(&req)
+		if err != nil {
+			CmdErrorf(cmd, "Failed to make request: %v\n", err)
+		}
+		if response.Err != nil {
+			CmdErrorf(cmd, "%s\n", response.Err.Reason)
+		}
+
+		var history api.PriceHistoryResult
+		err = api.MapToObject(response.Res, &history)
+		if err != nil {
+			CmdError(cmd, err)
+		}
+
+		w := csv.NewWriter(os.Stdout)
+		_ = w.Write([]string{"height", history.Asset})
+		for _, p := range history.Prices {
+			_ = w.Write([]string{fmt.Sprintf("%d", p.Height), fmt.Sprintf("%.8f", float64(p.Price)/1e8)})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			CmdError(cmd, err)
+		}
+	},
+}
+
 var networkCoordinator = &cobra.Command{
 	Use:   "netcoordinator",
 	Short: "Enables running of remote miners against this machine",
@@ -417,12 +694,17 @@ var networkCoordinator = &cobra.Command{
 		// Services
 		monitor := LaunchFactomMonitor(Config)
 		grader := LaunchGrader(Config, monitor, b, ctx, true)
+		LaunchDataSourceHealth(Config, grader, ctx)
 		statTracker := LaunchStatistics(Config, ctx)
-		apiserver := LaunchAPI(Config, statTracker, grader, b, true)
+		srv := networkMiner.NewMiningServer(Config, monitor, grader, statTracker)
+		srv.Shares = networkMiner.NewShareTracker(grader.DB, grader.Network)
+		go srv.TrackShares(ctx)
+
+		apiserver := LaunchAPI(Config, statTracker, grader, b, false)
+		apiserver.PoolShares = srv.Shares
+		ListenAPI(Config, apiserver)
 		LaunchControlPanel(Config, ctx, monitor, statTracker, b)
-		var _ = apiserver
 
-		srv := networkMiner.NewMiningServer(Config, monitor, grader, statTracker)
 		go srv.Listen()
 		srv.ForwardMonitorEvents()
 
@@ -437,10 +719,24 @@ var networkMinerCmd = &cobra.Command{
 		common.GlobalExitHandler.AddCancel(cancel)
 		ValidateConfig(Config) // Will fatal log if it fails
 
+		// Services
+		statTracker := LaunchStatistics(Config, ctx)
+
 		cl := networkMiner.NewMiningClient(Config)
+		if standalone, _ := Config.Bool(common.ConfigNetMinerStandalone); standalone {
+			// Standalone mining writes our own entries
+			if err := mining.NewEntryWriter(Config, 1).PopulateECAddress(); err != nil {
+				CmdErrorf(cmd, "standalone mining needs an ec address: %s\n", err.Error())
+			}
+			cl.Standalone = LaunchStandaloneFallback(Config, statTracker)
+		}
+
 		err := cl.Connect()
 		if err != nil {
-			panic(err)
+			if cl.Standalone == nil {
+				panic(err)
+			}
+			cl.ConnectionLost(err) // Mines standalone until a coordinator is reachable
 		}
 		// Pass the cancel func to stop the system
 		go cl.Listen(cancel)
@@ -452,9 +748,6 @@ var networkMinerCmd = &cobra.Command{
 			err := <-errListener
 			panic("Monitor threw error: " + err.Error())
 		}()
-
-		// Services
-		statTracker := LaunchStatistics(Config, ctx)
 		// TODO: Api on remote? CP on remote?
 		//apiserver := LaunchAPI(Config, statTracker)
 		//LaunchControlPanel(Config, ctx, monitor, statTracker)
@@ -464,6 +757,7 @@ var networkMinerCmd = &cobra.Command{
 
 		coord := mining.NewNetworkedMiningCoordinatorFromConfig(Config, monitor, grader, statTracker)
 		coord.OPRMaker = oprMaker
+		coord.OPRSwitches = cl.OPRSwitches
 		coord.FactomEntryWriter = cl.NewEntryForwarder()
 		err = coord.InitMinters()
 		if err != nil {
@@ -546,6 +840,122 @@ var minerStats = &cobra.Command{
 	},
 }
 
+var dbCmd = &cobra.Command{
+	Use:     "db",
+	Short:   "Manage the miner database",
+	Example: "pegnet db migrate",
+}
+
+var dbMigrate = &cobra.Command{
+	Use:   "migrate [--path <miner.ldb>]",
+	Short: "Rewrites the miner database in the on-disk format of this build",
+	Long: "Runs the migrations the database has not had yet, such as rewriting the stored oprblocks " +
+		"and sprblocks from gob to protobuf, and compacts it. pegnet migrates the database when it opens it, " +
+		"this does it ahead of time. Stop pegnet before running it.",
+	Run: func(cmd *cobra.Command, args []string) {
+		path, _ := cmd.Flags().GetString("path")
+		if path == "" {
+			var err error
+			path, err = Config.String(common.ConfigMinerDBPath)
+			if err != nil {
+				CmdError(cmd, err)
+			}
+		}
+		path = os.ExpandEnv(path)
+
+		ldb := new(database.Ldb)
+		if err := ldb.Open(path); err != nil {
+			CmdErrorf(cmd, "failed to open %s: %s\n", path, err.Error())
+		}
+		defer ldb.Close()
+
+		from, err := database.Migrate(ldb)
+		if err != nil {
+			CmdErrorf(cmd, "failed to migrate %s: %s\n", path, err.Error())
+		}
+		if from == database.SchemaVersion() {
+			fmt.Printf("%s is already at version %d\n", path, from)
+			return
+		}
+
+		// The rewritten records leave the old ones behind until they are compacted
+		if err := ldb.DB.CompactRange(util.Range{}); err != nil {
+			CmdErrorf(cmd, "failed to compact %s: %s\n", path, err.Error())
+		}
+		fmt.Printf("Migrated %s from version %d to %d\n", path, from, database.SchemaVersion())
+	},
+}
+
+var dbExport = &cobra.Command{
+	Use:   "export <file> [--height N]",
+	Short: "Writes a snapshot of the graded blocks, balances and opr chain cursor",
+	Long: "Writes a checksummed snapshot of the miner database at the height the opr chain is synced to, " +
+		"or at an earlier eblock of the opr chain with --height, " +
+		"for a new node to import instead of syncing the chains from the start. " +
+		"An earlier height needs factomd for its eblock. " +
+		"Files ending in .gz are gzipped. Stop pegnet before running it.",
+	Example: "pegnet db export snapshot.json.gz --height 220000",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		network, chainid := configOPRChain(cmd)
+		db := OpenLevelDB(Config)
+		defer db.Close()
+
+		height, _ := cmd.Flags().GetInt64("height")
+		snapshot, err := opr.PrepareSnapshot(db, chainid, network, height, common.DefaultFactomClient)
+		if err != nil {
+			CmdErrorf(cmd, "failed to export the snapshot: %s\n", err.Error())
+		}
+
+		f, err := opr.CreateSnapshotFile(args[0])
+		if err != nil {
+			CmdErrorf(cmd, "failed to create the snapshot: %s\n", err.Error())
+		}
+		err = snapshot.Write(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(args[0])
+			CmdErrorf(cmd, "failed to export the snapshot: %s\n", err.Error())
+		}
+		fmt.Printf("Exported the snapshot at height %d to %s\n", snapshot.Header.Height, args[0])
+	},
+}
+
+var dbImport = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Imports a snapshot into a new miner database, and verifies it against the chain",
+	Long: "Imports a snapshot written by 'pegnet db export' into a new miner database. " +
+		"The last block of the snapshot is graded again from factomd, and the snapshot is removed " +
+		"if its winners do not match. pegnet continues syncing from the snapshot when it starts.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		network, chainid := configOPRChain(cmd)
+		db := OpenLevelDB(Config)
+		defer db.Close()
+
+		f, err := opr.OpenSnapshotFile(args[0])
+		if err != nil {
+			CmdErrorf(cmd, "failed to open the snapshot: %s\n", err.Error())
+		}
+		header, err := opr.ImportSnapshot(f, db, chainid, network)
+		f.Close()
+		if err != nil {
+			CmdErrorf(cmd, "failed to import the snapshot: %s\n", err.Error())
+		}
+
+		grader := opr.NewQuickGrader(Config, db, balances.NewBalanceTracker())
+		if err := grader.VerifySnapshot(header); err != nil {
+			if derr := opr.DeleteSnapshot(db); derr != nil {
+				CmdErrorf(cmd, "the snapshot failed to verify: %s, and failed to be removed: %s\n", err.Error(), derr.Error())
+			}
+			CmdErrorf(cmd, "the snapshot failed to verify, it was removed: %s\n", err.Error())
+		}
+		fmt.Printf("Imported and verified the snapshot at height %d\n", header.Height)
+	},
+}
+
 var decode = &cobra.Command{
 	Use:     "decode",
 	Short:   "Attempt to decode an opr from an entry/eblock",
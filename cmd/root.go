@@ -86,6 +86,7 @@ var RootCmd = &cobra.Command{
 		// Services
 		monitor := LaunchFactomMonitor(Config)
 		grader := LaunchGrader(Config, monitor, b, ctx, true)
+		LaunchDataSourceHealth(Config, grader, ctx)
 		statTracker := LaunchStatistics(Config, ctx)
 		apiserver := LaunchAPI(Config, statTracker, grader, b, true)
 		LaunchControlPanel(Config, ctx, monitor, statTracker, b)
@@ -142,6 +143,27 @@ func ValidateStakingConfig(config *config.Config) {
 	}
 }
 
+// ValidateNodeConfig will validate the config has what `pegnet node` needs. A node
+// only syncs and serves the chains, so it needs no identity, EC address or coinbase.
+// Will fatal if it fails
+func ValidateNodeConfig(config *config.Config) {
+	_, err := config.String("Miner.Protocol")
+	if err != nil {
+		log.WithError(err).Fatal("failed to read miner protocol from config")
+	}
+	_, err = common.LoadConfigNetwork(config)
+	if err != nil {
+		log.WithError(err).Fatal("failed to read miner network from config")
+	}
+
+	ValidateStakingConfig(config)
+
+	_, err = config.String(common.ConfigPegnetNodeDBPath)
+	if err != nil {
+		log.WithError(err).Fatal("failed to read the node database from config")
+	}
+}
+
 func initLogger() {
 	switch strings.ToLower(LogLevel) {
 	case "trace":
@@ -5,6 +5,7 @@ import (
 	"github.com/pegnet/pegnet/staking"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pegnet/pegnet/balances"
@@ -14,6 +15,7 @@ import (
 	"github.com/pegnet/pegnet/controlPanel"
 	"github.com/pegnet/pegnet/database"
 	"github.com/pegnet/pegnet/mining"
+	"github.com/pegnet/pegnet/node"
 	"github.com/pegnet/pegnet/opr"
 	log "github.com/sirupsen/logrus"
 	"github.com/zpatrick/go-config"
@@ -36,6 +38,9 @@ func LaunchGrader(config *config.Config, monitor *common.Monitor, balances *bala
 	db := OpenDB(Config)
 
 	grader := opr.NewQuickGrader(config, db, balances)
+	if index, _ := config.Bool(common.ConfigPegnetNodeIndex); index {
+		LaunchNodeDatabase(config, grader)
+	}
 	if run {
 		go grader.Run(monitor, ctx)
 	}
@@ -43,6 +48,63 @@ func LaunchGrader(config *config.Config, monitor *common.Monitor, balances *bala
 	return grader
 }
 
+// LaunchDataSourceHealth feeds the winning prices of every graded block to the
+// data source health tracker, so sources that drift from consensus are demoted.
+func LaunchDataSourceHealth(config *config.Config, grader opr.IGrader, ctx context.Context) {
+	opr.InitDataSource(config)
+	alert := grader.GetAlert("datasource-health")
+	go func() {
+		defer grader.StopAlert("datasource-health")
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case winners, ok := <-alert:
+				if !ok {
+					return
+				}
+				if winners == nil || len(winners.GradedOPRs) == 0 {
+					continue
+				}
+				winning := make(map[string]float64)
+				for asset := range winners.GradedOPRs[0].Assets {
+					winning[asset] = winners.GradedOPRs[0].Assets.Value(asset)
+				}
+				opr.PollingDataSource.Health.RecordGradedPrices(winning)
+			}
+		}
+	}()
+}
+
+// LaunchNodeDatabase opens the node database, and has the grader write into it. It has
+// to be called before the grader runs.
+func LaunchNodeDatabase(config *config.Config, grader *opr.QuickGrader) *node.NodeDatabase {
+	dbpath, err := config.String(common.ConfigPegnetNodeDBPath)
+	if err != nil {
+		log.WithError(err).Fatal("Database.NodeDatabase needs to be set in the config file or cmd line")
+		os.Exit(1)
+	}
+	n, err := node.OpenNodeDatabase(os.ExpandEnv(dbpath), grader.Network)
+	if err != nil {
+		log.WithError(err).Fatal("node database failed to open")
+		os.Exit(1)
+	}
+	store, err := node.Attach(grader, n)
+	if err != nil {
+		log.WithError(err).Fatal("node database failed to attach")
+		os.Exit(1)
+	}
+	common.GlobalExitHandler.AddExit(n.Close)
+
+	// What the grader had before is written next to the grading
+	go func() {
+		if err := store.Backfill(grader); err != nil {
+			log.WithError(err).Error("node database failed to backfill")
+		}
+	}()
+	return n
+}
+
 func OpenDB(config *config.Config) database.IDatabase {
 	dbtype, err := config.String(common.ConfigMinerDBType)
 	if err != nil {
@@ -70,16 +132,97 @@ func OpenLevelDB(config *config.Config) *database.Ldb {
 		log.WithError(err).Fatal("Database.MinerDatabase needs to be set in the config file or cmd line")
 		os.Exit(1)
 	}
+	return openLevelDBAt(dbpath)
+}
+
+// OpenStakerDB opens the database of the spr grader. It is kept apart from the miner
+// database, so a miner and a staker can run side by side.
+func OpenStakerDB(config *config.Config) database.IDatabase {
+	dbtype, err := config.String(common.ConfigMinerDBType)
+	if err != nil {
+		log.WithError(err).Fatal("Database.MinerDatabaseType needs to be set in the config file or cmd line")
+		os.Exit(1)
+	}
+	if strings.ToLower(dbtype) == "map" {
+		return database.NewMapDb()
+	}
 
+	dbpath, err := config.String(common.ConfigStakerDBPath)
+	if err != nil {
+		log.WithError(err).Fatal("Database.StakerDatabase needs to be set in the config file or cmd line")
+		os.Exit(1)
+	}
+	return openLevelDBAt(dbpath)
+}
+
+func openLevelDBAt(dbpath string) *database.Ldb {
 	ldb := new(database.Ldb)
-	err = ldb.Open(os.ExpandEnv(dbpath))
+	err := ldb.Open(os.ExpandEnv(dbpath))
 	if err != nil {
 		log.WithError(err).Fatal("ldb failed to open")
 		os.Exit(1)
 	}
+	// Bring the database up to the on-disk format of this build
+	if _, err := database.Migrate(ldb); err != nil {
+		log.WithError(err).Fatal("ldb failed to migrate")
+		os.Exit(1)
+	}
 	return ldb
 }
 
+func LaunchSPRGrader(config *config.Config, monitor *common.Monitor, ctx context.Context) *staking.SPRGrader {
+	db := OpenStakerDB(config)
+
+	grader := staking.NewSPRGrader(config, db)
+	go grader.Run(monitor, ctx)
+	common.GlobalExitHandler.AddExit(grader.Close)
+	return grader
+}
+
+// LaunchStakerResults logs how the sprs of our coinbase addresses placed in every
+// graded spr block
+func LaunchStakerResults(config *config.Config, grader *staking.SPRGrader, ctx context.Context) {
+	coinbases := make(map[string]bool)
+	addresses, _ := staking.StakingAddresses(config)
+	for _, addr := range addresses {
+		coinbases[addr] = true
+	}
+
+	alert := grader.GetAlert("staker-results")
+	go func() {
+		defer grader.StopAlert("staker-results")
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case graded, ok := <-alert:
+				if !ok {
+					return
+				}
+				if graded == nil || graded.Error != nil || len(graded.GradedSPRs) == 0 {
+					continue
+				}
+				found := false
+				for _, s := range graded.GradedSPRs {
+					if !coinbases[s.CoinbaseAddress] {
+						continue
+					}
+					found = true
+					log.WithFields(log.Fields{
+						"dbht":     graded.Dbht,
+						"coinbase": s.CoinbaseAddress,
+						"position": s.Position,
+						"payout":   s.Payout,
+					}).Info("SPR graded")
+				}
+				if !found {
+					log.WithField("dbht", graded.Dbht).Warn("None of our SPRs were graded")
+				}
+			}
+		}
+	}()
+}
+
 func LaunchStatistics(config *config.Config, ctx context.Context) *mining.GlobalStatTracker {
 	statTracker := mining.NewGlobalStatTracker()
 
@@ -89,18 +232,66 @@ func LaunchStatistics(config *config.Config, ctx context.Context) *mining.Global
 
 func LaunchAPI(config *config.Config, stats *mining.GlobalStatTracker, grader *opr.QuickGrader, bals *balances.BalanceTracker, run bool) *api.APIServer {
 	s := api.NewApiServer(grader, bals, config)
+	if grader != nil {
+		if store, ok := grader.BlockStore.(*node.IndexedBlockStore); ok {
+			s.UseNodeDatabase(store.Node)
+		}
+	}
 
 	if run {
-		apiport, err := config.Int(common.ConfigAPIPort)
-		if err != nil {
-			log.WithError(err).Fatal("can't find api port")
-			os.Exit(1)
-		}
-		go s.Listen(apiport)
+		ListenAPI(config, s)
+	}
+	return s
+}
+
+// ListenAPI serves the api on the configured api port
+func ListenAPI(config *config.Config, s *api.APIServer) {
+	apiport, err := config.Int(common.ConfigAPIPort)
+	if err != nil {
+		log.WithError(err).Fatal("can't find api port")
+		os.Exit(1)
+	}
+	go s.Listen(apiport)
+}
+
+// LaunchStakerAPI serves the api of the staker, on its own port so it can run next to a miner
+func LaunchStakerAPI(config *config.Config, grader *staking.SPRGrader, accounts *staking.StakerAccounts) *api.APIServer {
+	s := api.NewApiServer(nil, nil, config)
+	s.SPRGrader = grader
+	s.Accounts = accounts
+
+	apiport, err := config.Int(common.ConfigStakerAPIPort)
+	if err != nil {
+		log.WithError(err).Fatal("can't find staker api port")
+		os.Exit(1)
 	}
+	go s.Listen(apiport)
 	return s
 }
 
+// LaunchStandaloneFallback returns a func that mines until its context is cancelled, so
+// a netminer can mine on its own while it can not reach a coordinator. The factomd monitor
+// and the grader are only launched the first time it is called. Losing factomd then stops
+// the standalone miners, rather than the netminer, as a coordinator may come back.
+func LaunchStandaloneFallback(config *config.Config, stats *mining.GlobalStatTracker) func(ctx context.Context) {
+	var once sync.Once
+	var monitor *common.Monitor
+	var grader *opr.QuickGrader
+	return func(ctx context.Context) {
+		once.Do(func() {
+			monitor = common.GetMonitor()
+			monitor.SetTimeout(time.Duration(Timeout) * time.Second)
+			go func() {
+				for err := range monitor.NewErrorListener() {
+					log.WithError(err).Error("standalone mining can not reach factomd")
+				}
+			}()
+			grader = LaunchGrader(config, monitor, balances.NewBalanceTracker(), context.Background(), true)
+		})
+		LaunchMiners(config, ctx, monitor, grader, stats)
+	}
+}
+
 func LaunchControlPanel(config *config.Config, ctx context.Context, monitor common.IMonitor, stats *mining.GlobalStatTracker, bals *balances.BalanceTracker) *controlPanel.ControlPanel {
 	cp := controlPanel.NewControlPanel(config, monitor, stats, bals)
 	go cp.ServeControlPanel()
@@ -113,18 +304,38 @@ func LaunchMiners(config *config.Config, ctx context.Context, monitor common.IMo
 	if err != nil {
 		panic(err)
 	}
+	if g, ok := grader.(*opr.QuickGrader); ok {
+		coord.Strategy, err = mining.NewSubmissionStrategyFromConfig(config, g.BlockStore)
+		if err != nil {
+			panic(err)
+		}
+		// The entry credits bought today are kept in the miner database
+		if err := coord.Budget.Load(g.DB); err != nil {
+			log.WithError(err).Fatal("failed to load the entry credit purchases")
+		}
+	}
 
 	// TODO: Make this unblocking
 	coord.LaunchMiners(ctx) // Inf loop unless context cancelled
 	return coord
 }
 
-func LaunchStaker(config *config.Config, ctx context.Context, monitor common.IMonitor) *staking.StakingCoordinator {
+func LaunchStaker(config *config.Config, ctx context.Context, monitor common.IMonitor, grader *staking.SPRGrader) *staking.StakingCoordinator {
 	coord_s := staking.NewStakingCoordinatorFromConfig(config, monitor)
 	err := coord_s.InitStaker()
 	if err != nil {
 		panic(err)
 	}
+	// The accounts and the entry credits bought today are kept in the staker database,
+	// next to the sprblocks
+	coord_s.Accounts.DB = grader.BlockStore.DB
+	if err := coord_s.Accounts.Load(); err != nil {
+		log.WithError(err).Fatal("failed to load the staker accounts")
+	}
+	if err := coord_s.Budget.Load(grader.BlockStore.DB); err != nil {
+		log.WithError(err).Fatal("failed to load the entry credit purchases")
+	}
+	LaunchStakerAPI(config, grader, coord_s.Accounts)
 
 	coord_s.LaunchStaker(ctx) // Inf loop unless context cancelled
 	return coord_s
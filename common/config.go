@@ -15,13 +15,34 @@ const (
 	ConfigCoordinatorLocation          = "Miner.MiningCoordinatorHost"
 	ConfigCoordinatorSecret            = "Miner.CoordinatorSecret"
 	ConfigCoordinatorUseAuthentication = "Miner.UseCoordinatorAuthentication"
+	ConfigCoordinatorCredentials       = "Miner.CoordinatorCredentials"
+	ConfigCoordinatorUser              = "Miner.CoordinatorUser"
+	ConfigCoordinatorTLSCert           = "Miner.CoordinatorTLSCert"
+	ConfigCoordinatorTLSKey            = "Miner.CoordinatorTLSKey"
+	ConfigCoordinatorTLSClientCA       = "Miner.CoordinatorTLSClientCA"
+	ConfigNetMinerTLS                  = "Miner.NetMinerTLS"
+	ConfigNetMinerTLSCA                = "Miner.NetMinerTLSCA"
+	ConfigNetMinerTLSCert              = "Miner.NetMinerTLSCert"
+	ConfigNetMinerTLSKey               = "Miner.NetMinerTLSKey"
+	ConfigNetMinerStandalone           = "Miner.NetMinerStandalone"
 	ConfigSubmissionCutOff             = "Miner.SubmissionCutOff"
+	ConfigHashBackend                  = "Miner.HashBackend"
+	ConfigSubmissionStrategy           = "Miner.SubmissionStrategy"
+	ConfigStrategyBlocks               = "Miner.StrategyBlocks"
+
+	ConfigECBuyAddress   = "EntryCredits.FCTAddress"
+	ConfigECBuyThreshold = "EntryCredits.BuyThreshold"
+	ConfigECBuyAmount    = "EntryCredits.BuyAmount"
+	ConfigECDailyBuyCap  = "EntryCredits.DailyBuyCap"
 
 	ConfigMinerDBPath      = "Database.MinerDatabase"
 	ConfigMinerDBType      = "Database.MinerDatabaseType"
 	ConfigPegnetNodeDBPath = "Database.NodeDatabase"
+	ConfigPegnetNodeIndex  = "Database.IndexNodeDatabase"
+	ConfigStakerDBPath     = "Database.StakerDatabase"
 
 	ConfigAPIPort          = "API.APIPort"
+	ConfigStakerAPIPort    = "API.StakerAPIPort"
 	ConfigControlPanelPort = "API.ControlPanelPort"
 
 	ConfigCoinbaseAddress = "Miner.CoinbaseAddress"
@@ -36,6 +57,30 @@ const (
 	// ConfigStaleDuration determines how old a quote is allowed to be and still be
 	// acceptable
 	ConfigStaleDuration = "Oracle.StaleQuoteDuration"
+
+	// ConfigAggregationMode is how the quotes of all the data sources are combined into
+	// a single price. One of priority, median or trimmedmean
+	ConfigAggregationMode = "Oracle.AggregationMode"
+	// ConfigOutlierPercent drops quotes further than this percent from the median of all
+	// quotes of an asset. 0 disables it
+	ConfigOutlierPercent = "Oracle.OutlierPercent"
+
+	// Data sources over any of these are moved to the end of the priority order
+	// for the demote duration
+	ConfigHealthMaxLatency     = "Oracle.HealthMaxLatency"
+	ConfigHealthMaxErrorRate   = "Oracle.HealthMaxErrorRate"
+	ConfigHealthMaxStaleRate   = "Oracle.HealthMaxStaleRate"
+	ConfigHealthMaxDeviation   = "Oracle.HealthMaxDeviation"
+	ConfigHealthDemoteDuration = "Oracle.HealthDemoteDuration"
+
+	// The streaming price feed. The address is host:port of a line-delimited json feed
+	ConfigStreamAddress        = "OracleStream.Address"
+	ConfigStreamReconnectDelay = "OracleStream.ReconnectDelay"
+	ConfigStreamFirstTickWait  = "OracleStream.FirstTickWait"
+
+	// ConfigCustomSourcePrefix is the section prefix of user defined json data sources.
+	// Each source is configured in [OracleCustomSource.<name>]
+	ConfigCustomSourcePrefix = "OracleCustomSource"
 )
 
 // DefaultConfigOptions gives us the ability to add configurable settings that really
@@ -56,11 +101,23 @@ func (c *DefaultConfigOptions) Load() (map[string]string, error) {
 	// Include default settings here
 	settings[ConfigSubmissionCutOff] = "200"
 	settings[ConfigAPIPort] = "8099"
+	settings[ConfigStakerAPIPort] = "8097"
 	settings[ConfigMinerDBPath] = "$PEGNETHOME/data_$PEGNETNETWORK/miner.ldb"
 	settings[ConfigMinerDBType] = "ldb"
 	settings[ConfigPegnetNodeDBPath] = "$PEGNETHOME/data_$PEGNETNETWORK/node.sqlite"
+	settings[ConfigPegnetNodeIndex] = "false"
+	settings[ConfigStakerDBPath] = "$PEGNETHOME/data_$PEGNETNETWORK/staker.ldb"
 	settings[ConfigControlPanelPort] = "8080"
 	settings[ConfigStaleDuration] = "30m"
+	settings[ConfigAggregationMode] = "priority"
+	settings[ConfigOutlierPercent] = "0"
+	settings[ConfigHealthMaxLatency] = "15s"
+	settings[ConfigHealthMaxErrorRate] = "0.5"
+	settings[ConfigHealthMaxStaleRate] = "0.5"
+	settings[ConfigHealthMaxDeviation] = "5"
+	settings[ConfigHealthDemoteDuration] = "30m"
+	settings[ConfigStreamReconnectDelay] = "5s"
+	settings[ConfigStreamFirstTickWait] = "10s"
 
 	return settings, nil
 }
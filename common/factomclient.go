@@ -0,0 +1,122 @@
+// Copyright (c) of parts are held by the various contributors (see the CLA)
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+package common
+
+import (
+	"github.com/FactomProject/factom"
+)
+
+// FactomClient is all of the access to factomd and the wallet we need. Everything that
+// talks to the chain goes through one, so the chain can be faked in unit tests.
+type FactomClient interface {
+	// Heights
+	GetHeights() (*factom.HeightsResponse, error)
+	GetCurrentMinute() (*factom.CurrentMinuteInfo, error)
+
+	// Blocks and entries
+	GetChainHead(chainid string) (string, bool, error)
+	GetEBlock(keymr string) (*factom.EBlock, error)
+	GetEntry(hash string) (*factom.Entry, error)
+	GetAllEBlockEntries(keymr string) ([]*factom.Entry, error)
+	GetDBlockByHeight(height int64) (*factom.DBlock, []byte, error)
+	GetFBlockByHeight(height int64) (*factom.FBlock, []byte, error)
+	GetTransaction(txid string) (*factom.TransactionResponse, error)
+
+	// Entry credits
+	GetECBalance(addr string) (int64, error)
+	CommitEntry(e *factom.Entry, ec *factom.ECAddress) (string, error)
+	RevealEntry(e *factom.Entry) (string, error)
+
+	// Factoids
+	GetFactoidBalance(addr string) (int64, error)
+	GetECRate() (uint64, error)
+
+	// Wallet
+	FetchECAddress(ecpub string) (*factom.ECAddress, error)
+	SignData(signer string, data []byte) (*factom.Signature, error)
+	// BuyExactEC buys the amount of entry credits for the ec address with the factoids
+	// of the factoid address, returning the txid
+	BuyExactEC(from, to string, amount uint64) (string, error)
+}
+
+// DefaultFactomClient is the client used when none is given. It talks to the factomd and
+// walletd set with factom.SetFactomdServer and factom.SetWalletServer.
+var DefaultFactomClient FactomClient = new(FactomdClient)
+
+// FactomdClient is the FactomClient that calls the factom library
+type FactomdClient struct{}
+
+var _ FactomClient = (*FactomdClient)(nil)
+
+func (FactomdClient) GetHeights() (*factom.HeightsResponse, error) {
+	return factom.GetHeights()
+}
+
+func (FactomdClient) GetCurrentMinute() (*factom.CurrentMinuteInfo, error) {
+	return factom.GetCurrentMinute()
+}
+
+func (FactomdClient) GetChainHead(chainid string) (string, bool, error) {
+	return factom.GetChainHead(chainid)
+}
+
+func (FactomdClient) GetEBlock(keymr string) (*factom.EBlock, error) {
+	return factom.GetEBlock(keymr)
+}
+
+func (FactomdClient) GetEntry(hash string) (*factom.Entry, error) {
+	return factom.GetEntry(hash)
+}
+
+func (FactomdClient) GetAllEBlockEntries(keymr string) ([]*factom.Entry, error) {
+	return factom.GetAllEBlockEntries(keymr)
+}
+
+func (FactomdClient) GetDBlockByHeight(height int64) (*factom.DBlock, []byte, error) {
+	return factom.GetDBlockByHeight(height)
+}
+
+func (FactomdClient) GetFBlockByHeight(height int64) (*factom.FBlock, []byte, error) {
+	return factom.GetFBlockByHeight(height)
+}
+
+func (FactomdClient) GetTransaction(txid string) (*factom.TransactionResponse, error) {
+	return factom.GetTransaction(txid)
+}
+
+func (FactomdClient) GetECBalance(addr string) (int64, error) {
+	return factom.GetECBalance(addr)
+}
+
+func (FactomdClient) CommitEntry(e *factom.Entry, ec *factom.ECAddress) (string, error) {
+	return factom.CommitEntry(e, ec)
+}
+
+func (FactomdClient) RevealEntry(e *factom.Entry) (string, error) {
+	return factom.RevealEntry(e)
+}
+
+func (FactomdClient) FetchECAddress(ecpub string) (*factom.ECAddress, error) {
+	return factom.FetchECAddress(ecpub)
+}
+
+func (FactomdClient) SignData(signer string, data []byte) (*factom.Signature, error) {
+	return factom.SignData(signer, data)
+}
+
+func (FactomdClient) GetFactoidBalance(addr string) (int64, error) {
+	return factom.GetFactoidBalance(addr)
+}
+
+func (FactomdClient) GetECRate() (uint64, error) {
+	return factom.GetECRate()
+}
+
+func (FactomdClient) BuyExactEC(from, to string, amount uint64) (string, error) {
+	tx, err := factom.BuyExactEC(from, to, amount, false)
+	if err != nil {
+		return "", err
+	}
+	return tx.TxID, nil
+}
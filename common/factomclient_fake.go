@@ -0,0 +1,402 @@
+// Copyright (c) of parts are held by the various contributors (see the CLA)
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	ed "github.com/FactomProject/ed25519"
+	"github.com/FactomProject/factom"
+)
+
+// FakeFactomClient is an in memory chain that can be used in unit tests. Entries that
+// are committed and revealed are put into eblocks when the block is advanced, so a
+// full mine, grade and pay cycle can be run without a factomd.
+type FakeFactomClient struct {
+	Start       time.Time // The timestamp of the first block
+	StartHeight int64
+
+	height int64 // The height of the block being built
+	minute int64
+
+	dblocks      map[int64]*factom.DBlock
+	fblocks      map[int64]*factom.FBlock
+	eblocks      map[string]*factom.EBlock
+	heads        map[string]string
+	entries      map[string]*factom.Entry
+	transactions map[string]*factom.TransactionResponse
+
+	// The block being built
+	committed map[string]bool
+	pending   []*factom.Entry
+	pendingTx []factom.Transaction
+
+	ecAddresses  map[string]*factom.ECAddress
+	ecBalances   map[string]int64
+	fctAddresses map[string]*factom.FactoidAddress
+	fctBalances  map[string]int64
+
+	ECRate uint64 // The factoshis an entry credit costs
+
+	sync.Mutex
+}
+
+var _ FactomClient = (*FakeFactomClient)(nil)
+
+// NewFakeFactomClient makes an empty chain that is building the block at the height
+func NewFakeFactomClient(height int64) *FakeFactomClient {
+	f := new(FakeFactomClient)
+	f.Start = time.Now()
+	f.StartHeight = height
+	f.height = height
+
+	f.dblocks = make(map[int64]*factom.DBlock)
+	f.fblocks = make(map[int64]*factom.FBlock)
+	f.eblocks = make(map[string]*factom.EBlock)
+	f.heads = make(map[string]string)
+	f.entries = make(map[string]*factom.Entry)
+	f.transactions = make(map[string]*factom.TransactionResponse)
+	f.committed = make(map[string]bool)
+	f.ecAddresses = make(map[string]*factom.ECAddress)
+	f.ecBalances = make(map[string]int64)
+	f.fctAddresses = make(map[string]*factom.FactoidAddress)
+	f.fctBalances = make(map[string]int64)
+	f.ECRate = 1000
+
+	return f
+}
+
+// AddECAddress adds the address to the fake wallet with the given balance
+func (f *FakeFactomClient) AddECAddress(ec *factom.ECAddress, balance int64) {
+	f.Lock()
+	defer f.Unlock()
+	f.ecAddresses[ec.String()] = ec
+	f.ecBalances[ec.String()] = balance
+}
+
+// AddFactoidAddress adds the address to the fake wallet, so it can sign data
+func (f *FakeFactomClient) AddFactoidAddress(fa *factom.FactoidAddress) {
+	f.Lock()
+	defer f.Unlock()
+	f.fctAddresses[fa.String()] = fa
+}
+
+// SetFactoidBalance sets the factoshi balance of the factoid address
+func (f *FakeFactomClient) SetFactoidBalance(addr string, balance int64) {
+	f.Lock()
+	defer f.Unlock()
+	f.fctBalances[addr] = balance
+}
+
+// AddFactoidTransaction adds the transaction to the block being built. The transaction
+// is returned as is in the FactoidTransaction of GetTransaction.
+func (f *FakeFactomClient) AddFactoidTransaction(tx interface{}) (string, error) {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return "", err
+	}
+	f.Lock()
+	defer f.Unlock()
+
+	sum := sha256.Sum256(append(data, byte(len(f.transactions))))
+	txid := hex.EncodeToString(sum[:])
+	f.transactions[txid] = &factom.TransactionResponse{
+		FactoidTransaction:             tx,
+		IncludedInDirectoryBlockHeight: f.height,
+	}
+	f.pendingTx = append(f.pendingTx, factom.Transaction{TxID: txid, BlockHeight: uint32(f.height)})
+	return txid, nil
+}
+
+// Height returns the height of the block being built
+func (f *FakeFactomClient) Height() int64 {
+	f.Lock()
+	defer f.Unlock()
+	return f.height
+}
+
+// AdvanceMinute moves to the next minute, and the next block after minute 9
+func (f *FakeFactomClient) AdvanceMinute() {
+	f.Lock()
+	f.minute++
+	next := f.minute == 10
+	f.Unlock()
+
+	if next {
+		f.AdvanceBlock()
+	}
+}
+
+// AdvanceBlock completes the block being built. The revealed entries are put into an
+// eblock per chain, in the order they were revealed.
+func (f *FakeFactomClient) AdvanceBlock() {
+	f.Lock()
+	defer f.Unlock()
+
+	dblock := new(factom.DBlock)
+	dblock.SequenceNumber = f.height
+	dblock.Header.DBHeight = int(f.height)
+	dblock.Header.Timestamp = int(f.Start.Add(time.Duration(f.height-f.StartHeight)*10*time.Minute).Unix() / 60)
+	if prev, ok := f.dblocks[f.height-1]; ok {
+		dblock.Header.PrevKeyMR = prev.KeyMR
+	} else {
+		dblock.Header.PrevKeyMR = ZeroHash
+	}
+
+	// Group the entries by chain, keeping the order of the chains
+	var chains []string
+	byChain := make(map[string][]*factom.Entry)
+	for _, e := range f.pending {
+		if _, ok := byChain[e.ChainID]; !ok {
+			chains = append(chains, e.ChainID)
+		}
+		byChain[e.ChainID] = append(byChain[e.ChainID], e)
+	}
+
+	for _, chain := range chains {
+		eblock := new(factom.EBlock)
+		eblock.Header.ChainID = chain
+		eblock.Header.DBHeight = f.height
+		eblock.Header.Timestamp = int64(dblock.Header.Timestamp) * 60
+		eblock.Header.PrevKeyMR = ZeroHash
+		if head, ok := f.heads[chain]; ok {
+			eblock.Header.PrevKeyMR = head
+			eblock.Header.BlockSequenceNumber = f.eblocks[head].Header.BlockSequenceNumber + 1
+		}
+		for _, e := range byChain[chain] {
+			eblock.EntryList = append(eblock.EntryList, factom.EBEntry{EntryHash: hex.EncodeToString(e.Hash()), Timestamp: eblock.Header.Timestamp})
+		}
+
+		keymr := fakeKeyMR(eblock)
+		f.eblocks[keymr] = eblock
+		f.heads[chain] = keymr
+		dblock.DBEntries = append(dblock.DBEntries, struct {
+			ChainID string `json:"chainid"`
+			KeyMR   string `json:"keymr"`
+		}{ChainID: chain, KeyMR: keymr})
+	}
+
+	dblock.KeyMR = fakeKeyMR(dblock)
+	f.dblocks[f.height] = dblock
+	f.fblocks[f.height] = &factom.FBlock{DBHeight: f.height, Transactions: f.pendingTx}
+
+	f.pending = nil
+	f.pendingTx = nil
+	f.height++
+	f.minute = 0
+}
+
+func fakeKeyMR(block interface{}) string {
+	data, _ := json.Marshal(block)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (f *FakeFactomClient) GetHeights() (*factom.HeightsResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	return &factom.HeightsResponse{
+		DirectoryBlockHeight: f.height - 1,
+		LeaderHeight:         f.height,
+		EntryBlockHeight:     f.height - 1,
+		EntryHeight:          f.height - 1,
+	}, nil
+}
+
+func (f *FakeFactomClient) GetCurrentMinute() (*factom.CurrentMinuteInfo, error) {
+	f.Lock()
+	defer f.Unlock()
+	return &factom.CurrentMinuteInfo{
+		LeaderHeight:            f.height,
+		DirectoryBlockHeight:    f.height - 1,
+		Minute:                  f.minute,
+		DirectoryBlockInSeconds: 600,
+	}, nil
+}
+
+func (f *FakeFactomClient) GetChainHead(chainid string) (string, bool, error) {
+	f.Lock()
+	defer f.Unlock()
+	head, ok := f.heads[chainid]
+	if !ok {
+		return "", false, fmt.Errorf("Missing Chain Head")
+	}
+	return head, false, nil
+}
+
+func (f *FakeFactomClient) GetEBlock(keymr string) (*factom.EBlock, error) {
+	f.Lock()
+	defer f.Unlock()
+	eblock, ok := f.eblocks[keymr]
+	if !ok {
+		return nil, fmt.Errorf("eblock %s not found", keymr)
+	}
+	return eblock, nil
+}
+
+func (f *FakeFactomClient) GetEntry(hash string) (*factom.Entry, error) {
+	f.Lock()
+	defer f.Unlock()
+	entry, ok := f.entries[hash]
+	if !ok {
+		return nil, fmt.Errorf("entry %s not found", hash)
+	}
+	return entry, nil
+}
+
+func (f *FakeFactomClient) GetAllEBlockEntries(keymr string) ([]*factom.Entry, error) {
+	eblock, err := f.GetEBlock(keymr)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*factom.Entry, 0, len(eblock.EntryList))
+	for _, e := range eblock.EntryList {
+		entry, err := f.GetEntry(e.EntryHash)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (f *FakeFactomClient) GetDBlockByHeight(height int64) (*factom.DBlock, []byte, error) {
+	f.Lock()
+	defer f.Unlock()
+	dblock, ok := f.dblocks[height]
+	if !ok {
+		return nil, nil, fmt.Errorf("dblock %d not found", height)
+	}
+	return dblock, nil, nil
+}
+
+func (f *FakeFactomClient) GetFBlockByHeight(height int64) (*factom.FBlock, []byte, error) {
+	f.Lock()
+	defer f.Unlock()
+	fblock, ok := f.fblocks[height]
+	if !ok {
+		return nil, nil, fmt.Errorf("fblock %d not found", height)
+	}
+	return fblock, nil, nil
+}
+
+func (f *FakeFactomClient) GetTransaction(txid string) (*factom.TransactionResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	tx, ok := f.transactions[txid]
+	if !ok {
+		return nil, fmt.Errorf("transaction %s not found", txid)
+	}
+	return tx, nil
+}
+
+func (f *FakeFactomClient) GetECBalance(addr string) (int64, error) {
+	f.Lock()
+	defer f.Unlock()
+	return f.ecBalances[addr], nil
+}
+
+// CommitEntry pays for the entry from the ec balance
+func (f *FakeFactomClient) CommitEntry(e *factom.Entry, ec *factom.ECAddress) (string, error) {
+	cost, err := factom.EntryCost(e)
+	if err != nil {
+		return "", err
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	if f.ecBalances[ec.String()] < int64(cost) {
+		return "", fmt.Errorf("not enough entry credits in %s", ec.String())
+	}
+	f.ecBalances[ec.String()] -= int64(cost)
+
+	hash := hex.EncodeToString(e.Hash())
+	f.committed[hash] = true
+	sum := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// RevealEntry adds a committed entry to the block being built
+func (f *FakeFactomClient) RevealEntry(e *factom.Entry) (string, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	hash := hex.EncodeToString(e.Hash())
+	if !f.committed[hash] {
+		return "", fmt.Errorf("entry %s was not committed", hash)
+	}
+	delete(f.committed, hash)
+
+	// Copy the entry, so the caller can not change it once it is on chain
+	entry := &factom.Entry{ChainID: e.ChainID, Content: append([]byte{}, e.Content...)}
+	for _, ext := range e.ExtIDs {
+		entry.ExtIDs = append(entry.ExtIDs, append([]byte{}, ext...))
+	}
+	f.entries[hash] = entry
+	f.pending = append(f.pending, entry)
+	return hash, nil
+}
+
+func (f *FakeFactomClient) FetchECAddress(ecpub string) (*factom.ECAddress, error) {
+	f.Lock()
+	defer f.Unlock()
+	ec, ok := f.ecAddresses[ecpub]
+	if !ok {
+		return nil, fmt.Errorf("ec address %s not in the wallet", ecpub)
+	}
+	return ec, nil
+}
+
+func (f *FakeFactomClient) SignData(signer string, data []byte) (*factom.Signature, error) {
+	f.Lock()
+	defer f.Unlock()
+	fa, ok := f.fctAddresses[signer]
+	if !ok {
+		return nil, fmt.Errorf("address %s not in the wallet", signer)
+	}
+	sig := ed.Sign(fa.SecFixed(), data)
+	return &factom.Signature{PubKey: fa.PubBytes(), Signature: sig[:]}, nil
+}
+
+func (f *FakeFactomClient) GetFactoidBalance(addr string) (int64, error) {
+	f.Lock()
+	defer f.Unlock()
+	return f.fctBalances[addr], nil
+}
+
+func (f *FakeFactomClient) GetECRate() (uint64, error) {
+	f.Lock()
+	defer f.Unlock()
+	return f.ECRate, nil
+}
+
+// BuyExactEC moves the factoids to the ec balance at the ECRate, without a fee. The
+// factoid address has to be in the fake wallet.
+func (f *FakeFactomClient) BuyExactEC(from, to string, amount uint64) (string, error) {
+	f.Lock()
+	if _, ok := f.fctAddresses[from]; !ok {
+		f.Unlock()
+		return "", fmt.Errorf("address %s not in the wallet", from)
+	}
+	cost := int64(amount * f.ECRate)
+	if f.fctBalances[from] < cost {
+		f.Unlock()
+		return "", fmt.Errorf("not enough factoids in %s", from)
+	}
+	f.fctBalances[from] -= cost
+	f.ecBalances[to] += int64(amount)
+	f.Unlock()
+
+	return f.AddFactoidTransaction(struct {
+		From     string `json:"from"`
+		To       string `json:"to"`
+		Amount   uint64 `json:"amount"`
+		Factoids int64  `json:"factoids"`
+	}{from, to, amount, cost})
+}
@@ -0,0 +1,88 @@
+// Copyright (c) of parts are held by the various contributors (see the CLA)
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package common_test
+
+import (
+	"bytes"
+	"testing"
+
+	ed "github.com/FactomProject/ed25519"
+	"github.com/FactomProject/factom"
+	. "github.com/pegnet/pegnet/common"
+)
+
+func TestFakeFactomClient(t *testing.T) {
+	f := NewFakeFactomClient(10)
+	ec, _ := factom.GetECAddress("Es2XT3jSxi1xqrDvS5JERM3W3jh1awRHuyoahn3hbQLyfEi1jvbq")
+	f.AddECAddress(ec, 1)
+
+	entry := &factom.Entry{ChainID: ZeroHash, ExtIDs: [][]byte{[]byte("a")}, Content: []byte("content")}
+	if _, err := f.RevealEntry(entry); err == nil {
+		t.Error("exp an error revealing an entry that was not committed")
+	}
+	if _, err := f.CommitEntry(entry, ec); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.CommitEntry(entry, ec); err == nil {
+		t.Error("exp an error committing without entry credits")
+	}
+	if _, err := f.RevealEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.GetChainHead(ZeroHash); err == nil {
+		t.Error("exp no chain head before the block is complete")
+	}
+
+	// Two blocks, the second eblock links to the first
+	f.AdvanceBlock()
+	f.AddECAddress(ec, 1)
+	entry.Content = []byte("second")
+	f.CommitEntry(entry, ec)
+	f.RevealEntry(entry)
+	for i := 0; i < 10; i++ {
+		f.AdvanceMinute()
+	}
+
+	heights, _ := f.GetHeights()
+	if heights.DirectoryBlockHeight != 11 || f.Height() != 12 {
+		t.Errorf("exp 2 complete blocks, found height %d", heights.DirectoryBlockHeight)
+	}
+	head, _, err := f.GetChainHead(ZeroHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eblock, _ := f.GetEBlock(head)
+	if eblock.Header.DBHeight != 11 || eblock.Header.BlockSequenceNumber != 1 {
+		t.Errorf("unexpected eblock header %+v", eblock.Header)
+	}
+	prev, err := f.GetEBlock(eblock.Header.PrevKeyMR)
+	if err != nil || prev.Header.DBHeight != 10 {
+		t.Errorf("exp the previous eblock at height 10")
+	}
+	dblock, _, _ := f.GetDBlockByHeight(11)
+	if len(dblock.DBEntries) != 1 || dblock.DBEntries[0].KeyMR != head {
+		t.Errorf("exp the dblock to hold the eblock")
+	}
+	entries, _ := f.GetAllEBlockEntries(head)
+	if len(entries) != 1 || !bytes.Equal(entries[0].Content, []byte("second")) {
+		t.Errorf("unexpected entries %v", entries)
+	}
+
+	// Signing
+	fa, _ := factom.GetFactoidAddress("Fs3E9gV6DXsYzf7Fqx1fVBQPQXV695eP3k5XbmHEZVRLkMdD9qCK")
+	if _, err := f.SignData(fa.String(), []byte("data")); err == nil {
+		t.Error("exp an error signing with an address not in the wallet")
+	}
+	f.AddFactoidAddress(fa)
+	sig, err := f.SignData(fa.String(), []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pub [32]byte
+	var s [64]byte
+	copy(pub[:], sig.PubKey)
+	copy(s[:], sig.Signature)
+	if !ed.Verify(&pub, []byte("data"), &s) {
+		t.Error("exp a valid signature")
+	}
+}
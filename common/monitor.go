@@ -18,6 +18,7 @@ var once sync.Once
 func GetMonitor() *Monitor {
 	once.Do(func() {
 		monitor = new(Monitor)
+		monitor.Factom = DefaultFactomClient
 		monitor.errors = []chan error{}
 		monitor.listeners = []chan MonitorEvent{}
 		go monitor.poll()
@@ -34,6 +35,7 @@ type IMonitor interface {
 // Monitor polls a factomd node and sends alerts whenever the block height or minute changes
 type Monitor struct {
 	timeout time.Duration
+	Factom  FactomClient
 
 	listenerMutex sync.Mutex
 	listeners     []chan MonitorEvent // Channels to send minutes to
@@ -85,7 +87,7 @@ func (f *Monitor) getMinute() (*factom.CurrentMinuteInfo, error) {
 	var info *factom.CurrentMinuteInfo
 	var err error
 	retry := func() error {
-		info, err = factom.GetCurrentMinute()
+		info, err = f.Factom.GetCurrentMinute()
 		return err
 	}
 
@@ -96,17 +96,14 @@ func (c *ControlPanel) ServeControlPanel() {
 	go func() {
 		var CurrentHashRate uint64
 		var CurrentDifficulty uint64
-		var CoinbaseAddress string
 
-		if str, err := c.Config.String(common.ConfigCoinbaseAddress); err != nil {
-			log.Fatal("config file has no Coinbase Address")
-		} else {
-			CoinbaseAddress = str
-		}
-
-		CoinbasePEGAddress, err := common.ConvertFCTtoPegNetAsset(network, "PEG", CoinbaseAddress)
-		if err != nil {
-			panic("no valid coinbase address in the config file")
+		// A node that does not mine has no coinbase, so it has no balance to show
+		var CoinbasePEGAddress string
+		if str, err := c.Config.String(common.ConfigCoinbaseAddress); err == nil {
+			if CoinbasePEGAddress, err = common.ConvertFCTtoPegNetAsset(network, "PEG", str); err != nil {
+				log.WithField("coinbase", str).Warn("no valid coinbase address in the config file, the control panel will not show its balance")
+				CoinbasePEGAddress = ""
+			}
 		}
 		// TODO: Include states from statTracker
 
@@ -115,7 +112,9 @@ func (c *ControlPanel) ServeControlPanel() {
 			case e := <-alert:
 
 				r := CommonResponse{Minute: e.Minute, Dbht: e.Dbht, HashRate: CurrentHashRate, Difficulty: CurrentDifficulty}
-				r.Balance = c.Balances.GetBalance(CoinbasePEGAddress)
+				if CoinbasePEGAddress != "" {
+					r.Balance = c.Balances.GetBalance(CoinbasePEGAddress)
+				}
 
 				data, _ := json.Marshal(r)
 				c.SSEServer.SendMessage("/events/common", sse.SimpleMessage(string(data)))
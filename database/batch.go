@@ -0,0 +1,46 @@
+// Copyright (c) of parts are held by the various contributors (see the CLA)
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+package database
+
+// Batch is a set of writes that are committed together with IDatabase.Write.
+// Either all of them are on disk, or none of them are. The writes are applied
+// in the order they were added.
+type Batch struct {
+	writes []batchWrite
+}
+
+type batchWrite struct {
+	key    []byte // The key with the bucket, from BuildKey
+	value  []byte
+	delete bool
+}
+
+func NewBatch() *Batch {
+	return new(Batch)
+}
+
+// Put adds a write of the value to the key in the bucket
+func (b *Batch) Put(bucket Bucket, key []byte, value []byte) {
+	b.writes = append(b.writes, batchWrite{key: BuildKey(bucket, key), value: value})
+}
+
+// Delete adds a delete of the key in the bucket
+func (b *Batch) Delete(bucket Bucket, key []byte) {
+	b.writes = append(b.writes, batchWrite{key: BuildKey(bucket, key), delete: true})
+}
+
+// deleteRaw adds a delete of a key as it is on disk, for migrations of the key format
+func (b *Batch) deleteRaw(key []byte) {
+	b.writes = append(b.writes, batchWrite{key: key, delete: true})
+}
+
+// Len is the number of writes in the batch
+func (b *Batch) Len() int {
+	return len(b.writes)
+}
+
+// Reset empties the batch, so it can be used again
+func (b *Batch) Reset() {
+	b.writes = b.writes[:0]
+}
@@ -0,0 +1,109 @@
+package database_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/pegnet/pegnet/database"
+)
+
+// testDatabases returns a map db and a leveldb in a temporary directory
+func testDatabases(t *testing.T) (map[string]IDatabase, func()) {
+	dir, err := ioutil.TempDir("", "pegnet-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ldb := new(Ldb)
+	if err := ldb.Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]IDatabase{"map": NewMapDb(), "ldb": ldb}, func() {
+		_ = ldb.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func keys(iter Iterator) (keys []string) {
+	defer iter.Release()
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	return keys
+}
+
+func TestBatch(t *testing.T) {
+	dbs, cleanup := testDatabases(t)
+	defer cleanup()
+
+	for name, db := range dbs {
+		Chk(t, db.Put(BUCKET_BALANCES, []byte("deleted"), []byte{1}))
+
+		batch := NewBatch()
+		batch.Put(BUCKET_BALANCES, []byte("a"), []byte{1})
+		batch.Put(BUCKET_BALANCES, []byte("b"), []byte{2})
+		batch.Put(BUCKET_BALANCES, []byte("a"), []byte{3})
+		batch.Put(BUCKET_PRICE_HISTORY, []byte("a"), []byte{4})
+		batch.Delete(BUCKET_BALANCES, []byte("deleted"))
+		if batch.Len() != 5 {
+			t.Errorf("%s: exp 5 writes, found %d", name, batch.Len())
+		}
+		Chk(t, db.Write(batch))
+
+		// The writes are applied in order, and the buckets do not share keys
+		if v, err := db.Get(BUCKET_BALANCES, []byte("a")); err != nil || v[0] != 3 {
+			t.Errorf("%s: exp the last write of a, found %v %v", name, v, err)
+		}
+		if v, err := db.Get(BUCKET_PRICE_HISTORY, []byte("a")); err != nil || v[0] != 4 {
+			t.Errorf("%s: exp a in the price history, found %v %v", name, v, err)
+		}
+		if _, err := db.Get(BUCKET_BALANCES, []byte("deleted")); err != ErrNotFound {
+			t.Errorf("%s: exp the key to be deleted, found %v", name, err)
+		}
+		if _, err := db.Get(BUCKET_OPR_HEIGHT, []byte("a")); err != ErrNotFound {
+			t.Errorf("%s: exp no key in another bucket, found %v", name, err)
+		}
+	}
+}
+
+func TestIterate(t *testing.T) {
+	dbs, cleanup := testDatabases(t)
+	defer cleanup()
+
+	for name, db := range dbs {
+		for _, key := range []string{"c2", "a1", "b1", "b2", "b3", "c1"} {
+			Chk(t, db.Put(BUCKET_PRICE_HISTORY, []byte(key), []byte(key)))
+		}
+		Chk(t, db.Put(BUCKET_OPR_HEIGHT, []byte("b0"), nil))
+		Chk(t, db.Put(BUCKET_SPR_HEIGHT, []byte("b4"), nil))
+
+		check := func(what string, iter Iterator, exp ...string) {
+			t.Helper()
+			found := keys(iter)
+			if len(found) != len(exp) {
+				t.Errorf("%s %s: exp %v, found %v", name, what, exp, found)
+				return
+			}
+			for i := range exp {
+				if found[i] != exp[i] {
+					t.Errorf("%s %s: exp %v, found %v", name, what, exp, found)
+					return
+				}
+			}
+		}
+		check("bucket", db.Iterate(BUCKET_PRICE_HISTORY), "a1", "b1", "b2", "b3", "c1", "c2")
+		check("prefix", db.IteratePrefix(BUCKET_PRICE_HISTORY, []byte("b")), "b1", "b2", "b3")
+		check("range", db.IterateRange(BUCKET_PRICE_HISTORY, []byte("b2"), []byte("c2")), "b2", "b3", "c1")
+		check("open range", db.IterateRange(BUCKET_PRICE_HISTORY, []byte("b3"), nil), "b3", "c1", "c2")
+		check("empty prefix", db.IteratePrefix(BUCKET_PRICE_HISTORY, []byte("d")))
+
+		iter := db.IteratePrefix(BUCKET_PRICE_HISTORY, []byte("b"))
+		if !iter.Last() || string(iter.Key()) != "b3" || string(iter.Value()) != "b3" {
+			t.Errorf("%s: exp the last key to be b3, found %s", name, iter.Key())
+		}
+		if !iter.First() || string(iter.Key()) != "b1" {
+			t.Errorf("%s: exp the first key to be b1, found %s", name, iter.Key())
+		}
+		iter.Release()
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/gob"
+
+	"github.com/syndtr/goleveldb/leveldb/errors"
 )
 
 type Bucket int
@@ -24,9 +26,57 @@ const (
 	BUCKET_ALL_EB     // OPR chain Entry Blocks indexed by Directory Block Height
 	BUCKET_VALID_EB   // OPR chain Entry Blocks that actually qualify to pay out mining fees and set asset prices
 	BUCKET_VALID_OPRS // OPR Lists of valid OPRS, indexed by Directory Block Height, ordered as graded
-	BUCKET_BALANCES   // PEG payout balances
+
+	// The bucket with the balance checkpoints
+	//	Key -> "snapshot"
+	//	Value -> All balances and the sync heights at the last compaction
+	//	Key -> "checkpoint" | Sequence
+	//	Value -> The balances changed by a block and the sync heights after it
+	BUCKET_BALANCES
+
+	// The bucket indexed by asset and height that has the graded consensus price
+	//	Key -> Asset | Height
+	//	Value -> Winning price of the asset (uint64)
+	BUCKET_PRICE_HISTORY
+
+	// The bucket with the eblock sync cursors
+	//	Key -> Chainid
+	//	Value -> The last parsed eblock
+	//	Key -> Chainid | Height
+	//	Value -> Nothing, the height of a parsed eblock
+	BUCKET_EBLOCK_SYNC
+
+	// The bucket indexed by height that has the graded sprblock data
+	//	Key -> Height
+	//	Value -> Graded spr list
+	BUCKET_SPR_HEIGHT
+
+	// The bucket with the shares submitted to a net coordinator
+	//	Key -> Height
+	//	Value -> The shares of all clients for the block
+	BUCKET_POOL_SHARES
+
+	// The bucket with what is known about the database itself
+	//	Key -> "schema"
+	//	Value -> The version of the on-disk format (uint64)
+	BUCKET_META
+
+	// The bucket with the accounts of the coinbase addresses a staker writes sprs for
+	//	Key -> Coinbase address
+	//	Value -> What the address has written and spent
+	BUCKET_STAKER_ACCOUNTS
+
+	// The bucket with the entry credits bought in the last 24 hours
+	//	Key -> Factoid address | Txid
+	//	Value -> The purchase
+	BUCKET_EC_PURCHASES
 )
 
+// ErrNotFound is returned by Get when the key does not exist in the bucket
+var ErrNotFound = errors.ErrNotFound
+
+// Iterator walks the keys of a bucket in order. The keys do not include the bucket.
+// It starts before the first key, so Next() has to be called to get to it.
 type Iterator interface {
 	First() bool
 	Last() bool
@@ -34,6 +84,7 @@ type Iterator interface {
 	Key() []byte
 	Value() []byte
 	Release()
+	Error() error
 }
 
 type IDatabase interface {
@@ -43,7 +94,16 @@ type IDatabase interface {
 	Delete(bucket Bucket, key []byte) error
 	Close() error
 
+	// Write commits all the writes of the batch, or none of them
+	Write(batch *Batch) error
+
+	// Iterate walks the whole bucket
 	Iterate(bucket Bucket) Iterator
+	// IteratePrefix walks the keys of the bucket that start with the prefix
+	IteratePrefix(bucket Bucket, prefix []byte) Iterator
+	// IterateRange walks the keys of the bucket in [start, limit). A nil limit
+	// walks to the end of the bucket.
+	IterateRange(bucket Bucket, start, limit []byte) Iterator
 }
 
 // Decode is a gob decode into the target object
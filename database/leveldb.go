@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
@@ -19,20 +20,23 @@ type Ldb struct {
 }
 
 // BuildKey()
-// appends the bucket as a number to the front of the key, only using 7 bits
+// prepends the bucket as a number to the front of the key, only using 7 bits
 // and keeping the high bit set.  Much like a varint.  This does not work well
 // for negative numbers or really big numbers.
 //
-// This usually this adds two bytes, the value and a zero.  The bucket is always
-// separated from the key by one zero. We set the high order bit
+// This usually adds two bytes, the value and a zero.  The bucket is always
+// separated from the key by one zero. We set the high order bit, so no byte of
+// the bucket is zero, and the keys of one bucket never run into another.
 func BuildKey(bucket Bucket, key []byte) (bkey []byte) {
 	for {
-		bkey = append(key, byte(bucket)|0x80)
+		bkey = append(bkey, byte(bucket&0x7F)|0x80)
+		bucket = bucket >> 7
 		if bucket == 0 {
-			return bkey
+			break
 		}
-		bucket = bucket >> 7
 	}
+	bkey = append(bkey, 0)
+	return append(bkey, key...)
 }
 
 // Open()
@@ -104,6 +108,24 @@ func (db *Ldb) Delete(bucket Bucket, key []byte) error {
 	return nil
 }
 
+// Write()
+// Commits the batch in a single leveldb write, so it is all on disk or none of it is.
+func (db *Ldb) Write(batch *Batch) error {
+	b := new(leveldb.Batch)
+	for _, w := range batch.writes {
+		if w.delete {
+			b.Delete(w.key)
+		} else {
+			b.Put(w.key, w.value)
+		}
+	}
+
+	db.lock.Lock() // make database access concurrent safe
+	defer db.lock.Unlock()
+
+	return db.DB.Write(b, nil)
+}
+
 // Iterate()
 // Creates an iterator to iterate over the elements in a bucket.
 // A particular iterator cannot be used in multiple processes, but
@@ -111,7 +133,49 @@ func (db *Ldb) Delete(bucket Bucket, key []byte) error {
 //
 // Iterators must be released.
 func (db *Ldb) Iterate(bucket Bucket) (iter Iterator) {
-	bkey := BuildKey(bucket, []byte{})
-	iter = db.DB.NewIterator(util.BytesPrefix(bkey), nil)
-	return iter
+	return db.IteratePrefix(bucket, nil)
+}
+
+func (db *Ldb) IteratePrefix(bucket Bucket, prefix []byte) Iterator {
+	return db.iterate(bucket, util.BytesPrefix(BuildKey(bucket, prefix)))
+}
+
+func (db *Ldb) IterateRange(bucket Bucket, start, limit []byte) Iterator {
+	r := &util.Range{Start: BuildKey(bucket, start), Limit: BuildKey(bucket, limit)}
+	if limit == nil {
+		r.Limit = util.BytesPrefix(BuildKey(bucket, nil)).Limit
+	}
+	return db.iterate(bucket, r)
+}
+
+func (db *Ldb) iterate(bucket Bucket, r *util.Range) Iterator {
+	return &ldbIterator{Iterator: db.DB.NewIterator(r, nil), bucket: len(BuildKey(bucket, nil))}
+}
+
+// iterateRaw calls fn with every key and value as they are on disk
+func (db *Ldb) iterateRaw(fn func(key, value []byte) error) error {
+	iter := db.DB.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := append([]byte{}, iter.Key()...)
+		value := append([]byte{}, iter.Value()...)
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// ldbIterator strips the bucket from the keys
+type ldbIterator struct {
+	iterator.Iterator
+	bucket int // The length of the bucket at the front of the keys
+}
+
+func (i *ldbIterator) Key() []byte {
+	key := i.Iterator.Key()
+	if key == nil {
+		return nil
+	}
+	return key[i.bucket:]
 }
@@ -4,6 +4,8 @@
 package database
 
 import (
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/syndtr/goleveldb/leveldb/errors"
@@ -64,7 +66,126 @@ func (db *MapDb) Delete(bucket Bucket, key []byte) error {
 	return nil
 }
 
-// TODO: implement this for a map? Are we going to use this?
+// Write applies the batch while holding the lock, so no reader sees half of it
+func (db *MapDb) Write(batch *Batch) error {
+	db.lock.Lock() // make database access concurrent safe
+	defer db.lock.Unlock()
+
+	for _, w := range batch.writes {
+		if w.delete {
+			delete(db.data, string(w.key))
+		} else {
+			db.data[string(w.key)] = w.value
+		}
+	}
+	return nil
+}
+
 func (db *MapDb) Iterate(bucket Bucket) (iter Iterator) {
+	return db.IteratePrefix(bucket, nil)
+}
+
+func (db *MapDb) IteratePrefix(bucket Bucket, prefix []byte) Iterator {
+	bprefix := string(BuildKey(bucket, prefix))
+	return db.iterate(bucket, func(key string) bool {
+		return strings.HasPrefix(key, bprefix)
+	})
+}
+
+func (db *MapDb) IterateRange(bucket Bucket, start, limit []byte) Iterator {
+	bucketPrefix := string(BuildKey(bucket, nil))
+	bstart, blimit := string(BuildKey(bucket, start)), string(BuildKey(bucket, limit))
+	return db.iterate(bucket, func(key string) bool {
+		if !strings.HasPrefix(key, bucketPrefix) || key < bstart {
+			return false
+		}
+		return limit == nil || key < blimit
+	})
+}
+
+// iterate walks a sorted copy of the keys that match, so the map can be
+// written while it is walked
+func (db *MapDb) iterate(bucket Bucket, match func(key string) bool) Iterator {
+	db.lock.Lock() // make database access concurrent safe
+	defer db.lock.Unlock()
+
+	iter := &mapIterator{bucket: len(BuildKey(bucket, nil)), pos: -1}
+	for key := range db.data {
+		if match(key) {
+			iter.keys = append(iter.keys, key)
+		}
+	}
+	sort.Strings(iter.keys)
+	for _, key := range iter.keys {
+		iter.values = append(iter.values, db.data[key])
+	}
+	return iter
+}
+
+// iterateRaw calls fn with every key and value as they are stored
+func (db *MapDb) iterateRaw(fn func(key, value []byte) error) error {
+	db.lock.Lock()
+	data := make(map[string][]byte, len(db.data))
+	for key, value := range db.data {
+		data[key] = value
+	}
+	db.lock.Unlock()
+
+	for key, value := range data {
+		if err := fn([]byte(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type mapIterator struct {
+	keys   []string
+	values [][]byte
+	bucket int // The length of the bucket at the front of the keys
+	pos    int
+}
+
+func (i *mapIterator) valid() bool {
+	return i.pos >= 0 && i.pos < len(i.keys)
+}
+
+func (i *mapIterator) First() bool {
+	i.pos = 0
+	return i.valid()
+}
+
+func (i *mapIterator) Last() bool {
+	i.pos = len(i.keys) - 1
+	return i.valid()
+}
+
+func (i *mapIterator) Next() bool {
+	if i.pos < len(i.keys) {
+		i.pos++
+	}
+	return i.valid()
+}
+
+func (i *mapIterator) Key() []byte {
+	if !i.valid() {
+		return nil
+	}
+	return []byte(i.keys[i.pos][i.bucket:])
+}
+
+func (i *mapIterator) Value() []byte {
+	if !i.valid() {
+		return nil
+	}
+	return i.values[i.pos]
+}
+
+func (i *mapIterator) Release() {
+	i.keys, i.values = nil, nil
+	i.pos = -1
+}
+
+func (i *mapIterator) Error() error {
 	return nil
 }
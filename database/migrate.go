@@ -0,0 +1,113 @@
+// Copyright (c) of parts are held by the various contributors (see the CLA)
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var schemaKey = []byte("schema")
+
+// Migration moves a database from the version before it to its version
+type Migration struct {
+	Version     uint64
+	Description string
+	// Migrate adds its changes to the batch. The batch is written along with the new
+	// schema version, so a migration is either done entirely or not at all.
+	Migrate func(db IDatabase, batch *Batch) error
+}
+
+var migrations = []Migration{
+	{Version: 1, Description: "give every bucket its own keys", Migrate: migrateBucketKeys},
+}
+
+// RegisterMigration adds a migration of the on-disk format. Migrations are run in the
+// order they are registered, and each has to be the version after the last one.
+func RegisterMigration(m Migration) {
+	if m.Version != SchemaVersion()+1 {
+		panic(fmt.Sprintf("migration %d registered after version %d", m.Version, SchemaVersion()))
+	}
+	migrations = append(migrations, m)
+}
+
+// SchemaVersion is the version of the on-disk format written by this build
+func SchemaVersion() uint64 {
+	return migrations[len(migrations)-1].Version
+}
+
+// ReadSchemaVersion returns the version of the on-disk format of the database.
+// Databases from before the version was kept are version 0.
+func ReadSchemaVersion(db IDatabase) (uint64, error) {
+	data, err := db.Get(BUCKET_META, schemaKey)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 8 {
+		return 0, fmt.Errorf("schema version is corrupt")
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// Migrate runs the migrations the database has not had yet, one batch per migration,
+// and returns the version it was before. A database newer than this build is an error.
+func Migrate(db IDatabase) (uint64, error) {
+	from, err := ReadSchemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if from > SchemaVersion() {
+		return from, fmt.Errorf("the database is version %d, this build only knows up to version %d", from, SchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.Version <= from {
+			continue
+		}
+		batch := NewBatch()
+		if err := m.Migrate(db, batch); err != nil {
+			return from, fmt.Errorf("migration %d failed: %s", m.Version, err.Error())
+		}
+		version := make([]byte, 8)
+		binary.BigEndian.PutUint64(version, m.Version)
+		batch.Put(BUCKET_META, schemaKey, version)
+		if err := db.Write(batch); err != nil {
+			return from, err
+		}
+		log.WithFields(log.Fields{
+			"version": m.Version,
+			"writes":  batch.Len(),
+		}).Infof("migrated the database to %s", m.Description)
+	}
+	return from, nil
+}
+
+// rawDatabase is a database that can walk its keys as they are stored
+type rawDatabase interface {
+	iterateRaw(fn func(key, value []byte) error) error
+}
+
+// migrateBucketKeys moves the oprblocks to the keys of their bucket. Before version 1
+// the bucket was not part of the key, just a 0x80 after it. The oprblocks, keyed by
+// height, were all that was written then, so any other key is from a database this
+// build does not know, and the migration stops rather than guess its bucket.
+func migrateBucketKeys(db IDatabase, batch *Batch) error {
+	raw, ok := db.(rawDatabase)
+	if !ok {
+		return fmt.Errorf("%T can not be migrated", db)
+	}
+	return raw.iterateRaw(func(key, value []byte) error {
+		if len(key) != 9 || key[8] != 0x80 {
+			return fmt.Errorf("key %x is not an oprblock height from before version 1", key)
+		}
+		batch.deleteRaw(key)
+		batch.Put(BUCKET_OPR_HEIGHT, key[:8], value)
+		return nil
+	})
+}
@@ -0,0 +1,111 @@
+package database_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/pegnet/pegnet/database"
+	"github.com/pegnet/pegnet/opr"
+)
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pegnet-migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := new(Ldb)
+	Chk(t, db.Open(dir))
+	defer db.Close()
+
+	// Write the keys as they were before version 1, with a 0x80 after them
+	legacy := func(key, value []byte) {
+		Chk(t, db.DB.Put(append(key, 0x80), value, nil))
+	}
+	// The oprblocks were all that was written then
+	obj := RandomOPRBlock()
+	obj.DblockHeight = 100
+	oprblock, err := Encode(obj)
+	Chk(t, err)
+	legacy(HeightToBytes(100), oprblock)
+
+	if v, err := ReadSchemaVersion(db); err != nil || v != 0 {
+		t.Fatalf("exp version 0, found %d %v", v, err)
+	}
+	from, err := Migrate(db)
+	if err != nil || from != 0 {
+		t.Fatalf("exp to migrate from version 0, found %d %v", from, err)
+	}
+	if v, _ := ReadSchemaVersion(db); v != SchemaVersion() {
+		t.Errorf("exp version %d, found %d", SchemaVersion(), v)
+	}
+
+	// The oprblock is also moved to the versioned format by the opr migration
+	data, err := db.Get(BUCKET_OPR_HEIGHT, HeightToBytes(100))
+	if err != nil || opr.IsLegacyOPRBlock(data) {
+		t.Errorf("exp the oprblock in the versioned format, found %v", err)
+	} else if block, err := opr.DecodeOPRBlock(data); err != nil || block.DblockHeight != 100 || len(block.GradedOprs) != len(obj.GradedOprs) {
+		t.Errorf("exp the oprblock to be the same after the migrations, found %v", err)
+	} else {
+		for i := range obj.GradedOprs {
+			if !bytes.Equal(block.GradedOprs[i].OPRHash, obj.GradedOprs[i].OPRHash) {
+				t.Errorf("opr %d: exp %x, found %x", i, obj.GradedOprs[i].OPRHash, block.GradedOprs[i].OPRHash)
+			}
+		}
+	}
+
+	// Only the migrated oprblock and the version are left
+	iter := db.DB.NewIterator(nil, nil)
+	count := 0
+	for iter.Next() {
+		count++
+	}
+	iter.Release()
+	if count != 2 {
+		t.Errorf("exp 2 keys after the migration, found %d", count)
+	}
+
+	// A migrated database is not migrated again
+	if from, err := Migrate(db); err != nil || from != SchemaVersion() {
+		t.Errorf("exp no migration, found %d %v", from, err)
+	}
+}
+
+func TestMigrate_UnknownKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pegnet-migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := new(Ldb)
+	Chk(t, db.Open(dir))
+	defer db.Close()
+
+	oprblock, err := Encode(RandomOPRBlock())
+	Chk(t, err)
+	Chk(t, db.DB.Put(append(HeightToBytes(100), 0x80), oprblock, nil))
+	Chk(t, db.DB.Put(append([]byte("unknown key"), 0x80), []byte("kept"), nil))
+
+	// Nothing is migrated, or lost
+	if _, err := Migrate(db); err == nil {
+		t.Fatal("exp the migration to stop at the unknown key")
+	}
+	if v, _ := ReadSchemaVersion(db); v != 0 {
+		t.Errorf("exp version 0, found %d", v)
+	}
+	for _, key := range [][]byte{append(HeightToBytes(100), 0x80), append([]byte("unknown key"), 0x80)} {
+		if _, err := db.DB.Get(key, nil); err != nil {
+			t.Errorf("exp %x to be left as it was, found %v", key, err)
+		}
+	}
+}
+
+func TestMigrate_Newer(t *testing.T) {
+	db := NewMapDb()
+	Chk(t, db.Put(BUCKET_META, []byte("schema"), HeightToBytes(int64(SchemaVersion()+1))))
+	if _, err := Migrate(db); err == nil {
+		t.Error("exp an error for a database newer than the build")
+	}
+}
@@ -10,6 +10,7 @@ require (
 	github.com/FactomProject/btcutil v0.0.0-20160826074221-43986820ccd5
 	github.com/FactomProject/btcutilecc v0.0.0-20130527213604-d3a63a5752ec // indirect
 	github.com/FactomProject/dynrsrc v0.3.1 // indirect
+	github.com/FactomProject/ed25519 v0.0.0-20150814230546-38002c4fe7b6
 	github.com/FactomProject/factoid v0.3.4
 	github.com/FactomProject/factom v0.3.6-0.20200826003247-4751d0f52dda
 	github.com/FactomProject/factomd v6.3.2+incompatible
@@ -52,14 +53,11 @@ require (
 	github.com/zpatrick/go-config v0.0.0-20190509173111-460869022dbd
 	go.uber.org/atomic v1.4.0 // indirect
 	go.uber.org/ratelimit v0.1.0
-	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4 // indirect
-	golang.org/x/net v0.0.0-20190813141303-74dc4d7220e7 // indirect
-	golang.org/x/sys v0.0.0-20190813064441-fde4db37ae7a // indirect
-	golang.org/x/text v0.3.2 // indirect
 	google.golang.org/genproto v0.0.0-20190801165951-fa694d86fc64 // indirect
 	google.golang.org/grpc v1.23.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 	gopkg.in/gcfg.v1 v1.2.3 // indirect
 	gopkg.in/ini.v1 v1.42.0 // indirect
 	gopkg.in/warnings.v0 v0.1.2 // indirect
+	modernc.org/sqlite v1.14.8
 )
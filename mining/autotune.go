@@ -0,0 +1,87 @@
+package mining
+
+import (
+	"context"
+	"crypto/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AutoTuneDuration is how long each number of miners is benchmarked when auto tuning
+var AutoTuneDuration = 2 * time.Second
+
+// BenchmarkHasher hashes with the backend on the number of miners for the duration,
+// and returns the total hashes per second
+func BenchmarkHasher(backend string, miners int, duration time.Duration) (float64, error) {
+	// Make sure the backend exists before we launch anything
+	if _, err := NewHasher(backend); err != nil {
+		return 0, err
+	}
+
+	oprhash := make([]byte, 32)
+	_, _ = rand.Read(oprhash)
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var total int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < miners; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			hasher, _ := NewHasher(backend)
+			n := NewNonceIncrementer(id)
+			nonces := make([][]byte, DefaultHashBatch)
+			difficulties := make([]uint64, DefaultHashBatch)
+			for ctx.Err() == nil {
+				for j := range nonces {
+					n.NextNonce()
+					nonces[j] = append(nonces[j][:0], n.Nonce...)
+				}
+				hasher.Difficulties(oprhash, nonces, difficulties)
+				atomic.AddInt64(&total, int64(len(nonces)))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return float64(total) / time.Since(start).Seconds(), nil
+}
+
+// AutoTuneMiners benchmarks the backend with 1, 2, 4... miners up to max, and returns
+// the number of miners with the best hashrate along with the hashrate of every number
+// tried. It stops trying more once the hashrate drops.
+func AutoTuneMiners(backend string, max int, duration time.Duration) (int, map[int]float64, error) {
+	if max < 1 {
+		max = 1
+	}
+
+	// Powers of two, and the number of cores
+	var counts []int
+	for n := 1; n < max; n *= 2 {
+		counts = append(counts, n)
+		if cores := runtime.NumCPU(); n < cores && cores < n*2 && cores < max {
+			counts = append(counts, cores)
+		}
+	}
+	counts = append(counts, max)
+
+	rates := make(map[int]float64)
+	best := 0
+	for _, n := range counts {
+		rate, err := BenchmarkHasher(backend, n, duration)
+		if err != nil {
+			return 0, nil, err
+		}
+		rates[n] = rate
+		if best != 0 && rate < rates[best] {
+			break // More miners only get in each other's way from here
+		}
+		best = n
+	}
+	return best, rates, nil
+}
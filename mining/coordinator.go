@@ -1,10 +1,13 @@
 package mining
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"fmt"
+	"runtime"
 
+	"github.com/pegnet/pegnet/budget"
 	"github.com/pegnet/pegnet/common"
 	"github.com/pegnet/pegnet/opr"
 	log "github.com/sirupsen/logrus"
@@ -28,12 +31,25 @@ type MiningCoordinator struct {
 	Miners []*ControlledMiner
 	// FactomEntryWriter writes the oprs to chain
 	FactomEntryWriter IEntryWriter
+	// Budget buys the entry credits the writer spends. Nil if the coordinator does not
+	// write with its own EC address.
+	Budget *budget.ECBudget
 
 	// Who we submit our stats too
 	StatTracker *GlobalStatTracker
 
 	// Used when going over the network
 	OPRMaker IOPRMaker
+	// OPRSwitches replace the opr being mined mid block, when a netminer fails over to a
+	// coordinator that distributes another opr. Nil if the opr is never replaced.
+	OPRSwitches chan *opr.OraclePriceRecord
+	// Strategy decides the records to write for each block. Nil uses the static
+	// SubmissionCutOff and RecordsPerBlock.
+	Strategy *SubmissionStrategy
+
+	// The hashrate of the miners in the last block, and the records to keep this block
+	hashRate float64
+	keep     int
 
 	// To give miners unique IDs
 	minerIDCounter int
@@ -82,18 +98,59 @@ func NewMiningCoordinatorFromConfig(config *config.Config, monitor common.IMonit
 		panic(err)
 	}
 
+	c.Budget, err = budget.NewECBudgetFromConfig(config, "Miner.ECAddress", common.DefaultFactomClient)
+	if err != nil {
+		panic(err)
+	}
+
 	return c
 }
 
+// ecBalance is the balance of the EC address, once entry credits are bought if the
+// budget runs low
+func (c *MiningCoordinator) ecBalance(height int64) (int64, error) {
+	if c.Budget != nil {
+		return c.Budget.Check(height)
+	}
+	return c.FactomEntryWriter.ECBalance()
+}
+
+// InitMinters makes the configured number of miners, hashing with the configured
+// backend. With 0 miners, the number of miners is tuned to the machine.
 func (c *MiningCoordinator) InitMinters() error {
 	numMiners, err := c.config.Int("Miner.NumberOfMiners")
 	if err != nil {
 		return err
 	}
 
+	backend, _ := c.config.String(common.ConfigHashBackend)
+	if backend == "" {
+		backend = "lxr" // Configs from before the backends
+	}
+	if _, err := NewHasher(backend); err != nil {
+		return err
+	}
+
+	if numMiners <= 0 {
+		opr.InitLX()
+		cores := runtime.NumCPU()
+		log.WithFields(log.Fields{"backend": backend, "cores": cores}).Info("Tuning the number of miners...")
+		best, rates, err := AutoTuneMiners(backend, 2*cores, AutoTuneDuration)
+		if err != nil {
+			return err
+		}
+		fields := log.Fields{"backend": backend, "miners": best, "per_core": float64(best) / float64(cores)}
+		for n, rate := range rates {
+			fields[fmt.Sprintf("hashrate_%d", n)] = fmt.Sprintf("%.0f/s", rate)
+		}
+		log.WithFields(fields).Info("Tuned the number of miners")
+		numMiners = best
+	}
+
 	c.Miners = make([]*ControlledMiner, numMiners)
 	for i := range c.Miners {
 		c.Miners[i] = c.NewMiner(i)
+		c.Miners[i].Miner.Hasher, _ = NewHasher(backend)
 	}
 
 	return nil
@@ -126,6 +183,21 @@ MiningLoop:
 		var fds common.MonitorEvent
 		select {
 		case fds = <-alert:
+		case o := <-c.OPRSwitches:
+			if !mining || o == nil || oprTemplate == nil || o.Dbht < oprTemplate.Dbht {
+				continue MiningLoop // Only the opr being mined can be replaced, and not by an older one
+			}
+			if bytes.Equal(o.GetHash(), oprHash) {
+				continue MiningLoop // Same opr, keep the records we have
+			}
+			oprTemplate = o
+			oprHash = oprTemplate.GetHash()
+			statsAggregate = c.mineOPR(oprTemplate)
+			mineLog.WithFields(log.Fields{
+				"height":  oprTemplate.Dbht,
+				"oprhash": fmt.Sprintf("%x", oprHash),
+			}).Info("Switched to the opr of the new coordinator")
+			continue MiningLoop
 		case <-ctx.Done(): // If cancelled
 			return
 		}
@@ -144,7 +216,7 @@ MiningLoop:
 		switch fds.Minute {
 		case 1:
 			// First check if we have the funds to mine
-			bal, err := c.FactomEntryWriter.ECBalance()
+			bal, err := c.ecBalance(int64(fds.Dbht))
 			if err != nil {
 				hLog.WithError(err).WithField("action", "balance-query").Error("failed to mine this block")
 				continue MiningLoop // OPR cancelled
@@ -168,29 +240,23 @@ MiningLoop:
 					continue MiningLoop // OPR cancelled
 				}
 
+				if c.Strategy != nil {
+					if d := c.Strategy.Decide(int64(fds.Dbht), c.hashRate); d != nil {
+						if d.Records == 0 {
+							hLog.WithField("mindiff", fmt.Sprintf("%x", d.MinimumDifficulty)).Info("Not mining this block, no record is expected to pay for its entry credit")
+							mining = false
+							continue MiningLoop
+						}
+						oprTemplate.MinimumDifficulty = d.MinimumDifficulty
+						c.keep = d.Records
+					} else {
+						c.keep = c.Strategy.MaxRecords // Not enough history, so the static cutoff
+					}
+				}
+
 				// Get the OPRHash for miners to mine.
 				oprHash = oprTemplate.GetHash()
-
-				// The consolidator that will write to the blockchain
-				c.FactomEntryWriter = c.FactomEntryWriter.NextBlockWriter()
-				c.FactomEntryWriter.SetOPR(oprTemplate)
-
-				// We aggregate mining stats per block
-				statsAggregate = make(chan *SingleMinerStats, len(c.Miners))
-
-				command := BuildCommand().
-					Aggregator(c.FactomEntryWriter).                  // New aggregate per block. Writes the top X records
-					StatsAggregator(statsAggregate).                  // Stat collection per block
-					ResetRecords().                                   // Reset the miner's stats/difficulty/etc
-					NewOPRHash(oprHash).                              // New OPR hash to mine
-					MinimumDifficulty(oprTemplate.MinimumDifficulty). // Floor difficulty to use
-					ResumeMining().                                   // Start mining
-					Build()
-
-				// Need to send to our miners
-				for _, m := range c.Miners {
-					m.SendCommand(command)
-				}
+				statsAggregate = c.mineOPR(oprTemplate)
 
 				buf := make([]byte, 8)
 				binary.BigEndian.PutUint64(buf, oprTemplate.MinimumDifficulty)
@@ -224,6 +290,8 @@ MiningLoop:
 					}
 				}
 
+				c.hashRate = groupStats.TotalHashPower()
+
 				// groupStats is the stats for all the miners for this block
 				c.StatTracker.MiningStatsChannel <- groupStats
 
@@ -232,6 +300,37 @@ MiningLoop:
 	}
 }
 
+// mineOPR sets all miners to work on the opr, writing their records with a new entry
+// writer. It returns the channel the stats of the miners are aggregated on.
+func (c *MiningCoordinator) mineOPR(oprTemplate *opr.OraclePriceRecord) chan *SingleMinerStats {
+	// The consolidator that will write to the blockchain
+	c.FactomEntryWriter = c.FactomEntryWriter.NextBlockWriter()
+	c.FactomEntryWriter.SetOPR(oprTemplate)
+
+	// We aggregate mining stats per block
+	statsAggregate := make(chan *SingleMinerStats, len(c.Miners))
+
+	builder := BuildCommand()
+	if c.keep > 0 {
+		c.FactomEntryWriter.SetKeep(c.keep)
+		builder.RecordsToKeep(c.keep) // Before the records are reset
+	}
+	command := builder.
+		Aggregator(c.FactomEntryWriter).                  // New aggregate per block. Writes the top X records
+		StatsAggregator(statsAggregate).                  // Stat collection per block
+		ResetRecords().                                   // Reset the miner's stats/difficulty/etc
+		NewOPRHash(oprTemplate.GetHash()).                // New OPR hash to mine
+		MinimumDifficulty(oprTemplate.MinimumDifficulty). // Floor difficulty to use
+		ResumeMining().                                   // Start mining
+		Build()
+
+	// Need to send to our miners
+	for _, m := range c.Miners {
+		m.SendCommand(command)
+	}
+	return statsAggregate
+}
+
 type ControlledMiner struct {
 	Miner          *PegnetMiner
 	CommandChannel chan *MinerCommand
@@ -277,6 +376,11 @@ func (b *CommandBuilder) MinimumDifficulty(min uint64) *CommandBuilder {
 	return b
 }
 
+func (b *CommandBuilder) RecordsToKeep(keep int) *CommandBuilder {
+	b.commands = append(b.commands, &MinerCommand{Command: RecordsToKeep, Data: keep})
+	return b
+}
+
 func (b *CommandBuilder) SubmitNonces() *CommandBuilder {
 	b.commands = append(b.commands, &MinerCommand{Command: SubmitNonces, Data: nil})
 	return b
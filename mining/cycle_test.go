@@ -0,0 +1,121 @@
+package mining
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/FactomProject/factom"
+	"github.com/pegnet/pegnet/balances"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+	"github.com/pegnet/pegnet/opr"
+	"github.com/pegnet/pegnet/testutils"
+	"github.com/zpatrick/go-config"
+)
+
+// TestMineGradePay mines a block of oprs onto a fake chain, grades it, and checks
+// the winners are paid.
+func TestMineGradePay(t *testing.T) {
+	// Payouts need a network with pegnet addresses
+	c := config.NewConfig([]config.Provider{
+		common.NewUnitTestConfigProvider(),
+		config.NewStatic(map[string]string{"Miner.Network": common.TestNetwork}),
+	})
+	opr.InitLX()
+	opr.PollingDataSource = testutils.AlwaysOnePolling()
+
+	chain := common.NewFakeFactomClient(100)
+	ec, err := factom.GetECAddress("Es2XT3jSxi1xqrDvS5JERM3W3jh1awRHuyoahn3hbQLyfEi1jvbq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.AddECAddress(ec, 1000)
+
+	b := balances.NewBalanceTracker()
+	db := database.NewMapDb()
+	g := opr.NewQuickGrader(c, db, b)
+	g.SetFactomClient(chain)
+
+	// Mine: the first block has no previous winners
+	alert := make(chan *opr.OPRs, 1)
+	alert <- new(opr.OPRs)
+	record, err := opr.NewOpr(context.Background(), 0, int32(chain.Height()), c, alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keep := 30
+	w := NewEntryWriter(c, keep)
+	w.Factom = chain
+	if err := w.PopulateECAddress(); err != nil {
+		t.Fatal(err)
+	}
+	w.SetOPR(record)
+	miner := w.AddMiner()
+	ranking := opr.NewNonceRanking(keep)
+	for i := 0; i < 100; i++ {
+		nonce := make([]byte, 8)
+		binary.BigEndian.PutUint64(nonce, uint64(i))
+		ranking.AddNonce(nonce, record.ComputeDifficulty(nonce))
+	}
+	miner <- ranking
+	w.CollectAndWrite(true)
+
+	if bal, _ := chain.GetECBalance(ec.String()); bal != 1000-int64(keep) {
+		t.Errorf("exp %d ecs to be spent, found %d left", keep, bal)
+	}
+
+	// A burn in the same block
+	network, _ := common.LoadConfigNetwork(c)
+	burn := balances.FactoidTransaction{
+		Inputs: []balances.TransactionOutput{{Amount: 5, Useraddress: record.CoinbaseAddress}},
+		Outecs: []balances.TransactionOutput{{Amount: 0, Useraddress: common.BurnAddresses[network]}},
+	}
+	if _, err := chain.AddFactoidTransaction(burn); err != nil {
+		t.Fatal(err)
+	}
+
+	// Grade and pay
+	chain.AdvanceBlock()
+	if err := g.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := g.GetBlocks()
+	if len(blocks) != 1 {
+		t.Fatalf("exp 1 graded block, found %d", len(blocks))
+	}
+	if blocks[0].TotalNumberRecords != keep {
+		t.Errorf("exp %d records, found %d", keep, blocks[0].TotalNumberRecords)
+	}
+	if b.GetBalance(record.CoinbasePEGAddress) <= 0 {
+		t.Errorf("exp the winners to be paid")
+	}
+
+	// A restart picks up the graded blocks from the db
+	restored := opr.NewQuickGrader(c, db, balances.NewBalanceTracker())
+	if len(restored.GetBlocks()) != 1 || !restored.OPRChain.Current.IsSameAs(&g.OPRChain.Current) {
+		t.Errorf("exp the opr chain to be restored")
+	}
+	// Unless a block is missing, then the chain is synced again
+	db.Delete(database.BUCKET_OPR_HEIGHT, database.HeightToBytes(blocks[0].Dbht))
+	restored = opr.NewQuickGrader(c, db, balances.NewBalanceTracker())
+	restored.SetFactomClient(chain)
+	if len(restored.GetBlocks()) != 0 || restored.OPRChain.Current.KeyMr != "" {
+		t.Errorf("exp the opr chain to be reset")
+	}
+	if err := restored.Sync(); err != nil || len(restored.GetBlocks()) != 1 {
+		t.Errorf("exp the missing block to be synced again")
+	}
+
+	// Burns are synced once the block after is complete
+	chain.AdvanceBlock()
+	if err := g.Burns.UpdateBurns(c, chain.StartHeight-1); err != nil {
+		t.Fatal(err)
+	}
+	pFCT, _ := common.ConvertFCTtoPegNetAsset(network, "FCT", record.CoinbaseAddress)
+	if bal := b.GetBalance(pFCT); bal != 5000 {
+		t.Errorf("exp the burn to credit 5000, found %d", bal)
+	}
+}
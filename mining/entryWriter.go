@@ -18,6 +18,7 @@ type IEntryWriter interface {
 	NextBlockWriter() IEntryWriter
 	AddMiner() chan<- *opr.NonceRanking
 	SetOPR(opr *opr.OraclePriceRecord)
+	SetKeep(keep int)
 	CollectAndWrite(blocking bool)
 	ECBalance() (int64, error)
 }
@@ -30,6 +31,7 @@ type EntryWriter struct {
 
 	ec     *factom.ECAddress
 	config *config.Config
+	Factom common.FactomClient
 
 	minerLists chan *opr.NonceRanking
 	miners     int
@@ -47,13 +49,14 @@ func NewEntryWriter(config *config.Config, keep int) *EntryWriter {
 	w.Keep = keep
 	w.minerLists = make(chan *opr.NonceRanking, keep)
 	w.config = config
+	w.Factom = common.DefaultFactomClient
 	w.EntryWritingFunction = w.writeMiningRecord
 
 	return w
 }
 
 func (w *EntryWriter) ECBalance() (int64, error) {
-	return factom.GetECBalance(w.ec.String())
+	return w.Factom.GetECBalance(w.ec.String())
 }
 
 // PopulateECAddress only needs to be called once
@@ -62,7 +65,7 @@ func (w *EntryWriter) PopulateECAddress() error {
 	if ecadrStr, err := w.config.String("Miner.ECAddress"); err != nil {
 		return err
 	} else {
-		ecAdr, err := factom.FetchECAddress(ecadrStr)
+		ecAdr, err := w.Factom.FetchECAddress(ecadrStr)
 		if err != nil {
 			return err
 		}
@@ -79,6 +82,7 @@ func (w *EntryWriter) NextBlockWriter() IEntryWriter {
 	if w.Next == nil {
 		w.Next = NewEntryWriter(w.config, w.Keep)
 		w.Next.ec = w.ec
+		w.Next.Factom = w.Factom
 	}
 	return w.Next
 }
@@ -93,6 +97,13 @@ func (w *EntryWriter) AddMiner() chan<- *opr.NonceRanking {
 	return w.minerLists
 }
 
+// SetKeep sets the number of records to write, for a block not yet written
+func (w *EntryWriter) SetKeep(keep int) {
+	w.Lock()
+	defer w.Unlock()
+	w.Keep = keep
+}
+
 // SetOPR is here because we need an opr to create the entry.
 func (w *EntryWriter) SetOPR(opr *opr.OraclePriceRecord) {
 	w.Lock()
@@ -164,8 +175,8 @@ func (w *EntryWriter) writeMiningRecord(unique *opr.UniqueOPRData) error {
 			return err
 		}
 
-		_, err1 = factom.CommitEntry(entry, w.ec)
-		_, err2 = factom.RevealEntry(entry)
+		_, err1 = w.Factom.CommitEntry(entry, w.ec)
+		_, err2 = w.Factom.RevealEntry(entry)
 		if err1 == nil && err2 == nil {
 			return nil
 		}
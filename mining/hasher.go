@@ -0,0 +1,51 @@
+package mining
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pegnet/pegnet/opr"
+)
+
+// DefaultHashBatch is the number of nonces a miner hashes between checking for commands
+const DefaultHashBatch = 64
+
+// Hasher computes the difficulty of a batch of nonces for an opr hash. A miner owns its
+// hasher, so a hasher does not have to be safe for concurrent use.
+type Hasher interface {
+	// Name is the backend of the hasher, as it is configured
+	Name() string
+	// Difficulties sets the difficulty of every nonce in difficulties, which is at
+	// least as long as the nonces
+	Difficulties(oprhash []byte, nonces [][]byte, difficulties []uint64)
+}
+
+// HashBackends are the hashers that can be configured, by name
+var HashBackends = map[string]func() Hasher{
+	"lxr": func() Hasher { return new(LXRHasher) },
+}
+
+// NewHasher returns a new hasher of the backend
+func NewHasher(backend string) (Hasher, error) {
+	f, ok := HashBackends[backend]
+	if !ok {
+		var names []string
+		for name := range HashBackends {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("hash backend %q not found, use one of %v", backend, names)
+	}
+	return f(), nil
+}
+
+// LXRHasher hashes one nonce at a time with opr.ComputeDifficulty
+type LXRHasher struct{}
+
+func (LXRHasher) Name() string { return "lxr" }
+
+func (LXRHasher) Difficulties(oprhash []byte, nonces [][]byte, difficulties []uint64) {
+	for i, nonce := range nonces {
+		difficulties[i] = opr.ComputeDifficulty(oprhash, nonce)
+	}
+}
@@ -0,0 +1,23 @@
+package mining
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+func init() {
+	HashBackends["fake"] = func() Hasher { return new(FakeHasher) }
+}
+
+// FakeHasher is a deterministic hasher for tests, which does not need the LXR table.
+// The difficulty is the high eight bytes of the sha256 of oprhash + nonce.
+type FakeHasher struct{}
+
+func (FakeHasher) Name() string { return "fake" }
+
+func (FakeHasher) Difficulties(oprhash []byte, nonces [][]byte, difficulties []uint64) {
+	for i, nonce := range nonces {
+		h := sha256.Sum256(append(append([]byte{}, oprhash...), nonce...))
+		difficulties[i] = binary.BigEndian.Uint64(h[:8])
+	}
+}
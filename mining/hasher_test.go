@@ -0,0 +1,93 @@
+package mining_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/pegnet/pegnet/mining"
+	"github.com/pegnet/pegnet/opr"
+)
+
+func TestHashers(t *testing.T) {
+	opr.InitLX()
+	oprhash := make([]byte, 32)
+	oprhash[0] = 0xAB
+	n := NewNonceIncrementer(3)
+	nonces := make([][]byte, 100)
+	for i := range nonces {
+		n.NextNonce()
+		nonces[i] = append([]byte{}, n.Nonce...)
+	}
+
+	// The lxr backend computes the consensus difficulty
+	for _, backend := range []string{"lxr"} {
+		h, err := NewHasher(backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name() != backend {
+			t.Errorf("exp backend %s, found %s", backend, h.Name())
+		}
+		difficulties := make([]uint64, len(nonces))
+		h.Difficulties(oprhash, nonces, difficulties)
+		for i, nonce := range nonces {
+			if exp := opr.ComputeDifficulty(oprhash, nonce); difficulties[i] != exp {
+				t.Fatalf("%s: exp difficulty %x for nonce %x, found %x", backend, exp, nonce, difficulties[i])
+			}
+		}
+	}
+
+	// The fake is deterministic
+	fake, _ := NewHasher("fake")
+	a, b := make([]uint64, len(nonces)), make([]uint64, len(nonces))
+	fake.Difficulties(oprhash, nonces, a)
+	fake.Difficulties(oprhash, nonces, b)
+	for i := range a {
+		if a[i] != b[i] || (i > 0 && a[i] == a[i-1]) {
+			t.Fatalf("exp deterministic and distinct difficulties, found %x and %x", a[i], b[i])
+		}
+	}
+
+	if _, err := NewHasher("gpu"); err == nil {
+		t.Error("exp an unknown backend to be an error")
+	}
+}
+
+func TestAutoTuneMiners(t *testing.T) {
+	best, rates, err := AutoTuneMiners("fake", 4, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best < 1 || best > 4 || rates[best] <= 0 {
+		t.Errorf("unexpected tuning %d miners, rates %v", best, rates)
+	}
+	for n, rate := range rates {
+		if rate > rates[best] {
+			t.Errorf("exp %d miners to be the best, %d miners hash %f/s", best, n, rate)
+		}
+	}
+
+	if _, _, err := AutoTuneMiners("gpu", 4, time.Millisecond); err == nil {
+		t.Error("exp an unknown backend to be an error")
+	}
+}
+
+func BenchmarkHashers(b *testing.B) {
+	opr.InitLX()
+	oprhash := make([]byte, 32)
+	nonces := make([][]byte, DefaultHashBatch)
+	n := NewNonceIncrementer(0)
+	for i := range nonces {
+		n.NextNonce()
+		nonces[i] = append([]byte{}, n.Nonce...)
+	}
+	difficulties := make([]uint64, len(nonces))
+	for _, backend := range []string{"lxr", "fake"} {
+		h, _ := NewHasher(backend)
+		b.Run(backend, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				h.Difficulties(oprhash, nonces, difficulties)
+			}
+		})
+	}
+}
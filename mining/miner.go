@@ -48,6 +48,10 @@ type PegnetMiner struct {
 
 	// Tells us we are paused
 	paused bool
+
+	// Hasher computes the difficulties of the nonces, BatchSize at a time
+	Hasher    Hasher `json:"-"`
+	BatchSize int    `json:"-"`
 }
 
 type oprMiningState struct {
@@ -122,6 +126,9 @@ func NewPegnetMinerFromConfig(c *config.Config, id int, commands <-chan *MinerCo
 	p.ResetNonce()
 	p.MiningState.rankings = opr.NewNonceRanking(p.MiningState.keep)
 
+	p.Hasher = new(LXRHasher)
+	p.BatchSize = DefaultHashBatch
+
 	return p
 }
 
@@ -137,6 +144,10 @@ func (p *PegnetMiner) Mine(ctx context.Context) {
 		return // Cancelled
 	}
 
+	// The nonces of a batch, and their difficulties
+	nonces := make([][]byte, p.BatchSize)
+	difficulties := make([]uint64, p.BatchSize)
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -152,17 +163,17 @@ func (p *PegnetMiner) Mine(ctx context.Context) {
 			continue
 		}
 
-		p.MiningState.NextNonce()
-
-		p.MiningState.stats.TotalHashes++
-		diff := opr.ComputeDifficulty(p.MiningState.oprhash, p.MiningState.Nonce)
-		if diff > p.MiningState.minimumDifficulty && p.MiningState.rankings.AddNonce(p.MiningState.Nonce, diff) {
-			p.MiningState.stats.NewDifficulty(diff)
-			//mineLog.WithFields(log.Fields{
-			//	"oprhash": fmt.Sprintf("%x", p.MiningState.oprhash),
-			//	"Nonce":   fmt.Sprintf("%x", p.MiningState.Nonce),
-			//	"diff":    diff,
-			//}).Debugf("new Nonce")
+		for i := range nonces {
+			p.MiningState.NextNonce()
+			nonces[i] = append(nonces[i][:0], p.MiningState.Nonce...)
+		}
+		p.Hasher.Difficulties(p.MiningState.oprhash, nonces, difficulties)
+
+		p.MiningState.stats.TotalHashes += int64(len(nonces))
+		for i, diff := range difficulties {
+			if diff > p.MiningState.minimumDifficulty && p.MiningState.rankings.AddNonce(nonces[i], diff) {
+				p.MiningState.stats.NewDifficulty(diff)
+			}
 		}
 	}
 
@@ -182,6 +193,7 @@ func (p *PegnetMiner) HandleCommand(c *MinerCommand) {
 		p.MiningState.rankings = opr.NewNonceRanking(p.MiningState.keep)
 		p.MiningState.stats = NewSingleMinerStats()
 		p.MiningState.stats.ID = p.ID
+		p.MiningState.stats.Backend = p.Hasher.Name()
 		p.MiningState.stats.Start = time.Now()
 	case MinimumAccept:
 		p.MiningState.minimumDifficulty = c.Data.(uint64)
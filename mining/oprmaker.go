@@ -53,7 +53,12 @@ func (b *BlockingOPRMaker) RecOPR(opr *opr.OraclePriceRecord) {
 }
 
 func (b *BlockingOPRMaker) NewOPR(ctx context.Context, minerNumber int, dbht int32, config *config.Config, alert chan *opr.OPRs) (*opr.OraclePriceRecord, error) {
-	o := <-b.n
+	var o *opr.OraclePriceRecord
+	select {
+	case o = <-b.n:
+	case <-ctx.Done():
+		return nil, context.Canceled
+	}
 	if o == nil {
 		return nil, fmt.Errorf("opr failed to be created")
 	}
@@ -198,6 +198,15 @@ func (g *GroupMinerStats) AvgHashRatePerMiner() float64 {
 	return acc / totalDur.Seconds()
 }
 
+// BackendHashRates is the sum of the hashrate of the miners using each hash backend
+func (g *GroupMinerStats) BackendHashRates() map[string]float64 {
+	rates := make(map[string]float64)
+	for _, m := range g.Miners {
+		rates[m.Backend] += m.HashRate()
+	}
+	return rates
+}
+
 // AvgDurationPerMiner is the average duration of mining across all miners.
 func (g *GroupMinerStats) AvgDurationPerMiner() time.Duration {
 	var totalDur time.Duration
@@ -219,6 +228,12 @@ func (g *GroupMinerStats) LogFields() log.Fields {
 		"avg_duration":   fmt.Sprintf("%s", g.AvgDurationPerMiner()),
 	}
 
+	for backend, rate := range g.BackendHashRates() {
+		if backend != "" {
+			f[backend+"_hashrate"] = fmt.Sprintf("%s/s", humanize.FormatFloat("", rate))
+		}
+	}
+
 	for k, v := range g.Tags {
 		f[k] = v
 	}
@@ -232,6 +247,7 @@ type SingleMinerStats struct {
 	BestDifficulty uint64    `json:"bestdifficulty"`
 	Start          time.Time `json:"start"`
 	Stop           time.Time `json:"stop"`
+	Backend        string    `json:"backend"` // The hash backend of the miner
 }
 
 func NewSingleMinerStats() *SingleMinerStats {
@@ -239,6 +255,15 @@ func NewSingleMinerStats() *SingleMinerStats {
 	return s
 }
 
+// HashRate is the hashes per second of the miner
+func (s *SingleMinerStats) HashRate() float64 {
+	elapsed := s.Stop.Sub(s.Start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(s.TotalHashes) / elapsed
+}
+
 func (s *SingleMinerStats) NewDifficulty(diff uint64) {
 	if diff > s.BestDifficulty {
 		s.BestDifficulty = diff
@@ -2,6 +2,7 @@ package mining_test
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/pegnet/pegnet/mining"
 )
@@ -35,6 +36,20 @@ func TestStats(t *testing.T) {
 
 }
 
+func TestGroupMinerStats_BackendHashRates(t *testing.T) {
+	start := time.Now()
+	g := NewGroupMinerStats("main", 10)
+	g.Miners[0] = &SingleMinerStats{ID: 0, Backend: "lxr", TotalHashes: 100, Start: start, Stop: start.Add(time.Second)}
+	g.Miners[1] = &SingleMinerStats{ID: 1, Backend: "lxr", TotalHashes: 300, Start: start, Stop: start.Add(2 * time.Second)}
+	g.Miners[2] = &SingleMinerStats{ID: 2, Backend: "gpu", TotalHashes: 500, Start: start, Stop: start.Add(time.Second)}
+	g.Miners[3] = &SingleMinerStats{ID: 3, Backend: "fake", Start: start, Stop: start} // Never mined
+
+	rates := g.BackendHashRates()
+	if rates["lxr"] != 250 || rates["gpu"] != 500 || rates["fake"] != 0 {
+		t.Errorf("unexpected backend hashrates %v", rates)
+	}
+}
+
 func verifyOrder(gs []*StatisticBucket) bool {
 	for i := 1; i < len(gs); i++ {
 		if gs[i].BlockHeight > gs[i-1].BlockHeight {
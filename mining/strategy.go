@@ -0,0 +1,243 @@
+package mining
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/opr"
+	log "github.com/sirupsen/logrus"
+	"github.com/zpatrick/go-config"
+)
+
+const (
+	// ECPriceUSD is the price of an entry credit, which factom pegs at a tenth of a cent
+	ECPriceUSD = 0.001
+	// DifficultyPlaces is how many oprs, by difficulty, make it into grading
+	DifficultyPlaces = 50
+	// DefaultStrategyBlocks is how many graded blocks the adaptive strategy learns from
+	DefaultStrategyBlocks = 72
+)
+
+// SubmissionDecision is how many records to write for a block, and the minimum
+// difficulty a record needs to be worth writing
+type SubmissionDecision struct {
+	Height            int64
+	Records           int
+	MinimumDifficulty uint64
+
+	NetworkHashRate float64 // The average effective hashrate of the network, in hashes/s
+	ExpectedReward  float64 // The expected PEG the records win
+	ExpectedValue   float64 // The expected reward less the ECs spent, in USD
+}
+
+// SubmissionStrategy decides the records to write for a block from the difficulties of
+// the last graded blocks. A record is worth writing if its expected reward is worth more
+// than the EC it costs.
+type SubmissionStrategy struct {
+	Store      opr.IOPRBlockStore
+	Network    string
+	Blocks     int // The number of graded blocks to learn from
+	MaxRecords int // The most records to write for a block
+}
+
+func NewSubmissionStrategy(store opr.IOPRBlockStore, network string, blocks, maxRecords int) *SubmissionStrategy {
+	s := new(SubmissionStrategy)
+	s.Store = store
+	s.Network = network
+	s.Blocks = blocks
+	s.MaxRecords = maxRecords
+	return s
+}
+
+// NewSubmissionStrategyFromConfig returns the adaptive strategy if the config asks for
+// it, or nil for the static cutoff
+func NewSubmissionStrategyFromConfig(c *config.Config, store opr.IOPRBlockStore) (*SubmissionStrategy, error) {
+	strategy, _ := c.String(common.ConfigSubmissionStrategy)
+	switch strategy {
+	case "", "static":
+		return nil, nil
+	case "adaptive":
+	default:
+		return nil, fmt.Errorf("submission strategy %q is not static or adaptive", strategy)
+	}
+
+	network, err := common.LoadConfigNetwork(c)
+	if err != nil {
+		return nil, err
+	}
+	records, err := c.Int("Miner.RecordsPerBlock")
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := c.Int(common.ConfigStrategyBlocks)
+	if err != nil || blocks <= 0 {
+		blocks = DefaultStrategyBlocks
+	}
+	return NewSubmissionStrategy(store, network, blocks, records), nil
+}
+
+// Cutoffs returns the difficulty it took to make it into grading in each of the last
+// graded blocks before the height, and the usd price of PEG in the latest of them.
+// Blocks with fewer than 50 records have a cutoff of 0.
+func (s *SubmissionStrategy) Cutoffs(height int64) (cutoffs []uint64, pegPrice float64) {
+	for h := height - 1; h >= 0 && h >= height-int64(s.Blocks); h-- {
+		block, err := s.Store.FetchOPRBlock(h)
+		if err != nil || block == nil || block.EmptyOPRBlock || len(block.GradedOPRs) == 0 {
+			continue
+		}
+		if pegPrice == 0 {
+			pegPrice = block.GradedOPRs[0].Assets.Value("PEG")
+		}
+
+		var cutoff uint64
+		if len(block.OPRs) >= DifficultyPlaces {
+			difficulties := make([]uint64, len(block.OPRs))
+			for i, o := range block.OPRs {
+				difficulties[i] = o.Difficulty
+			}
+			sort.Slice(difficulties, func(i, j int) bool { return difficulties[i] > difficulties[j] })
+			cutoff = difficulties[DifficultyPlaces-1]
+		}
+		cutoffs = append(cutoffs, cutoff)
+	}
+	return cutoffs, pegPrice
+}
+
+// Decide decides the records to write at the height, given our hashrate in hashes/s.
+// Without a hashrate, every record over the minimum difficulty is written. It returns
+// nil if there is not enough history to decide on.
+func (s *SubmissionStrategy) Decide(height int64, hashrate float64) *SubmissionDecision {
+	cutoffs, pegPrice := s.Cutoffs(height)
+	if len(cutoffs) == 0 || pegPrice <= 0 {
+		return nil
+	}
+
+	// The reward of a record that makes it into grading, on average
+	var paid int
+	var reward float64
+	for place := 0; place < DifficultyPlaces; place++ {
+		r := opr.GetRewardFromPlace(place, s.Network, height)
+		if r <= 0 {
+			break
+		}
+		paid++
+		reward += float64(r) / 1e8
+	}
+	if paid == 0 {
+		return nil
+	}
+	graded := reward / DifficultyPlaces // The expected PEG of a record in grading
+	value := graded * pegPrice          // in usd
+
+	d := new(SubmissionDecision)
+	d.Height = height
+	var rates []float64
+	for _, c := range cutoffs {
+		if c > 0 {
+			rates = append(rates, opr.EffectiveHashRate(c, DifficultyPlaces))
+		}
+	}
+	for _, r := range rates {
+		d.NetworkHashRate += r / float64(len(rates))
+	}
+
+	// The lowest difficulty whose chance to make it into grading pays for its EC
+	d.MinimumDifficulty = minimumDifficulty(func(difficulty uint64) bool {
+		return gradingChance(rates, len(cutoffs), difficulty)*value >= ECPriceUSD
+	})
+
+	// Our i-th best record makes it if at least i of our hashes beat the cutoff, and
+	// costs an EC if at least i of our hashes beat the minimum difficulty
+	d.Records = s.MaxRecords
+	if hashrate > 0 {
+		hashes := hashrate * opr.MiningPeriod
+		d.Records = 0
+		for i := 1; i <= s.MaxRecords; i++ {
+			var win, write float64
+			for _, c := range cutoffs {
+				if c < d.MinimumDifficulty {
+					c = d.MinimumDifficulty
+				}
+				win += poissonAtLeast(hashes*above(c), i) / float64(len(cutoffs))
+			}
+			write = poissonAtLeast(hashes*above(d.MinimumDifficulty), i)
+			ev := win*value - write*ECPriceUSD
+			if ev <= 0 {
+				break // Every worse record is worth even less
+			}
+			d.Records = i
+			d.ExpectedReward += win * graded
+			d.ExpectedValue += ev
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"height":           height,
+		"blocks":           len(cutoffs),
+		"records":          d.Records,
+		"mindiff":          fmt.Sprintf("%x", d.MinimumDifficulty),
+		"network_hashrate": fmt.Sprintf("%.0f/s", d.NetworkHashRate),
+		"hashrate":         fmt.Sprintf("%.0f/s", hashrate),
+		"peg_price":        pegPrice,
+		"exp_reward":       fmt.Sprintf("%.4f PEG", d.ExpectedReward),
+		"exp_value":        fmt.Sprintf("$%.6f", d.ExpectedValue),
+	}).Info("submission decision")
+	return d
+}
+
+// gradingChance is the chance a record of the difficulty is among the 50 most difficult,
+// averaged over the network hashrates of the blocks. Blocks without a cutoff, having
+// fewer than 50 records, always let it in.
+func gradingChance(rates []float64, blocks int, difficulty uint64) float64 {
+	chance := float64(blocks - len(rates)) // Blocks without a cutoff
+	for _, rate := range rates {
+		// The number of network hashes beating the difficulty
+		chance += 1 - poissonAtLeast(rate*opr.MiningPeriod*above(difficulty), DifficultyPlaces)
+	}
+	return chance / float64(blocks)
+}
+
+// minimumDifficulty finds the lowest difficulty that is worth it, given it is worth it
+// for all difficulties above one that is
+func minimumDifficulty(worth func(difficulty uint64) bool) uint64 {
+	if worth(0) {
+		return 0
+	}
+	if !worth(math.MaxUint64) {
+		return math.MaxUint64
+	}
+	lo, hi := uint64(0), uint64(math.MaxUint64)
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if worth(mid) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi
+}
+
+// above is the chance a hash beats the difficulty
+func above(difficulty uint64) float64 {
+	return 1 - float64(difficulty)/math.Exp2(64)
+}
+
+// poissonAtLeast is the chance of at least k events, expecting lambda
+func poissonAtLeast(lambda float64, k int) float64 {
+	if k <= 0 {
+		return 1
+	}
+	term := math.Exp(-lambda)
+	sum := term
+	for j := 1; j < k; j++ {
+		term *= lambda / float64(j)
+		sum += term
+	}
+	if sum > 1 {
+		return 0
+	}
+	return 1 - sum
+}
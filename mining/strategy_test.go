@@ -0,0 +1,90 @@
+package mining_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+	. "github.com/pegnet/pegnet/mining"
+	"github.com/pegnet/pegnet/opr"
+)
+
+// strategyStore is a store of graded blocks below the height, each with 50 oprs mined
+// by a network of the hashrate, where PEG is worth the price in usd
+func strategyStore(t *testing.T, height int64, blocks int, hashrate, pegPrice float64) opr.IOPRBlockStore {
+	store := opr.NewOPRBlockStore(database.NewMapDb())
+	batch := database.NewBatch()
+	cutoff := opr.ExpectedMinimumDifficulty(hashrate, DifficultyPlaces)
+	for h := height - int64(blocks); h < height; h++ {
+		block := &opr.OprBlock{Dbht: h, TotalNumberRecords: DifficultyPlaces}
+		for i := 0; i < DifficultyPlaces; i++ {
+			o := opr.NewOraclePriceRecord()
+			o.Dbht = int32(h)
+			o.Assets = opr.OraclePriceRecordAssetList{"PEG": uint64(pegPrice * 1e8)}
+			o.Difficulty = cutoff + uint64(DifficultyPlaces-1-i)*(math.MaxUint64-cutoff)/DifficultyPlaces
+			block.GradedOPRs = append(block.GradedOPRs, o)
+		}
+		if err := store.WriteOPRBlock(batch, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.DB.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSubmissionStrategy_Decide(t *testing.T) {
+	const height, network = 1000, 1e6
+
+	t.Run("no history", func(t *testing.T) {
+		s := NewSubmissionStrategy(opr.NewOPRBlockStore(database.NewMapDb()), common.TestNetwork, 10, 5)
+		if d := s.Decide(height, network); d != nil {
+			t.Errorf("exp no decision without history, found %v", d)
+		}
+	})
+
+	valuable := NewSubmissionStrategy(strategyStore(t, height, 10, network, 1), common.TestNetwork, 10, 5)
+	cheap := NewSubmissionStrategy(strategyStore(t, height, 10, network, 1e-5), common.TestNetwork, 10, 5)
+	worthless := NewSubmissionStrategy(strategyStore(t, height, 10, network, 1e-8), common.TestNetwork, 10, 5)
+
+	t.Run("valuable", func(t *testing.T) {
+		d := valuable.Decide(height, 0)
+		if d == nil {
+			t.Fatal("exp a decision")
+		}
+		if d.Records != 5 {
+			t.Errorf("exp every record without a hashrate, found %d", d.Records)
+		}
+		if d.NetworkHashRate < network/2 || d.NetworkHashRate > network*2 {
+			t.Errorf("exp a network hashrate near %.0f, found %.0f", network, d.NetworkHashRate)
+		}
+
+		// A miner with the hashrate of the network expects a record in every block
+		d = valuable.Decide(height, network)
+		if d.Records == 0 || d.ExpectedValue <= 0 || d.ExpectedReward <= 0 {
+			t.Errorf("exp records of value, found %d records of $%f", d.Records, d.ExpectedValue)
+		}
+	})
+
+	t.Run("cheap", func(t *testing.T) {
+		v, c := valuable.Decide(height, network), cheap.Decide(height, network)
+		if c.MinimumDifficulty <= v.MinimumDifficulty {
+			t.Errorf("exp a cheaper PEG to raise the minimum difficulty, %x <= %x", c.MinimumDifficulty, v.MinimumDifficulty)
+		}
+		if c.Records > v.Records {
+			t.Errorf("exp a cheaper PEG to write no more records, %d > %d", c.Records, v.Records)
+		}
+	})
+
+	t.Run("worthless", func(t *testing.T) {
+		d := worthless.Decide(height, network)
+		if d.Records != 0 {
+			t.Errorf("exp no records worth their EC, found %d", d.Records)
+		}
+		if d.MinimumDifficulty != math.MaxUint64 {
+			t.Errorf("exp no difficulty to be worth it, found %x", d.MinimumDifficulty)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package networkMiner
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/pegnet/pegnet/common"
+	"github.com/zpatrick/go-config"
+)
+
+// Credentials are the secrets of the miners allowed to connect to a coordinator
+type Credentials struct {
+	// secrets are the per miner secrets, by user
+	secrets map[string]string
+	// shared is the secret of any user without their own. Empty if there is none.
+	shared string
+}
+
+// LoadCredentials reads the per miner credentials, as a comma separated list of
+// user:secret pairs, and the shared secret from the config
+func LoadCredentials(config *config.Config) (*Credentials, error) {
+	c := new(Credentials)
+	c.secrets = make(map[string]string)
+	c.shared, _ = config.String(common.ConfigCoordinatorSecret)
+
+	list, _ := config.String(common.ConfigCoordinatorCredentials)
+	for _, pair := range strings.Split(list, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.Index(pair, ":")
+		if i <= 0 || i == len(pair)-1 {
+			return nil, fmt.Errorf("credential %q is not a user:secret pair", pair)
+		}
+		user := pair[:i]
+		if _, ok := c.secrets[user]; ok {
+			return nil, fmt.Errorf("user %s has more than one credential", user)
+		}
+		c.secrets[user] = pair[i+1:]
+	}
+
+	// Per miner credentials replace the shared secret
+	if len(c.secrets) > 0 {
+		c.shared = ""
+	}
+	if len(c.secrets) == 0 && c.shared == "" {
+		return nil, fmt.Errorf("no credentials, set %s or %s", common.ConfigCoordinatorCredentials, common.ConfigCoordinatorSecret)
+	}
+	return c, nil
+}
+
+// Secret returns the secret of the user
+func (c *Credentials) Secret(user string) (string, bool) {
+	if secret, ok := c.secrets[user]; ok {
+		return secret, true
+	}
+	return c.shared, c.shared != ""
+}
+
+// Verify checks the response to the challenge is from the user
+func (c *Credentials) Verify(user, challenge, response string) bool {
+	secret, ok := c.Secret(user)
+	if !ok {
+		return false
+	}
+	return hmac.Equal([]byte(ChallengeResponse(secret, challenge)), []byte(response))
+}
+
+// ChallengeResponse is the hex hmac-sha256 of the challenge, keyed by the secret
+func ChallengeResponse(secret, challenge string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(challenge))
+	return fmt.Sprintf("%x", mac.Sum(nil))
+}
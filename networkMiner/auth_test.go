@@ -0,0 +1,73 @@
+package networkMiner_test
+
+import (
+	"testing"
+
+	"github.com/pegnet/pegnet/common"
+	. "github.com/pegnet/pegnet/networkMiner"
+	"github.com/zpatrick/go-config"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	if v, err := NegotiateVersion(NewHello("")); err != nil || v != ProtocolVersion {
+		t.Errorf("exp version %d, found %d %v", ProtocolVersion, v, err)
+	}
+	// A newer miner that still speaks our version
+	if v, err := NegotiateVersion(Hello{Version: ProtocolVersion + 3, MinVersion: MinProtocolVersion}); err != nil || v != ProtocolVersion {
+		t.Errorf("exp version %d, found %d %v", ProtocolVersion, v, err)
+	}
+
+	for _, hello := range []Hello{
+		{Version: MinProtocolVersion - 1, MinVersion: 1},                // Too old
+		{Version: ProtocolVersion + 2, MinVersion: ProtocolVersion + 1}, // Too new
+		{Version: ProtocolVersion, MinVersion: ProtocolVersion + 1},     // Nonsense
+		{}, // Not a hello
+	} {
+		if _, err := NegotiateVersion(hello); err == nil {
+			t.Errorf("exp %+v to be incompatible", hello)
+		}
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	load := func(settings map[string]string) (*Credentials, error) {
+		return LoadCredentials(config.NewConfig([]config.Provider{config.NewStatic(settings)}))
+	}
+
+	shared, err := load(map[string]string{common.ConfigCoordinatorSecret: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !shared.Verify("anyone", "challenge", ChallengeResponse("hunter2", "challenge")) {
+		t.Error("exp the shared secret to be accepted for any user")
+	}
+	if shared.Verify("anyone", "challenge", ChallengeResponse("hunter2", "other")) {
+		t.Error("exp a response to another challenge to be rejected")
+	}
+
+	perMiner, err := load(map[string]string{
+		common.ConfigCoordinatorSecret:      "hunter2",
+		common.ConfigCoordinatorCredentials: "rig1:one, rig2:two:three",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !perMiner.Verify("rig1", "c", ChallengeResponse("one", "c")) || !perMiner.Verify("rig2", "c", ChallengeResponse("two:three", "c")) {
+		t.Error("exp each miner to be accepted with its own secret")
+	}
+	if perMiner.Verify("rig1", "c", ChallengeResponse("two:three", "c")) {
+		t.Error("exp a miner to be rejected with the secret of another")
+	}
+	if perMiner.Verify("rig3", "c", ChallengeResponse("hunter2", "c")) {
+		t.Error("exp the shared secret to be replaced by the per miner credentials")
+	}
+
+	for _, bad := range []string{"rig1", "rig1:", ":secret", "rig1:a,rig1:b"} {
+		if _, err := load(map[string]string{common.ConfigCoordinatorCredentials: bad}); err == nil {
+			t.Errorf("exp %q to be invalid", bad)
+		}
+	}
+	if _, err := load(map[string]string{}); err == nil {
+		t.Error("exp an error without any credentials")
+	}
+}
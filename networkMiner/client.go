@@ -2,10 +2,11 @@ package networkMiner
 
 import (
 	"context"
-	"crypto/sha256"
+	"crypto/tls"
 	"encoding/gob"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/FactomProject/factom"
@@ -17,17 +18,43 @@ import (
 	config "github.com/zpatrick/go-config"
 )
 
+// DialTimeout is how long we wait on a coordinator before failing over to the next
+const DialTimeout = 5 * time.Second
+
+// RetryInterval is how long we wait to try all coordinators again, if none of them
+// are reachable
+const RetryInterval = 5 * time.Second
+
 // MiningClient talks to a coordinator. It receives events and trys to maintain
-// a connection
+// a connection. If the coordinator is lost, it fails over to the next one.
 type MiningClient struct {
 	config *config.Config
 
-	Host            string // Coordinator Location
+	Hosts           []string // Coordinator Locations, in order of preference
+	Host            string   // The coordinator we are connected to
 	FactomDigitalID string
+	User            string // The user we authenticate as
+
+	// Version is the protocol version negotiated with the coordinator, 0 until it is
+	Version   int
+	tlsConfig *tls.Config
 
 	Monitor  *common.FakeMonitor
 	Grader   *opr.FakeGrader
 	OPRMaker *mining.BlockingOPRMaker
+	// OPRSwitches has the opr of the coordinator we failed over to, if it was mining
+	OPRSwitches chan *opr.OraclePriceRecord
+
+	// Standalone mines without a coordinator until the context is cancelled. It is
+	// run while no coordinator is reachable. Nil if we just wait for one.
+	Standalone func(ctx context.Context)
+
+	// lastEvent is the last factom event from the coordinator, and failedOver is set
+	// if we lost the coordinator in the middle of mining a block. oprDbht is the
+	// height of the last opr our miners got.
+	lastEvent  common.MonitorEvent
+	failedOver bool
+	oprDbht    int32
 
 	entryChannel  chan *factom.Entry
 	UpstreamStats chan *mining.GroupMinerStats
@@ -42,10 +69,15 @@ func NewMiningClient(config *config.Config) *MiningClient {
 	s := new(MiningClient)
 	s.config = config
 
-	s.Host, err = config.String(common.ConfigCoordinatorLocation)
+	hosts, err := config.String(common.ConfigCoordinatorLocation)
 	if err != nil {
 		panic(err)
 	}
+	s.Hosts = ParseHosts(hosts)
+	if len(s.Hosts) == 0 {
+		panic(fmt.Errorf("no coordinator in %s", common.ConfigCoordinatorLocation))
+	}
+	s.Host = s.Hosts[0]
 
 	s.entryChannel = make(chan *factom.Entry, 25)
 	b := balances.NewBalanceTracker()
@@ -53,6 +85,7 @@ func NewMiningClient(config *config.Config) *MiningClient {
 	s.Monitor = common.NewFakeMonitor()
 	s.Grader = opr.NewFakeGrader(config, b)
 	s.OPRMaker = mining.NewBlockingOPRMaker()
+	s.OPRSwitches = make(chan *opr.OraclePriceRecord, 1)
 
 	// We need to put our data in it
 	id, err := config.String("Miner.IdentityChain")
@@ -61,6 +94,13 @@ func NewMiningClient(config *config.Config) *MiningClient {
 	}
 	s.FactomDigitalID = id
 
+	// Without a user, the coordinator knows us by our certificate or its shared secret
+	s.User, _ = config.String(common.ConfigCoordinatorUser)
+	s.tlsConfig, err = MinerTLSConfig(config, s.Host)
+	if err != nil {
+		panic(err)
+	}
+
 	return s
 }
 
@@ -68,15 +108,59 @@ func (c *MiningClient) Listeners() (common.IMonitor, opr.IGrader, mining.IOPRMak
 	return c.Monitor, c.Grader, c.OPRMaker
 }
 
+// ParseHosts splits the comma separated list of coordinators
+func ParseHosts(list string) []string {
+	var hosts []string
+	for _, host := range strings.Split(list, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// Connect connects to the first coordinator that is reachable, in order of preference
 func (c *MiningClient) Connect() error {
-	conn, err := net.Dial("tcp", c.Host)
+	var err error
+	for _, host := range c.Hosts {
+		if err = c.connect(host); err == nil {
+			return nil
+		}
+		log.WithField("host", host).WithError(err).Warn("failed to connect to coordinator")
+	}
+	return err
+}
+
+func (c *MiningClient) connect(host string) error {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: DialTimeout}
+	if c.tlsConfig != nil {
+		// The coordinator's cert is checked against the host we dial
+		tlsConfig := c.tlsConfig.Clone()
+		tlsConfig.ServerName = host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			tlsConfig.ServerName = h
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
 	if err != nil {
 		return err
 	}
-	log.Infof("Connected to %s", c.Host)
+	log.WithField("tls", c.tlsConfig != nil).Infof("Connected to %s", host)
+	c.Host = host
 	c.conn = conn
+	c.Version = 0
 	c.initCoders()
 
+	// The coordinator won't listen to anything else until we negotiated the protocol version
+	err = c.encoder.Encode(NewNetworkMessage(ProtocolHello, NewHello(c.User)))
+	if err != nil {
+		return fmt.Errorf("hello: %s", err.Error())
+	}
+
 	// Send over our tags
 	err = c.encoder.Encode(NewNetworkMessage(AddTag, Tag{
 		Key:   "id",
@@ -90,21 +174,41 @@ func (c *MiningClient) Connect() error {
 	return nil
 }
 
-// ConnectionLost will put us into a holding pattern to reconnect
+// ConnectionLost fails over to the next coordinator that is reachable. If none are, it
+// mines standalone if it can, and keeps trying until one is back.
 func (c *MiningClient) ConnectionLost(err error) {
-	log.WithTime(time.Now()).WithFields(log.Fields{"host": c.Host, "time": time.Now().Format("15:04:05")}).WithError(err).Errorf("lost connection to host, retrying...")
+	log.WithTime(time.Now()).WithFields(log.Fields{"host": c.Host, "time": time.Now().Format("15:04:05")}).WithError(err).Errorf("lost connection to host, failing over...")
 
+	// If we were mining, we continue with the opr of the coordinator we fail over to
+	c.failedOver = c.lastEvent.Minute >= 1 && c.lastEvent.Minute < 9
+
+	var stopStandalone context.CancelFunc
 	// Endless try to reconnect
 	for {
-		time.Sleep(1 * time.Second)
 		err := c.Connect()
-		if err != nil {
-			log.WithFields(log.Fields{"host": c.Host, "time": time.Now().Format("15:04:05")}).WithError(err).Errorf("failed to reconnect, retrying...")
-			time.Sleep(5 * time.Second)
-			continue
+		if err == nil {
+			break
 		}
-		break
+		log.WithFields(log.Fields{"hosts": c.Hosts, "time": time.Now().Format("15:04:05")}).WithError(err).Errorf("failed to reach any coordinator, retrying...")
+
+		if c.Standalone != nil && stopStandalone == nil {
+			// Our miners wind down the block of the lost coordinator, and we mine on
+			// our own until a coordinator is back
+			c.lastEvent = common.MonitorEvent{Dbht: c.lastEvent.Dbht, Minute: 9}
+			c.Monitor.FakeNotifyEvt(c.lastEvent)
+			c.failedOver = false
+
+			var ctx context.Context
+			ctx, stopStandalone = context.WithCancel(context.Background())
+			go c.Standalone(ctx)
+			log.Warn("no coordinator is reachable, mining standalone until one is")
+		}
+		time.Sleep(RetryInterval)
+	}
 
+	if stopStandalone != nil {
+		stopStandalone()
+		log.WithField("host", c.Host).Info("stopped standalone mining, a coordinator is back")
 	}
 }
 
@@ -143,6 +247,7 @@ func (c *MiningClient) Listen(cancel context.CancelFunc) {
 		err := c.decoder.Decode(&m)
 		if err != nil {
 			c.ConnectionLost(fmt.Errorf("decode: %s", err.Error()))
+			continue
 		}
 
 		switch m.NetworkCommand {
@@ -154,6 +259,12 @@ func (c *MiningClient) Listen(cancel context.CancelFunc) {
 			}
 		case FactomEvent:
 			evt := m.Data.(common.MonitorEvent)
+			if evt == c.lastEvent {
+				// The coordinator we failed over to catches us up on an event we
+				// already have
+				continue
+			}
+			c.lastEvent = evt
 
 			// Drain anything that was left over
 			if evt.Minute == 1 {
@@ -187,40 +298,63 @@ func (c *MiningClient) Listen(cancel context.CancelFunc) {
 			evt.CoinbaseAddress = addr
 			evt.OPRHash = nil // Reset the oprhash since we changed some fields
 
+			failedOver := c.failedOver && c.oprDbht == evt.Dbht
+			c.failedOver = false
+			c.oprDbht = evt.Dbht
+			if failedOver {
+				// Our miners are mid block with the opr of the lost coordinator, so
+				// they switch to this one. Without one, they are still waiting on it.
+				select {
+				case c.OPRSwitches <- evt:
+				default:
+				}
+				continue
+			}
 			c.OPRMaker.RecOPR(evt)
 		case Ping:
 			err := c.encoder.Encode(NewNetworkMessage(Pong, nil))
 			if err != nil {
 				fLog.WithField("evt", "ping").WithError(err).Error("failed to pong")
 			}
-		case SecretChallenge:
-			// Respond to the challenge with our secret
-			challenge, ok := m.Data.(AuthenticationChallenge)
-			if !ok {
-				fLog.Errorf("server did not send a proper challenge")
+		case ProtocolWelcome:
+			welcome, ok := m.Data.(Welcome)
+			if !ok || welcome.Version < MinProtocolVersion || welcome.Version > ProtocolVersion {
+				fLog.Errorf("server did not send a proper welcome")
 				cancel() // Cancel mining
 				return
 			}
+			c.Version = welcome.Version
+			fLog.WithFields(log.Fields{"protocol": c.Version, "user": c.User}).Info("negotiated the protocol with the coordinator")
+			if welcome.Challenge == "" {
+				continue // No authentication
+			}
 
+			// Respond to the challenge with our secret
 			secret, err := c.config.String(common.ConfigCoordinatorSecret)
 			if err != nil {
 				// Do not return here, let the empty secret fail the challenge.
 				fLog.WithError(err).Errorf("client is missing coordinator secret")
 			}
-
-			// Challenge Resp is sha256(secret+challenge)
-			resp := sha256.Sum256([]byte(secret + challenge.Challenge))
-			challenge.Response = fmt.Sprintf("%x", resp)
+			challenge := AuthenticationChallenge{Challenge: welcome.Challenge}
+			challenge.Response = ChallengeResponse(secret, challenge.Challenge)
 			err = c.encoder.Encode(NewNetworkMessage(SecretChallenge, challenge))
 			if err != nil {
 				fLog.WithError(err).Errorf("failed to respond to challenge")
 				cancel()
 				return
 			}
+		case SecretChallenge:
+			// Only coordinators from before the version negotiation challenge us right away
+			fLog.Errorf("The coordinator does not negotiate the protocol version, it is older than this miner. " +
+				"Upgrade the coordinator, and try again.")
+			cancel()
+			return
 		case RejectedConnection:
-			// This means the server rejected us. Probably due to a failed challenge
-			fLog.Errorf("Our connection to the coordinator was rejected. This is most likely due to failing the " +
-				"authentication challenge. Ensure this miner has the same secret as the coordinator, and try again.")
+			// This means the server rejected us. Probably due to a failed challenge, or an
+			// incompatible version
+			reason, _ := m.Data.(string)
+			fLog.WithField("reason", reason).Errorf("Our connection to the coordinator was rejected. If the " +
+				"authentication challenge failed, ensure this miner has its secret of the coordinator, and try again.")
 			cancel()
 			return
 		case Pong:
@@ -0,0 +1,149 @@
+package networkMiner_test
+
+import (
+	"context"
+	"encoding/gob"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pegnet/pegnet/common"
+	. "github.com/pegnet/pegnet/networkMiner"
+	"github.com/pegnet/pegnet/opr"
+	"github.com/zpatrick/go-config"
+)
+
+func TestParseHosts(t *testing.T) {
+	hosts := ParseHosts(" primary:7777, ,backup:7777,")
+	if !reflect.DeepEqual(hosts, []string{"primary:7777", "backup:7777"}) {
+		t.Errorf("unexpected hosts %v", hosts)
+	}
+}
+
+func TestMiningClient_Failover(t *testing.T) {
+	// The primary coordinator is down
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down.Close()
+
+	backup, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	hello := make(chan Hello, 1)
+	go func() {
+		conn, err := backup.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var m NetworkMessage
+		if err := gob.NewDecoder(conn).Decode(&m); err == nil {
+			h, _ := m.Data.(Hello)
+			hello <- h
+		}
+	}()
+
+	c := config.NewConfig([]config.Provider{
+		common.NewUnitTestConfigProvider(),
+		config.NewStatic(map[string]string{
+			common.ConfigCoordinatorLocation: down.Addr().String() + "," + backup.Addr().String(),
+			common.ConfigCoordinatorUser:     "rig1",
+		}),
+	})
+	cl := NewMiningClient(c)
+	if err := cl.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if cl.Host != backup.Addr().String() {
+		t.Errorf("exp to fail over to %s, connected to %s", backup.Addr(), cl.Host)
+	}
+	if h := <-hello; h.User != "rig1" || h.Version != ProtocolVersion {
+		t.Errorf("exp the backup to get our hello, found %+v", h)
+	}
+
+	// With every coordinator down, connecting fails
+	backup.Close()
+	cl.Hosts = []string{down.Addr().String()}
+	if err := cl.Connect(); err == nil {
+		t.Error("exp an error without any reachable coordinator")
+	}
+}
+
+// fakeCoordinator accepts a single miner and sends it the messages
+func fakeCoordinator(t *testing.T, l net.Listener, msgs ...*NetworkMessage) {
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		enc := gob.NewEncoder(conn)
+		for _, m := range msgs {
+			if err := enc.Encode(m); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+}
+
+func TestMiningClient_FailoverMinuteOne(t *testing.T) {
+	primary, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+
+	// The primary dies at minute 1, before it sent the opr
+	minute1 := common.MonitorEvent{Dbht: 5, Minute: 1}
+	fakeCoordinator(t, primary, NewNetworkMessage(FactomEvent, minute1))
+	// The backup catches us up on minute 1 and its opr
+	fakeCoordinator(t, backup,
+		NewNetworkMessage(FactomEvent, minute1),
+		NewNetworkMessage(ConstructedOPR, opr.OraclePriceRecord{Dbht: 5}))
+
+	c := config.NewConfig([]config.Provider{
+		common.NewUnitTestConfigProvider(),
+		config.NewStatic(map[string]string{
+			common.ConfigCoordinatorLocation: primary.Addr().String() + "," + backup.Addr().String(),
+		}),
+	})
+	cl := NewMiningClient(c)
+	events := cl.Monitor.NewListener()
+	if err := cl.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	primary.Close()
+	go cl.Listen(func() {})
+
+	// Our miners are blocked on the opr at minute 1, so it has to go to them
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	o, err := cl.OPRMaker.NewOPR(ctx, 0, 5, c, nil)
+	if err != nil {
+		t.Fatalf("exp the opr of the backup, %s", err)
+	}
+	if o.Dbht != 5 {
+		t.Errorf("exp an opr for height 5, found %d", o.Dbht)
+	}
+	if len(cl.OPRSwitches) != 0 {
+		t.Error("exp no opr switch without an opr to switch from")
+	}
+
+	// The caught up minute 1 is not delivered twice
+	if evt := <-events; evt != minute1 {
+		t.Errorf("exp %+v, found %+v", minute1, evt)
+	}
+	if len(events) != 0 {
+		t.Errorf("exp minute 1 once, found %d more events", len(events))
+	}
+}
@@ -2,7 +2,6 @@ package networkMiner
 
 import (
 	"context"
-	"crypto/sha256"
 	"encoding/gob"
 	"errors"
 	"fmt"
@@ -32,8 +31,13 @@ const (
 	SecretChallenge
 	RejectedConnection // Sever rejected client
 	CoordinatorError
+	ProtocolHello   // Client says which protocol versions it speaks
+	ProtocolWelcome // Server replies with the negotiated version
 )
 
+// HelloTimeout is how long a client has to say hello after connecting
+const HelloTimeout = 10 * time.Second
+
 // Idk why the factom.entry does not work
 type GobbedEntry struct {
 	ChainID string   `json:"chainid"`
@@ -67,6 +71,8 @@ func init() {
 	gob.Register(Tag{})
 	gob.Register(AuthenticationChallenge{})
 	gob.Register(ErrorMessage{})
+	gob.Register(Hello{})
+	gob.Register(Welcome{})
 }
 
 // MiningServer is the coordinator to emit events to anyone listening
@@ -79,14 +85,23 @@ type MiningServer struct {
 
 	Server *TCPServer
 	EC     *factom.ECAddress
+	Factom common.FactomClient
 
 	Stats *mining.GlobalStatTracker
 
+	// Shares records the work of every client, if the coordinator keeps share accounting
+	Shares *ShareTracker
+
+	// The last factom event and the opr being mined, for clients that join mid block
+	stateLock  sync.Mutex
+	lastEvent  common.MonitorEvent
+	currentOPR *opr.OraclePriceRecord
+
 	clientsLock sync.Mutex
 	clients     map[int]*TCPClient
 	numClients  int
 	salt        int // Random salt on each boot
-	secret      string
+	credentials *Credentials
 	useAuth     bool
 }
 
@@ -99,6 +114,7 @@ func NewMiningServer(config *config.Config, monitor common.IMonitor, grader opr.
 	s.FactomMonitor = monitor
 	s.OPRGrader = grader
 	s.Stats = stats
+	s.Factom = common.DefaultFactomClient
 
 	s.Host, err = config.String(common.ConfigCoordinatorListen)
 	if err != nil {
@@ -108,7 +124,7 @@ func NewMiningServer(config *config.Config, monitor common.IMonitor, grader opr.
 	if ecadrStr, err := config.String("Miner.ECAddress"); err != nil {
 		log.WithError(err).Fatalf("missing ec addr in config")
 	} else {
-		ecAdr, err := factom.FetchECAddress(ecadrStr)
+		ecAdr, err := s.Factom.FetchECAddress(ecadrStr)
 		if err != nil {
 			log.WithError(err).Fatalf("could not fetch ec addr")
 		}
@@ -130,9 +146,19 @@ func NewMiningServer(config *config.Config, monitor common.IMonitor, grader opr.
 		log.WithError(err).Fatalf("missing coordinator use authentication in config")
 	}
 
-	s.secret, err = config.String(common.ConfigCoordinatorSecret)
+	if s.useAuth {
+		s.credentials, err = LoadCredentials(config)
+		if err != nil {
+			log.WithError(err).Fatalf("invalid coordinator credentials in config")
+		}
+	}
+
+	tlsConfig, err := CoordinatorTLSConfig(config)
 	if err != nil {
-		log.WithError(err).Fatalf("missing authentication secret in config")
+		log.WithError(err).Fatalf("invalid coordinator tls config")
+	}
+	if tlsConfig != nil {
+		s.Server.SetTLSConfig(tlsConfig)
 	}
 
 	return s
@@ -155,7 +181,7 @@ func (c *MiningServer) ForwardMonitorEvents() {
 			// If we do not have an EC balance, do not push events to start mining.
 			// Minute 1 is where we start mining, ensure we have some ECs.
 			if fds.Minute == 1 {
-				bal, err := factom.GetECBalance(c.EC.String())
+				bal, err := c.Factom.GetECBalance(c.EC.String())
 				if err != nil {
 					fLog.WithField("evt", "factom").WithError(err).Error("failed to send, balance query failed")
 					coordError := fmt.Errorf("balance query failed on net coordinator")
@@ -182,6 +208,13 @@ func (c *MiningServer) ForwardMonitorEvents() {
 			m.Data = fds
 			last = fds
 
+			c.stateLock.Lock()
+			c.lastEvent = fds
+			if fds.Minute == 1 {
+				c.currentOPR = nil // The new block gets a new opr
+			}
+			c.stateLock.Unlock()
+
 			c.SendToClients(m, fLog.WithField("evt", "factom"))
 			fLog.WithFields(log.Fields{
 				"height": fds.Dbht,
@@ -205,6 +238,9 @@ func (c *MiningServer) ForwardMonitorEvents() {
 				m.Data = nil
 			} else {
 				m.Data = *oprobject
+				c.stateLock.Lock()
+				c.currentOPR = oprobject
+				c.stateLock.Unlock()
 			}
 
 			c.SendToClients(m, fLog.WithField("evt", "opr"))
@@ -213,6 +249,26 @@ func (c *MiningServer) ForwardMonitorEvents() {
 	}
 }
 
+// TrackShares marks the shares that win as the grader pays them
+func (s *MiningServer) TrackShares(ctx context.Context) {
+	fLog := log.WithFields(log.Fields{"func": "TrackShares"})
+	alert := s.OPRGrader.GetAlert("pool-shares")
+	defer s.OPRGrader.StopAlert("pool-shares")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case winners, ok := <-alert:
+			if !ok {
+				return
+			}
+			if err := s.Shares.RecordWinners(winners); err != nil {
+				fLog.WithError(err).Error("failed to record the winning shares")
+			}
+		}
+	}
+}
+
 func (n *MiningServer) SendToClients(message *NetworkMessage, logger *log.Entry) {
 	n.clientsLock.Lock()
 	defer n.clientsLock.Unlock()
@@ -226,6 +282,20 @@ func (n *MiningServer) SendToClients(message *NetworkMessage, logger *log.Entry)
 
 // onNewMessage is when the client messages us.
 func (n *MiningServer) onNewMessage(c *TCPClient, message *NetworkMessage) {
+	if c.version == 0 {
+		// Nothing is accepted until the client negotiated the protocol version.
+		// Clients from before the negotiation won't say hello, and are turned away.
+		switch message.NetworkCommand {
+		case ProtocolHello:
+			n.onHello(c, message)
+		case Ping, Pong:
+		default:
+			n.Reject(c, fmt.Sprintf("the miner did not negotiate a protocol version, the coordinator speaks versions %d-%d. "+
+				"Upgrade the miner", MinProtocolVersion, ProtocolVersion))
+		}
+		return
+	}
+
 	if !c.accepted {
 		switch message.NetworkCommand {
 		case SecretChallenge, AddTag, Ping, Pong:
@@ -275,8 +345,14 @@ func (n *MiningServer) onNewMessage(c *TCPClient, message *NetworkMessage) {
 			err := n.WriteEntry(e)
 			if err != nil {
 				log.WithFields(n.Fields()).WithError(err).Errorf("failed to submit entry from client")
-			} else {
-				log.WithFields(n.Fields()).WithField("client", c.id).Debugf("submitted entry %x", e.Hash())
+				return
+			}
+			log.WithFields(n.Fields()).WithField("client", c.id).Debugf("submitted entry %x", e.Hash())
+
+			if n.Shares != nil {
+				if _, err := n.Shares.RecordShare(c.Name(), e); err != nil {
+					log.WithFields(n.Fields()).WithFields(c.LogFields()).WithError(err).Errorf("failed to record share of entry %x", e.Hash())
+				}
 			}
 		}()
 	case MiningStatistics:
@@ -289,6 +365,9 @@ func (n *MiningServer) onNewMessage(c *TCPClient, message *NetworkMessage) {
 		// Modify the stats so we know it came from us
 		g.ID = fmt.Sprintf("Net-%d", c.id)
 		g.Tags["src"] = c.conn.RemoteAddr().String()
+		if c.user != "" {
+			g.Tags["user"] = c.user
+		}
 
 		c.tagLock.Lock()
 		for k, v := range c.tags {
@@ -310,25 +389,13 @@ func (n *MiningServer) onNewMessage(c *TCPClient, message *NetworkMessage) {
 
 		// If the user is responding to another challenge, they are wrong.
 		if challengeResp.Challenge != challenge.Challenge {
-			err := c.SendNetworkCommand(NewNetworkMessage(RejectedConnection, "challenge data did not match expected"))
-			if err != nil {
-				log.WithFields(n.Fields()).WithError(err).Errorf("client failed challenge")
-			}
-			var _ = c.Close()
+			n.Reject(c, "challenge data did not match expected")
 			return
 		}
 
-		// Challenge Resp is sha256(secret+challenge)
-		resp := sha256.Sum256([]byte(n.secret + challenge.Challenge))
-		challenge.Response = fmt.Sprintf("%x", resp)
-
-		// Check the user's challenge response
-		if challengeResp.Response != challenge.Response {
-			err := c.SendNetworkCommand(NewNetworkMessage(RejectedConnection, "challenge response is incorrect"))
-			if err != nil {
-				log.WithFields(n.Fields()).WithError(err).Errorf("client failed challenge")
-			}
-			var _ = c.Close()
+		// Check the user's challenge response, it has to be from their secret
+		if !n.useAuth || !n.credentials.Verify(c.user, challenge.Challenge, challengeResp.Response) {
+			n.Reject(c, "challenge response is incorrect")
 			return
 		}
 
@@ -345,6 +412,61 @@ func (s *MiningServer) GetAuthenticationChallenge(c *TCPClient) AuthenticationCh
 	return AuthenticationChallenge{Challenge: fmt.Sprintf("%d%d", s.salt, c.id)}
 }
 
+// onHello negotiates the protocol version with the client, and challenges it if we
+// use authentication
+func (s *MiningServer) onHello(c *TCPClient, message *NetworkMessage) {
+	hello, ok := message.Data.(Hello)
+	if !ok {
+		s.Reject(c, "client did not send a proper hello")
+		return
+	}
+
+	v, err := NegotiateVersion(hello)
+	if err != nil {
+		s.Reject(c, err.Error())
+		return
+	}
+
+	// A verified client certificate names the miner
+	user := hello.User
+	if cn := c.PeerCommonName(); cn != "" {
+		if user != "" && user != cn {
+			s.Reject(c, fmt.Sprintf("user %s does not match the certificate of %s", user, cn))
+			return
+		}
+		user = cn
+	}
+	c.version = v
+	c.user = user
+	_ = c.conn.SetReadDeadline(time.Time{})
+
+	welcome := Welcome{Version: v}
+	if s.useAuth {
+		welcome.Challenge = s.GetAuthenticationChallenge(c).Challenge
+	}
+	err = c.SendNetworkCommand(NewNetworkMessage(ProtocolWelcome, welcome))
+	if err != nil {
+		log.WithFields(s.Fields()).WithError(err).WithField("func", "onHello").Error("failed to send welcome")
+		return
+	}
+
+	if s.useAuth {
+		log.WithFields(s.Fields()).WithFields(c.LogFields()).WithField("protocol", v).Info("Client pending challenge")
+		return
+	}
+	s.Accept(c)
+}
+
+// Reject tells the client why it is rejected, and closes the connection
+func (s *MiningServer) Reject(c *TCPClient, reason string) {
+	log.WithFields(s.Fields()).WithFields(c.LogFields()).WithField("reason", reason).Warn("Client rejected")
+	err := c.SendNetworkCommand(NewNetworkMessage(RejectedConnection, reason))
+	if err != nil {
+		log.WithFields(s.Fields()).WithError(err).Errorf("failed to send rejection")
+	}
+	var _ = c.Close()
+}
+
 func (s *MiningServer) onClientConnectionClosed(c *TCPClient, err error) {
 	s.clientsLock.Lock()
 	defer s.clientsLock.Unlock()
@@ -355,23 +477,12 @@ func (s *MiningServer) onClientConnectionClosed(c *TCPClient, err error) {
 }
 
 func (s *MiningServer) onNewClient(c *TCPClient) {
-	if s.useAuth {
-		challenge := s.GetAuthenticationChallenge(c)
-		err := c.SendNetworkCommand(NewNetworkMessage(SecretChallenge, challenge))
-		if err != nil {
-			log.WithFields(s.Fields()).WithError(err).WithField("func", "onNewClient").Error("failed to send challenge")
-			return
-		}
-		log.WithFields(s.Fields()).WithFields(c.LogFields()).Info("Client pending challenge")
-	} else {
-		err := c.SendNetworkCommand(NewNetworkMessage(Ping, nil))
-		if err != nil {
-			log.WithFields(s.Fields()).WithError(err).WithField("func", "onNewClient").Error("ping failed")
-			return
-		}
-
-		s.Accept(c)
+	// The client has to say hello first, and the rest waits on the negotiated version
+	err := c.conn.SetReadDeadline(time.Now().Add(HelloTimeout))
+	if err != nil {
+		log.WithFields(s.Fields()).WithError(err).WithField("func", "onNewClient").Error("failed to set the hello deadline")
 	}
+	log.WithFields(s.Fields()).WithFields(c.LogFields()).Info("Client pending hello")
 }
 
 func (s *MiningServer) Accept(c *TCPClient) {
@@ -382,12 +493,37 @@ func (s *MiningServer) Accept(c *TCPClient) {
 	s.clients[c.id] = c
 	s.numClients = len(s.clients)
 	log.WithFields(s.Fields()).WithFields(c.LogFields()).Info("Client connected")
+	s.catchUp(c)
+}
+
+// catchUp sends a client that joins mid block the last factom event and the opr being
+// mined. A miner that failed over from another coordinator then mines our opr right away.
+// The clients lock must be held, so nothing else is sent to the client meanwhile.
+func (s *MiningServer) catchUp(c *TCPClient) {
+	s.stateLock.Lock()
+	evt, current := s.lastEvent, s.currentOPR
+	s.stateLock.Unlock()
+
+	if evt.Dbht == 0 {
+		return // Nothing happened yet
+	}
+	fLog := log.WithFields(s.Fields()).WithFields(c.LogFields()).WithField("func", "catchUp")
+	if err := c.SendNetworkCommand(NewNetworkMessage(FactomEvent, evt)); err != nil {
+		fLog.WithError(err).Error("failed to send the last event")
+		return
+	}
+	if current == nil || current.Dbht != evt.Dbht {
+		return // Not mining
+	}
+	if err := c.SendNetworkCommand(NewNetworkMessage(ConstructedOPR, *current)); err != nil {
+		fLog.WithError(err).Error("failed to send the current opr")
+	}
 }
 
 func (s *MiningServer) WriteEntry(entry *factom.Entry) error {
 	operation := func() error {
-		_, err1 := factom.CommitEntry(entry, s.EC)
-		_, err2 := factom.RevealEntry(entry)
+		_, err1 := s.Factom.CommitEntry(entry, s.EC)
+		_, err2 := s.Factom.RevealEntry(entry)
 		if err1 == nil && err2 == nil {
 			return nil
 		}
@@ -0,0 +1,239 @@
+package networkMiner
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/FactomProject/factom"
+	"github.com/pegnet/pegnet/database"
+	"github.com/pegnet/pegnet/opr"
+)
+
+// Share is an opr a client submitted through the coordinator
+type Share struct {
+	Dbht       int64  `json:"dbht"`
+	Client     string `json:"client"`
+	EntryHash  []byte `json:"entryhash"`
+	Nonce      []byte `json:"nonce"`
+	Difficulty uint64 `json:"difficulty"`
+	Won        bool   `json:"won"`
+	Payout     int64  `json:"payout"` // The reward of the opr if it won, in PEG factoshis
+}
+
+// Work is the expected number of hashes it takes to find a nonce of the share's difficulty
+func (s *Share) Work() float64 {
+	return ExpectedHashes(s.Difficulty)
+}
+
+// ExpectedHashes is the expected number of hashes it takes to find a nonce of at least
+// the difficulty
+func ExpectedHashes(difficulty uint64) float64 {
+	miss := 1 - float64(difficulty)/math.Exp2(64)
+	if miss <= 0 {
+		return math.Exp2(64)
+	}
+	return 1 / miss
+}
+
+// ClientReport is the work and rewards of a client over a range of blocks
+type ClientReport struct {
+	Client string  `json:"client"`
+	Shares int     `json:"shares"` // The number of submitted oprs
+	Wins   int     `json:"wins"`   // The number of submitted oprs that were paid
+	Work   float64 `json:"work"`   // The expected hashes of the submitted oprs
+	Payout int64   `json:"payout"` // The rewards of the client's own winning oprs
+
+	// WorkShare is the fraction of the pool's work done by the client, and Split is
+	// that fraction of the pool's total payout
+	WorkShare float64 `json:"workshare"`
+	Split     int64   `json:"split"`
+}
+
+// PoolReport splits the rewards of the pool's winning oprs over a range of blocks by
+// the work each client did
+type PoolReport struct {
+	Start       int64           `json:"start"`
+	End         int64           `json:"end"`
+	Shares      int             `json:"shares"`
+	Work        float64         `json:"work"`
+	TotalPayout int64           `json:"totalpayout"`
+	Clients     []*ClientReport `json:"clients"`
+}
+
+// ShareTracker persists the shares of every client of the coordinator, and which of
+// them were paid by the grader
+type ShareTracker struct {
+	DB      database.IDatabase
+	Network string
+
+	// Shares of a block are read, appended to and written back
+	sync.Mutex
+}
+
+func NewShareTracker(db database.IDatabase, network string) *ShareTracker {
+	opr.InitLX() // Shares are checked against their difficulty
+	t := new(ShareTracker)
+	t.DB = db
+	t.Network = network
+	return t
+}
+
+// ParseShare checks the entry is an opr with a nonce of the self reported difficulty,
+// and returns it as a share of the client
+func ParseShare(client string, entry *factom.Entry) (*Share, error) {
+	if len(entry.ExtIDs) != 3 || len(entry.ExtIDs[1]) != 8 || len(entry.ExtIDs[2]) != 1 {
+		return nil, fmt.Errorf("entry is not an opr")
+	}
+
+	o := opr.NewOraclePriceRecord()
+	o.Version = entry.ExtIDs[2][0]
+	if err := o.SafeUnmarshal(entry.Content); err != nil {
+		return nil, fmt.Errorf("opr content: %s", err.Error())
+	}
+
+	share := new(Share)
+	share.Dbht = int64(o.Dbht)
+	share.Client = client
+	share.EntryHash = entry.Hash()
+	share.Nonce = entry.ExtIDs[0]
+	share.Difficulty = binary.BigEndian.Uint64(entry.ExtIDs[1])
+
+	oprHash := sha256.Sum256(entry.Content)
+	if found := opr.ComputeDifficulty(oprHash[:], share.Nonce); found != share.Difficulty {
+		return nil, fmt.Errorf("self reported difficulty %d does not match the nonce difficulty %d", share.Difficulty, found)
+	}
+	return share, nil
+}
+
+// RecordShare persists the entry a client submitted as one of its shares
+func (t *ShareTracker) RecordShare(client string, entry *factom.Entry) (*Share, error) {
+	share, err := ParseShare(client, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	shares, err := t.fetch(share.Dbht)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range shares {
+		if string(s.EntryHash) == string(share.EntryHash) {
+			return s, nil // Already have it
+		}
+	}
+	return share, t.write(share.Dbht, append(shares, share))
+}
+
+// RecordWinners marks the shares that the grader paid, with their reward
+func (t *ShareTracker) RecordWinners(winners *opr.OPRs) error {
+	if winners == nil || len(winners.ToBePaid) == 0 {
+		return nil
+	}
+	dbht := int64(winners.ToBePaid[0].Dbht)
+
+	t.Lock()
+	defer t.Unlock()
+	shares, err := t.fetch(dbht)
+	if err != nil || len(shares) == 0 {
+		return err
+	}
+
+	for _, s := range shares {
+		s.Won, s.Payout = false, 0
+		for place, w := range winners.ToBePaid {
+			if string(s.EntryHash) == string(w.EntryHash) {
+				s.Won = true
+				s.Payout = opr.GetRewardFromPlace(place, t.Network, dbht)
+				break
+			}
+		}
+	}
+	return t.write(dbht, shares)
+}
+
+// Shares returns the shares of all clients in the range [start, end]. Only the heights
+// with shares are read, so the range can be as wide as the chain.
+func (t *ShareTracker) Shares(start, end int64) ([]*Share, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	var all []*Share
+	iter := t.DB.IterateRange(database.BUCKET_POOL_SHARES, database.HeightToBytes(start), database.HeightToBytes(end+1))
+	defer iter.Release()
+	for iter.Next() {
+		var shares []*Share
+		if err := database.Decode(&shares, iter.Value()); err != nil {
+			return nil, fmt.Errorf("shares at %x: %s", iter.Key(), err.Error())
+		}
+		all = append(all, shares...)
+	}
+	return all, iter.Error()
+}
+
+// Report splits the payout of the shares in the range [start, end] by the work of
+// each client
+func (t *ShareTracker) Report(start, end int64) (*PoolReport, error) {
+	shares, err := t.Shares(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PoolReport{Start: start, End: end, Clients: []*ClientReport{}}
+	clients := make(map[string]*ClientReport)
+	for _, s := range shares {
+		c, ok := clients[s.Client]
+		if !ok {
+			c = &ClientReport{Client: s.Client}
+			clients[s.Client] = c
+			report.Clients = append(report.Clients, c)
+		}
+		c.Shares++
+		c.Work += s.Work()
+		report.Shares++
+		report.Work += s.Work()
+		if s.Won {
+			c.Wins++
+			c.Payout += s.Payout
+			report.TotalPayout += s.Payout
+		}
+	}
+
+	for _, c := range report.Clients {
+		if report.Work > 0 {
+			c.WorkShare = c.Work / report.Work
+		}
+		c.Split = int64(c.WorkShare * float64(report.TotalPayout))
+	}
+	sort.Slice(report.Clients, func(i, j int) bool { return report.Clients[i].Client < report.Clients[j].Client })
+	return report, nil
+}
+
+func (t *ShareTracker) fetch(dbht int64) ([]*Share, error) {
+	data, err := t.DB.Get(database.BUCKET_POOL_SHARES, database.HeightToBytes(dbht))
+	if err == database.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var shares []*Share
+	if err := database.Decode(&shares, data); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func (t *ShareTracker) write(dbht int64, shares []*Share) error {
+	data, err := database.Encode(shares)
+	if err != nil {
+		return err
+	}
+	return t.DB.Put(database.BUCKET_POOL_SHARES, database.HeightToBytes(dbht), data)
+}
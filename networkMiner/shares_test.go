@@ -0,0 +1,127 @@
+package networkMiner_test
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/FactomProject/factom"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+	. "github.com/pegnet/pegnet/networkMiner"
+	"github.com/pegnet/pegnet/opr"
+)
+
+// shareEntry makes an opr entry at the height with a nonce of the right difficulty
+func shareEntry(t *testing.T, dbht int32, nonce byte) (*factom.Entry, *opr.OraclePriceRecord) {
+	o := opr.NewOraclePriceRecord()
+	o.Dbht = dbht
+	o.Version = 2
+	o.FactomDigitalID = "pool"
+	o.CoinbaseAddress = common.ConvertRawToFCT(common.RandomByteSliceOfLen(32))
+	o.WinPreviousOPR = make([]string, 25)
+	for _, asset := range common.AssetsV2 {
+		o.Assets.SetValue(asset, 1)
+	}
+	content, err := o.SafeMarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sha := sha256.Sum256(content)
+	o.OPRHash = sha[:]
+	o.Nonce = []byte{nonce}
+	o.Difficulty = opr.ComputeDifficulty(o.OPRHash, o.Nonce)
+	difficulty := make([]byte, 8)
+	binary.BigEndian.PutUint64(difficulty, o.Difficulty)
+
+	e := &factom.Entry{ChainID: opr.OPRChainID, ExtIDs: [][]byte{o.Nonce, difficulty, {o.Version}}, Content: content}
+	o.EntryHash = e.Hash()
+	return e, o
+}
+
+func TestShareTracker(t *testing.T) {
+	tracker := NewShareTracker(database.NewMapDb(), common.TestNetwork)
+
+	// rig1 submits two oprs at 100 and one at 101, rig2 one at 100
+	e1, o1 := shareEntry(t, 100, 1)
+	e2, _ := shareEntry(t, 100, 2)
+	e3, o3 := shareEntry(t, 101, 3)
+	e4, _ := shareEntry(t, 100, 4)
+	for _, s := range []struct {
+		client string
+		entry  *factom.Entry
+	}{{"rig1", e1}, {"rig1", e2}, {"rig1", e3}, {"rig2", e4}, {"rig2", e4}} {
+		if _, err := tracker.RecordShare(s.client, s.entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	shares, err := tracker.Shares(100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 3 {
+		t.Errorf("exp 3 shares at 100 with the duplicate dropped, found %d", len(shares))
+	}
+
+	// Only the heights with shares are read, however wide the range
+	if shares, err := tracker.Shares(0, math.MaxInt64); err != nil || len(shares) != 4 {
+		t.Errorf("exp the 4 shares of the whole chain, found %d, %v", len(shares), err)
+	}
+
+	// A nonce that does not match the self reported difficulty is no share
+	bad, _ := shareEntry(t, 100, 5)
+	binary.BigEndian.PutUint64(bad.ExtIDs[1], binary.BigEndian.Uint64(bad.ExtIDs[1])+1)
+	if _, err := tracker.RecordShare("rig2", bad); err == nil {
+		t.Error("exp a share with a wrong difficulty to be rejected")
+	}
+
+	// o1 wins first place at 100, o3 second at 101
+	other := opr.NewOraclePriceRecord()
+	other.Dbht, other.EntryHash = 101, make([]byte, 32)
+	for _, winners := range []*opr.OPRs{
+		{ToBePaid: []*opr.OraclePriceRecord{o1}},
+		{ToBePaid: []*opr.OraclePriceRecord{other, o3}},
+	} {
+		if err := tracker.RecordWinners(winners); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := tracker.Report(100, 101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payout := opr.GetRewardFromPlace(0, common.TestNetwork, 100) + opr.GetRewardFromPlace(1, common.TestNetwork, 101)
+	if report.Shares != 4 || report.TotalPayout != payout || len(report.Clients) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	rig1, rig2 := report.Clients[0], report.Clients[1]
+	if rig1.Client != "rig1" || rig1.Shares != 3 || rig1.Wins != 2 || rig1.Payout != payout {
+		t.Errorf("unexpected rig1 report %+v", rig1)
+	}
+	if rig2.Client != "rig2" || rig2.Shares != 1 || rig2.Wins != 0 || rig2.Payout != 0 {
+		t.Errorf("unexpected rig2 report %+v", rig2)
+	}
+	if math.Abs(rig1.WorkShare+rig2.WorkShare-1) > 1e-9 || rig1.Split+rig2.Split > payout {
+		t.Errorf("exp the payout to be split by work, found %+v and %+v", rig1, rig2)
+	}
+	if exp := int64(rig2.Work / report.Work * float64(payout)); rig2.Split != exp {
+		t.Errorf("exp rig2 to get %d, found %d", exp, rig2.Split)
+	}
+}
+
+func TestExpectedHashes(t *testing.T) {
+	if ExpectedHashes(0) != 1 {
+		t.Errorf("exp any hash to meet difficulty 0")
+	}
+	if h := ExpectedHashes(math.MaxUint64 - math.MaxUint64/4); math.Abs(h-4) > 1e-6 {
+		t.Errorf("exp 4 hashes for the top quarter, found %f", h)
+	}
+	if ExpectedHashes(math.MaxUint64) != math.Exp2(64) {
+		t.Errorf("exp the max difficulty to be capped")
+	}
+}
@@ -38,6 +38,10 @@ type TCPClient struct {
 	Server   *TCPServer
 	closed   bool
 	accepted bool
+
+	// Set once the client said hello
+	version int    // The negotiated protocol version, 0 before the hello
+	user    string // The user the client authenticates as
 }
 
 func NewTCPClient(conn net.Conn, s *TCPServer) *TCPClient {
@@ -57,10 +61,46 @@ func (c *TCPClient) LogFields() log.Fields {
 		ip = c.conn.RemoteAddr().String()
 	}
 
-	return log.Fields{
+	fields := log.Fields{
 		"ip": ip,
 		"id": c.id,
 	}
+	if c.user != "" {
+		fields["user"] = c.user
+	}
+	return fields
+}
+
+// Name is who the client mines for. That is the user it authenticated as, or the
+// identity it tagged itself with if there is no user.
+func (c *TCPClient) Name() string {
+	if c.user != "" {
+		return c.user
+	}
+	c.tagLock.Lock()
+	defer c.tagLock.Unlock()
+	if id := c.tags["id"]; id != "" {
+		return id
+	}
+	return fmt.Sprintf("Net-%d", c.id)
+}
+
+// PeerCommonName returns the common name of the client's verified tls certificate,
+// or "" if the client did not present one
+func (c *TCPClient) PeerCommonName() string {
+	tlsConn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return ""
+	}
+	// The handshake is done lazily on the first read, make sure it is done
+	if err := tlsConn.Handshake(); err != nil {
+		return ""
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	return state.PeerCertificates[0].Subject.CommonName
 }
 
 func (c *TCPClient) init() {
@@ -125,6 +165,11 @@ func (s *TCPServer) OnClientConnectionClosed(callback func(c *TCPClient, err err
 	s.onClientConnectionClosed = callback
 }
 
+// SetTLSConfig makes the server serve tls. It has to be set before Listen
+func (s *TCPServer) SetTLSConfig(config *tls.Config) {
+	s.config = config
+}
+
 // Called when Client receives new message
 func (s *TCPServer) OnNewMessage(callback func(c *TCPClient, message *NetworkMessage)) {
 	s.onNewMessage = callback
@@ -149,6 +194,7 @@ func (s *TCPServer) Listen() {
 		conn, err := listener.Accept()
 		if err != nil {
 			log.WithError(err).Error("failed to accept client")
+			continue
 		}
 		client := NewTCPClient(conn, s)
 		client.init()
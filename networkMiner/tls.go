@@ -0,0 +1,97 @@
+package networkMiner
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/pegnet/pegnet/common"
+	"github.com/zpatrick/go-config"
+)
+
+// configPath returns the expanded path of the config key, or "" if it is not set
+func configPath(config *config.Config, key string) string {
+	path, err := config.String(key)
+	if err != nil {
+		return ""
+	}
+	return os.ExpandEnv(path)
+}
+
+// loadCertPool reads the pem encoded certificates of a CA
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// CoordinatorTLSConfig returns the tls config the coordinator serves with, or nil if
+// it does not have a cert and key. If it has a client CA, miners must have a cert
+// signed by it.
+func CoordinatorTLSConfig(config *config.Config) (*tls.Config, error) {
+	certPath := configPath(config, common.ConfigCoordinatorTLSCert)
+	keyPath := configPath(config, common.ConfigCoordinatorTLSKey)
+	if certPath == "" && keyPath == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("coordinator tls cert: %s", err.Error())
+	}
+	c := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if caPath := configPath(config, common.ConfigCoordinatorTLSClientCA); caPath != "" {
+		c.ClientCAs, err = loadCertPool(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("coordinator tls client ca: %s", err.Error())
+		}
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return c, nil
+}
+
+// MinerTLSConfig returns the tls config a miner connects to the coordinator with, or
+// nil if it does not use tls
+func MinerTLSConfig(config *config.Config, host string) (*tls.Config, error) {
+	if use, err := config.Bool(common.ConfigNetMinerTLS); err != nil || !use {
+		return nil, nil
+	}
+
+	c := &tls.Config{MinVersion: tls.VersionTLS12}
+	c.ServerName = host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		c.ServerName = h
+	}
+
+	var err error
+	if caPath := configPath(config, common.ConfigNetMinerTLSCA); caPath != "" {
+		c.RootCAs, err = loadCertPool(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("miner tls ca: %s", err.Error())
+		}
+	}
+
+	certPath := configPath(config, common.ConfigNetMinerTLSCert)
+	keyPath := configPath(config, common.ConfigNetMinerTLSKey)
+	if certPath != "" || keyPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("miner tls cert: %s", err.Error())
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
@@ -1,8 +1,57 @@
 package networkMiner
 
-// Include versioning. Might be helpful in the future.
-const version = "0.1.0"
+import (
+	"fmt"
+)
+
+// version is the software version sent along with every message
+const version = "0.2.0"
+
+const (
+	// ProtocolVersion is the newest protocol version we speak
+	ProtocolVersion = 2
+	// MinProtocolVersion is the oldest protocol version we still speak.
+	// Version 1 is the protocol before the Hello, which is not negotiated.
+	MinProtocolVersion = 2
+)
 
 func NewNetworkMessage(cmd int, data interface{}) *NetworkMessage {
 	return &NetworkMessage{NetworkCommand: cmd, Data: data, Version: version}
 }
+
+// Hello is the first message a miner sends to a coordinator. It has the range of
+// protocol versions the miner speaks, and who the miner is.
+type Hello struct {
+	Version    int    // The newest protocol version the miner speaks
+	MinVersion int    // The oldest protocol version the miner speaks
+	User       string // The user the miner authenticates as
+}
+
+// Welcome is the reply of the coordinator to a Hello
+type Welcome struct {
+	Version   int    // The negotiated protocol version
+	Challenge string // The authentication challenge, empty if there is no authentication
+}
+
+// NewHello makes the hello of the protocol versions we speak
+func NewHello(user string) Hello {
+	return Hello{Version: ProtocolVersion, MinVersion: MinProtocolVersion, User: user}
+}
+
+// NegotiateVersion returns the newest protocol version both sides speak, or an error
+// if they have none in common
+func NegotiateVersion(hello Hello) (int, error) {
+	if hello.Version < hello.MinVersion {
+		return 0, fmt.Errorf("invalid protocol versions %d-%d", hello.MinVersion, hello.Version)
+	}
+
+	v := ProtocolVersion
+	if hello.Version < v {
+		v = hello.Version
+	}
+	if v < MinProtocolVersion || v < hello.MinVersion {
+		return 0, fmt.Errorf("incompatible protocol versions, the miner speaks %d-%d and the coordinator speaks %d-%d",
+			hello.MinVersion, hello.Version, MinProtocolVersion, ProtocolVersion)
+	}
+	return v, nil
+}
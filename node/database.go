@@ -0,0 +1,512 @@
+// Package node is the relational database of a pegnet node. The grader writes every
+// graded block into it, with its oprs, winners and payouts, and the burns and balances
+// of the addresses, so the api can answer queries with an index instead of a scan.
+package node
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+	"github.com/pegnet/pegnet/opr"
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS blocks (
+	height        INTEGER PRIMARY KEY,
+	empty         INTEGER NOT NULL,
+	total_records INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS oprs (
+	entry_hash       TEXT PRIMARY KEY,
+	short_hash       TEXT NOT NULL,
+	height           INTEGER NOT NULL,
+	miner_id         TEXT NOT NULL,
+	coinbase         TEXT NOT NULL,
+	difficulty       TEXT NOT NULL,
+	difficulty_place INTEGER NOT NULL,
+	graded_place     INTEGER NOT NULL,
+	record           BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS oprs_height ON oprs (height);
+CREATE INDEX IF NOT EXISTS oprs_short_hash ON oprs (short_hash);
+CREATE INDEX IF NOT EXISTS oprs_miner_id ON oprs (miner_id, height);
+CREATE INDEX IF NOT EXISTS oprs_coinbase ON oprs (coinbase, height);
+
+CREATE TABLE IF NOT EXISTS winners (
+	height     INTEGER NOT NULL,
+	place      INTEGER NOT NULL,
+	entry_hash TEXT NOT NULL,
+	PRIMARY KEY (height, place)
+);
+
+CREATE TABLE IF NOT EXISTS payouts (
+	height   INTEGER NOT NULL,
+	place    INTEGER NOT NULL,
+	coinbase TEXT NOT NULL,
+	address  TEXT NOT NULL,
+	amount   INTEGER NOT NULL,
+	PRIMARY KEY (height, place)
+);
+CREATE INDEX IF NOT EXISTS payouts_coinbase ON payouts (coinbase, height);
+CREATE INDEX IF NOT EXISTS payouts_address ON payouts (address, height);
+
+CREATE TABLE IF NOT EXISTS prices (
+	asset  TEXT NOT NULL,
+	height INTEGER NOT NULL,
+	price  INTEGER NOT NULL,
+	PRIMARY KEY (asset, height)
+);
+
+CREATE TABLE IF NOT EXISTS burns (
+	txid    TEXT PRIMARY KEY,
+	height  INTEGER NOT NULL,
+	address TEXT NOT NULL,
+	amount  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS burns_address ON burns (address, height);
+
+CREATE TABLE IF NOT EXISTS balances (
+	address  TEXT PRIMARY KEY,
+	coinbase TEXT NOT NULL,
+	asset    TEXT NOT NULL,
+	balance  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS balances_coinbase ON balances (coinbase);
+
+CREATE TABLE IF NOT EXISTS synced (
+	name   TEXT PRIMARY KEY,
+	height INTEGER NOT NULL
+);
+`
+
+// Payout is the reward of a winning opr
+type Payout struct {
+	Height    int64  `json:"height"`
+	Place     int    `json:"place"`
+	Coinbase  string `json:"coinbase"` // The FA address of the opr
+	Address   string `json:"address"`  // The PEG address that was paid
+	Amount    int64  `json:"amount"`
+	EntryHash string `json:"entryhash"`
+}
+
+// Burn is FCT burned for pFCT
+type Burn struct {
+	TxID    string `json:"txid"`
+	Height  int64  `json:"height"`
+	Address string `json:"address"`
+	Amount  int64  `json:"amount"`
+}
+
+// Balance is the balance of a pegnet address
+type Balance struct {
+	Address  string `json:"address"`
+	Coinbase string `json:"coinbase"` // The FA address of the pegnet address
+	Asset    string `json:"asset"`
+	Balance  int64  `json:"balance"`
+}
+
+// NodeDatabase is the sqlite database of the graded blocks and balances
+type NodeDatabase struct {
+	DB      *sql.DB
+	Network string
+}
+
+// OpenNodeDatabase opens the sqlite database at the path, creating it if it does not
+// exist
+func OpenNodeDatabase(path, network string) (*NodeDatabase, error) {
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite has one writer, and an in memory database is per connection
+	db.SetMaxOpenConns(1)
+	return NewNodeDatabase(db, network)
+}
+
+func NewNodeDatabase(db *sql.DB, network string) (*NodeDatabase, error) {
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("node database schema: %s", err.Error())
+	}
+	n := new(NodeDatabase)
+	n.DB = db
+	n.Network = network
+	return n, nil
+}
+
+func (n *NodeDatabase) Close() error {
+	return n.DB.Close()
+}
+
+// HasBlock is true if the block at the height is in the database
+func (n *NodeDatabase) HasBlock(height int64) bool {
+	var h int64
+	return n.DB.QueryRow(`SELECT height FROM blocks WHERE height = ?`, height).Scan(&h) == nil
+}
+
+// WriteOPRBlock writes the oprs of the block, its winners and their payouts, and the
+// prices of the winning opr, replacing what was at the height
+func (n *NodeDatabase) WriteOPRBlock(block *opr.OprBlock) error {
+	tx, err := n.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if err := n.writeOPRBlock(tx, block); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("node database block %d: %s", block.Dbht, err.Error())
+	}
+	return tx.Commit()
+}
+
+// DeleteOPRBlock removes the block at the height, with its oprs, winners, payouts and
+// prices
+func (n *NodeDatabase) DeleteOPRBlock(height int64) error {
+	tx, err := n.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if err := deleteOPRBlock(tx, height); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("node database block %d: %s", height, err.Error())
+	}
+	return tx.Commit()
+}
+
+func deleteOPRBlock(tx *sql.Tx, height int64) error {
+	for _, table := range []string{"blocks", "oprs", "winners", "payouts", "prices"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE height = ?`, height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *NodeDatabase) writeOPRBlock(tx *sql.Tx, block *opr.OprBlock) error {
+	if err := deleteOPRBlock(tx, block.Dbht); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`INSERT INTO blocks (height, empty, total_records) VALUES (?, ?, ?)`,
+		block.Dbht, block.EmptyOPRBlock, block.TotalNumberRecords)
+	if err != nil || block.EmptyOPRBlock {
+		return err
+	}
+
+	graded := make(map[*opr.OraclePriceRecord]int)
+	for place, o := range block.GradedOPRs {
+		graded[o] = place
+	}
+	oprs := block.OPRs
+	if len(oprs) == 0 {
+		oprs = block.GradedOPRs
+	}
+	for place, o := range oprs {
+		gradedPlace, ok := graded[o]
+		if !ok {
+			gradedPlace = -1
+		}
+		record, err := database.Encode(o)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO oprs (entry_hash, short_hash, height, miner_id, coinbase, difficulty, difficulty_place, graded_place, record)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			hex.EncodeToString(o.EntryHash), shortHash(o.EntryHash), block.Dbht, o.FactomDigitalID, o.CoinbaseAddress,
+			fmt.Sprintf("%016x", o.Difficulty), place, gradedPlace, record)
+		if err != nil {
+			return err
+		}
+	}
+
+	for place, o := range block.GradedOPRs {
+		reward := opr.GetRewardFromPlace(place, n.Network, block.Dbht)
+		if reward <= 0 {
+			break // Only the winners are paid
+		}
+		entryHash := hex.EncodeToString(o.EntryHash)
+		if _, err := tx.Exec(`INSERT INTO winners (height, place, entry_hash) VALUES (?, ?, ?)`, block.Dbht, place, entryHash); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO payouts (height, place, coinbase, address, amount) VALUES (?, ?, ?, ?, ?)`,
+			block.Dbht, place, o.CoinbaseAddress, o.CoinbasePEGAddress, reward)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(block.GradedOPRs) > 0 {
+		for asset, price := range block.GradedOPRs[0].Assets {
+			if _, err := tx.Exec(`INSERT INTO prices (asset, height, price) VALUES (?, ?, ?)`, asset, block.Dbht, int64(price)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteBurn records the burn, at the height of the fblock it is in
+func (n *NodeDatabase) WriteBurn(height int64, txid, address string, amount int64) error {
+	_, err := n.DB.Exec(`INSERT OR REPLACE INTO burns (txid, height, address, amount) VALUES (?, ?, ?, ?)`, txid, height, address, amount)
+	return err
+}
+
+// BurnsSynced is the fblock height up to which every burn is in the database
+func (n *NodeDatabase) BurnsSynced() (int64, error) {
+	var height int64
+	err := n.DB.QueryRow(`SELECT height FROM synced WHERE name = 'burns'`).Scan(&height)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return height, err
+}
+
+// syncBurns moves the height up to which every burn is in the database to the height,
+// if every burn up to from already is
+func (n *NodeDatabase) syncBurns(from, height int64) error {
+	_, err := n.DB.Exec(`INSERT OR IGNORE INTO synced (name, height) VALUES ('burns', 0)`)
+	if err != nil {
+		return err
+	}
+	_, err = n.DB.Exec(`UPDATE synced SET height = ? WHERE name = 'burns' AND height >= ? AND height < ?`, height, from, height)
+	return err
+}
+
+// WriteBalances updates the balances, as they are kept by the balance tracker
+func (n *NodeDatabase) WriteBalances(balances map[string]map[[32]byte]int64) error {
+	tx, err := n.DB.Begin()
+	if err != nil {
+		return err
+	}
+	for prefix, adrs := range balances {
+		for adr, balance := range adrs {
+			address, err := common.ConvertRawToPegNetAsset(prefix, adr[:])
+			if err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+			if balance == 0 {
+				_, err = tx.Exec(`DELETE FROM balances WHERE address = ?`, address)
+			} else {
+				_, err = tx.Exec(`INSERT OR REPLACE INTO balances (address, coinbase, asset, balance) VALUES (?, ?, ?, ?)`,
+					address, common.ConvertRawToFCT(adr[:]), prefix, balance)
+			}
+			if err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// OprBlockByHeight returns the graded block at the height, or nil if there is none
+func (n *NodeDatabase) OprBlockByHeight(height int64) *opr.OprBlock {
+	block := &opr.OprBlock{Dbht: height}
+	err := n.DB.QueryRow(`SELECT empty, total_records FROM blocks WHERE height = ?`, height).
+		Scan(&block.EmptyOPRBlock, &block.TotalNumberRecords)
+	if err != nil {
+		return nil
+	}
+
+	oprs, err := n.queryOPRs(`WHERE height = ? ORDER BY difficulty_place`, height)
+	if err != nil {
+		return nil
+	}
+	graded := make(map[int]*opr.OraclePriceRecord)
+	for _, o := range oprs {
+		block.OPRs = append(block.OPRs, o.OraclePriceRecord)
+		if o.graded >= 0 {
+			graded[o.graded] = o.OraclePriceRecord
+		}
+	}
+	for place := 0; place < len(graded); place++ {
+		block.GradedOPRs = append(block.GradedOPRs, graded[place])
+	}
+	return block
+}
+
+// OprsByDigitalID returns every opr of the miner id
+func (n *NodeDatabase) OprsByDigitalID(did string) []opr.OraclePriceRecord {
+	return values(n.queryOPRs(`WHERE miner_id = ? ORDER BY height, difficulty_place`, did))
+}
+
+// OprsByCoinbase returns every opr of the coinbase address in the range [start, end]
+func (n *NodeDatabase) OprsByCoinbase(coinbase string, start, end int64) []opr.OraclePriceRecord {
+	return values(n.queryOPRs(`WHERE coinbase = ? AND height BETWEEN ? AND ? ORDER BY height, difficulty_place`, coinbase, start, end))
+}
+
+// OprByHash returns the opr of the entry hash, or an empty opr if there is none
+func (n *NodeDatabase) OprByHash(hash string) opr.OraclePriceRecord {
+	return first(n.queryOPRs(`WHERE entry_hash = ?`, hash))
+}
+
+// OprByShortHash returns the opr of the first 8 bytes of the entry hash, as winners
+// are listed in an opr
+func (n *NodeDatabase) OprByShortHash(shorthash string) opr.OraclePriceRecord {
+	return first(n.queryOPRs(`WHERE short_hash = ? ORDER BY height DESC`, shorthash))
+}
+
+// Winners returns the paid oprs of the block at the height, by place
+func (n *NodeDatabase) Winners(height int64) ([]*opr.OraclePriceRecord, error) {
+	oprs, err := n.queryOPRs(`JOIN winners w ON w.entry_hash = oprs.entry_hash WHERE w.height = ? ORDER BY w.place`, height)
+	if err != nil {
+		return nil, err
+	}
+	winners := make([]*opr.OraclePriceRecord, len(oprs))
+	for i, o := range oprs {
+		winners[i] = o.OraclePriceRecord
+	}
+	return winners, nil
+}
+
+// Payouts returns the rewards of the coinbase address, FA or PEG, in the range [start, end]
+func (n *NodeDatabase) Payouts(address string, start, end int64) ([]Payout, error) {
+	rows, err := n.DB.Query(`SELECT p.height, p.place, p.coinbase, p.address, p.amount, w.entry_hash
+		FROM payouts p JOIN winners w ON w.height = p.height AND w.place = p.place
+		WHERE (p.coinbase = ? OR p.address = ?) AND p.height BETWEEN ? AND ? ORDER BY p.height, p.place`,
+		address, address, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payouts := []Payout{}
+	for rows.Next() {
+		var p Payout
+		if err := rows.Scan(&p.Height, &p.Place, &p.Coinbase, &p.Address, &p.Amount, &p.EntryHash); err != nil {
+			return nil, err
+		}
+		payouts = append(payouts, p)
+	}
+	return payouts, rows.Err()
+}
+
+// Burns returns the burns that credited the pFCT address
+func (n *NodeDatabase) Burns(address string) ([]Burn, error) {
+	rows, err := n.DB.Query(`SELECT txid, height, address, amount FROM burns WHERE address = ? ORDER BY height`, address)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	burns := []Burn{}
+	for rows.Next() {
+		var b Burn
+		if err := rows.Scan(&b.TxID, &b.Height, &b.Address, &b.Amount); err != nil {
+			return nil, err
+		}
+		burns = append(burns, b)
+	}
+	return burns, rows.Err()
+}
+
+// Balances returns the balances of every asset of the coinbase address, FA or any of
+// its pegnet addresses
+func (n *NodeDatabase) Balances(address string) ([]Balance, error) {
+	coinbase := address
+	if _, raw, err := common.ConvertPegNetAssetToRaw(address); err == nil {
+		coinbase = common.ConvertRawToFCT(raw)
+	}
+	rows, err := n.DB.Query(`SELECT address, coinbase, asset, balance FROM balances WHERE coinbase = ? ORDER BY asset`, coinbase)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := []Balance{}
+	for rows.Next() {
+		var b Balance
+		if err := rows.Scan(&b.Address, &b.Coinbase, &b.Asset, &b.Balance); err != nil {
+			return nil, err
+		}
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
+
+// PriceHistory returns the graded price of the asset for every block in the range
+// [start, end]
+func (n *NodeDatabase) PriceHistory(asset string, start, end int64) ([]opr.PricePoint, error) {
+	rows, err := n.DB.Query(`SELECT height, price FROM prices WHERE asset = ? AND height BETWEEN ? AND ? ORDER BY height`, asset, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []opr.PricePoint
+	for rows.Next() {
+		var p opr.PricePoint
+		var price int64
+		if err := rows.Scan(&p.Height, &price); err != nil {
+			return nil, err
+		}
+		p.Price = uint64(price)
+		history = append(history, p)
+	}
+	return history, rows.Err()
+}
+
+// storedOPR is an opr with its graded place, or -1 if it was not graded
+type storedOPR struct {
+	*opr.OraclePriceRecord
+	graded int
+}
+
+func (n *NodeDatabase) queryOPRs(where string, args ...interface{}) ([]storedOPR, error) {
+	rows, err := n.DB.Query(`SELECT oprs.record, oprs.graded_place FROM oprs `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var oprs []storedOPR
+	for rows.Next() {
+		var data []byte
+		var graded int
+		if err := rows.Scan(&data, &graded); err != nil {
+			return nil, err
+		}
+		o := opr.NewOraclePriceRecord()
+		if err := database.Decode(o, data); err != nil {
+			return nil, err
+		}
+		oprs = append(oprs, storedOPR{OraclePriceRecord: o, graded: graded})
+	}
+	return oprs, rows.Err()
+}
+
+func values(oprs []storedOPR, err error) []opr.OraclePriceRecord {
+	if err != nil {
+		return nil
+	}
+	var records []opr.OraclePriceRecord
+	for _, o := range oprs {
+		records = append(records, *o.OraclePriceRecord)
+	}
+	return records
+}
+
+func first(oprs []storedOPR, err error) opr.OraclePriceRecord {
+	if err != nil || len(oprs) == 0 {
+		return opr.OraclePriceRecord{}
+	}
+	return *oprs[0].OraclePriceRecord
+}
+
+func shortHash(entryHash []byte) string {
+	if len(entryHash) < 8 {
+		return hex.EncodeToString(entryHash)
+	}
+	return hex.EncodeToString(entryHash[:8])
+}
@@ -0,0 +1,284 @@
+package node_test
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/pegnet/pegnet/balances"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+	. "github.com/pegnet/pegnet/node"
+	"github.com/pegnet/pegnet/opr"
+	"github.com/zpatrick/go-config"
+)
+
+const coinbase = "FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q"
+
+// testBlock is a graded block of n oprs. The opr with the most difficulty is graded
+// last, and the i-th opr is mined by miner i%2, with our coinbase if i is even.
+func testBlock(t *testing.T, height int64, n int) *opr.OprBlock {
+	pegAddress, err := common.ConvertFCTtoPegNetAsset(common.TestNetwork, "PEG", coinbase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := &opr.OprBlock{Dbht: height, TotalNumberRecords: n}
+	for i := 0; i < n; i++ {
+		o := opr.NewOraclePriceRecord()
+		o.Dbht = int32(height)
+		o.EntryHash = []byte(fmt.Sprintf("%08d-%023d", height, i))
+		o.Difficulty = uint64(n - i)
+		o.FactomDigitalID = fmt.Sprintf("miner%d", i%2)
+		o.CoinbaseAddress = "FA-other"
+		if i%2 == 0 {
+			o.CoinbaseAddress, o.CoinbasePEGAddress = coinbase, pegAddress
+		}
+		o.Assets = opr.OraclePriceRecordAssetList{"PEG": uint64(height), "USD": 1e8}
+		block.OPRs = append(block.OPRs, o)
+	}
+	for i := n - 1; i >= 0; i-- {
+		block.GradedOPRs = append(block.GradedOPRs, block.OPRs[i])
+	}
+	return block
+}
+
+func openTestDatabase(t *testing.T) *NodeDatabase {
+	n, err := OpenNodeDatabase(":memory:", common.TestNetwork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// writeBlock writes the oprblock through the block store of the grader
+func writeBlock(t *testing.T, g *opr.QuickGrader, block *opr.OprBlock) {
+	batch := database.NewBatch()
+	if err := g.BlockStore.WriteOPRBlock(batch, block); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.DB.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNodeDatabase_OPRs(t *testing.T) {
+	n := openTestDatabase(t)
+	defer n.Close()
+
+	for height := int64(100); height < 103; height++ {
+		if err := n.WriteOPRBlock(testBlock(t, height, 30)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Writing a block again replaces it
+	if err := n.WriteOPRBlock(testBlock(t, 101, 30)); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.WriteOPRBlock(&opr.OprBlock{Dbht: 103, EmptyOPRBlock: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := testBlock(t, 101, 30)
+	block := n.OprBlockByHeight(101)
+	if block == nil || len(block.OPRs) != 30 || len(block.GradedOPRs) != 30 || block.TotalNumberRecords != 30 {
+		t.Fatalf("exp the block of 30 oprs, found %v", block)
+	}
+	for i := range exp.OPRs {
+		if string(block.OPRs[i].EntryHash) != string(exp.OPRs[i].EntryHash) {
+			t.Errorf("opr %d: exp %s, found %s", i, exp.OPRs[i].EntryHash, block.OPRs[i].EntryHash)
+		}
+		if string(block.GradedOPRs[i].EntryHash) != string(exp.GradedOPRs[i].EntryHash) {
+			t.Errorf("graded opr %d: exp %s, found %s", i, exp.GradedOPRs[i].EntryHash, block.GradedOPRs[i].EntryHash)
+		}
+	}
+	if b := n.OprBlockByHeight(103); b == nil || !b.EmptyOPRBlock {
+		t.Errorf("exp an empty block, found %v", b)
+	}
+	if n.OprBlockByHeight(104) != nil {
+		t.Error("exp no block")
+	}
+
+	if oprs := n.OprsByDigitalID("miner1"); len(oprs) != 45 {
+		t.Errorf("exp 45 oprs of miner1, found %d", len(oprs))
+	}
+	if oprs := n.OprsByCoinbase(coinbase, 101, 102); len(oprs) != 30 {
+		t.Errorf("exp 30 oprs of the coinbase in 2 blocks, found %d", len(oprs))
+	}
+
+	o := exp.OPRs[7]
+	if found := n.OprByHash(hex.EncodeToString(o.EntryHash)); string(found.EntryHash) != string(o.EntryHash) || found.Difficulty != o.Difficulty {
+		t.Errorf("exp the opr by its hash, found %v", found)
+	}
+	if found := n.OprByShortHash(hex.EncodeToString(o.EntryHash[:8])); found.Dbht != 101 {
+		t.Errorf("exp the first opr at 101 by its short hash, found %v", found)
+	}
+
+	// The top 25 of version 2 are paid, and 12 of them are ours
+	winners, err := n.Winners(101)
+	if err != nil || len(winners) != 25 || string(winners[0].EntryHash) != string(exp.GradedOPRs[0].EntryHash) {
+		t.Errorf("exp 25 winners, found %d %v", len(winners), err)
+	}
+	payouts, err := n.Payouts(coinbase, 100, 101)
+	if err != nil || len(payouts) != 24 {
+		t.Fatalf("exp 24 payouts in 2 blocks, found %d %v", len(payouts), err)
+	}
+	if payouts[0].Amount != opr.GetRewardFromPlace(0, common.TestNetwork, 100) || payouts[0].EntryHash == "" {
+		t.Errorf("exp the reward of the first place, found %v", payouts[0])
+	}
+	if found, _ := n.Payouts(payouts[0].Address, 100, 101); len(found) != 24 {
+		t.Errorf("exp the payouts by PEG address, found %d", len(found))
+	}
+
+	prices, err := n.PriceHistory("PEG", 100, 110)
+	if err != nil || len(prices) != 3 || prices[2].Price != 102 {
+		t.Errorf("exp 3 PEG prices, found %v %v", prices, err)
+	}
+}
+
+func TestAttach(t *testing.T) {
+	c := config.NewConfig([]config.Provider{
+		common.NewUnitTestConfigProvider(),
+		config.NewStatic(map[string]string{"Miner.Network": common.TestNetwork}),
+	})
+	g := opr.NewQuickGrader(c, database.NewMapDb(), balances.NewBalanceTracker())
+	before := testBlock(t, 100, 30)
+	writeBlock(t, g, before)
+
+	n := openTestDatabase(t)
+	defer n.Close()
+	if _, err := Attach(g, n); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading a block graded before does not write it, Backfill does
+	if _, err := g.BlockStore.FetchOPRBlock(100); err != nil {
+		t.Fatal(err)
+	}
+	if n.HasBlock(100) {
+		t.Error("exp a read not to write the block")
+	}
+	writeBlock(t, g, testBlock(t, 101, 30))
+	if !n.HasBlock(101) {
+		t.Error("exp the graded block to be written")
+	}
+
+	// A rolled back block is removed, and replaced once it is graded again
+	if err := g.OPRChain.Rewound([]int64{101}); err != nil {
+		t.Fatal(err)
+	}
+	if n.HasBlock(101) {
+		t.Error("exp the rolled back block to be removed")
+	}
+	if payouts, err := n.Payouts(coinbase, 101, 101); err != nil || len(payouts) != 0 {
+		t.Errorf("exp the payouts of the rolled back block to be removed, found %v %v", payouts, err)
+	}
+	writeBlock(t, g, testBlock(t, 101, 26))
+	if block := n.OprBlockByHeight(101); block == nil || len(block.OPRs) != 26 {
+		t.Errorf("exp the block graded again, found %v", block)
+	}
+
+	// Balances are written as they are checkpointed
+	pegAddress := before.OPRs[0].CoinbasePEGAddress
+	if err := g.Balances.AddToBalance(pegAddress, 500); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.CheckpointBalances(); err != nil {
+		t.Fatal(err)
+	}
+	bals, err := n.Balances(coinbase)
+	if err != nil || len(bals) != 1 || bals[0].Address != pegAddress || bals[0].Balance != 500 {
+		t.Errorf("exp a PEG balance of 500, found %v %v", bals, err)
+	}
+
+	if err := g.Burns.Burned(5, "tx", "pFCT-address", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if burns, err := n.Burns("pFCT-address"); err != nil || len(burns) != 1 || burns[0].Amount != 1000 {
+		t.Errorf("exp the burn, found %v %v", burns, err)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	c := config.NewConfig([]config.Provider{
+		common.NewUnitTestConfigProvider(),
+		config.NewStatic(map[string]string{"Miner.Network": common.TestNetwork}),
+	})
+	pFCT, err := common.ConvertFCTtoPegNetAsset(common.TestNetwork, "FCT", coinbase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The chain has a burn at height 3, before the node database is attached, and
+	// another at height 6, after it is
+	chain := common.NewFakeFactomClient(1)
+	burn := func() {
+		_, err := chain.AddFactoidTransaction(balances.FactoidTransaction{
+			Inputs: []balances.TransactionOutput{{Amount: 5, Useraddress: coinbase}},
+			Outecs: []balances.TransactionOutput{{Amount: 0, Useraddress: common.BurnAddresses[common.TestNetwork]}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for height := 1; height <= 7; height++ {
+		if height == 3 || height == 6 {
+			burn()
+		}
+		chain.AdvanceBlock()
+	}
+
+	g := opr.NewQuickGrader(c, database.NewMapDb(), balances.NewBalanceTracker())
+	g.SetFactomClient(chain)
+	// The grader graded block 100 and synced the burns up to height 4 before
+	writeBlock(t, g, testBlock(t, 100, 30))
+	g.OPRChain.Heights = []int64{100}
+	g.Burns.FctDbht = 4
+	if err := g.Balances.AddToBalance(pFCT, 42); err != nil {
+		t.Fatal(err)
+	}
+
+	n := openTestDatabase(t)
+	defer n.Close()
+	store, err := Attach(g, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bals, err := n.Balances(pFCT); err != nil || len(bals) != 1 || bals[0].Balance != 42 {
+		t.Errorf("exp the balances to be written as they are attached, found %v %v", bals, err)
+	}
+
+	// The grader syncs the burns after it was attached
+	if err := g.Burns.UpdateBurns(c, 0); err != nil {
+		t.Fatal(err)
+	}
+	if burns, _ := n.Burns(pFCT); len(burns) != 1 || burns[0].Height != 6 {
+		t.Errorf("exp only the burn after attaching, found %v", burns)
+	}
+	if synced, _ := n.BurnsSynced(); synced != 0 {
+		t.Errorf("exp the burns not to be complete before the backfill, found %d", synced)
+	}
+
+	if err := store.Backfill(g); err != nil {
+		t.Fatal(err)
+	}
+	if !n.HasBlock(100) {
+		t.Error("exp the block graded before to be backfilled")
+	}
+	burns, err := n.Burns(pFCT)
+	if err != nil || len(burns) != 2 || burns[0].Height != 3 || burns[0].Amount != 5000 {
+		t.Errorf("exp the burn before attaching to be backfilled, found %v %v", burns, err)
+	}
+	if synced, _ := n.BurnsSynced(); synced != 4 {
+		t.Errorf("exp the burns to be complete up to the attached height 4, found %d", synced)
+	}
+
+	// The next synced block completes the burns up to it
+	chain.AdvanceBlock()
+	if err := g.Burns.UpdateBurns(c, 0); err != nil {
+		t.Fatal(err)
+	}
+	if synced, _ := n.BurnsSynced(); synced != g.Burns.FctDbht {
+		t.Errorf("exp the burns to be complete up to %d, found %d", g.Burns.FctDbht, synced)
+	}
+}
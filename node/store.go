@@ -0,0 +1,129 @@
+package node
+
+import (
+	"github.com/pegnet/pegnet/database"
+	"github.com/pegnet/pegnet/opr"
+	log "github.com/sirupsen/logrus"
+)
+
+// IndexedBlockStore writes the oprblocks of the grader to the node database, as well as
+// to the block store they are graded from
+type IndexedBlockStore struct {
+	opr.IOPRBlockStore
+	Node *NodeDatabase
+
+	// What the grader had synced when the node database was attached, for Backfill
+	heights       []int64 // The eblock heights of the graded blocks
+	burnsStart    int64   // The fblock height burns are synced from
+	burnsAttached int64   // The fblock height burns were synced to
+}
+
+var _ opr.IOPRBlockStore = (*IndexedBlockStore)(nil)
+
+// Attach has the grader write into the node database as it grades, and writes the
+// balances the grader has. It has to be called before the grader runs. The blocks and
+// burns the grader synced before are written by Backfill.
+func Attach(g *opr.QuickGrader, n *NodeDatabase) (*IndexedBlockStore, error) {
+	s := &IndexedBlockStore{IOPRBlockStore: g.BlockStore, Node: n}
+	s.heights = append([]int64{}, g.OPRChain.Heights...)
+	if first := g.GetFirstOPRBlock(); first != nil {
+		s.burnsStart = first.Dbht
+	}
+	s.burnsAttached = g.Burns.FctDbht
+
+	if err := n.WriteBalances(g.Balances.Copy()); err != nil {
+		return nil, err
+	}
+	// The burns synced from here on are complete once the ones before are backfilled
+	if err := n.syncBurns(s.burnsAttached, s.burnsAttached); err != nil {
+		return nil, err
+	}
+
+	g.BlockStore = s
+	g.Burns.Burned = n.WriteBurn
+	checkpoint := g.Burns.Checkpoint
+	g.Burns.Checkpoint = func() error {
+		if err := n.syncBurns(s.burnsAttached, g.Burns.FctDbht); err != nil {
+			return err
+		}
+		if checkpoint != nil {
+			return checkpoint()
+		}
+		return nil
+	}
+	g.BalanceStore.Written = n.WriteBalances
+	return s, nil
+}
+
+// Backfill writes the blocks the grader graded, and the burns of the fblocks it synced,
+// before the node database was attached. It can run next to the grader. If it is
+// interrupted, the next Backfill picks up the burns where it left off.
+func (s *IndexedBlockStore) Backfill(g *opr.QuickGrader) error {
+	var written int
+	for _, height := range s.heights {
+		if s.Node.HasBlock(height) {
+			continue
+		}
+		block, err := s.IOPRBlockStore.FetchOPRBlock(height)
+		if err == database.ErrNotFound {
+			continue // Graded again as the grader repairs the chain
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.Node.WriteOPRBlock(block); err != nil {
+			return err
+		}
+		written++
+	}
+
+	synced, err := s.Node.BurnsSynced()
+	if err != nil {
+		return err
+	}
+	from := synced
+	if from < s.burnsStart {
+		from = s.burnsStart // There are no burns before the opr chain
+	}
+	if from < s.burnsAttached {
+		err = g.Burns.ScanBurns(g.Config, from, s.burnsAttached, func(height int64, txid, address string, amount int64) error {
+			if err := s.Node.WriteBurn(height, txid, address, amount); err != nil {
+				return err
+			}
+			// Every burn before this block is written
+			return s.Node.syncBurns(synced, height-1)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := s.Node.syncBurns(synced, s.burnsAttached); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"blocks": written, "burns_from": from, "burns_to": s.burnsAttached}).Info("node database backfilled")
+	return nil
+}
+
+func (s *IndexedBlockStore) WriteInvalidOPRBlock(batch *database.Batch, dbht int64) error {
+	if err := s.IOPRBlockStore.WriteInvalidOPRBlock(batch, dbht); err != nil {
+		return err
+	}
+	return s.Node.WriteOPRBlock(&opr.OprBlock{Dbht: dbht, EmptyOPRBlock: true})
+}
+
+// WriteOPRBlock replaces the block at its height in the node database, as a block graded
+// again after the opr chain is rolled back can differ
+func (s *IndexedBlockStore) WriteOPRBlock(batch *database.Batch, block *opr.OprBlock) error {
+	if err := s.IOPRBlockStore.WriteOPRBlock(batch, block); err != nil {
+		return err
+	}
+	return s.Node.WriteOPRBlock(block)
+}
+
+func (s *IndexedBlockStore) DeleteOPRBlock(batch *database.Batch, height int64) error {
+	if err := s.IOPRBlockStore.DeleteOPRBlock(batch, height); err != nil {
+		return err
+	}
+	return s.Node.DeleteOPRBlock(height)
+}
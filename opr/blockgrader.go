@@ -0,0 +1,72 @@
+package opr
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/FactomProject/factom"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/modules/grader"
+	log "github.com/sirupsen/logrus"
+)
+
+// GradeOPRBlock grades the oprs of the eblock at the height with the modules/grader of
+// the opr version at that height. The entries are the factom entries the oprs were parsed
+// from, in the same order. Oprs the grader rejects, like ones with the wrong previous
+// winners, are dropped.
+// The oprblock is nil if the block does not have enough oprs to have winners.
+func GradeOPRBlock(network string, dbht int64, prevWinners []string, oprs []*OraclePriceRecord, entries []*factom.Entry) (*OprBlock, grader.GradedBlock, error) {
+	if len(oprs) != len(entries) {
+		return nil, nil, fmt.Errorf("found %d oprs for %d entries", len(oprs), len(entries))
+	}
+
+	g, err := grader.NewGrader(common.OPRVersion(network, dbht), int32(dbht), prevWinners)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var added []*OraclePriceRecord
+	byHash := make(map[string]*OraclePriceRecord)
+	for i, opr := range oprs {
+		if err := g.AddOPR(opr.EntryHash, entries[i].ExtIDs, entries[i].Content); err != nil {
+			log.WithFields(log.Fields{
+				"entryhash": fmt.Sprintf("%x", opr.EntryHash),
+				"dbht":      dbht,
+			}).Debugf("opr rejected: %s", err.Error())
+			continue
+		}
+		added = append(added, opr)
+		byHash[hex.EncodeToString(opr.EntryHash)] = opr
+	}
+
+	graded := g.Grade()
+	if len(graded.Winners()) == 0 {
+		return nil, graded, nil
+	}
+
+	oprblock := &OprBlock{
+		Dbht:               dbht,
+		OPRs:               added,
+		GradedOPRs:         make([]*OraclePriceRecord, 0, len(graded.Graded())),
+		TotalNumberRecords: len(added),
+	}
+	for _, o := range graded.Graded() {
+		opr, ok := byHash[hex.EncodeToString(o.EntryHash)]
+		if !ok {
+			return nil, nil, fmt.Errorf("graded opr %x was not added", o.EntryHash)
+		}
+		opr.Grade = o.Grade
+		opr.Difficulty = o.SelfReportedDifficulty // The grader only keeps honest difficulties
+		oprblock.GradedOPRs = append(oprblock.GradedOPRs, opr)
+	}
+	return oprblock, graded, nil
+}
+
+// ShortHashes returns the shorthashes of the oprs, the way they are listed as previous winners
+func ShortHashes(oprs []*OraclePriceRecord) []string {
+	hashes := make([]string, 0, len(oprs))
+	for _, o := range oprs {
+		hashes = append(hashes, hex.EncodeToString(o.EntryHash[:8]))
+	}
+	return hashes
+}
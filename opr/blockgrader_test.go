@@ -0,0 +1,220 @@
+package opr_test
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/FactomProject/factom"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/modules/grader"
+	modopr "github.com/pegnet/pegnet/modules/opr"
+	"github.com/pegnet/pegnet/modules/testutils"
+	. "github.com/pegnet/pegnet/opr"
+	"github.com/zpatrick/go-config"
+)
+
+// TestGradeOPRBlock_Differential grades the recorded mainnet blocks with both the legacy
+// GradeMinimum and the modules/grader pipeline, and checks they agree. With the full size
+// LXRHash both also have to pick the winners recorded on mainnet. With a smaller one the
+// self reported difficulties are recomputed, which changes the entry hashes, so only the
+// number of winners can be checked against mainnet.
+// The recorded blocks are all version 1 and 2, so blocks at the activation heights of the
+// later versions are made up, and only checked against the legacy grading.
+func TestGradeOPRBlock_Differential(t *testing.T) {
+	InitLX()
+	size := os.Getenv("LXRBITSIZE")
+	fullsize := size == "" || size == "30"
+	c := config.NewConfig([]config.Provider{
+		common.NewUnitTestConfigProvider(),
+		config.NewStatic(map[string]string{"Miner.Network": common.MainNetwork}),
+	})
+	chainid := hex.EncodeToString(common.ComputeChainIDFromStrings([]string{"PegNet", common.MainNetwork, common.OPRChainTag}))
+
+	for _, height := range []int64{206422, 209000, 210330, 210419} {
+		t.Run(fmt.Sprintf("%d", height), func(t *testing.T) {
+			tb := loadTestBlock(t, height)
+			if !fullsize {
+				for _, e := range tb.Entries {
+					oprhash := sha256.Sum256(e.Content)
+					diff := binary.BigEndian.Uint64(grader.LX.Hash(append(oprhash[:], e.ExtIDs[0]...)))
+					e.ExtIDs[1] = make([]byte, 8)
+					binary.BigEndian.PutUint64(e.ExtIDs[1], diff)
+				}
+			}
+			testDifferential(t, c, chainid, tb, fullsize)
+		})
+	}
+
+	testutils.SetTestLXR(grader.LX)
+	for _, height := range []int64{common.FloatingPegPriceActivation, common.V4HeightActivation, common.V20HeightActivation} {
+		t.Run(fmt.Sprintf("synthetic %d", height), func(t *testing.T) {
+			testDifferential(t, c, chainid, syntheticTestBlock(height, 70), false)
+		})
+	}
+}
+
+// testDifferential grades the block with both graders. If mainnet is set, the winners
+// also have to be the ones in the block.
+func testDifferential(t *testing.T, c *config.Config, chainid string, tb *testBlock, mainnet bool) {
+	height := tb.Height
+	entries := make([]*factom.Entry, len(tb.Entries))
+	for i, e := range tb.Entries {
+		entries[i] = &factom.Entry{ChainID: chainid, ExtIDs: e.ExtIDs, Content: e.Content}
+	}
+
+	// Legacy: verify the previous winners, then grade the honest records
+	var prevWinners []*OraclePriceRecord
+	for _, w := range tb.PreviousWinners {
+		if w == "" {
+			prevWinners = nil
+			break
+		}
+		hash, _ := hex.DecodeString(w)
+		prevWinners = append(prevWinners, &OraclePriceRecord{EntryHash: hash})
+	}
+	var legacy []*OraclePriceRecord
+	for _, opr := range parseTestEntries(t, c, entries, height) {
+		if opr != nil && VerifyWinners(opr, prevWinners) {
+			legacy = append(legacy, opr)
+		}
+	}
+	sort.SliceStable(legacy, func(i, j int) bool {
+		return binary.BigEndian.Uint64(legacy[i].SelfReportedDifficulty) > binary.BigEndian.Uint64(legacy[j].SelfReportedDifficulty)
+	})
+	legacyGraded := GradeMinimum(legacy, common.MainNetwork, height)
+
+	// modules/grader
+	var oprs []*OraclePriceRecord
+	var oprEntries []*factom.Entry
+	for i, opr := range parseTestEntries(t, c, entries, height) {
+		if opr == nil {
+			continue
+		}
+		oprs = append(oprs, opr)
+		oprEntries = append(oprEntries, entries[i])
+	}
+	oprblock, graded, err := GradeOPRBlock(common.MainNetwork, height, tb.PreviousWinners, oprs, oprEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oprblock == nil {
+		t.Fatal("exp the block to have winners")
+	}
+	if v := graded.Version(); v != common.OPRVersion(common.MainNetwork, height) {
+		t.Errorf("exp version %d, found %d", common.OPRVersion(common.MainNetwork, height), v)
+	}
+
+	winners := graded.WinnersShortHashes()
+	if len(winners) != len(tb.Winners) {
+		t.Fatalf("exp %d winners, found %d", len(tb.Winners), len(winners))
+	}
+	// Both graders have to match mainnet, not just each other
+	if mainnet && !equalStrings(winners, tb.Winners) {
+		t.Errorf("winners differ from mainnet\n mainnet: %v\n module:  %v", tb.Winners, winners)
+	}
+	if len(legacyGraded) < len(winners) {
+		t.Fatalf("legacy graded %d records, exp at least %d", len(legacyGraded), len(winners))
+	}
+	if legacyWinners := ShortHashes(legacyGraded[:len(winners)]); !equalStrings(legacyWinners, winners) {
+		t.Errorf("winners differ\n legacy: %v\n module: %v", legacyWinners, winners)
+	}
+	if !equalStrings(ShortHashes(legacyGraded), ShortHashes(oprblock.GradedOPRs)) {
+		t.Errorf("graded order differs")
+	}
+	for i := range legacyGraded {
+		if legacyGraded[i].Grade != oprblock.GradedOPRs[i].Grade {
+			t.Errorf("grade %d differs, legacy %v, module %v", i, legacyGraded[i].Grade, oprblock.GradedOPRs[i].Grade)
+		}
+	}
+}
+
+// syntheticTestBlock makes up a block of records at the height. The prices are all within
+// a few percent of each other, so the tolerance band decides part of the grading, and
+// every fifth record lies about its difficulty. The winners are left blank, only their
+// number is known.
+func syntheticTestBlock(height int64, records int) *testBlock {
+	rand.Seed(height)
+	version := common.OPRVersion(common.MainNetwork, height)
+	tb := &testBlock{
+		Height:          height,
+		PreviousWinners: testutils.RandomWinners(version),
+		Winners:         make([]string, testutils.WinnerAmt(version)),
+	}
+
+	var base []uint64
+	clustered := func(o interface{}) {
+		content := o.(*modopr.V2Content)
+		if base == nil {
+			base = content.Assets
+		}
+		for i := range content.Assets {
+			content.Assets[i] = base[i] + base[i]*uint64(rand.Intn(300))/10000
+		}
+	}
+	for i := 0; i < records; i++ {
+		_, extids, content := testutils.RandomOPRWithFieldsAndModify(version, int32(height), tb.PreviousWinners, clustered)
+		if i%5 == 4 {
+			extids[1] = []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, byte(i)}
+		}
+		tb.Entries = append(tb.Entries, struct {
+			ExtIDs  [][]byte
+			Content []byte
+		}{extids, content})
+	}
+	return tb
+}
+
+type testBlock struct {
+	Height          int64
+	PreviousWinners []string
+	Winners         []string
+	Entries         []struct {
+		ExtIDs  [][]byte
+		Content []byte
+	}
+}
+
+func loadTestBlock(t *testing.T, height int64) *testBlock {
+	data, err := ioutil.ReadFile(fmt.Sprintf("../modules/grader/testdata/%d.json", height))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb := new(testBlock)
+	if err := json.Unmarshal(data, tb); err != nil {
+		t.Fatal(err)
+	}
+	return tb
+}
+
+// parseTestEntries returns the oprs of the entries. Entries that are not oprs are nil.
+func parseTestEntries(t *testing.T, c *config.Config, entries []*factom.Entry, height int64) []*OraclePriceRecord {
+	oprs := make([]*OraclePriceRecord, 0, len(entries))
+	for _, entry := range entries {
+		opr, err := ParseOPREntry(c, common.MainNetwork, "PegNet", entry, height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		oprs = append(oprs, opr)
+	}
+	return oprs
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
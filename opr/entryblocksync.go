@@ -1,8 +1,13 @@
 package opr
 
 import (
+	"encoding/binary"
+	"fmt"
+
 	"github.com/FactomProject/factom"
 	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+	log "github.com/sirupsen/logrus"
 )
 
 // EntryBlockSync has the current eblock synced to, and the target Eblock
@@ -12,57 +17,322 @@ type EntryBlockSync struct {
 	Current          EntryBlockMarker   // The current eblock we have synced
 	Target           EntryBlockMarker   // The target is the chainhead
 	BlocksToBeParsed []EntryBlockMarker // The eblocks between the current and target (including target)
+	Heights          []int64            // The heights of all parsed eblocks, in order
+
+	Factom common.FactomClient // Where the eblocks are fetched from
+	DB     database.IDatabase  // Where the cursor is persisted, if set
+
+	// Rewound is called with the heights of the parsed eblocks that were dropped when the
+	// chainhead did not link to them, if set. Anything built on them has to be dropped too,
+	// those eblocks are parsed again.
+	Rewound func(dropped []int64) error
+
+	// fetched are the verified eblocks of an unfinished walk back from the chainhead.
+	// If a fetch fails, the next walk only has to fetch what is missing.
+	fetched map[string]EntryBlockMarker
+
+	// saved is the number of heights persisted. If rewrite is set, heights were dropped
+	// and the persisted heights are all written again.
+	saved   int
+	rewrite bool
 }
 
 func NewEntryBlockSync(chainid string) *EntryBlockSync {
 	e := new(EntryBlockSync)
 	e.ChainID = chainid
+	e.Factom = common.DefaultFactomClient
+	e.fetched = make(map[string]EntryBlockMarker)
 
 	return e
 }
 
 // SyncBlocks will query factomd and check if the chainhead has been updated,
-// and fill in the non synced eblocks
+// and fill in the non synced eblocks. Every eblock is verified against the directory
+// block at its height, and the eblocks must link back to our head without any gaps.
 func (a *EntryBlockSync) SyncBlocks() error {
 	// First check to see if the chainhead has been updated
 	expChainHead := a.Head()
 
-	heb, _, err := factom.GetChainHead(a.ChainID)
+	heb, _, err := a.Factom.GetChainHead(a.ChainID)
 	if err != nil {
 		return common.DetailError(err)
 	}
 
-	if expChainHead.KeyMr != heb {
-		// We have a new chainhead. This means we need to walk backwards in our entryblocks
-		// until we find our target. And add all the eblocks we are missing.
-		// From there we will have a clean Eblock sync to properly sync from, and use eblocks
-		// as checkpoints.
-		var eblocks []EntryBlockMarker
-		next := heb
-		for {
-			// If we found the target, we can stop
-			// Or if we found the first eblock in the chain, we can stop.
-			if next == expChainHead.KeyMr || next == common.ZeroHash {
-				break
+	if expChainHead.KeyMr == heb {
+		return nil
+	}
+
+	// We have a new chainhead. This means we need to walk backwards in our entryblocks
+	// until we find our target. And add all the eblocks we are missing.
+	// From there we will have a clean Eblock sync to properly sync from, and use eblocks
+	// as checkpoints.
+	var eblocks []EntryBlockMarker
+	next := heb
+	for {
+		// If we found the target, we can stop
+		// Or if we found the first eblock in the chain, we can stop.
+		if next == expChainHead.KeyMr || next == common.ZeroHash {
+			break
+		}
+
+		marker, err := a.fetch(next)
+		if err != nil {
+			return err // The eblocks fetched so far are kept for the next walk
+		}
+		header := marker.EntryBlock.Header
+
+		if expChainHead.KeyMr != "" && header.BlockSequenceNumber <= expChainHead.EntryBlock.Header.BlockSequenceNumber {
+			if len(eblocks) == 0 && header.BlockSequenceNumber < expChainHead.EntryBlock.Header.BlockSequenceNumber {
+				// Factomd is behind us, we will catch the new eblocks once it catches up
+				log.WithFields(log.Fields{"chain": a.ChainID, "head": heb}).Warn("chainhead is behind the synced eblocks")
+				return nil
 			}
+			// The walk passed our head without finding it, so the chainhead does not build on
+			// the eblocks we synced
+			return a.rewind(heb)
+		}
+
+		if len(eblocks) > 0 {
+			child := eblocks[len(eblocks)-1].EntryBlock.Header
+			if header.BlockSequenceNumber != child.BlockSequenceNumber-1 || header.DBHeight >= child.DBHeight {
+				// A gap in the chain. Drop the eblocks around it, so they are fetched again.
+				delete(a.fetched, next)
+				delete(a.fetched, eblocks[len(eblocks)-1].KeyMr)
+				return fmt.Errorf("eblock %s at height %d does not follow eblock %s at height %d", eblocks[len(eblocks)-1].KeyMr, child.DBHeight, next, header.DBHeight)
+			}
+		}
+
+		eblocks = append(eblocks, marker)
+		next = header.PrevKeyMR
+	}
+
+	// The walk has to end at our head, with the eblock right after it
+	linked := next == expChainHead.KeyMr || (expChainHead.KeyMr == "" && next == common.ZeroHash)
+	if linked && len(eblocks) > 0 {
+		expSeq := int64(0)
+		if expChainHead.KeyMr != "" {
+			expSeq = expChainHead.EntryBlock.Header.BlockSequenceNumber + 1
+		}
+		linked = eblocks[len(eblocks)-1].EntryBlock.Header.BlockSequenceNumber == expSeq
+	}
+	if !linked {
+		return a.rewind(heb)
+	}
+
+	// Add the blocks to our sync in the order they are on chain
+	for i := len(eblocks) - 1; i >= 0; i-- {
+		a.AddNewHeadMarker(eblocks[i])
+	}
+	a.fetched = make(map[string]EntryBlockMarker)
+	return nil
+}
+
+// rewind walks back from a chainhead that does not link to our head, to the last eblock
+// that is also in our parsed heights. The sync is rolled back to that eblock, and the
+// eblocks after it on the chain are added to be parsed. If none is found, the chain is
+// synced again from the first eblock.
+func (a *EntryBlockSync) rewind(heb string) error {
+	var eblocks []EntryBlockMarker
+	var last EntryBlockMarker
+	for next := heb; next != common.ZeroHash; {
+		marker, err := a.fetch(next)
+		if err != nil {
+			return err
+		}
+		header := marker.EntryBlock.Header
+
+		if len(eblocks) > 0 && header.BlockSequenceNumber != eblocks[len(eblocks)-1].EntryBlock.Header.BlockSequenceNumber-1 {
+			a.fetched = make(map[string]EntryBlockMarker)
+			return fmt.Errorf("eblock %s does not follow eblock %s", eblocks[len(eblocks)-1].KeyMr, next)
+		}
+		// The heights are of every eblock from the first, so the eblock with sequence n
+		// is at the nth height
+		if seq := header.BlockSequenceNumber; seq < int64(len(a.Heights)) && a.Heights[seq] == header.DBHeight {
+			last = marker
+			break
+		}
+		eblocks = append(eblocks, marker)
+		next = header.PrevKeyMR
+	}
+
+	keep := 0
+	if last.EntryBlock != nil {
+		keep = int(last.EntryBlock.Header.BlockSequenceNumber) + 1
+	}
+	dropped := append([]int64{}, a.Heights[keep:]...)
+	log.WithFields(log.Fields{
+		"chain":   a.ChainID,
+		"head":    heb,
+		"synced":  a.Current.KeyMr,
+		"dropped": len(dropped),
+	}).Warn("chainhead does not link to the synced eblocks, syncing again from the last eblock that does")
+
+	if a.Rewound != nil && len(dropped) > 0 {
+		if err := a.Rewound(dropped); err != nil {
+			return err
+		}
+	}
+
+	a.Heights = a.Heights[:keep]
+	a.rewrite = true
+	a.Current = last
+	a.Target = last
+	a.BlocksToBeParsed = nil
+	for i := len(eblocks) - 1; i >= 0; i-- {
+		a.AddNewHeadMarker(eblocks[i])
+	}
+	a.fetched = make(map[string]EntryBlockMarker)
+	return nil
+}
+
+// fetch returns the eblock, either from an unfinished walk or from factomd.
+// Eblocks from factomd are verified before they are returned.
+func (a *EntryBlockSync) fetch(keymr string) (EntryBlockMarker, error) {
+	if marker, ok := a.fetched[keymr]; ok {
+		return marker, nil
+	}
+
+	eblock, err := a.Factom.GetEBlock(keymr)
+	if err != nil {
+		return EntryBlockMarker{}, common.DetailError(err)
+	}
+	if err := a.VerifyEBlock(keymr, eblock); err != nil {
+		return EntryBlockMarker{}, err
+	}
+
+	marker := EntryBlockMarker{keymr, eblock}
+	a.fetched[keymr] = marker
+	return marker, nil
+}
+
+// VerifyEBlock checks the eblock belongs to our chain, and is in the directory block
+// at its height
+func (a *EntryBlockSync) VerifyEBlock(keymr string, eblock *factom.EBlock) error {
+	if eblock == nil {
+		return fmt.Errorf("eblock %s is nil", keymr)
+	}
+	if eblock.Header.ChainID != a.ChainID {
+		return fmt.Errorf("eblock %s is in chain %s, exp %s", keymr, eblock.Header.ChainID, a.ChainID)
+	}
 
-			eblock, err := factom.GetEBlock(next)
-			if err != nil {
-				return err
+	dblock, _, err := a.Factom.GetDBlockByHeight(eblock.Header.DBHeight)
+	if err != nil {
+		return common.DetailError(err)
+	}
+	if dblock == nil {
+		return fmt.Errorf("dblock %d is nil", eblock.Header.DBHeight)
+	}
+	for _, entry := range dblock.DBEntries {
+		if entry.ChainID == a.ChainID {
+			if entry.KeyMR != keymr {
+				return fmt.Errorf("dblock %d has eblock %s for the chain, not %s", eblock.Header.DBHeight, entry.KeyMR, keymr)
 			}
+			return nil
+		}
+	}
+	return fmt.Errorf("dblock %d does not have eblock %s", eblock.Header.DBHeight, keymr)
+}
+
+// EntryBlockCursor is what is persisted of an EntryBlockSync. The heights are each
+// their own key, see EBlockHeightKey.
+type EntryBlockCursor struct {
+	Current EntryBlockMarker
+}
+
+// EBlockHeightKey is the key of a parsed eblock height of a chain. The keys of a chain
+// start with its chainid, and sort by height.
+func EBlockHeightKey(chainID string, height int64) []byte {
+	return append([]byte(chainID), database.HeightToBytes(height)...)
+}
 
-			eblocks = append(eblocks, EntryBlockMarker{next, eblock})
-			next = eblock.Header.PrevKeyMR
+// SaveCursor adds the last parsed eblock to the batch, so a restart only walks back to
+// it, along with the heights parsed since the last save. The eblocks still to be parsed
+// are not saved, they are fetched again. If the batch is not written, LoadCursor has to
+// be called to go back to the cursor on disk.
+func (a *EntryBlockSync) SaveCursor(batch *database.Batch) error {
+	if a.DB == nil {
+		return nil
+	}
+
+	data, err := database.Encode(EntryBlockCursor{Current: a.Current})
+	if err != nil {
+		return err
+	}
+
+	saved := a.saved
+	if a.rewrite {
+		// Heights were dropped, so the persisted ones are replaced
+		iter := a.DB.IteratePrefix(database.BUCKET_EBLOCK_SYNC, []byte(a.ChainID))
+		for iter.Next() {
+			if len(iter.Key()) == len(a.ChainID)+8 {
+				batch.Delete(database.BUCKET_EBLOCK_SYNC, append([]byte{}, iter.Key()...))
+			}
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
 		}
+		saved = 0
+	}
+	for _, height := range a.Heights[saved:] {
+		batch.Put(database.BUCKET_EBLOCK_SYNC, EBlockHeightKey(a.ChainID, height), []byte{})
+	}
+	batch.Put(database.BUCKET_EBLOCK_SYNC, []byte(a.ChainID), data)
+	a.saved = len(a.Heights)
+	a.rewrite = false
+	return nil
+}
+
+// LoadCursor restores the last persisted cursor. If there is none, nothing changes.
+func (a *EntryBlockSync) LoadCursor() error {
+	if a.DB == nil {
+		return nil
+	}
+
+	data, err := a.DB.Get(database.BUCKET_EBLOCK_SYNC, []byte(a.ChainID))
+	if err == database.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	cursor := new(EntryBlockCursor)
+	if err := database.Decode(cursor, data); err != nil {
+		return err
+	}
 
-		// Add the blocks to our sync in the order they are on chain
-		for i := len(eblocks) - 1; i >= 0; i-- {
-			a.AddNewHeadMarker(eblocks[i])
+	var heights []int64
+	iter := a.DB.IteratePrefix(database.BUCKET_EBLOCK_SYNC, []byte(a.ChainID))
+	for iter.Next() {
+		if key := iter.Key(); len(key) == len(a.ChainID)+8 {
+			heights = append(heights, int64(binary.BigEndian.Uint64(key[len(a.ChainID):])))
 		}
 	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	a.Current = cursor.Current
+	a.Target = cursor.Current
+	a.Heights = heights
+	a.BlocksToBeParsed = nil
+	a.saved = len(heights)
+	a.rewrite = false
 	return nil
 }
 
+// Reset drops everything synced, so the chain is synced again from the first eblock
+func (a *EntryBlockSync) Reset() {
+	a.Current = EntryBlockMarker{}
+	a.Target = EntryBlockMarker{}
+	a.BlocksToBeParsed = nil
+	a.Heights = nil
+	a.rewrite = true
+	a.fetched = make(map[string]EntryBlockMarker)
+}
+
 // Synced returns if fully synced (current == target)
 func (a *EntryBlockSync) Synced() bool {
 	return a.Current.IsSameAs(&a.Target)
@@ -87,6 +357,9 @@ func (a *EntryBlockSync) BlockParsed(block EntryBlockMarker) {
 		panic("This block should not be next in the list")
 	}
 	a.Current = block
+	if block.EntryBlock != nil {
+		a.Heights = append(a.Heights, block.EntryBlock.Header.DBHeight)
+	}
 	tmp := make([]EntryBlockMarker, len(a.BlocksToBeParsed)-1)
 	copy(tmp, a.BlocksToBeParsed[1:])
 	a.BlocksToBeParsed = tmp
@@ -1,8 +1,13 @@
 package opr_test
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
 
+	"github.com/FactomProject/factom"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
 	. "github.com/pegnet/pegnet/opr"
 )
 
@@ -27,3 +32,207 @@ func TestEntryBlockSync_AddNewHeadMarker(t *testing.T) {
 	}
 
 }
+
+// flakyFactom fails eblock fetches on request, and can serve a stale chainhead
+type flakyFactom struct {
+	*common.FakeFactomClient
+	fetches   int
+	failAt    int
+	head      string
+	badDBlock bool
+}
+
+func (f *flakyFactom) GetChainHead(chainid string) (string, bool, error) {
+	if f.head != "" {
+		return f.head, false, nil
+	}
+	return f.FakeFactomClient.GetChainHead(chainid)
+}
+
+func (f *flakyFactom) GetEBlock(keymr string) (*factom.EBlock, error) {
+	f.fetches++
+	if f.fetches == f.failAt {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return f.FakeFactomClient.GetEBlock(keymr)
+}
+
+func (f *flakyFactom) GetDBlockByHeight(height int64) (*factom.DBlock, []byte, error) {
+	if f.badDBlock {
+		return new(factom.DBlock), nil, nil
+	}
+	return f.FakeFactomClient.GetDBlockByHeight(height)
+}
+
+const testSyncChain = "a642a8674f46696cc47fdb6b65f9c87b2a19c5ea8123b3d2f0c13b6f33a9d5ef"
+
+// addTestEBlocks adds an eblock to the chain for each of the next blocks
+func addTestEBlocks(t *testing.T, chain *common.FakeFactomClient, blocks int) {
+	ec, _ := factom.GetECAddress("Es2XT3jSxi1xqrDvS5JERM3W3jh1awRHuyoahn3hbQLyfEi1jvbq")
+	chain.AddECAddress(ec, 100)
+	for i := 0; i < blocks; i++ {
+		entry := &factom.Entry{ChainID: testSyncChain, Content: []byte(fmt.Sprintf("%d", chain.Height()))}
+		if _, err := chain.CommitEntry(entry, ec); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := chain.RevealEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+		chain.AdvanceBlock()
+	}
+}
+
+// parseAll marks all the eblocks to be parsed as parsed, and returns their heights
+func parseAll(e *EntryBlockSync) []int64 {
+	var heights []int64
+	for block := e.NextEBlock(); block != nil; block = e.NextEBlock() {
+		heights = append(heights, block.EntryBlock.Header.DBHeight)
+		e.BlockParsed(*block)
+	}
+	return heights
+}
+
+// saveCursor writes the cursor of the sync to its database
+func saveCursor(t *testing.T, e *EntryBlockSync) {
+	batch := database.NewBatch()
+	if err := e.SaveCursor(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.DB.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEntryBlockSync_SyncBlocks(t *testing.T) {
+	chain := common.NewFakeFactomClient(10)
+	addTestEBlocks(t, chain, 5)
+	client := &flakyFactom{FakeFactomClient: chain}
+
+	e := NewEntryBlockSync(testSyncChain)
+	e.Factom = client
+
+	t.Run("resume after a failed fetch", func(t *testing.T) {
+		client.failAt = 3
+		if err := e.SyncBlocks(); err == nil {
+			t.Fatal("exp an error")
+		}
+		if e.NextEBlock() != nil {
+			t.Errorf("exp no eblocks from a failed walk")
+		}
+		if err := e.SyncBlocks(); err != nil {
+			t.Fatal(err)
+		}
+		// 2 fetched, 1 failed, and only the last 3 are fetched again
+		if client.fetches != 6 {
+			t.Errorf("exp 6 fetches, found %d", client.fetches)
+		}
+		if heights := parseAll(e); !reflect.DeepEqual(heights, []int64{10, 11, 12, 13, 14}) {
+			t.Errorf("unexpected heights %v", heights)
+		}
+	})
+
+	t.Run("stale chainhead", func(t *testing.T) {
+		stale, _, _ := chain.GetDBlockByHeight(12)
+		client.head = stale.DBEntries[0].KeyMR
+		if err := e.SyncBlocks(); err != nil {
+			t.Fatal(err)
+		}
+		if e.NextEBlock() != nil || !e.Synced() {
+			t.Errorf("exp nothing to sync from a stale chainhead")
+		}
+		client.head = ""
+	})
+
+	t.Run("unverified eblock", func(t *testing.T) {
+		addTestEBlocks(t, chain, 1)
+		client.badDBlock = true
+		if err := e.SyncBlocks(); err == nil {
+			t.Error("exp an error for an eblock not in its dblock")
+		}
+		client.badDBlock = false
+		if err := e.SyncBlocks(); err != nil {
+			t.Fatal(err)
+		}
+		if heights := parseAll(e); !reflect.DeepEqual(heights, []int64{15}) {
+			t.Errorf("unexpected heights %v", heights)
+		}
+	})
+
+	t.Run("persisted cursor", func(t *testing.T) {
+		db := database.NewMapDb()
+		e.DB = db
+		saveCursor(t, e)
+		addTestEBlocks(t, chain, 2)
+
+		restored := NewEntryBlockSync(testSyncChain)
+		restored.Factom = client
+		restored.DB = db
+		if err := restored.LoadCursor(); err != nil {
+			t.Fatal(err)
+		}
+		if !restored.Current.IsSameAs(&e.Current) || !reflect.DeepEqual(restored.Heights, e.Heights) {
+			t.Errorf("exp the cursor to be restored")
+		}
+
+		client.fetches = 0
+		if err := restored.SyncBlocks(); err != nil {
+			t.Fatal(err)
+		}
+		if client.fetches != 2 {
+			t.Errorf("exp only the new eblocks to be fetched, found %d fetches", client.fetches)
+		}
+		if heights := parseAll(restored); !reflect.DeepEqual(heights, []int64{16, 17}) {
+			t.Errorf("unexpected heights %v", heights)
+		}
+	})
+}
+
+func TestEntryBlockSync_Unlinked(t *testing.T) {
+	chain := common.NewFakeFactomClient(10)
+	addTestEBlocks(t, chain, 3)
+
+	e := NewEntryBlockSync(testSyncChain)
+	e.Factom = chain
+	e.DB = database.NewMapDb()
+	if err := e.SyncBlocks(); err != nil {
+		t.Fatal(err)
+	}
+	parseAll(e)
+
+	// Our last eblock is not on the chain factomd has
+	other := *e.Current.EntryBlock
+	e.Current = EntryBlockMarker{KeyMr: "b642a8674f46696cc47fdb6b65f9c87b2a19c5ea8123b3d2f0c13b6f33a9d5ef", EntryBlock: &other}
+	e.Target = e.Current
+	e.Heights[2] = 99
+	saveCursor(t, e)
+	addTestEBlocks(t, chain, 1)
+
+	var dropped []int64
+	e.Rewound = func(heights []int64) error {
+		dropped = heights
+		return nil
+	}
+	if err := e.SyncBlocks(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dropped, []int64{99}) {
+		t.Errorf("exp the unlinked eblock to be dropped, found %v", dropped)
+	}
+	if e.Current.EntryBlock.Header.DBHeight != 11 {
+		t.Errorf("exp to rewind to the last linked eblock at 11, found %d", e.Current.EntryBlock.Header.DBHeight)
+	}
+	if heights := parseAll(e); !reflect.DeepEqual(heights, []int64{12, 13}) {
+		t.Errorf("exp the eblocks after the linked eblock to be synced again, found %v", heights)
+	}
+
+	// The dropped height is not persisted
+	saveCursor(t, e)
+	restored := NewEntryBlockSync(testSyncChain)
+	restored.DB = e.DB
+	if err := restored.LoadCursor(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored.Heights, []int64{10, 11, 12, 13}) {
+		t.Errorf("unexpected heights %v", restored.Heights)
+	}
+}
@@ -0,0 +1,211 @@
+package opr
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/FactomProject/factom"
+	"github.com/pegnet/pegnet/common"
+)
+
+// ChainExportVersion is the version of the export format written by ChainExportWriter
+const ChainExportVersion = 1
+
+// An export file is line delimited json. The first line is the ChainExportHeader, and
+// every line after is an ExportedEBlock, in the order they are on chain.
+// Files ending in .gz are gzipped.
+
+// ChainExportHeader describes the chain in an export file
+type ChainExportHeader struct {
+	Version int    `json:"version"`
+	ChainID string `json:"chainid"`
+	Network string `json:"network"`
+}
+
+// ExportedEBlock is an eblock of the opr chain with all of its entries
+type ExportedEBlock struct {
+	KeyMR    string          `json:"keymr"`
+	DBHeight int64           `json:"dbheight"`
+	Entries  []ExportedEntry `json:"entries"`
+}
+
+// ExportedEntry is a single entry of an eblock. The hash is kept so the entry
+// can be verified when it is read back.
+type ExportedEntry struct {
+	Hash    string   `json:"hash"`
+	ExtIDs  [][]byte `json:"extids"`
+	Content []byte   `json:"content"`
+}
+
+// Entry returns the factom entry in the chain
+func (e *ExportedEntry) Entry(chainid string) *factom.Entry {
+	return &factom.Entry{ChainID: chainid, ExtIDs: e.ExtIDs, Content: e.Content}
+}
+
+// ChainExportWriter writes the eblocks of a chain to an export file
+type ChainExportWriter struct {
+	Header ChainExportHeader
+
+	enc    *json.Encoder
+	closer []io.Closer
+}
+
+// NewChainExportWriter writes the header to w. Eblocks are written with WriteEBlock.
+func NewChainExportWriter(w io.Writer, header ChainExportHeader) (*ChainExportWriter, error) {
+	e := new(ChainExportWriter)
+	e.Header = header
+	e.Header.Version = ChainExportVersion
+	e.enc = json.NewEncoder(w)
+
+	if err := e.enc.Encode(e.Header); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// CreateChainExport creates the export file at the path, gzipped if the path ends in .gz
+func CreateChainExport(path string, header ChainExportHeader) (*ChainExportWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var w io.Writer = f
+	var closers []io.Closer
+	if strings.HasSuffix(path, ".gz") {
+		gz := gzip.NewWriter(f)
+		w = gz
+		closers = append(closers, gz)
+	}
+	closers = append(closers, f)
+
+	e, err := NewChainExportWriter(w, header)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	e.closer = closers
+	return e, nil
+}
+
+// WriteEBlock appends the eblock to the export
+func (e *ChainExportWriter) WriteEBlock(block *ExportedEBlock) error {
+	return e.enc.Encode(block)
+}
+
+// Close flushes and closes the file, if the writer was created with CreateChainExport
+func (e *ChainExportWriter) Close() error {
+	for _, c := range e.closer {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChainExportReader reads the eblocks of an export file in order
+type ChainExportReader struct {
+	Header ChainExportHeader
+
+	dec    *json.Decoder
+	closer []io.Closer
+}
+
+// NewChainExportReader reads the header from r
+func NewChainExportReader(r io.Reader) (*ChainExportReader, error) {
+	e := new(ChainExportReader)
+	e.dec = json.NewDecoder(bufio.NewReader(r))
+
+	if err := e.dec.Decode(&e.Header); err != nil {
+		return nil, fmt.Errorf("failed to read the export header: %s", err.Error())
+	}
+	if e.Header.Version != ChainExportVersion {
+		return nil, fmt.Errorf("export version %d is not supported", e.Header.Version)
+	}
+	return e, nil
+}
+
+// OpenChainExport opens the export file at the path, gzipped if the path ends in .gz
+func OpenChainExport(path string) (*ChainExportReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.Reader = f
+	var closers []io.Closer
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		r = gz
+		closers = append(closers, gz)
+	}
+	closers = append(closers, f)
+
+	e, err := NewChainExportReader(r)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	e.closer = closers
+	return e, nil
+}
+
+// Next returns the next eblock of the export, or io.EOF when there are no more
+func (e *ChainExportReader) Next() (*ExportedEBlock, error) {
+	block := new(ExportedEBlock)
+	if err := e.dec.Decode(block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// Close closes the file, if the reader was opened with OpenChainExport
+func (e *ChainExportReader) Close() error {
+	for _, c := range e.closer {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportChain fetches every eblock of the chain in the header and its entries
+// from factomd, and writes them to the export.
+func ExportChain(e *ChainExportWriter) error {
+	chain := NewEntryBlockSync(e.Header.ChainID)
+	if err := chain.SyncBlocks(); err != nil {
+		return err
+	}
+
+	for i, block := range chain.BlocksToBeParsed {
+		exp := &ExportedEBlock{
+			KeyMR:    block.KeyMr,
+			DBHeight: block.EntryBlock.Header.DBHeight,
+			Entries:  make([]ExportedEntry, 0, len(block.EntryBlock.EntryList)),
+		}
+		for _, eb := range block.EntryBlock.EntryList {
+			entry, err := chain.Factom.GetEntry(eb.EntryHash)
+			if err != nil {
+				return common.DetailError(fmt.Errorf("entry %s : %s", eb.EntryHash, err.Error()))
+			}
+			exp.Entries = append(exp.Entries, ExportedEntry{Hash: eb.EntryHash, ExtIDs: entry.ExtIDs, Content: entry.Content})
+		}
+
+		if err := e.WriteEBlock(exp); err != nil {
+			return err
+		}
+		if (i+1)%100 == 0 || i == len(chain.BlocksToBeParsed)-1 {
+			gLog.WithField("dbht", exp.DBHeight).Infof("exported %d of %d eblocks", i+1, len(chain.BlocksToBeParsed))
+		}
+	}
+	return nil
+}
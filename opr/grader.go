@@ -39,17 +39,24 @@ type QuickGrader struct {
 	OPRChainID       []byte
 	OPRChainIDString string
 
-	Balances *balances.BalanceTracker
-	Burns    *balances.BurnTracking
-	OPRChain *EntryBlockSync
+	Balances     *balances.BalanceTracker
+	Burns        *balances.BurnTracking
+	Transactions *balances.TransactionTracking
+	OPRChain     *EntryBlockSync
 
 	Config *config.Config
+	Factom common.FactomClient
+	DB     database.IDatabase
 
 	// oprBlks is all the eblocks that contain the oprs
 	oprBlks    []*OprBlock
 	oprBlkLock sync.Mutex
 
-	BlockStore IOPRBlockStore
+	BlockStore   IOPRBlockStore
+	BalanceStore *balances.BalanceStore
+
+	// paidDbht is the last oprblk whose rewards are in the balances
+	paidDbht int64
 
 	// lastGraded is the last graded oprblk, so we know
 	// where to start grading
@@ -78,16 +85,163 @@ func NewQuickGrader(config *config.Config, db database.IDatabase, balanceTraker
 
 	g.alerts = make(map[string]chan *OPRs)
 
+	g.Factom = common.DefaultFactomClient
+	g.DB = db
 	g.OPRChain = NewEntryBlockSync(g.OPRChainIDString)
+	g.OPRChain.DB = db
+	g.OPRChain.Rewound = g.dropOPRBlocks
 	g.oprBlks = make([]*OprBlock, 0)
 
 	g.BlockStore = NewOPRBlockStore(db)
 	g.Balances = balanceTraker
 	g.Burns = balances.NewBurnTracking(g.Balances)
+	g.Transactions = balances.NewTransactionTracking(config, g.Balances, g)
+
+	g.BalanceStore = balances.NewBalanceStore(db)
+	g.Burns.Checkpoint = g.CheckpointBalances
+	g.Transactions.Checkpoint = g.CheckpointBalances
+	common.CheckAndPanic(g.RestoreBalances())
+	common.CheckAndPanic(g.RestoreOPRChain())
 
 	return g
 }
 
+// SetFactomClient sets the client the grader and its chain syncing use
+func (g *QuickGrader) SetFactomClient(client common.FactomClient) {
+	g.Factom = client
+	g.OPRChain.Factom = client
+	g.Burns.Factom = client
+	g.Transactions.Factom = client
+}
+
+// CheckpointBalances persists the balances and the heights they are synced to
+func (g *QuickGrader) CheckpointBalances() error {
+	batch := database.NewBatch()
+	if err := g.checkpointBalances(batch); err != nil {
+		return err
+	}
+	return g.DB.Write(batch)
+}
+
+// checkpointBalances adds the balances and the heights they are synced to, to the batch
+func (g *QuickGrader) checkpointBalances(batch *database.Batch) error {
+	return g.BalanceStore.Checkpoint(batch, g.Balances, balances.SyncHeights{
+		Payouts:      g.paidDbht,
+		Burns:        g.Burns.FctDbht,
+		Transactions: g.Transactions.Dbht,
+		Applied:      g.Transactions.Applied(),
+	})
+}
+
+// RestoreBalances rolls the balances and the heights they are synced to back to
+// the last checkpoint. Anything applied since is reapplied on the next sync.
+func (g *QuickGrader) RestoreBalances() error {
+	heights, err := g.BalanceStore.Load(g.Balances)
+	if err != nil {
+		return err
+	}
+	g.paidDbht = heights.Payouts
+	g.Burns.FctDbht = heights.Burns
+	g.Transactions.Restore(heights.Transactions, heights.Applied)
+	return nil
+}
+
+// RestoreOPRChain loads the opr chain cursor, and the oprblocks synced up to it.
+// If an oprblock is missing, the cursor is reset so the chain is synced again and
+// the missing blocks are repaired. Blocks already on disk are not fetched again.
+func (g *QuickGrader) RestoreOPRChain() error {
+	if err := g.OPRChain.LoadCursor(); err != nil {
+		return err
+	}
+
+	blocks := make([]*OprBlock, 0, len(g.OPRChain.Heights))
+	for _, height := range g.OPRChain.Heights {
+		oprblock, err := g.BlockStore.FetchOPRBlock(height)
+		if err == database.ErrNotFound {
+			gLog.WithField("dbht", height).Warn("oprblock is missing, syncing the opr chain again")
+			g.OPRChain.Reset()
+			blocks = make([]*OprBlock, 0)
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if oprblock.EmptyOPRBlock {
+			continue
+		}
+		blocks = append(blocks, oprblock)
+	}
+
+	g.oprBlkLock.Lock()
+	g.oprBlks = blocks
+	g.oprBlkLock.Unlock()
+	return nil
+}
+
+// dropOPRBlocks removes the oprblocks of the eblocks the opr chain was rolled back past,
+// along with their price history, so they are graded again from factomd instead of
+// reused from disk
+func (g *QuickGrader) dropOPRBlocks(dropped []int64) error {
+	batch := database.NewBatch()
+	for _, height := range dropped {
+		if err := g.BlockStore.DeleteOPRBlock(batch, height); err != nil {
+			return err
+		}
+	}
+	if err := g.DB.Write(batch); err != nil {
+		return err
+	}
+
+	g.oprBlkLock.Lock()
+	kept := make([]*OprBlock, 0, len(g.oprBlks))
+	for _, block := range g.oprBlks {
+		if block.Dbht < dropped[0] {
+			kept = append(kept, block)
+		}
+	}
+	g.oprBlks = kept
+	g.oprBlkLock.Unlock()
+
+	if dropped[0] <= g.paidDbht {
+		// The rewards are not paid again for the blocks graded again
+		gLog.WithFields(log.Fields{"dbht": dropped[0], "paid": g.paidDbht}).Error("rolled back oprblocks that were already paid out")
+	}
+	return nil
+}
+
+// rollbackBalances restores the last checkpoint after a failed block
+func (g *QuickGrader) rollbackBalances() {
+	if err := g.RestoreBalances(); err != nil {
+		gLog.WithError(err).Fatal("failed to restore balances")
+	}
+}
+
+// rollbackSync restores the balances and the opr chain to what is on disk, after a
+// block failed before it was written
+func (g *QuickGrader) rollbackSync() {
+	g.rollbackBalances()
+	g.OPRChain.Reset() // In case nothing is on disk yet
+	if err := g.RestoreOPRChain(); err != nil {
+		gLog.WithError(err).Fatal("failed to restore the opr chain")
+	}
+}
+
+// payWinners adds the rewards of the oprblock winners to the balances
+func (g *QuickGrader) payWinners(oprblock *OprBlock) error {
+	payouts := g.MinRecords(oprblock.Dbht)
+	for place, winner := range oprblock.GradedOPRs[:payouts] { // The top 25 matter in version 2
+		reward := GetRewardFromPlace(place, g.Network, oprblock.Dbht)
+		if reward > 0 {
+			err := g.Balances.AddToBalance(winner.CoinbasePEGAddress, reward)
+			if err != nil {
+				return fmt.Errorf("failed to update balance of %s: %s", winner.CoinbasePEGAddress, err.Error())
+			}
+			// Debug logs were here before to print the winners, it was a bit noisy
+		}
+	}
+	return nil
+}
+
 func (g *QuickGrader) Close() error {
 	log.Info("closing grader db")
 	return g.BlockStore.Close()
@@ -202,6 +356,15 @@ func (g *QuickGrader) Run(monitor *common.Monitor, ctx context.Context) {
 					log.WithFields(log.Fields{
 						"id": "grader",
 					}).WithError(err).Errorf("error processing burns")
+					g.rollbackBalances()
+				}
+
+				err = g.Transactions.UpdateTransactions(firstOPR.Dbht)
+				if err != nil {
+					log.WithFields(log.Fields{
+						"id": "grader",
+					}).WithError(err).Errorf("error processing transactions")
+					g.rollbackBalances()
 				}
 			}
 		}
@@ -222,6 +385,17 @@ func (g *QuickGrader) Sync() error {
 		return err
 	}
 
+	// If the chain was rolled back, the cursor is on disk before anything is graded again
+	batch := database.NewBatch()
+	if err := g.OPRChain.SaveCursor(batch); err != nil {
+		g.rollbackSync()
+		return err
+	}
+	if err := g.DB.Write(batch); err != nil {
+		g.rollbackSync()
+		return err
+	}
+
 	dbheight := int64(0)
 	fLog.Debugf("syncing entries")
 	startAmt := len(g.OPRChain.BlocksToBeParsed)
@@ -241,61 +415,78 @@ func (g *QuickGrader) Sync() error {
 				}).Debugf("syncing entries, %.2f%%", float64(done)/float64(startAmt)*100)
 			}
 
-			var err error
-			// Before we try to fetch from the net, we try and fetch from disk
-			oprblock, _ := g.BlockStore.FetchOPRBlock(block.EntryBlock.Header.DBHeight)
-			if oprblock == nil {
-				// Fetch from factomd
-				oprblock, err = g.FetchOPRBlock(block)
-			} else {
-				if oprblock.EmptyOPRBlock {
-					g.OPRChain.BlockParsed(*block)
-					continue // This eblock does not have a valid opr block
-				}
+			if err := g.syncEBlock(block); err != nil {
+				return err
 			}
+		}
+	}
+	fLog.WithField("height", dbheight).Debugf("synced!")
 
-			// If we have an error from factomd
-			if err != nil {
+	return nil
+}
+
+// syncEBlock grades the oprblock of the eblock, or loads it from disk. The oprblock, the
+// rewards of its winners and the opr chain cursor are written in a single batch, so a
+// block is either entirely on disk or not at all.
+func (g *QuickGrader) syncEBlock(block *EntryBlockMarker) error {
+	dbheight := block.EntryBlock.Header.DBHeight
+	batch := database.NewBatch()
+
+	// Before we try to fetch from the net, we try and fetch from disk
+	oprblock, _ := g.BlockStore.FetchOPRBlock(dbheight)
+	if oprblock == nil {
+		// Fetch from factomd
+		var err error
+		oprblock, err = g.FetchOPRBlock(block)
+		if err != nil {
+			return err // We have an error from factomd
+		}
+		if oprblock == nil {
+			if err := g.BlockStore.WriteInvalidOPRBlock(batch, dbheight); err != nil {
 				return err
 			}
-
-			if oprblock == nil {
-				err := g.BlockStore.WriteInvalidOPRBlock(block.EntryBlock.Header.DBHeight)
-				if err != nil {
-					return err
-				}
-				g.OPRChain.BlockParsed(*block) // This block is done being processed
-				continue
+		}
+	}
+	valid := oprblock != nil && !oprblock.EmptyOPRBlock // Else this eblock does not have a valid opr block
+
+	if valid {
+		// Let's add the winner's rewards. They will be happy that we do this step :)
+		// Blocks at or below the checkpoint are already in the balances.
+		if dbheight > g.paidDbht {
+			err := g.payWinners(oprblock)
+			if err == nil {
+				g.paidDbht = dbheight
+				err = g.checkpointBalances(batch)
 			}
-
-			g.oprBlkLock.Lock()
-			// We add the oprs, and the graded blocks. The next iteration of this loop will use these graded oprs.
-			err = g.BlockStore.WriteOPRBlock(oprblock)
 			if err != nil {
-				g.oprBlkLock.Unlock()
+				// Roll back whatever part of the block was applied
+				g.rollbackSync()
 				return err
 			}
-			g.oprBlks = append(g.oprBlks, oprblock)
-			g.oprBlkLock.Unlock()
-
-			// Let's add the winner's rewards. They will be happy that we do this step :)
-			payouts := g.MinRecords(dbheight)
-			for place, winner := range oprblock.GradedOPRs[:payouts] { // The top 25 matter in version 2
-				reward := GetRewardFromPlace(place, g.Network, block.EntryBlock.Header.DBHeight)
-				if reward > 0 {
-					err := g.Balances.AddToBalance(winner.CoinbasePEGAddress, reward)
-					if err != nil {
-						log.WithError(err).Fatal("Failed to update balance")
-					}
-					// Debug logs were here before to print the winners, it was a bit noisy
-				}
-			}
+		}
 
-			g.OPRChain.BlockParsed(*block)
+		// We add the oprs, and the graded blocks. The next iteration of the sync will use these graded oprs.
+		if err := g.BlockStore.WriteOPRBlock(batch, oprblock); err != nil {
+			g.rollbackSync()
+			return err
 		}
 	}
-	fLog.WithField("height", dbheight).Debugf("synced!")
 
+	g.OPRChain.BlockParsed(*block) // This block is done being processed
+	if err := g.OPRChain.SaveCursor(batch); err != nil {
+		g.rollbackSync()
+		return err
+	}
+	if err := g.DB.Write(batch); err != nil {
+		g.rollbackSync()
+		return err
+	}
+
+	if valid {
+		g.oprBlkLock.Lock()
+		g.oprBlks = append(g.oprBlks, oprblock)
+		g.oprBlkLock.Unlock()
+	}
 	return nil
 }
 
@@ -306,11 +497,9 @@ func (g *QuickGrader) FetchOPRBlock(block *EntryBlockMarker) (*OprBlock, error)
 		return nil, nil
 	}
 
-	var oprs []*OraclePriceRecord
-	var err error
 	// Multithread when there is a lot (like a 6x speedup in my tests against mainnet)
-	oprs, err = g.ParallelFetchOPRsFromEBlock(block, 4, true)
-
+	// The previous winners are checked by the grader, not when fetching
+	oprs, entries, err := g.parallelFetchFromEBlock(block, 4, false)
 	if err != nil {
 		return nil, err
 	}
@@ -321,21 +510,15 @@ func (g *QuickGrader) FetchOPRBlock(block *EntryBlockMarker) (*OprBlock, error)
 		return nil, nil // Not enough oprs for this block be a valid oprblock
 	}
 
-	// GradeMinimum will only grade the first 50 honest records
-	graded := GradeMinimum(oprs, g.Network, block.EntryBlock.Header.DBHeight)
-	if len(graded) < min { // We might lose some when we reject dishonest records
-		return nil, nil // Not enough to be complete
-	}
-
-	// We are saving all of the oprs here, even the ones that were not graded.
+	// The grader only grades the first 50 honest records. We are saving all of the oprs
+	// it accepted here, even the ones that were not graded.
 	// TODO: Should we save them all? Or truncate here
-	oprblock := &OprBlock{
-		Dbht:               block.EntryBlock.Header.DBHeight,
-		OPRs:               oprs,
-		GradedOPRs:         graded,
-		TotalNumberRecords: len(oprs),
+	prevWinners := ShortHashes(g.GetPreviousWinners(int32(block.EntryBlock.Header.DBHeight)))
+	oprblock, _, err := GradeOPRBlock(g.Network, block.EntryBlock.Header.DBHeight, prevWinners, oprs, entries)
+	if err != nil {
+		return nil, err
 	}
-	return oprblock, nil
+	return oprblock, nil // Nil if there are not enough to be complete
 }
 
 type OPRWorkRequest struct {
@@ -346,6 +529,7 @@ type OPRWorkRequest struct {
 type OPRWorkResponse struct {
 	order int // The original entry order
 	opr   *OraclePriceRecord
+	entry *factom.Entry // The entry the opr was parsed from
 	err   error
 }
 
@@ -355,6 +539,12 @@ type OPRWorkResponse struct {
 //		workerCount		Number of parallel outbound requests
 //		enforceWinners	Verify the previous winners
 func (g *QuickGrader) ParallelFetchOPRsFromEBlock(block *EntryBlockMarker, workerCount int, enforceWinners bool) ([]*OraclePriceRecord, error) {
+	oprs, _, err := g.parallelFetchFromEBlock(block, workerCount, enforceWinners)
+	return oprs, err
+}
+
+// parallelFetchFromEBlock also returns the entry of each opr, in the same order
+func (g *QuickGrader) parallelFetchFromEBlock(block *EntryBlockMarker, workerCount int, enforceWinners bool) ([]*OraclePriceRecord, []*factom.Entry, error) {
 	// Previous winners so we know if the opr is valid
 	// The Winners() wrapper just handles the base case for us, where there is no winners
 	prevWinners := g.GetPreviousWinners(int32(block.EntryBlock.Header.DBHeight))
@@ -401,11 +591,13 @@ func (g *QuickGrader) ParallelFetchOPRsFromEBlock(block *EntryBlockMarker, worke
 	sort.SliceStable(oprResponses, func(i, j int) bool { return oprResponses[i].order < oprResponses[j].order })
 	// Now grab oprs
 	oprs := make([]*OraclePriceRecord, len(oprResponses))
+	entries := make([]*factom.Entry, len(oprResponses))
 	for i := range oprResponses {
 		oprs[i] = oprResponses[i].opr
+		entries[i] = oprResponses[i].entry
 	}
 
-	return oprs, collectErr
+	return oprs, entries, collectErr
 }
 
 func (g *QuickGrader) fetchOPRWorker(work chan *OPRWorkRequest, results chan *OPRWorkResponse, prevWinners []*OraclePriceRecord, dbht int64, enforceWinners bool) {
@@ -416,7 +608,7 @@ func (g *QuickGrader) fetchOPRWorker(work chan *OPRWorkRequest, results chan *OP
 				return // Done working
 			}
 
-			entry, err := factom.GetEntry(job.entryhash)
+			entry, err := g.Factom.GetEntry(job.entryhash)
 			if err != nil {
 				results <- &OPRWorkResponse{err: fmt.Errorf("entry %s : %s", job.entryhash, err.Error()), order: job.order}
 				continue
@@ -442,7 +634,7 @@ func (g *QuickGrader) fetchOPRWorker(work chan *OPRWorkRequest, results chan *OP
 				continue
 			}
 
-			results <- &OPRWorkResponse{opr: opr, order: job.order}
+			results <- &OPRWorkResponse{opr: opr, entry: entry, order: job.order}
 		}
 	}
 }
@@ -497,6 +689,12 @@ func (g *QuickGrader) GetPreviousWinners(dbht int32) (winners []*OraclePriceReco
 //		(nil, nil)		Entry is not an OPR and no errors
 //		(nil, error)	We don't know, we should not check this eblock as processed
 func (g *QuickGrader) ParseOPREntry(entry *factom.Entry, height int64) (*OraclePriceRecord, error) {
+	return ParseOPREntry(g.Config, g.Network, g.Protocol, entry, height)
+}
+
+// ParseOPREntry parses the entry into an oracle price record for the network.
+// See QuickGrader.ParseOPREntry for the return values.
+func ParseOPREntry(c *config.Config, network, protocol string, entry *factom.Entry, height int64) (*OraclePriceRecord, error) {
 	var err error
 	// Do some quick collecting of data and checks of the entry.
 	// Can only have three ExtIDs which must be:
@@ -519,11 +717,11 @@ func (g *QuickGrader) ParseOPREntry(entry *factom.Entry, height int64) (*OracleP
 	if err := opr.SafeUnmarshal(entry.Content); err != nil {
 		return nil, nil // Doesn't unmarshal, then it isn't valid for sure.  Continue on.
 	}
-	if opr.CoinbasePEGAddress, err = common.ConvertFCTtoPegNetAsset(g.Network, "PEG", opr.CoinbaseAddress); err != nil {
+	if opr.CoinbasePEGAddress, err = common.ConvertFCTtoPegNetAsset(network, "PEG", opr.CoinbaseAddress); err != nil {
 		return nil, nil // Invalid Coinbase Address
 	}
 	// Run some basic checks on the values.  If they don't check out, then ignore the entry
-	if !opr.Validate(g.Config, height) {
+	if !opr.Validate(c, height) {
 		return nil, nil
 	}
 
@@ -540,8 +738,8 @@ func (g *QuickGrader) ParseOPREntry(entry *factom.Entry, height int64) (*OracleP
 	opr.OPRHash = sha[:] // Save the OPRHash
 
 	// Set this information so we know what grading version to use
-	opr.Network = g.Network
-	opr.Protocol = g.Protocol
+	opr.Network = network
+	opr.Protocol = protocol
 
 	return opr, nil
 }
@@ -582,6 +780,31 @@ func (g *QuickGrader) OprBlockByHeight(dbht int64) *OprBlock {
 	return nil
 }
 
+// GradedRates returns the asset rates of the winning opr at the height.
+// If the height has no graded oprblock, nil is returned.
+func (g *QuickGrader) GradedRates(height int64) map[string]uint64 {
+	block := g.OprBlockByHeight(height)
+	if block == nil || block.EmptyOPRBlock || len(block.GradedOPRs) == 0 {
+		return nil
+	}
+
+	rates := make(map[string]uint64)
+	for asset, rate := range block.GradedOPRs[0].Assets {
+		rates[asset] = rate
+	}
+	return rates
+}
+
+// PriceHistory returns the graded consensus price of an asset for the
+// inclusive height range [start, end]. The prices are read from the block store,
+// so they are available for every block the grader has synced.
+func (g *QuickGrader) PriceHistory(asset string, start, end int64) ([]PricePoint, error) {
+	if start > end {
+		return nil, fmt.Errorf("start height %d is after end height %d", start, end)
+	}
+	return g.BlockStore.FetchPriceHistory(asset, start, end)
+}
+
 // oprsByDigitalID returns every OPR created by a given ID
 // Multiple ID's per miner or single daemon are possible.
 // This function searches through every possible ID and returns all.
@@ -331,3 +331,92 @@ func shuffleList() {
 		common.AssetsV5[i], common.AssetsV5[j] = common.AssetsV5[j], common.AssetsV5[i]
 	})
 }
+
+// failingDB fails the batch writes after the first ok ones
+type failingDB struct {
+	database.IDatabase
+	ok int
+}
+
+func (db *failingDB) Write(batch *database.Batch) error {
+	if db.ok <= 0 {
+		return fmt.Errorf("disk is full")
+	}
+	db.ok--
+	return db.IDatabase.Write(batch)
+}
+
+func TestQuickGrader_FailedWrite(t *testing.T) {
+	common.SetTestingVersion(1)
+	mapDb := database.NewMapDb()
+	if _, err := database.Migrate(mapDb); err != nil {
+		t.Fatal(err)
+	}
+	db := &failingDB{IDatabase: mapDb, ok: 1000}
+	g := NewQuickGrader(snapshotTestConfig(), db, balances.NewBalanceTracker())
+	height := exportedTestChain(t, g).StartHeight
+
+	// The cursor is written, then the block fails to
+	db.ok = 1
+	if err := g.Sync(); err == nil {
+		t.Fatal("exp the sync to fail")
+	}
+	if _, err := db.Get(database.BUCKET_OPR_HEIGHT, database.HeightToBytes(height)); err != database.ErrNotFound {
+		t.Errorf("exp the block not to be on disk, found %v", err)
+	}
+	heights, err := balances.NewBalanceStore(db).Load(balances.NewBalanceTracker())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heights.Payouts != 0 {
+		t.Errorf("exp no payouts on disk, found them up to %d", heights.Payouts)
+	}
+	for _, adrs := range g.Balances.Copy() {
+		if len(adrs) > 0 {
+			t.Error("exp the balances to be rolled back")
+		}
+	}
+	if len(g.GetBlocks()) != 0 || len(g.OPRChain.Heights) != 0 {
+		t.Error("exp the opr chain to be rolled back")
+	}
+
+	// The block is graded and paid once it can be written
+	db.ok = 1000
+	if err := g.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(database.BUCKET_OPR_HEIGHT, database.HeightToBytes(height)); err != nil {
+		t.Errorf("exp the block to be on disk, found %v", err)
+	}
+	graded := g.GetBlocks()[0].GradedOPRs
+	var reward int64
+	for place, o := range graded[:g.MinRecords(height)] {
+		if o.CoinbasePEGAddress == graded[0].CoinbasePEGAddress {
+			reward += GetRewardFromPlace(place, g.Network, height)
+		}
+	}
+	if bal := g.Balances.GetBalance(graded[0].CoinbasePEGAddress); bal != reward {
+		t.Errorf("exp the winner to be paid %d once, found %d", reward, bal)
+	}
+}
+
+func TestQuickGrader_Rewound(t *testing.T) {
+	g, chain := snapshotTestGrader(t)
+	height := chain.StartHeight
+	if history, err := g.PriceHistory("XAU", height, height); err != nil || len(history) != 1 {
+		t.Fatalf("exp the price of the graded block, found %v %v", history, err)
+	}
+
+	if err := g.OPRChain.Rewound([]int64{height}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.BlockStore.FetchOPRBlock(height); err != database.ErrNotFound {
+		t.Errorf("exp the block to be dropped, found %v", err)
+	}
+	if history, err := g.PriceHistory("XAU", height, height); err != nil || len(history) != 0 {
+		t.Errorf("exp the price history of the block to be dropped, found %v %v", history, err)
+	}
+	if len(g.GetBlocks()) != 0 {
+		t.Error("exp the block to be dropped from memory")
+	}
+}
@@ -117,6 +117,9 @@ func ApplyBand(diff float64, band float64) float64 {
 
 // GradeMinimum only grades the top 50 honest records. The input must be the records sorted by
 // self reported difficulty.
+//
+// Deprecated: The node grades with GradeOPRBlock. This is only kept to check the two agree,
+// and will be removed.
 func GradeMinimum(orderedList []*OraclePriceRecord, network string, dbht int64) (graded []*OraclePriceRecord) {
 	// No grade algo can handle 0
 	if len(orderedList) == 0 {
@@ -11,9 +11,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"sort"
-	"strconv"
 	"sync"
 
 	"github.com/FactomProject/btcutil/base58"
@@ -21,6 +19,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	lxr "github.com/pegnet/LXRHash"
 	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/modules/grader"
 	"github.com/pegnet/pegnet/opr/oprencoding"
 	"github.com/pegnet/pegnet/polling"
 	log "github.com/sirupsen/logrus"
@@ -109,13 +108,10 @@ var lxInitializer sync.Once
 func InitLX() {
 	lxInitializer.Do(func() {
 		// This code will only be executed ONCE, no matter how often you call it
-		LX.Verbose(true)
-		if size, err := strconv.Atoi(os.Getenv("LXRBITSIZE")); err == nil && size >= 8 && size <= 30 {
-			LX.Init(0xfafaececfafaecec, uint64(size), 256, 5)
-		} else {
-			LX.Init(0xfafaececfafaecec, 30, 256, 5)
-		}
-
+		// The grader module hashes with the same table, so we share it rather than
+		// holding two of them in memory
+		grader.InitLX()
+		LX = *grader.LX
 	})
 }
 
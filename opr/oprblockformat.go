@@ -0,0 +1,160 @@
+package opr
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pegnet/pegnet/database"
+	"github.com/pegnet/pegnet/opr/oprencoding"
+)
+
+// OPRBlockFormatVersion is the version of the format oprblocks are written to the
+// database in.
+//
+// A stored oprblock is a zero byte, the version of its format, then the
+// oprencoding.ProtoOPRBlock. The first byte of a gob is the length of its first
+// message, which is never zero, so anything else is a gob of the
+// OPRBlockDatabaseObject from before the format was versioned.
+const OPRBlockFormatVersion = 1
+
+func init() {
+	database.RegisterMigration(database.Migration{
+		Version:     2,
+		Description: "store oprblocks as protobufs",
+		Migrate:     migrateOPRBlocks,
+	})
+	database.RegisterMigration(database.Migration{
+		Version:     3,
+		Description: "index the price history of stored oprblocks",
+		Migrate:     migratePriceHistory,
+	})
+}
+
+// EncodeOPRBlock encodes the oprblock in the current format
+func EncodeOPRBlock(obj *OPRBlockDatabaseObject) ([]byte, error) {
+	block := &oprencoding.ProtoOPRBlock{
+		Height:             obj.DblockHeight,
+		Empty:              obj.EmptyOPRBlock,
+		TotalNumberRecords: int32(obj.TotalNumberRecords),
+		GradedOPRs:         make([]*oprencoding.ProtoGradedOPR, len(obj.GradedOprs)),
+	}
+	for i, o := range obj.GradedOprs {
+		block.GradedOPRs[i] = oprToProto(o)
+	}
+
+	data, err := proto.Marshal(block)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{0, OPRBlockFormatVersion}, data...), nil
+}
+
+// DecodeOPRBlock decodes an oprblock of any format version, or a legacy gob
+func DecodeOPRBlock(data []byte) (*OPRBlockDatabaseObject, error) {
+	if IsLegacyOPRBlock(data) {
+		obj := new(OPRBlockDatabaseObject)
+		if err := database.Decode(obj, data); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	}
+	if len(data) < 2 {
+		return nil, fmt.Errorf("oprblock is corrupt")
+	}
+
+	switch data[1] {
+	case OPRBlockFormatVersion:
+		block := new(oprencoding.ProtoOPRBlock)
+		if err := proto.Unmarshal(data[2:], block); err != nil {
+			return nil, err
+		}
+		obj := &OPRBlockDatabaseObject{
+			DblockHeight:       block.Height,
+			EmptyOPRBlock:      block.Empty,
+			TotalNumberRecords: int(block.TotalNumberRecords),
+		}
+		for _, o := range block.GradedOPRs {
+			obj.GradedOprs = append(obj.GradedOprs, oprFromProto(o))
+		}
+		return obj, nil
+	default:
+		return nil, fmt.Errorf("oprblock format version %d is newer than this build", data[1])
+	}
+}
+
+// IsLegacyOPRBlock is true if the stored oprblock is a gob from before the format
+// was versioned
+func IsLegacyOPRBlock(data []byte) bool {
+	return len(data) > 0 && data[0] != 0
+}
+
+func oprToProto(o *OraclePriceRecord) *oprencoding.ProtoGradedOPR {
+	p := &oprencoding.ProtoGradedOPR{
+		EntryHash:              o.EntryHash,
+		Nonce:                  o.Nonce,
+		SelfReportedDifficulty: o.SelfReportedDifficulty,
+		Version:                uint32(o.Version),
+		CoinbaseAddress:        o.CoinbaseAddress,
+		Dbht:                   o.Dbht,
+		WinPreviousOPR:         o.WinPreviousOPR,
+		FactomDigitalID:        o.FactomDigitalID,
+		Difficulty:             o.Difficulty,
+		Grade:                  o.Grade,
+		OPRHash:                o.OPRHash,
+		CoinbasePEGAddress:     o.CoinbasePEGAddress,
+		Protocol:               o.Protocol,
+		Network:                o.Network,
+		OPRChainID:             o.OPRChainID,
+	}
+	// Sorted, so the same block is always the same bytes
+	for name, price := range o.Assets {
+		p.Assets = append(p.Assets, &oprencoding.ProtoAsset{Name: name, Price: price})
+	}
+	sort.Slice(p.Assets, func(i, j int) bool { return p.Assets[i].Name < p.Assets[j].Name })
+	return p
+}
+
+func oprFromProto(p *oprencoding.ProtoGradedOPR) *OraclePriceRecord {
+	o := NewOraclePriceRecord()
+	o.EntryHash = p.EntryHash
+	o.Nonce = p.Nonce
+	o.SelfReportedDifficulty = p.SelfReportedDifficulty
+	o.Version = uint8(p.Version)
+	o.CoinbaseAddress = p.CoinbaseAddress
+	o.Dbht = p.Dbht
+	o.WinPreviousOPR = p.WinPreviousOPR
+	o.FactomDigitalID = p.FactomDigitalID
+	o.Difficulty = p.Difficulty
+	o.Grade = p.Grade
+	o.OPRHash = p.OPRHash
+	o.CoinbasePEGAddress = p.CoinbasePEGAddress
+	o.Protocol = p.Protocol
+	o.Network = p.Network
+	o.OPRChainID = p.OPRChainID
+	for _, asset := range p.Assets {
+		o.Assets[asset.Name] = asset.Price
+	}
+	return o
+}
+
+// migrateOPRBlocks rewrites the legacy gob oprblocks in the current format
+func migrateOPRBlocks(db database.IDatabase, batch *database.Batch) error {
+	iter := db.Iterate(database.BUCKET_OPR_HEIGHT)
+	defer iter.Release()
+	for iter.Next() {
+		if !IsLegacyOPRBlock(iter.Value()) {
+			continue
+		}
+		obj, err := DecodeOPRBlock(iter.Value())
+		if err != nil {
+			return fmt.Errorf("oprblock %x: %s", iter.Key(), err.Error())
+		}
+		data, err := EncodeOPRBlock(obj)
+		if err != nil {
+			return err
+		}
+		batch.Put(database.BUCKET_OPR_HEIGHT, append([]byte{}, iter.Key()...), data)
+	}
+	return iter.Error()
+}
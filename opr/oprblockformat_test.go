@@ -0,0 +1,56 @@
+package opr_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/pegnet/pegnet/database"
+	. "github.com/pegnet/pegnet/opr"
+)
+
+func TestOPRBlockFormat(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		orig := RandomOPRBlock()
+		orig.TotalNumberRecords = len(orig.GradedOprs) + 10
+
+		data, err := EncodeOPRBlock(orig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if IsLegacyOPRBlock(data) || data[1] != OPRBlockFormatVersion {
+			t.Fatalf("exp format version %d, found %x", OPRBlockFormatVersion, data[:2])
+		}
+		if again, _ := EncodeOPRBlock(orig); !bytes.Equal(data, again) {
+			t.Error("exp the same block to be encoded the same")
+		}
+
+		decoded, err := DecodeOPRBlock(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(orig, decoded) {
+			t.Error("decoded is not the same as the orig")
+		}
+
+		// The gobs written before the format was versioned are still read
+		legacy, err := database.Encode(orig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsLegacyOPRBlock(legacy) {
+			t.Fatal("exp a gob to be legacy")
+		}
+		decoded, err = DecodeOPRBlock(legacy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(orig, decoded) {
+			t.Error("legacy decoded is not the same as the orig")
+		}
+	}
+
+	if _, err := DecodeOPRBlock([]byte{0, OPRBlockFormatVersion + 1}); err == nil {
+		t.Error("exp an error for a newer format")
+	}
+}
@@ -1,16 +1,21 @@
 package opr
 
 import (
-	"encoding/gob"
+	"encoding/binary"
+	"fmt"
 	"sort"
 
 	"github.com/pegnet/pegnet/database"
 )
 
+// IOPRBlockStore stores the graded oprblocks. The writes are added to a batch the caller
+// commits, so a block is written together with everything else it changes.
 type IOPRBlockStore interface {
-	WriteInvalidOPRBlock(dbht int64) error
-	WriteOPRBlock(opr *OprBlock) error
+	WriteInvalidOPRBlock(batch *database.Batch, dbht int64) error
+	WriteOPRBlock(batch *database.Batch, opr *OprBlock) error
+	DeleteOPRBlock(batch *database.Batch, height int64) error
 	FetchOPRBlock(height int64) (*OprBlock, error)
+	FetchPriceHistory(asset string, start, end int64) ([]PricePoint, error)
 	Close() error
 }
 
@@ -21,7 +26,6 @@ type OPRBlockStore struct {
 
 func NewOPRBlockStore(db database.IDatabase) *OPRBlockStore {
 	o := new(OPRBlockStore)
-	gob.Register(OPRBlockDatabaseObject{})
 	o.DB = db
 
 	return o
@@ -32,17 +36,18 @@ func (d *OPRBlockStore) Close() error {
 
 // WriteInvalidOPRBlock is for writing a dbht to disk that has an invalid oprblock. This could
 // be because the oprblock does not have enough entries, or another error
-func (d *OPRBlockStore) WriteInvalidOPRBlock(dbht int64) error {
+func (d *OPRBlockStore) WriteInvalidOPRBlock(batch *database.Batch, dbht int64) error {
 	// An invalid oprblock is
 	oprblock := new(OprBlock)
 	oprblock.EmptyOPRBlock = true
 	oprblock.Dbht = dbht
 
-	return d.WriteOPRBlock(oprblock)
+	return d.WriteOPRBlock(batch, oprblock)
 }
 
-// WriteOPRBlock will write the top 50 graded oprs and write their corresponding indexes
-func (d *OPRBlockStore) WriteOPRBlock(opr *OprBlock) error {
+// WriteOPRBlock adds the top 50 graded oprs and their corresponding indexes to the batch.
+// Nothing is on disk until the batch is written.
+func (d *OPRBlockStore) WriteOPRBlock(batch *database.Batch, opr *OprBlock) error {
 	// And opr block has both a graded component and sorted by difficulty component.
 	// To save space, we can just keep the graded component, and resort the oprs when we pull them.
 
@@ -53,32 +58,119 @@ func (d *OPRBlockStore) WriteOPRBlock(opr *OprBlock) error {
 		TotalNumberRecords: opr.TotalNumberRecords,
 	}
 
-	data, err := database.Encode(obj)
+	data, err := EncodeOPRBlock(&obj)
 	if err != nil {
 		return err
 	}
 
-	// The multiple indexes. First we write the OPR block to the first index by height. This is where
-	// the raw data will live
-	err = d.DB.Put(database.BUCKET_OPR_HEIGHT, database.HeightToBytes(obj.DblockHeight), data)
+	// The multiple indexes are written in the same batch, so a block is never on disk
+	// without its indexes. First we write the OPR block to the first index by height.
+	// This is where the raw data will live
+	batch.Put(database.BUCKET_OPR_HEIGHT, database.HeightToBytes(obj.DblockHeight), data)
+
+	// The second index is the price history. Each asset of the winning opr is indexed by
+	// asset and height, so a range of prices can be pulled without decoding every block.
+	batchPriceHistory(batch, opr)
+
+	// TODO: Add more indexing if you need more
+
+	return nil
+}
+
+// DeleteOPRBlock adds the removal of the oprblock at the height, and its indexes, to the
+// batch. Nothing changes on disk until the batch is written.
+func (d *OPRBlockStore) DeleteOPRBlock(batch *database.Batch, height int64) error {
+	block, err := d.FetchOPRBlock(height)
+	if err == database.ErrNotFound {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	batchDeletePriceHistory(batch, block)
+	batch.Delete(database.BUCKET_OPR_HEIGHT, database.HeightToBytes(height))
+	return nil
+}
 
-	// TODO: Add more indexing if you need more
+// batchPriceHistory indexes the graded consensus price of every asset in the oprblock.
+// The consensus price is the price reported by the top graded opr.
+func batchPriceHistory(batch *database.Batch, opr *OprBlock) {
+	if opr.EmptyOPRBlock || len(opr.GradedOPRs) == 0 {
+		return // No consensus prices for this block
+	}
 
-	return nil
+	for asset, price := range opr.GradedOPRs[0].Assets {
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, price)
+		batch.Put(database.BUCKET_PRICE_HISTORY, PriceHistoryKey(asset, opr.Dbht), value)
+	}
 }
 
-func (d *OPRBlockStore) FetchOPRBlock(height int64) (*OprBlock, error) {
-	obj := new(OPRBlockDatabaseObject)
+// batchDeletePriceHistory removes the consensus prices of the oprblock from the index
+func batchDeletePriceHistory(batch *database.Batch, opr *OprBlock) {
+	if opr.EmptyOPRBlock || len(opr.GradedOPRs) == 0 {
+		return
+	}
+
+	for asset := range opr.GradedOPRs[0].Assets {
+		batch.Delete(database.BUCKET_PRICE_HISTORY, PriceHistoryKey(asset, opr.Dbht))
+	}
+}
 
+// migratePriceHistory indexes the price history of the oprblocks graded before the
+// index was written along with them
+func migratePriceHistory(db database.IDatabase, batch *database.Batch) error {
+	iter := db.Iterate(database.BUCKET_OPR_HEIGHT)
+	defer iter.Release()
+	for iter.Next() {
+		obj, err := DecodeOPRBlock(iter.Value())
+		if err != nil {
+			return fmt.Errorf("oprblock %x: %s", iter.Key(), err.Error())
+		}
+		batchPriceHistory(batch, obj.ToOPRBlock())
+	}
+	return iter.Error()
+}
+
+// FetchPriceHistory returns the graded consensus price of an asset for every height in
+// the range [start, end]. Heights without a graded oprblock are skipped.
+func (d *OPRBlockStore) FetchPriceHistory(asset string, start, end int64) ([]PricePoint, error) {
+	var history []PricePoint
+	iter := d.DB.IterateRange(database.BUCKET_PRICE_HISTORY, PriceHistoryKey(asset, start), PriceHistoryKey(asset, end+1))
+	defer iter.Release()
+	for iter.Next() {
+		key, data := iter.Key(), iter.Value()
+		if len(key) != len(asset)+8 {
+			continue // The key of a longer asset name
+		}
+		height := int64(binary.BigEndian.Uint64(key[len(asset):]))
+		if len(data) != 8 {
+			return nil, fmt.Errorf("price history for %s at %d is corrupt", asset, height)
+		}
+
+		history = append(history, PricePoint{Height: height, Price: binary.BigEndian.Uint64(data)})
+	}
+	return history, iter.Error()
+}
+
+// PriceHistoryKey is the key of an asset price at a given height
+func PriceHistoryKey(asset string, height int64) []byte {
+	return append([]byte(asset), database.HeightToBytes(height)...)
+}
+
+// PricePoint is the graded consensus price of an asset at a given height
+type PricePoint struct {
+	Height int64  `json:"height"`
+	Price  uint64 `json:"price"`
+}
+
+func (d *OPRBlockStore) FetchOPRBlock(height int64) (*OprBlock, error) {
 	data, err := d.DB.Get(database.BUCKET_OPR_HEIGHT, database.HeightToBytes(height))
 	if err != nil {
 		return nil, err
 	}
 
-	err = database.Decode(obj, data)
+	obj, err := DecodeOPRBlock(data)
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +178,7 @@ func (d *OPRBlockStore) FetchOPRBlock(height int64) (*OprBlock, error) {
 	return obj.ToOPRBlock(), nil
 }
 
+// OPRBlockDatabaseObject is an oprblock as it is stored, see EncodeOPRBlock
 type OPRBlockDatabaseObject struct {
 	GradedOprs         []*OraclePriceRecord
 	DblockHeight       int64
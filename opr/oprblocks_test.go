@@ -15,10 +15,14 @@ func TestOPRBlockStore(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		orig := RandomOPRBlock()
 
-		err = o.WriteOPRBlock(orig.ToOPRBlock())
+		batch := database.NewBatch()
+		err = o.WriteOPRBlock(batch, orig.ToOPRBlock())
 		if err != nil {
 			t.Error(err)
 		}
+		if err := o.DB.Write(batch); err != nil {
+			t.Error(err)
+		}
 
 		newO, err := o.FetchOPRBlock(orig.DblockHeight)
 		if err != nil {
@@ -33,10 +37,14 @@ func TestOPRBlockStore(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		h := rand.Int63()
 		// Test an invalid
-		err = o.WriteInvalidOPRBlock(h)
+		batch := database.NewBatch()
+		err = o.WriteInvalidOPRBlock(batch, h)
 		if err != nil {
 			t.Error(err)
 		}
+		if err := o.DB.Write(batch); err != nil {
+			t.Error(err)
+		}
 
 		block, err := o.FetchOPRBlock(h)
 		if err != nil {
@@ -47,3 +55,102 @@ func TestOPRBlockStore(t *testing.T) {
 		}
 	}
 }
+
+func TestOPRBlockStore_PriceHistory(t *testing.T) {
+	o := NewOPRBlockStore(database.NewMapDb())
+
+	// Write 10 blocks, every other block is an invalid oprblock
+	batch := database.NewBatch()
+	for h := int64(100); h < 110; h++ {
+		if h%2 == 1 {
+			if err := o.WriteInvalidOPRBlock(batch, h); err != nil {
+				t.Error(err)
+			}
+			continue
+		}
+
+		block := RandomOPRBlock()
+		block.DblockHeight = h
+		for _, record := range block.GradedOprs {
+			record.Assets = OraclePriceRecordAssetList{"XAU": uint64(h) * 1e8, "PEG": 1}
+		}
+
+		if err := o.WriteOPRBlock(batch, block.ToOPRBlock()); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := o.DB.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := o.FetchPriceHistory("XAU", 100, 109)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(history) != 5 {
+		t.Errorf("exp 5 prices, found %d", len(history))
+	}
+	for _, p := range history {
+		if p.Height%2 != 0 {
+			t.Errorf("found a price at invalid height %d", p.Height)
+		}
+		if p.Price != uint64(p.Height)*1e8 {
+			t.Errorf("height %d has price %d, exp %d", p.Height, p.Price, uint64(p.Height)*1e8)
+		}
+	}
+
+	// A partial range
+	history, err = o.FetchPriceHistory("XAU", 104, 106)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(history) != 2 {
+		t.Errorf("exp 2 prices, found %d", len(history))
+	}
+
+	// An asset that was never reported
+	history, err = o.FetchPriceHistory("XBT", 100, 109)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(history) != 0 {
+		t.Errorf("exp no prices, found %d", len(history))
+	}
+}
+
+func TestOPRBlockStore_PriceHistoryMigration(t *testing.T) {
+	// A database of version 2 has oprblocks, but no price history
+	db := database.NewMapDb()
+	for h := int64(100); h < 105; h++ {
+		block := RandomOPRBlock()
+		block.DblockHeight = h
+		block.GradedOprs[0].Assets = OraclePriceRecordAssetList{"XAU": uint64(h) * 1e8}
+		data, err := EncodeOPRBlock(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put(database.BUCKET_OPR_HEIGHT, database.HeightToBytes(h), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put(database.BUCKET_META, []byte("schema"), database.HeightToBytes(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	history, err := NewOPRBlockStore(db).FetchPriceHistory("XAU", 100, 104)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 5 {
+		t.Fatalf("exp 5 prices, found %d", len(history))
+	}
+	for _, p := range history {
+		if p.Price != uint64(p.Height)*1e8 {
+			t.Errorf("height %d has price %d, exp %d", p.Height, p.Price, uint64(p.Height)*1e8)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: oprblock.proto
+
+package oprencoding
+
+import (
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// ProtoOPRBlock is a graded oprblock as it is kept in the miner database
+type ProtoOPRBlock struct {
+	Height               int64             `protobuf:"varint,1,opt,name=Height,proto3" json:"Height,omitempty"`
+	Empty                bool              `protobuf:"varint,2,opt,name=Empty,proto3" json:"Empty,omitempty"`
+	TotalNumberRecords   int32             `protobuf:"varint,3,opt,name=TotalNumberRecords,proto3" json:"TotalNumberRecords,omitempty"`
+	GradedOPRs           []*ProtoGradedOPR `protobuf:"bytes,4,rep,name=GradedOPRs,proto3" json:"GradedOPRs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *ProtoOPRBlock) Reset()         { *m = ProtoOPRBlock{} }
+func (m *ProtoOPRBlock) String() string { return proto.CompactTextString(m) }
+func (*ProtoOPRBlock) ProtoMessage()    {}
+func (*ProtoOPRBlock) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a678c53b57ed342, []int{0}
+}
+
+func (m *ProtoOPRBlock) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProtoOPRBlock.Unmarshal(m, b)
+}
+func (m *ProtoOPRBlock) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProtoOPRBlock.Marshal(b, m, deterministic)
+}
+func (m *ProtoOPRBlock) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProtoOPRBlock.Merge(m, src)
+}
+func (m *ProtoOPRBlock) XXX_Size() int {
+	return xxx_messageInfo_ProtoOPRBlock.Size(m)
+}
+func (m *ProtoOPRBlock) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProtoOPRBlock.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ProtoOPRBlock proto.InternalMessageInfo
+
+func (m *ProtoOPRBlock) GetHeight() int64 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+func (m *ProtoOPRBlock) GetEmpty() bool {
+	if m != nil {
+		return m.Empty
+	}
+	return false
+}
+
+func (m *ProtoOPRBlock) GetTotalNumberRecords() int32 {
+	if m != nil {
+		return m.TotalNumberRecords
+	}
+	return 0
+}
+
+func (m *ProtoOPRBlock) GetGradedOPRs() []*ProtoGradedOPR {
+	if m != nil {
+		return m.GradedOPRs
+	}
+	return nil
+}
+
+// ProtoGradedOPR is an opr of a block and what was found when it was graded
+type ProtoGradedOPR struct {
+	// The opr entry
+	EntryHash              []byte `protobuf:"bytes,1,opt,name=EntryHash,proto3" json:"EntryHash,omitempty"`
+	Nonce                  []byte `protobuf:"bytes,2,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	SelfReportedDifficulty []byte `protobuf:"bytes,3,opt,name=SelfReportedDifficulty,proto3" json:"SelfReportedDifficulty,omitempty"`
+	Version                uint32 `protobuf:"varint,4,opt,name=Version,proto3" json:"Version,omitempty"`
+	// The content of the opr
+	CoinbaseAddress string        `protobuf:"bytes,5,opt,name=CoinbaseAddress,proto3" json:"CoinbaseAddress,omitempty"`
+	Dbht            int32         `protobuf:"varint,6,opt,name=Dbht,proto3" json:"Dbht,omitempty"`
+	WinPreviousOPR  []string      `protobuf:"bytes,7,rep,name=WinPreviousOPR,proto3" json:"WinPreviousOPR,omitempty"`
+	FactomDigitalID string        `protobuf:"bytes,8,opt,name=FactomDigitalID,proto3" json:"FactomDigitalID,omitempty"`
+	Assets          []*ProtoAsset `protobuf:"bytes,9,rep,name=Assets,proto3" json:"Assets,omitempty"`
+	// Found when it was graded
+	Difficulty           uint64   `protobuf:"varint,10,opt,name=Difficulty,proto3" json:"Difficulty,omitempty"`
+	Grade                float64  `protobuf:"fixed64,11,opt,name=Grade,proto3" json:"Grade,omitempty"`
+	OPRHash              []byte   `protobuf:"bytes,12,opt,name=OPRHash,proto3" json:"OPRHash,omitempty"`
+	CoinbasePEGAddress   string   `protobuf:"bytes,13,opt,name=CoinbasePEGAddress,proto3" json:"CoinbasePEGAddress,omitempty"`
+	Protocol             string   `protobuf:"bytes,14,opt,name=Protocol,proto3" json:"Protocol,omitempty"`
+	Network              string   `protobuf:"bytes,15,opt,name=Network,proto3" json:"Network,omitempty"`
+	OPRChainID           string   `protobuf:"bytes,16,opt,name=OPRChainID,proto3" json:"OPRChainID,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ProtoGradedOPR) Reset()         { *m = ProtoGradedOPR{} }
+func (m *ProtoGradedOPR) String() string { return proto.CompactTextString(m) }
+func (*ProtoGradedOPR) ProtoMessage()    {}
+func (*ProtoGradedOPR) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a678c53b57ed342, []int{1}
+}
+
+func (m *ProtoGradedOPR) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProtoGradedOPR.Unmarshal(m, b)
+}
+func (m *ProtoGradedOPR) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProtoGradedOPR.Marshal(b, m, deterministic)
+}
+func (m *ProtoGradedOPR) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProtoGradedOPR.Merge(m, src)
+}
+func (m *ProtoGradedOPR) XXX_Size() int {
+	return xxx_messageInfo_ProtoGradedOPR.Size(m)
+}
+func (m *ProtoGradedOPR) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProtoGradedOPR.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ProtoGradedOPR proto.InternalMessageInfo
+
+func (m *ProtoGradedOPR) GetEntryHash() []byte {
+	if m != nil {
+		return m.EntryHash
+	}
+	return nil
+}
+
+func (m *ProtoGradedOPR) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
+func (m *ProtoGradedOPR) GetSelfReportedDifficulty() []byte {
+	if m != nil {
+		return m.SelfReportedDifficulty
+	}
+	return nil
+}
+
+func (m *ProtoGradedOPR) GetVersion() uint32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *ProtoGradedOPR) GetCoinbaseAddress() string {
+	if m != nil {
+		return m.CoinbaseAddress
+	}
+	return ""
+}
+
+func (m *ProtoGradedOPR) GetDbht() int32 {
+	if m != nil {
+		return m.Dbht
+	}
+	return 0
+}
+
+func (m *ProtoGradedOPR) GetWinPreviousOPR() []string {
+	if m != nil {
+		return m.WinPreviousOPR
+	}
+	return nil
+}
+
+func (m *ProtoGradedOPR) GetFactomDigitalID() string {
+	if m != nil {
+		return m.FactomDigitalID
+	}
+	return ""
+}
+
+func (m *ProtoGradedOPR) GetAssets() []*ProtoAsset {
+	if m != nil {
+		return m.Assets
+	}
+	return nil
+}
+
+func (m *ProtoGradedOPR) GetDifficulty() uint64 {
+	if m != nil {
+		return m.Difficulty
+	}
+	return 0
+}
+
+func (m *ProtoGradedOPR) GetGrade() float64 {
+	if m != nil {
+		return m.Grade
+	}
+	return 0
+}
+
+func (m *ProtoGradedOPR) GetOPRHash() []byte {
+	if m != nil {
+		return m.OPRHash
+	}
+	return nil
+}
+
+func (m *ProtoGradedOPR) GetCoinbasePEGAddress() string {
+	if m != nil {
+		return m.CoinbasePEGAddress
+	}
+	return ""
+}
+
+func (m *ProtoGradedOPR) GetProtocol() string {
+	if m != nil {
+		return m.Protocol
+	}
+	return ""
+}
+
+func (m *ProtoGradedOPR) GetNetwork() string {
+	if m != nil {
+		return m.Network
+	}
+	return ""
+}
+
+func (m *ProtoGradedOPR) GetOPRChainID() string {
+	if m != nil {
+		return m.OPRChainID
+	}
+	return ""
+}
+
+type ProtoAsset struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Price                uint64   `protobuf:"varint,2,opt,name=Price,proto3" json:"Price,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ProtoAsset) Reset()         { *m = ProtoAsset{} }
+func (m *ProtoAsset) String() string { return proto.CompactTextString(m) }
+func (*ProtoAsset) ProtoMessage()    {}
+func (*ProtoAsset) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a678c53b57ed342, []int{2}
+}
+
+func (m *ProtoAsset) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProtoAsset.Unmarshal(m, b)
+}
+func (m *ProtoAsset) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProtoAsset.Marshal(b, m, deterministic)
+}
+func (m *ProtoAsset) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProtoAsset.Merge(m, src)
+}
+func (m *ProtoAsset) XXX_Size() int {
+	return xxx_messageInfo_ProtoAsset.Size(m)
+}
+func (m *ProtoAsset) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProtoAsset.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ProtoAsset proto.InternalMessageInfo
+
+func (m *ProtoAsset) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *ProtoAsset) GetPrice() uint64 {
+	if m != nil {
+		return m.Price
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*ProtoOPRBlock)(nil), "oprencoding.ProtoOPRBlock")
+	proto.RegisterType((*ProtoGradedOPR)(nil), "oprencoding.ProtoGradedOPR")
+	proto.RegisterType((*ProtoAsset)(nil), "oprencoding.ProtoAsset")
+}
+
+func init() { proto.RegisterFile("oprblock.proto", fileDescriptor_5a678c53b57ed342) }
+
+var fileDescriptor_5a678c53b57ed342 = []byte{
+	// 461 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x93, 0x4d, 0x6f, 0xd3, 0x4c,
+	0x14, 0x85, 0x35, 0x6f, 0x9c, 0x34, 0xb9, 0xf9, 0xe8, 0xab, 0x11, 0x2a, 0x23, 0x40, 0xc8, 0xca,
+	0x02, 0xcd, 0x2a, 0x48, 0x20, 0x75, 0xc3, 0xaa, 0xd4, 0xa1, 0xed, 0x26, 0xb6, 0x2e, 0x08, 0xd6,
+	0xfe, 0x98, 0x24, 0xa3, 0x3a, 0x1e, 0x6b, 0x66, 0x02, 0xca, 0x5f, 0x42, 0xe2, 0x3f, 0xa2, 0x19,
+	0xc7, 0xad, 0x09, 0x65, 0xe7, 0x73, 0xce, 0x95, 0xe6, 0xdc, 0x47, 0xd7, 0x30, 0x53, 0xb5, 0xce,
+	0x4a, 0x95, 0xdf, 0x2f, 0x6a, 0xad, 0xac, 0xa2, 0x63, 0x55, 0x6b, 0x51, 0xe5, 0xaa, 0x90, 0xd5,
+	0x66, 0xfe, 0x93, 0xc0, 0x34, 0x71, 0x76, 0x9c, 0xe0, 0x47, 0x37, 0x44, 0x2f, 0x60, 0x70, 0x2b,
+	0xe4, 0x66, 0x6b, 0x19, 0x09, 0x09, 0xef, 0xe1, 0x51, 0xd1, 0x67, 0xd0, 0x5f, 0xee, 0x6a, 0x7b,
+	0x60, 0xff, 0x85, 0x84, 0x0f, 0xb1, 0x11, 0x74, 0x01, 0xf4, 0x8b, 0xb2, 0x69, 0xb9, 0xda, 0xef,
+	0x32, 0xa1, 0x51, 0xe4, 0x4a, 0x17, 0x86, 0xf5, 0x42, 0xc2, 0xfb, 0xf8, 0x44, 0x42, 0x3f, 0x00,
+	0xdc, 0xe8, 0xb4, 0x10, 0x45, 0x9c, 0xa0, 0x61, 0x41, 0xd8, 0xe3, 0xe3, 0x77, 0x2f, 0x17, 0x9d,
+	0x46, 0x0b, 0xdf, 0xe6, 0x61, 0x06, 0x3b, 0xe3, 0xf3, 0x5f, 0x01, 0xcc, 0xfe, 0x8c, 0xe9, 0x2b,
+	0x18, 0x2d, 0x2b, 0xab, 0x0f, 0xb7, 0xa9, 0xd9, 0xfa, 0xc2, 0x13, 0x7c, 0x34, 0x5c, 0xe7, 0x95,
+	0xaa, 0x72, 0xe1, 0x3b, 0x4f, 0xb0, 0x11, 0xf4, 0x12, 0x2e, 0x3e, 0x8b, 0x72, 0x8d, 0xa2, 0x56,
+	0xda, 0x8a, 0x22, 0x92, 0xeb, 0xb5, 0xcc, 0xf7, 0xa5, 0x3d, 0xf8, 0xde, 0x13, 0xfc, 0x47, 0x4a,
+	0x19, 0x9c, 0x7d, 0x15, 0xda, 0x48, 0x55, 0xb1, 0x20, 0x24, 0x7c, 0x8a, 0xad, 0xa4, 0x1c, 0xce,
+	0xaf, 0x95, 0xac, 0xb2, 0xd4, 0x88, 0xab, 0xa2, 0xd0, 0xc2, 0x18, 0xd6, 0x0f, 0x09, 0x1f, 0xe1,
+	0xa9, 0x4d, 0x29, 0x04, 0x51, 0xb6, 0xb5, 0x6c, 0xe0, 0x09, 0xf9, 0x6f, 0xfa, 0x06, 0x66, 0xdf,
+	0x64, 0x95, 0x68, 0xf1, 0x5d, 0xaa, 0xbd, 0x89, 0x13, 0x64, 0x67, 0x61, 0x8f, 0x8f, 0xf0, 0xc4,
+	0x75, 0xaf, 0x7c, 0x4a, 0x73, 0xab, 0x76, 0x91, 0xdc, 0x48, 0x9b, 0x96, 0x77, 0x11, 0x1b, 0x36,
+	0xaf, 0x9c, 0xd8, 0xf4, 0x2d, 0x0c, 0xae, 0x8c, 0x11, 0xd6, 0xb0, 0x91, 0x27, 0xfc, 0xfc, 0x6f,
+	0xc2, 0x3e, 0xc7, 0xe3, 0x18, 0x7d, 0x0d, 0xd0, 0xc1, 0x00, 0x21, 0xe1, 0x01, 0x76, 0x1c, 0x07,
+	0xd2, 0x33, 0x67, 0xe3, 0x90, 0x70, 0x82, 0x8d, 0x70, 0x40, 0xe2, 0x04, 0x3d, 0xfa, 0x89, 0x27,
+	0xd7, 0x4a, 0x77, 0x16, 0xed, 0xe6, 0xc9, 0xf2, 0xa6, 0x65, 0x32, 0xf5, 0x6d, 0x9f, 0x48, 0xe8,
+	0x0b, 0x18, 0xfa, 0x56, 0xb9, 0x2a, 0xd9, 0xcc, 0x4f, 0x3d, 0x68, 0xf7, 0xca, 0x4a, 0xd8, 0x1f,
+	0x4a, 0xdf, 0xb3, 0x73, 0x1f, 0xb5, 0xd2, 0xb5, 0x8e, 0x13, 0xbc, 0xde, 0xa6, 0xb2, 0xba, 0x8b,
+	0xd8, 0xff, 0x3e, 0xec, 0x38, 0xf3, 0x4b, 0x80, 0xc7, 0x5d, 0x1d, 0xfa, 0x55, 0xba, 0x13, 0xfe,
+	0x4a, 0x46, 0xe8, 0xbf, 0xdd, 0x5e, 0x89, 0x96, 0xc7, 0x03, 0x09, 0xb0, 0x11, 0xd9, 0xc0, 0xff,
+	0x28, 0xef, 0x7f, 0x0f, 0x00, 0x97, 0x62, 0x3f, 0x16, 0x3a, 0x03, 0x00, 0x00,
+}
@@ -0,0 +1,119 @@
+package opr
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/FactomProject/factom"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+	"github.com/pegnet/pegnet/modules/grader"
+	config "github.com/zpatrick/go-config"
+)
+
+// Replayer grades the opr chain from an export file rather than factomd, and writes
+// the same oprblocks the QuickGrader does. Balances are not touched, as the burns
+// and transactions are not in the export.
+type Replayer struct {
+	Config   *config.Config
+	Network  string
+	Protocol string
+	ChainID  string
+
+	DB         database.IDatabase
+	BlockStore IOPRBlockStore
+
+	// prevWinners are the shorthashes of the winners of the last graded block
+	prevWinners []string
+}
+
+func NewReplayer(config *config.Config, db database.IDatabase) (*Replayer, error) {
+	grader.InitLX()
+	r := new(Replayer)
+	r.Config = config
+
+	var err error
+	r.Network, err = common.LoadConfigNetwork(config)
+	if err != nil {
+		return nil, err
+	}
+	r.Protocol, err = config.String("Miner.Protocol")
+	if err != nil {
+		return nil, err
+	}
+
+	r.ChainID = hex.EncodeToString(common.ComputeChainIDFromFields([][]byte{[]byte(r.Protocol), []byte(r.Network), []byte(common.OPRChainTag)}))
+	r.DB = db
+	r.BlockStore = NewOPRBlockStore(db)
+
+	return r, nil
+}
+
+// Replay grades every eblock in the export in order. It returns the number of eblocks graded.
+func (r *Replayer) Replay(export *ChainExportReader) (int, error) {
+	if export.Header.ChainID != r.ChainID {
+		return 0, fmt.Errorf("export is for chain %s, expected the opr chain %s", export.Header.ChainID, r.ChainID)
+	}
+
+	count := 0
+	for {
+		block, err := export.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		if err := r.ReplayEBlock(block); err != nil {
+			return count, fmt.Errorf("eblock %s at height %d : %s", block.KeyMR, block.DBHeight, err.Error())
+		}
+		count++
+	}
+}
+
+// ReplayEBlock grades a single eblock and writes its oprblock. Blocks without enough
+// records to have winners are written as invalid oprblocks.
+func (r *Replayer) ReplayEBlock(block *ExportedEBlock) error {
+	var oprs []*OraclePriceRecord
+	var entries []*factom.Entry
+	for _, e := range block.Entries {
+		entry := e.Entry(r.ChainID)
+		if hash := hex.EncodeToString(entry.Hash()); hash != e.Hash {
+			return fmt.Errorf("entry %s does not match its hash %s", e.Hash, hash)
+		}
+
+		opr, err := ParseOPREntry(r.Config, r.Network, r.Protocol, entry, block.DBHeight)
+		if err != nil {
+			return err
+		}
+		if opr == nil {
+			continue // Not an opr
+		}
+		oprs = append(oprs, opr)
+		entries = append(entries, entry)
+	}
+
+	// The grader validates the previous winners
+	oprblock, graded, err := GradeOPRBlock(r.Network, block.DBHeight, r.prevWinners, oprs, entries)
+	if err != nil {
+		return err
+	}
+	batch := database.NewBatch()
+	if oprblock == nil {
+		if err := r.BlockStore.WriteInvalidOPRBlock(batch, block.DBHeight); err != nil {
+			return err
+		}
+		return r.DB.Write(batch)
+	}
+
+	if err := r.BlockStore.WriteOPRBlock(batch, oprblock); err != nil {
+		return err
+	}
+	if err := r.DB.Write(batch); err != nil {
+		return err
+	}
+	r.prevWinners = graded.WinnersShortHashes()
+	return nil
+}
@@ -0,0 +1,121 @@
+package opr_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/FactomProject/factom"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+	"github.com/pegnet/pegnet/modules/grader"
+	. "github.com/pegnet/pegnet/opr"
+)
+
+// exportedTestBlock loads a mainnet block from the grader testdata as an exported eblock
+// of the chain. The self reported difficulties are recomputed, as the tests may
+// not run with the full size LXRHash.
+func exportedTestBlock(t *testing.T, chainid string) *ExportedEBlock {
+	data, err := ioutil.ReadFile("../modules/grader/testdata/206422.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tb struct {
+		Height  int64
+		Entries []struct {
+			ExtIDs  [][]byte
+			Content []byte
+		}
+	}
+	if err := json.Unmarshal(data, &tb); err != nil {
+		t.Fatal(err)
+	}
+
+	grader.InitLX()
+	block := &ExportedEBlock{KeyMR: "test", DBHeight: tb.Height}
+	for _, e := range tb.Entries {
+		oprhash := sha256.Sum256(e.Content)
+		diff := binary.BigEndian.Uint64(grader.LX.Hash(append(oprhash[:], e.ExtIDs[0]...)))
+		e.ExtIDs[1] = make([]byte, 8)
+		binary.BigEndian.PutUint64(e.ExtIDs[1], diff)
+
+		entry := factom.Entry{ChainID: chainid, ExtIDs: e.ExtIDs, Content: e.Content}
+		block.Entries = append(block.Entries, ExportedEntry{Hash: hex.EncodeToString(entry.Hash()), ExtIDs: e.ExtIDs, Content: e.Content})
+	}
+	return block
+}
+
+func TestReplayer(t *testing.T) {
+	common.SetTestingVersion(1)
+	db := database.NewMapDb()
+	r, err := NewReplayer(common.NewUnitTestConfig(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := exportedTestBlock(t, r.ChainID)
+	short := &ExportedEBlock{KeyMR: "short", DBHeight: block.DBHeight + 1, Entries: block.Entries[:5]}
+
+	// Write and read back the export
+	buf := new(bytes.Buffer)
+	w, err := NewChainExportWriter(buf, ChainExportHeader{ChainID: r.ChainID, Network: r.Network})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []*ExportedEBlock{block, short} {
+		if err := w.WriteEBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	export, err := NewChainExportReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := r.Replay(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("exp 2 eblocks replayed, found %d", count)
+	}
+
+	// The winners must match the grader run directly on the entries
+	g, _ := grader.NewGrader(1, int32(block.DBHeight), nil)
+	for _, e := range block.Entries {
+		hash, _ := hex.DecodeString(e.Hash)
+		_ = g.AddOPR(hash, e.ExtIDs, e.Content)
+	}
+	winners := g.Grade().Winners()
+
+	oprblock, err := r.BlockStore.FetchOPRBlock(block.DBHeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oprblock.EmptyOPRBlock || len(oprblock.GradedOPRs) < len(winners) || len(winners) != 10 {
+		t.Fatalf("exp a graded oprblock, found %d graded oprs", len(oprblock.GradedOPRs))
+	}
+	for i, w := range winners {
+		if !bytes.Equal(oprblock.GradedOPRs[i].EntryHash, w.EntryHash) {
+			t.Errorf("winner %d: exp %x, found %x", i, w.EntryHash, oprblock.GradedOPRs[i].EntryHash)
+		}
+	}
+
+	oprblock, err = r.BlockStore.FetchOPRBlock(short.DBHeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !oprblock.EmptyOPRBlock {
+		t.Error("exp a block without enough records to be invalid")
+	}
+
+	// A tampered entry must fail the replay
+	block.Entries[0].Content = []byte("{}")
+	if err := r.ReplayEBlock(block); err == nil {
+		t.Error("exp an error for an entry that does not match its hash")
+	}
+}
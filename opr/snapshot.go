@@ -0,0 +1,432 @@
+package opr
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pegnet/pegnet/balances"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+)
+
+// SnapshotVersion is the version of the snapshot format written by ExportSnapshot
+const SnapshotVersion = 1
+
+// A snapshot is line delimited json, like a chain export. The first line is the
+// SnapshotHeader, every line after it is a SnapshotRecord, and the last line is the
+// SnapshotFooter with the number of records and the sha256 of every line before it.
+// Files ending in .gz are gzipped.
+
+// SnapshotBuckets are the buckets of the miner database in a snapshot. They are
+// everything a grader restores: the graded blocks, the balances and the opr chain cursor.
+var SnapshotBuckets = []database.Bucket{
+	database.BUCKET_OPR_HEIGHT,
+	database.BUCKET_PRICE_HISTORY,
+	database.BUCKET_BALANCES,
+	database.BUCKET_EBLOCK_SYNC,
+}
+
+// SnapshotHeader describes the database in a snapshot
+type SnapshotHeader struct {
+	Version int    `json:"version"`
+	ChainID string `json:"chainid"`
+	Network string `json:"network"`
+	Schema  uint64 `json:"schema"` // The database.SchemaVersion of the records
+	Height  int64  `json:"height"` // The height of the opr chain eblock the snapshot is at
+	KeyMR   string `json:"keymr"`  // The keymr of that eblock
+}
+
+// SnapshotRecord is a key of the database
+type SnapshotRecord struct {
+	Bucket database.Bucket `json:"bucket"`
+	Key    []byte          `json:"key"`
+	Value  []byte          `json:"value"`
+}
+
+// SnapshotFooter ends a snapshot. Its bucket is always INVALID, so it can not be
+// mistaken for a record.
+type SnapshotFooter struct {
+	Bucket   database.Bucket `json:"bucket"`
+	Records  int             `json:"records"`
+	Checksum string          `json:"sha256"`
+}
+
+// SnapshotExport is a snapshot of the database at a height of the opr chain, checked
+// and ready to be written
+type SnapshotExport struct {
+	Header SnapshotHeader
+
+	db       database.IDatabase
+	cursor   []byte // The EntryBlockCursor at the height
+	balances []byte // The BalanceCheckpoint at the height
+}
+
+// PrepareSnapshot checks the database can be exported at the height of the opr chain,
+// before anything is written. A height of 0 is the height the opr chain is synced to.
+// An earlier height has to be an eblock of the opr chain, it is fetched from the client
+// for the cursor. The database has to be in the schema version of this build.
+func PrepareSnapshot(db database.IDatabase, chainID, network string, height int64, client common.FactomClient) (*SnapshotExport, error) {
+	schema, err := database.ReadSchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if schema != database.SchemaVersion() {
+		return nil, fmt.Errorf("the database is version %d, it has to be migrated to %d first", schema, database.SchemaVersion())
+	}
+
+	chain := NewEntryBlockSync(chainID)
+	chain.DB = db
+	if err := chain.LoadCursor(); err != nil {
+		return nil, err
+	}
+	if chain.Current.EntryBlock == nil {
+		return nil, fmt.Errorf("the opr chain %s has not been synced", chainID)
+	}
+
+	current := chain.Current
+	synced := current.EntryBlock.Header.DBHeight
+	switch {
+	case height == 0 || height == synced:
+		height = synced
+	case height > synced:
+		return nil, fmt.Errorf("the opr chain is synced to %d, not %d", synced, height)
+	default:
+		if _, err := db.Get(database.BUCKET_OPR_HEIGHT, database.HeightToBytes(height)); err != nil {
+			return nil, fmt.Errorf("the opr chain has no eblock at %d: %s", height, err.Error())
+		}
+		if client == nil {
+			return nil, fmt.Errorf("factomd is needed for the eblock at %d", height)
+		}
+		chain.Factom = client
+		dblock, _, err := client.GetDBlockByHeight(height)
+		if err != nil {
+			return nil, common.DetailError(err)
+		}
+		current = EntryBlockMarker{}
+		for _, entry := range dblock.DBEntries {
+			if entry.ChainID == chainID {
+				if current, err = chain.fetch(entry.KeyMR); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if current.EntryBlock == nil {
+			return nil, fmt.Errorf("dblock %d does not have an eblock of the opr chain", height)
+		}
+	}
+
+	cursor, err := database.Encode(EntryBlockCursor{Current: current})
+	if err != nil {
+		return nil, err
+	}
+	snap, err := balances.NewBalanceStore(db).SnapshotAt(height)
+	if err != nil {
+		return nil, err
+	}
+	bals, err := database.Encode(snap)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SnapshotExport{
+		Header: SnapshotHeader{
+			Version: SnapshotVersion,
+			ChainID: chainID,
+			Network: network,
+			Schema:  schema,
+			Height:  height,
+			KeyMR:   current.KeyMr,
+		},
+		db:       db,
+		cursor:   cursor,
+		balances: bals,
+	}, nil
+}
+
+// ExportSnapshot writes the snapshot buckets of the database to w, at the height the
+// opr chain is synced to
+func ExportSnapshot(w io.Writer, db database.IDatabase, chainID, network string) (*SnapshotHeader, error) {
+	s, err := PrepareSnapshot(db, chainID, network, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &s.Header, s.Write(w)
+}
+
+// Write writes the snapshot to w. The blocks and price history are the ones up to the
+// height, the balances and the cursor are as they were at it.
+func (s *SnapshotExport) Write(w io.Writer) error {
+	sum := sha256.New()
+	enc := json.NewEncoder(io.MultiWriter(w, sum))
+	if err := enc.Encode(s.Header); err != nil {
+		return err
+	}
+
+	records := 0
+	write := func(bucket database.Bucket, key, value []byte) error {
+		records++
+		return enc.Encode(SnapshotRecord{Bucket: bucket, Key: key, Value: value})
+	}
+	for _, bucket := range SnapshotBuckets {
+		switch bucket {
+		case database.BUCKET_BALANCES:
+			if err := write(bucket, balances.SnapshotKey(), s.balances); err != nil {
+				return err
+			}
+			continue
+		case database.BUCKET_EBLOCK_SYNC:
+			if err := write(bucket, []byte(s.Header.ChainID), s.cursor); err != nil {
+				return err
+			}
+		}
+
+		iter := s.db.Iterate(bucket)
+		for iter.Next() {
+			if !s.includes(bucket, iter.Key()) {
+				continue
+			}
+			if err := write(bucket, iter.Key(), iter.Value()); err != nil {
+				iter.Release()
+				return err
+			}
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+	}
+
+	footer := SnapshotFooter{Records: records, Checksum: hex.EncodeToString(sum.Sum(nil))}
+	return json.NewEncoder(w).Encode(footer)
+}
+
+// includes is true if the key is in the snapshot. The keys of the blocks, prices and
+// eblock heights end in their height.
+func (s *SnapshotExport) includes(bucket database.Bucket, key []byte) bool {
+	if bucket == database.BUCKET_EBLOCK_SYNC {
+		// Only the opr chain is graded from the miner database, its cursor is written at the height
+		if len(key) != len(s.Header.ChainID)+8 || !bytes.HasPrefix(key, []byte(s.Header.ChainID)) {
+			return false
+		}
+	}
+	if len(key) < 8 {
+		return false
+	}
+	return int64(binary.BigEndian.Uint64(key[len(key)-8:])) <= s.Header.Height
+}
+
+// ImportSnapshot reads a snapshot into the database, for the opr chain of the network.
+// The database must not have anything in the snapshot buckets. Nothing is written
+// unless the whole snapshot is read and its checksum matches.
+func ImportSnapshot(r io.Reader, db database.IDatabase, chainID, network string) (*SnapshotHeader, error) {
+	for _, bucket := range SnapshotBuckets {
+		iter := db.Iterate(bucket)
+		used := iter.Next()
+		iter.Release()
+		if used {
+			return nil, fmt.Errorf("the database is not empty, a snapshot can only be imported into a new database")
+		}
+	}
+
+	s := &snapshotReader{r: bufio.NewReader(r), sum: sha256.New()}
+	header := new(SnapshotHeader)
+	if err := s.next(header); err != nil {
+		return nil, fmt.Errorf("failed to read the snapshot header: %s", err.Error())
+	}
+	switch {
+	case header.Version != SnapshotVersion:
+		return nil, fmt.Errorf("snapshot version %d is not supported", header.Version)
+	case header.ChainID != chainID || header.Network != network:
+		return nil, fmt.Errorf("snapshot is of chain %s on %s, expected the opr chain %s on %s", header.ChainID, header.Network, chainID, network)
+	case header.Schema != database.SchemaVersion():
+		return nil, fmt.Errorf("snapshot is of database version %d, this build is version %d", header.Schema, database.SchemaVersion())
+	}
+
+	batch := database.NewBatch()
+	for {
+		sum := s.sum.Sum(nil)
+		var line snapshotLine
+		if err := s.next(&line); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("snapshot ends without a footer")
+			}
+			return nil, err
+		}
+
+		if line.Bucket == database.INVALID {
+			if line.Records != batch.Len() {
+				return nil, fmt.Errorf("snapshot has %d records, the footer has %d", batch.Len(), line.Records)
+			}
+			if line.Checksum != hex.EncodeToString(sum) {
+				return nil, fmt.Errorf("snapshot checksum %s does not match %x", line.Checksum, sum)
+			}
+			break
+		}
+		if !isSnapshotBucket(line.Bucket) {
+			return nil, fmt.Errorf("snapshot has a record in bucket %d", line.Bucket)
+		}
+		batch.Put(line.Bucket, line.Key, line.Value)
+	}
+
+	if err := db.Write(batch); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// DeleteSnapshot removes everything in the snapshot buckets, such as a snapshot that
+// failed to verify
+func DeleteSnapshot(db database.IDatabase) error {
+	batch := database.NewBatch()
+	for _, bucket := range SnapshotBuckets {
+		iter := db.Iterate(bucket)
+		for iter.Next() {
+			batch.Delete(bucket, append([]byte{}, iter.Key()...))
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+	}
+	return db.Write(batch)
+}
+
+// VerifySnapshot grades the last eblock of an imported snapshot again from factomd,
+// and checks its winners are the winners in the snapshot. The grader has to be
+// created on the database the snapshot was imported into.
+func (g *QuickGrader) VerifySnapshot(header *SnapshotHeader) error {
+	current := g.OPRChain.Current
+	if current.KeyMr != header.KeyMR {
+		return fmt.Errorf("the opr chain is synced to %s, the snapshot to %s", current.KeyMr, header.KeyMR)
+	}
+
+	eblock, err := g.Factom.GetEBlock(header.KeyMR)
+	if err != nil {
+		return err
+	}
+	if err := g.OPRChain.VerifyEBlock(header.KeyMR, eblock); err != nil {
+		return err
+	}
+	if eblock.Header.DBHeight != header.Height {
+		return fmt.Errorf("eblock %s is at height %d, the snapshot is at %d", header.KeyMR, eblock.Header.DBHeight, header.Height)
+	}
+
+	graded, err := g.FetchOPRBlock(&EntryBlockMarker{KeyMr: header.KeyMR, EntryBlock: eblock})
+	if err != nil {
+		return err
+	}
+	stored, err := g.BlockStore.FetchOPRBlock(header.Height)
+	if err != nil {
+		return err
+	}
+
+	if graded == nil || stored.EmptyOPRBlock {
+		if graded != nil || !stored.EmptyOPRBlock {
+			return fmt.Errorf("the snapshot and the chain do not agree if block %d has winners", header.Height)
+		}
+		return nil
+	}
+
+	winners := g.MinRecords(header.Height)
+	if len(graded.GradedOPRs) < winners || len(stored.GradedOPRs) < winners {
+		return fmt.Errorf("block %d has less than %d graded oprs", header.Height, winners)
+	}
+	for i := 0; i < winners; i++ {
+		if !bytes.Equal(graded.GradedOPRs[i].EntryHash, stored.GradedOPRs[i].EntryHash) {
+			return fmt.Errorf("winner %d of block %d is %x on chain, %x in the snapshot", i, header.Height,
+				graded.GradedOPRs[i].EntryHash, stored.GradedOPRs[i].EntryHash)
+		}
+	}
+	return nil
+}
+
+func isSnapshotBucket(bucket database.Bucket) bool {
+	for _, b := range SnapshotBuckets {
+		if b == bucket {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotLine is a record or the footer, they are told apart by the bucket
+type snapshotLine struct {
+	SnapshotRecord
+	Records  int    `json:"records"`
+	Checksum string `json:"sha256"`
+}
+
+// snapshotReader reads the lines of a snapshot, and sums them as it goes
+type snapshotReader struct {
+	r   *bufio.Reader
+	sum hash.Hash
+}
+
+func (s *snapshotReader) next(v interface{}) error {
+	line, err := s.r.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		return io.ErrUnexpectedEOF // Every line ends in a newline
+	}
+	if err != nil {
+		return err
+	}
+	s.sum.Write(line)
+	return json.Unmarshal(line, v)
+}
+
+// CreateSnapshotFile creates the file at the path to export a snapshot to, gzipped
+// if the path ends in .gz
+func CreateSnapshotFile(path string) (io.WriteCloser, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz := gzip.NewWriter(f)
+	return &snapshotFile{Writer: gz, closers: []io.Closer{gz, f}}, nil
+}
+
+// OpenSnapshotFile opens the snapshot file at the path, gzipped if the path ends in .gz
+func OpenSnapshotFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &snapshotFile{Reader: gz, closers: []io.Closer{gz, f}}, nil
+}
+
+// snapshotFile closes the gzip stream before the file under it
+type snapshotFile struct {
+	io.Reader
+	io.Writer
+	closers []io.Closer
+}
+
+func (s *snapshotFile) Close() error {
+	for _, c := range s.closers {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
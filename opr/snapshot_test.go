@@ -0,0 +1,223 @@
+package opr_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/FactomProject/factom"
+	"github.com/pegnet/pegnet/balances"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+	. "github.com/pegnet/pegnet/opr"
+	"github.com/zpatrick/go-config"
+)
+
+// snapshotTestConfig is a mainnet config, for the mainnet block on the test chain
+func snapshotTestConfig() *config.Config {
+	return config.NewConfig([]config.Provider{
+		common.NewUnitTestConfigProvider(),
+		config.NewStatic(map[string]string{"Miner.Network": common.MainNetwork}),
+	})
+}
+
+// snapshotTestGrader returns a grader synced to a fake chain with a mainnet block
+func snapshotTestGrader(t *testing.T) (*QuickGrader, *common.FakeFactomClient) {
+	common.SetTestingVersion(1)
+	db := database.NewMapDb()
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	g := NewQuickGrader(snapshotTestConfig(), db, balances.NewBalanceTracker())
+
+	chain := exportedTestChain(t, g)
+	if err := g.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.GetBlocks()) != 1 {
+		t.Fatalf("exp 1 graded block, found %d", len(g.GetBlocks()))
+	}
+	return g, chain
+}
+
+// exportedTestChain has the grader sync from a fake chain with a mainnet block
+func exportedTestChain(t *testing.T, g *QuickGrader) *common.FakeFactomClient {
+	block := exportedTestBlock(t, g.OPRChainIDString)
+	chain := common.NewFakeFactomClient(block.DBHeight)
+	ec, _ := factom.GetECAddress("Es2XT3jSxi1xqrDvS5JERM3W3jh1awRHuyoahn3hbQLyfEi1jvbq")
+	chain.AddECAddress(ec, 1e6)
+	for _, e := range block.Entries {
+		entry := e.Entry(g.OPRChainIDString)
+		if _, err := chain.CommitEntry(entry, ec); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := chain.RevealEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chain.AdvanceBlock()
+
+	g.SetFactomClient(chain)
+	return chain
+}
+
+func TestSnapshot(t *testing.T) {
+	g, chain := snapshotTestGrader(t)
+
+	buf := new(bytes.Buffer)
+	header, err := ExportSnapshot(buf, g.DB, g.OPRChainIDString, g.Network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Height != chain.StartHeight || header.KeyMR != g.OPRChain.Current.KeyMr {
+		t.Errorf("exp the snapshot at the synced eblock, found %d %s", header.Height, header.KeyMR)
+	}
+
+	// Gzipped files read back the same
+	dir, err := ioutil.TempDir("", "pegnet-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json.gz")
+	f, err := CreateSnapshotFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenSnapshotFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, buf.Bytes()) {
+		t.Errorf("exp the gzipped snapshot to read back the same, found %v", err)
+	}
+	r.Close()
+
+	// Import into a new database, and grade the last block again from the chain
+	importTo := func(data []byte) (database.IDatabase, *SnapshotHeader, error) {
+		db := database.NewMapDb()
+		if _, err := database.Migrate(db); err != nil {
+			t.Fatal(err)
+		}
+		header, err := ImportSnapshot(bytes.NewReader(data), db, g.OPRChainIDString, g.Network)
+		return db, header, err
+	}
+	db, imported, err := importTo(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewQuickGrader(snapshotTestConfig(), db, balances.NewBalanceTracker())
+	restored.SetFactomClient(chain)
+	if err := restored.VerifySnapshot(imported); err != nil {
+		t.Errorf("exp the snapshot to verify, found %v", err)
+	}
+	if len(restored.GetBlocks()) != 1 || !restored.OPRChain.Current.IsSameAs(&g.OPRChain.Current) {
+		t.Error("exp the opr chain to be restored from the snapshot")
+	}
+	if _, err := ImportSnapshot(bytes.NewReader(buf.Bytes()), db, g.OPRChainIDString, g.Network); err == nil {
+		t.Error("exp an error importing into a database that is not empty")
+	}
+
+	// Winners that are not on chain fail to verify
+	block, _ := restored.BlockStore.FetchOPRBlock(imported.Height)
+	block.GradedOPRs[0], block.GradedOPRs[1] = block.GradedOPRs[1], block.GradedOPRs[0]
+	batch := database.NewBatch()
+	if err := restored.BlockStore.WriteOPRBlock(batch, block); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.VerifySnapshot(imported); err == nil {
+		t.Error("exp the swapped winners to fail to verify")
+	}
+	if err := DeleteSnapshot(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(database.BUCKET_OPR_HEIGHT, database.HeightToBytes(imported.Height)); err != database.ErrNotFound {
+		t.Errorf("exp the snapshot to be deleted, found %v", err)
+	}
+
+	// A changed record does not match the checksum, and nothing is imported
+	data := append([]byte{}, buf.Bytes()...)
+	data[len(data)/2]++
+	db, _, err = importTo(data)
+	if err == nil {
+		t.Error("exp an error for a snapshot that does not match its checksum")
+	}
+	if iter := db.Iterate(database.BUCKET_OPR_HEIGHT); iter.Next() {
+		t.Error("exp nothing to be imported")
+	}
+}
+
+func TestSnapshot_Height(t *testing.T) {
+	g, chain := snapshotTestGrader(t)
+	first, keyMR := chain.StartHeight, g.OPRChain.Current.KeyMr
+	if _, err := PrepareSnapshot(g.DB, g.OPRChainIDString, g.Network, first+1, chain); err == nil {
+		t.Error("exp an error for a height the opr chain is not synced to")
+	}
+
+	// An eblock without oprs is synced after the one we export at
+	ec, _ := factom.GetECAddress("Es2XT3jSxi1xqrDvS5JERM3W3jh1awRHuyoahn3hbQLyfEi1jvbq")
+	chain.AdvanceBlock()
+	entry := &factom.Entry{ChainID: g.OPRChainIDString, Content: []byte("not an opr")}
+	if _, err := chain.CommitEntry(entry, ec); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.RevealEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+	chain.AdvanceBlock()
+	if err := g.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	last := g.OPRChain.Current.EntryBlock.Header.DBHeight
+
+	if _, err := PrepareSnapshot(g.DB, g.OPRChainIDString, g.Network, first+1, chain); err == nil {
+		t.Error("exp an error for a height without an eblock")
+	}
+	snapshot, err := PrepareSnapshot(g.DB, g.OPRChainIDString, g.Network, first, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Header.Height != first || snapshot.Header.KeyMR != keyMR {
+		t.Errorf("exp the snapshot at the first eblock, found %d %s", snapshot.Header.Height, snapshot.Header.KeyMR)
+	}
+	buf := new(bytes.Buffer)
+	if err := snapshot.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	db := database.NewMapDb()
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportSnapshot(bytes.NewReader(buf.Bytes()), db, g.OPRChainIDString, g.Network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(database.BUCKET_OPR_HEIGHT, database.HeightToBytes(last)); err != database.ErrNotFound {
+		t.Errorf("exp the block after the height not to be exported, found %v", err)
+	}
+	restored := NewQuickGrader(snapshotTestConfig(), db, balances.NewBalanceTracker())
+	restored.SetFactomClient(chain)
+	if err := restored.VerifySnapshot(imported); err != nil {
+		t.Errorf("exp the snapshot to verify, found %v", err)
+	}
+
+	// The restored grader syncs the eblock after it
+	if err := restored.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if restored.OPRChain.Current.KeyMr != g.OPRChain.Current.KeyMr || len(restored.OPRChain.Heights) != 2 {
+		t.Errorf("exp the restored grader to sync up to %d, found %v", last, restored.OPRChain.Heights)
+	}
+}
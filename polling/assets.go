@@ -2,6 +2,7 @@ package polling
 
 import (
 	"fmt"
+	"math"
 	"regexp"
 	"sort"
 	"strings"
@@ -14,8 +15,17 @@ import (
 
 var dLog = log.WithField("id", "DataSources")
 
+// The aggregation modes, which decide how the quotes of all the data sources for
+// an asset are combined into a single price.
+const (
+	AggregatePriority    = "priority"    // The quote of the highest priority source
+	AggregateMedian      = "median"      // The median of all quotes
+	AggregateTrimmedMean = "trimmedmean" // The mean of all quotes without the highest and lowest
+)
+
 // AllDataSources is just a hard coded list of all the available assets. This list is copied in
 // `NewDataSource`. These are the only two spots the list should be hard coded.
+// The custom json data sources are defined in the config, so they are not in this list.
 // The reason I have the `new(DataSource` is so I can get the name, url, and supported
 // pegs from this map. It's useful in the cmdline to fetch the datasources dynamically.
 var AllDataSources = map[string]IDataSource{
@@ -33,6 +43,7 @@ var AllDataSources = map[string]IDataSource{
 	"AlternativeMe":     new(AlternativeMeDataSource),
 	"PegnetMarketCap":   new(PegnetMarketCapDataSource),
 	"CoinGecko":         new(CoinGeckoDataSource),
+	"Stream":            new(StreamDataSource),
 	//"Factoshiio":        new(FactoshiioDataSource), // This will be deprecated
 }
 
@@ -101,10 +112,21 @@ func NewDataSource(source string, config *config.Config) (IDataSource, error) {
 		ds, err = NewFactoshiioDataSource()
 	case "CoinGecko":
 		ds, err = NewCoinGeckoDataSource()
+	case "Stream":
+		// The stream always has the latest ticks, caching would only make them older
+		stream, err := NewStreamDataSource(config)
+		if err != nil {
+			return nil, err
+		}
+		return stream, nil
 	case "UnitTest": // This will fail outside a unit test
 		ds, err = NewTestingDataSource(config, source)
 	default:
-		return nil, fmt.Errorf("%s is not a supported data source", source)
+		// Anything else must be defined in the config
+		if !IsCustomJSONDataSource(config, source) {
+			return nil, fmt.Errorf("%s is not a supported data source", source)
+		}
+		ds, err = NewCustomJSONDataSource(config, source)
 	}
 
 	if err != nil {
@@ -134,10 +156,15 @@ type DataSources struct {
 	// The list of data sources by priority.
 	PriorityList []DataSourceWithPriority
 
+	// Health tracks the data sources, and demotes the misbehaving ones
+	Health *HealthTracker
+
 	config *config.Config
 
 	// Some configuration variables read in from the config
-	staleDuration time.Duration
+	staleDuration  time.Duration
+	aggregation    string
+	outlierPercent float64
 }
 
 type DataSourceWithPriority struct {
@@ -164,6 +191,24 @@ func NewDataSources(config *config.Config) *DataSources {
 	}
 	d.staleDuration = duration
 
+	d.aggregation, err = d.config.String(common.ConfigAggregationMode)
+	common.CheckAndPanic(err)
+	d.aggregation = strings.ToLower(d.aggregation)
+	switch d.aggregation {
+	case AggregatePriority, AggregateMedian, AggregateTrimmedMean:
+	default:
+		common.CheckAndPanic(fmt.Errorf("'%s' is not a valid aggregation mode, expect one of %s, %s, %s",
+			d.aggregation, AggregatePriority, AggregateMedian, AggregateTrimmedMean))
+	}
+
+	d.outlierPercent, err = d.config.Float(common.ConfigOutlierPercent)
+	common.CheckAndPanic(err)
+	if d.outlierPercent < 0 {
+		common.CheckAndPanic(fmt.Errorf("%s cannot be negative", common.ConfigOutlierPercent))
+	}
+
+	d.Health = NewHealthTracker(loadHealthThresholds(config), d.staleDuration)
+
 	// Load all the data-source config settings
 	allSettings, err := config.Settings()
 	common.CheckAndPanic(err)
@@ -189,6 +234,13 @@ func NewDataSources(config *config.Config) *DataSources {
 			s, err := NewDataSource(source[1], config)
 			common.CheckAndPanic(err)
 
+			// Record the actual calls, not the cached ones
+			if cache, ok := s.(*TimedDataSourceCache); ok {
+				cache.IDataSource = d.Health.Wrap(cache.IDataSource)
+			} else {
+				s = d.Health.Wrap(s)
+			}
+
 			// Add to our lists
 			d.PriorityList = append(d.PriorityList, DataSourceWithPriority{DataSource: s, Priority: p})
 			d.DataSources[s.Name()] = s
@@ -233,6 +285,22 @@ func NewDataSources(config *config.Config) *DataSources {
 	return d
 }
 
+func loadHealthThresholds(config *config.Config) HealthThresholds {
+	var t HealthThresholds
+	var err error
+	t.MaxLatency, err = configDuration(config, common.ConfigHealthMaxLatency)
+	common.CheckAndPanic(err)
+	t.DemoteFor, err = configDuration(config, common.ConfigHealthDemoteDuration)
+	common.CheckAndPanic(err)
+	t.MaxErrorRate, err = config.Float(common.ConfigHealthMaxErrorRate)
+	common.CheckAndPanic(err)
+	t.MaxStaleRate, err = config.Float(common.ConfigHealthMaxStaleRate)
+	common.CheckAndPanic(err)
+	t.MaxDeviation, err = config.Float(common.ConfigHealthMaxDeviation)
+	common.CheckAndPanic(err)
+	return t
+}
+
 // sortPriorityList sorts by priority
 func (ds *DataSources) sortPriorityList() {
 	sort.SliceStable(ds.PriorityList, func(i, j int) bool { return ds.PriorityList[i].Priority < ds.PriorityList[j].Priority })
@@ -356,6 +424,15 @@ func (d *DataSources) PullBestPrice(asset string, reference time.Time, sources m
 
 	// All the given data sources for the asset
 	sourceList := d.AssetSources[asset]
+	if d.Health != nil {
+		// Demoted sources go last. When combining the quotes, they are
+		// only used if no healthy source is left.
+		healthy, demoted := d.Health.Split(sourceList)
+		sourceList = append(healthy, demoted...)
+		if d.aggregation != AggregatePriority && len(healthy) > 0 {
+			sourceList = healthy
+		}
+	}
 
 	var prices []PegItem
 
@@ -373,6 +450,19 @@ func (d *DataSources) PullBestPrice(asset string, reference time.Time, sources m
 		}
 	}
 
+	// Stale quotes are dropped first, so they do not move the median the
+	// outliers are measured from
+	if d.outlierPercent > 0 || d.aggregation != AggregatePriority {
+		prices = d.nonStale(prices, reference)
+	}
+	if d.outlierPercent > 0 {
+		prices = RejectOutliers(prices, d.outlierPercent)
+	}
+
+	if len(prices) > 0 && d.aggregation != AggregatePriority {
+		return AggregatePrices(d.aggregation, prices), nil
+	}
+
 	if oprversion == 5 {
 		pricesClone := prices
 		if len(pricesClone) > 0 {
@@ -432,6 +522,86 @@ func (d *DataSources) PullBestPrice(asset string, reference time.Time, sources m
 		"please check your config file to ensure a datasource exists for this asset", asset)
 }
 
+// nonStale drops the quotes older than the stale duration from the reference. If every
+// quote is stale, they are all returned, as a stale price is better than none.
+func (d *DataSources) nonStale(prices []PegItem, reference time.Time) []PegItem {
+	var fresh []PegItem
+	for _, p := range prices {
+		if reference.Sub(p.When) <= d.staleDuration {
+			fresh = append(fresh, p)
+		}
+	}
+	if len(fresh) == 0 {
+		return prices
+	}
+	return fresh
+}
+
+// MedianPrice returns the median value of the quotes
+func MedianPrice(prices []PegItem) float64 {
+	values := make([]float64, len(prices))
+	for i := range prices {
+		values[i] = prices[i].Value
+	}
+	sort.Float64s(values)
+
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// RejectOutliers drops the quotes that deviate more than the given percent from
+// the median of all quotes. The priority order of the quotes is kept. If every quote
+// is rejected, such as quotes in two clusters with the median between them, there
+// is no telling which are the outliers and all of them are returned.
+func RejectOutliers(prices []PegItem, percent float64) []PegItem {
+	if len(prices) < 3 {
+		return prices // With 2 quotes, there is no telling which is the outlier
+	}
+	median := MedianPrice(prices)
+	if median == 0 {
+		return prices
+	}
+
+	var kept []PegItem
+	for _, p := range prices {
+		if math.Abs(p.Value-median)/median*100 <= percent {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == 0 {
+		return prices
+	}
+	return kept
+}
+
+// AggregatePrices combines the quotes into a single price with the given mode. The
+// timestamp is that of the most recent quote. The quotes must be in priority order.
+func AggregatePrices(mode string, prices []PegItem) PegItem {
+	sorted := make([]PegItem, len(prices))
+	copy(sorted, prices) // TrimmedMean sorts in place, keep the priority order intact
+
+	var pa PegItem
+	switch mode {
+	case AggregateMedian:
+		pa.Value = MedianPrice(sorted)
+	case AggregateTrimmedMean:
+		pa.Value = TrimmedMean(sorted, 1)
+	default:
+		return prices[0]
+	}
+
+	for _, p := range prices {
+		if p.When.After(pa.When) {
+			pa.When = p.When
+		}
+	}
+	pa.WhenUnix = pa.When.Unix()
+	return pa
+}
+
 // OneTimeUseCache will cache the data source response so we can query for
 // prices individually without making a new api call. This cache is only to be used
 // for 1 moment, rather than being used as a cache across multiple actions/rountines.
@@ -201,6 +201,90 @@ func configWithStaleness(d string) *config.Config {
 	return config
 }
 
+func configWithAggregation(mode string, outlier float64) *config.Config {
+	custom := common.NewUnitTestConfigProvider()
+	custom.Data = fmt.Sprintf(`
+[Oracle]
+  StaleQuoteDuration=10m
+  AggregationMode=%s
+  OutlierPercent=%f
+`, mode, outlier)
+	return config.NewConfig([]config.Provider{common.NewDefaultConfigOptionsProvider(), custom})
+}
+
+func TestDataSourceAggregation(t *testing.T) {
+	// In priority order. The first source is misbehaving, the last is stale.
+	values := []float64{50, 10, 11, 12, 9, 100}
+	mapped := make(map[string]IDataSource)
+	var names []string
+	reference := time.Now()
+	for i, v := range values {
+		s := new(testutils.UnitTestDataSource)
+		s.Value = v
+		s.Assets = common.AllAssets
+		s.SourceName = fmt.Sprintf("UnitTest%d", i)
+		s.Timestamp = func() time.Time { return reference }
+		if i == len(values)-1 {
+			s.Timestamp = func() time.Time { return reference.Add(-time.Hour) }
+		}
+		mapped[s.SourceName] = s
+		names = append(names, s.SourceName)
+	}
+
+	vects := []struct {
+		Mode    string
+		Outlier float64
+		Exp     float64
+	}{
+		{AggregatePriority, 0, 50},
+		{AggregatePriority, 20, 10},   // Only 9 to 12 are within 20% of the median 11, the stale 100 is not counted
+		{AggregateMedian, 0, 11},      // The stale 100 is ignored
+		{AggregateMedian, 20, 10.5},   // Median of 9, 10, 11, 12
+		{AggregateTrimmedMean, 0, 11}, // Mean of 10, 11, 12
+		{AggregateTrimmedMean, 5, 11}, // Only 11 is within 5%, too few to trim so the top priority is used
+	}
+
+	for _, v := range vects {
+		d := NewDataSources(configWithAggregation(v.Mode, v.Outlier))
+		d.AssetSources["EUR"] = names
+
+		price, err := d.PullBestPrice("EUR", reference, mapped, 4)
+		if err != nil {
+			t.Error(err)
+		}
+		if price.Value != v.Exp {
+			t.Errorf("%s with %.0f%% outliers: exp %f, found %f", v.Mode, v.Outlier, v.Exp, price.Value)
+		}
+	}
+}
+
+func TestRejectOutliers(t *testing.T) {
+	quotes := func(values ...float64) []PegItem {
+		prices := make([]PegItem, len(values))
+		for i, v := range values {
+			prices[i].Value = v
+		}
+		return prices
+	}
+
+	vects := []struct {
+		Prices  []PegItem
+		Percent float64
+		Exp     int
+	}{
+		{quotes(10, 11, 12, 50), 20, 3},
+		{quotes(10, 11), 1, 2},        // Too few to tell the outlier
+		{quotes(1, 1, 2, 2), 5, 4},    // The median 1.5 is between the clusters, so nothing is rejected
+		{quotes(1, 1, 1, 2, 2), 5, 3}, // The median is in the larger cluster
+	}
+
+	for i, v := range vects {
+		if kept := RejectOutliers(v.Prices, v.Percent); len(kept) != v.Exp {
+			t.Errorf("vector %d: exp %d quotes, found %d", i, v.Exp, len(kept))
+		}
+	}
+}
+
 func reverse(list []string) []string {
 	rev := make([]string, len(list))
 	for i, v := range list {
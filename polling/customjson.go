@@ -0,0 +1,213 @@
+package polling
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pegnet/pegnet/common"
+	config "github.com/zpatrick/go-config"
+)
+
+// CustomJSONDataSource is a data source defined entirely in the config file, in the
+// [OracleCustomSource.<name>] section. The name is what is ranked in [OracleDataSources],
+// so any number of them can be added.
+//	URL				The url to fetch. If it contains {asset}, it is fetched once per asset
+//	AuthHeader		Optional header sent with every request, ie "Authorization: Bearer KEY"
+//	<ASSET>			JSONPath to the price of the asset, ie XBT=$.data.bitcoin.usd
+//	Invert			Optional comma separated assets quoted as units per USD, rather than USD per unit
+//	Timestamp		Optional JSONPath to the quote time. If omitted, the time of the request is used
+//	TimestampFormat	unix (default), unixms, or a go time layout for string timestamps
+type CustomJSONDataSource struct {
+	config *config.Config
+
+	name            string
+	url             string
+	authHeader      string
+	paths           map[string]string
+	invert          map[string]bool
+	timestampPath   string
+	timestampFormat string
+}
+
+// IsCustomJSONDataSource returns true if the config has a custom source section for the name
+func IsCustomJSONDataSource(config *config.Config, name string) bool {
+	if config == nil {
+		return false
+	}
+	_, err := config.String(customSourceSetting(name, "URL"))
+	return err == nil
+}
+
+func customSourceSetting(name, setting string) string {
+	return fmt.Sprintf("%s.%s.%s", common.ConfigCustomSourcePrefix, name, setting)
+}
+
+func NewCustomJSONDataSource(config *config.Config, name string) (*CustomJSONDataSource, error) {
+	var err error
+	s := new(CustomJSONDataSource)
+	s.config = config
+	s.name = name
+
+	s.url, err = config.String(customSourceSetting(name, "URL"))
+	if err != nil {
+		return nil, err
+	}
+
+	// The rest are optional
+	s.authHeader, _ = config.String(customSourceSetting(name, "AuthHeader"))
+	if s.authHeader != "" && !strings.Contains(s.authHeader, ":") {
+		return nil, fmt.Errorf("%s must be in the form 'Header: value'", customSourceSetting(name, "AuthHeader"))
+	}
+	s.timestampPath, _ = config.String(customSourceSetting(name, "Timestamp"))
+	s.timestampFormat, _ = config.String(customSourceSetting(name, "TimestampFormat"))
+
+	s.paths = make(map[string]string)
+	for _, asset := range common.AllAssets {
+		if path, err := config.String(customSourceSetting(name, asset)); err == nil && path != "" {
+			s.paths[asset] = path
+		}
+	}
+	if len(s.paths) == 0 {
+		return nil, fmt.Errorf("custom data source %s does not have any assets", name)
+	}
+
+	s.invert = make(map[string]bool)
+	if inverted, err := config.String(customSourceSetting(name, "Invert")); err == nil && inverted != "" {
+		for _, asset := range strings.Split(inverted, ",") {
+			asset = strings.ToUpper(strings.TrimSpace(asset))
+			if _, ok := s.paths[asset]; !ok {
+				return nil, fmt.Errorf("custom data source %s inverts %s, which has no path", name, asset)
+			}
+			s.invert[asset] = true
+		}
+	}
+
+	return s, nil
+}
+
+func (d *CustomJSONDataSource) Name() string {
+	return d.name
+}
+
+func (d *CustomJSONDataSource) Url() string {
+	return d.url
+}
+
+func (d *CustomJSONDataSource) SupportedPegs() []string {
+	var pegs []string
+	for _, asset := range common.AllAssets {
+		if _, ok := d.paths[asset]; ok {
+			pegs = append(pegs, asset)
+		}
+	}
+	return pegs
+}
+
+func (d *CustomJSONDataSource) FetchPegPrices() (peg PegAssets, err error) {
+	peg = make(map[string]PegItem)
+
+	perAsset := strings.Contains(d.url, "{asset}")
+	var resp interface{}
+	var when time.Time
+	if !perAsset {
+		resp, when, err = d.fetch(d.url)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, asset := range d.SupportedPegs() {
+		if perAsset {
+			resp, when, err = d.fetch(strings.Replace(d.url, "{asset}", asset, -1))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		value, err := JSONPathFloat(resp, d.paths[asset])
+		if err != nil {
+			continue // The asset is missing from this response
+		}
+		if d.invert[asset] {
+			if value == 0 {
+				continue
+			}
+			value = 1 / value
+		}
+		peg[asset] = PegItem{Value: value, WhenUnix: when.Unix(), When: when}
+	}
+
+	return
+}
+
+func (d *CustomJSONDataSource) FetchPegPrice(peg string) (i PegItem, err error) {
+	return FetchPegPrice(peg, d.FetchPegPrices)
+}
+
+// fetch calls the url and returns the decoded json and the timestamp of the quotes
+func (d *CustomJSONDataSource) fetch(url string) (interface{}, time.Time, error) {
+	client := NewHTTPClient()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if d.authHeader != "" {
+		parts := strings.SplitN(d.authHeader, ":", 2)
+		req.Header.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, time.Time{}, fmt.Errorf("%s returned status %d", d.name, resp.StatusCode)
+	}
+
+	var body interface{}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber() // Keep the precision of the prices
+	if err := dec.Decode(&body); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	when, err := d.timestamp(body)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return body, when, nil
+}
+
+func (d *CustomJSONDataSource) timestamp(body interface{}) (time.Time, error) {
+	if d.timestampPath == "" {
+		return time.Now(), nil
+	}
+
+	v, err := JSONPath(body, d.timestampPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	str := fmt.Sprintf("%v", v)
+
+	switch d.timestampFormat {
+	case "", "unix":
+		sec, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(sec, 0), nil
+	case "unixms":
+		ms, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)), nil
+	default:
+		return time.Parse(d.timestampFormat, str)
+	}
+}
@@ -0,0 +1,116 @@
+package polling_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/polling"
+	"github.com/zpatrick/go-config"
+)
+
+func TestCustomJSONDataSource(t *testing.T) {
+	polling.NewHTTPClient = func() *http.Client {
+		return &http.Client{}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/all":
+			fmt.Fprint(w, `{"ts":1571234567,"data":{"btc":{"usd":"8123.45"},"eur.rate":{"per_usd":0.9}},"list":[{"price":180.5}]}`)
+		case "/asset/XBT":
+			fmt.Fprint(w, `{"price":8000,"time":"2019-10-16T14:02:47Z"}`)
+		case "/asset/ETH":
+			fmt.Fprint(w, `{"price":180,"time":"2019-10-16T14:02:47Z"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := config.NewConfig([]config.Provider{
+		common.NewUnitTestConfigProvider(),
+		config.NewStatic(map[string]string{
+			"OracleCustomSource.MyFeed.URL":        srv.URL + "/all",
+			"OracleCustomSource.MyFeed.AuthHeader": "X-Api-Key: secret",
+			"OracleCustomSource.MyFeed.XBT":        "$.data.btc.usd",
+			"OracleCustomSource.MyFeed.EUR":        "$.data['eur.rate'].per_usd",
+			"OracleCustomSource.MyFeed.ETH":        "$.list[0].price",
+			"OracleCustomSource.MyFeed.LTC":        "$.data.ltc.usd",
+			"OracleCustomSource.MyFeed.Invert":     "EUR",
+			"OracleCustomSource.MyFeed.Timestamp":  "$.ts",
+
+			"OracleCustomSource.PerAsset.URL":             srv.URL + "/asset/{asset}",
+			"OracleCustomSource.PerAsset.AuthHeader":      "X-Api-Key: secret",
+			"OracleCustomSource.PerAsset.XBT":             "price",
+			"OracleCustomSource.PerAsset.ETH":             "$.price",
+			"OracleCustomSource.PerAsset.Timestamp":       "time",
+			"OracleCustomSource.PerAsset.TimestampFormat": "2006-01-02T15:04:05Z",
+		}),
+	})
+
+	s, err := polling.NewDataSource("MyFeed", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name() != "MyFeed" {
+		t.Errorf("exp name MyFeed, found %s", s.Name())
+	}
+
+	prices, err := s.FetchPegPrices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string]float64{"XBT": 8123.45, "EUR": 1 / 0.9, "ETH": 180.5}
+	if len(prices) != len(exp) {
+		t.Errorf("exp %d prices, found %d", len(exp), len(prices))
+	}
+	for asset, v := range exp {
+		if prices[asset].Value != v {
+			t.Errorf("exp %s to be %f, found %f", asset, v, prices[asset].Value)
+		}
+		if prices[asset].WhenUnix != 1571234567 {
+			t.Errorf("exp %s timestamp to be %d, found %d", asset, 1571234567, prices[asset].WhenUnix)
+		}
+	}
+
+	s, err = polling.NewDataSource("PerAsset", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prices, err = s.FetchPegPrices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prices["XBT"].Value != 8000 || prices["ETH"].Value != 180 {
+		t.Errorf("unexpected per asset prices %v", prices)
+	}
+	if prices["XBT"].WhenUnix != 1571234567 {
+		t.Errorf("exp timestamp to be %d, found %d", 1571234567, prices["XBT"].WhenUnix)
+	}
+
+	if _, err := polling.NewDataSource("NotConfigured", c); err == nil {
+		t.Error("exp an error for a source that is not configured")
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	data := map[string]interface{}{
+		"a": []interface{}{map[string]interface{}{"b c": 1.5}},
+	}
+	v, err := polling.JSONPathFloat(data, "$.a[0]['b c']")
+	if err != nil || v != 1.5 {
+		t.Errorf("exp 1.5, found %f (err %v)", v, err)
+	}
+	for _, path := range []string{"$.a[1]", "$.b", "$.a[0]['b c'", "$a", "$.a."} {
+		if _, err := polling.JSONPath(data, path); err == nil {
+			t.Errorf("exp an error for %s", path)
+		}
+	}
+}
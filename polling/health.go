@@ -0,0 +1,227 @@
+package polling
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// healthSmoothing is the weight of the newest sample in the moving averages
+	healthSmoothing = 0.2
+	// healthMinSamples is the number of fetches before a source can be demoted for
+	// its latency, errors or staleness. One bad call should not demote a source.
+	healthMinSamples = 5
+)
+
+// HealthThresholds are the limits a data source must stay within. A source over any
+// of them is moved to the end of the priority order for the demote duration.
+type HealthThresholds struct {
+	MaxLatency   time.Duration
+	MaxErrorRate float64 // 0 to 1
+	MaxStaleRate float64 // 0 to 1
+	MaxDeviation float64 // Percent from the graded winning price
+	DemoteFor    time.Duration
+}
+
+// SourceHealth is the health record of a single data source. The rates are
+// moving averages, so recent behavior counts the most.
+type SourceHealth struct {
+	Name         string        `json:"name"`
+	Requests     int64         `json:"requests"`
+	Errors       int64         `json:"errors"`
+	ErrorRate    float64       `json:"errorrate"`
+	Latency      time.Duration `json:"latency"`
+	StaleRate    float64       `json:"stalerate"`
+	Deviation    float64       `json:"deviation"`
+	Graded       int64         `json:"graded"` // Number of graded blocks the deviation is measured over
+	LastError    string        `json:"lasterror,omitempty"`
+	Demoted      bool          `json:"demoted"`
+	DemotedUntil time.Time     `json:"demoteduntil,omitempty"`
+	Reason       string        `json:"reason,omitempty"`
+
+	// last are the last quotes, to compare against the graded prices
+	last PegAssets
+}
+
+// HealthTracker records how every data source behaves, and demotes the ones
+// that cross the thresholds.
+type HealthTracker struct {
+	Thresholds HealthThresholds
+
+	staleDuration time.Duration
+	sources       map[string]*SourceHealth
+	sync.Mutex
+}
+
+func NewHealthTracker(thresholds HealthThresholds, staleDuration time.Duration) *HealthTracker {
+	h := new(HealthTracker)
+	h.Thresholds = thresholds
+	h.staleDuration = staleDuration
+	h.sources = make(map[string]*SourceHealth)
+
+	return h
+}
+
+// Wrap returns the data source with every fetch recorded by the tracker
+func (h *HealthTracker) Wrap(s IDataSource) IDataSource {
+	return &HealthCheckedDataSource{IDataSource: s, health: h}
+}
+
+func (h *HealthTracker) source(name string) *SourceHealth {
+	s, ok := h.sources[name]
+	if !ok {
+		s = &SourceHealth{Name: name}
+		h.sources[name] = s
+	}
+	return s
+}
+
+func smooth(avg, sample float64, samples int64) float64 {
+	if samples <= 1 {
+		return sample
+	}
+	return avg*(1-healthSmoothing) + sample*healthSmoothing
+}
+
+// RecordFetch records a single call to the data source
+func (h *HealthTracker) RecordFetch(name string, latency time.Duration, prices PegAssets, err error) {
+	h.Lock()
+	defer h.Unlock()
+	s := h.source(name)
+	now := time.Now()
+
+	s.Requests++
+	s.Latency = time.Duration(smooth(float64(s.Latency), float64(latency), s.Requests))
+	failed := 0.0
+	if err != nil {
+		failed = 1
+		s.Errors++
+		s.LastError = err.Error()
+	}
+	s.ErrorRate = smooth(s.ErrorRate, failed, s.Requests)
+
+	if err == nil && len(prices) > 0 {
+		stale := 0
+		for _, p := range prices {
+			if now.Sub(p.When) > h.staleDuration {
+				stale++
+			}
+		}
+		s.StaleRate = smooth(s.StaleRate, float64(stale)/float64(len(prices)), s.Requests-s.Errors)
+		s.last = prices
+	}
+
+	h.evaluate(s, now)
+}
+
+// RecordGradedPrices compares the last quotes of every source to the winning
+// prices of a graded block.
+func (h *HealthTracker) RecordGradedPrices(winning map[string]float64) {
+	h.Lock()
+	defer h.Unlock()
+	now := time.Now()
+
+	for _, s := range h.sources {
+		total, count := 0.0, 0
+		for asset, p := range s.last {
+			w, ok := winning[asset]
+			if !ok || w == 0 {
+				continue
+			}
+			total += math.Abs(p.Value-w) / w * 100
+			count++
+		}
+		if count == 0 {
+			continue
+		}
+		s.Graded++
+		s.Deviation = smooth(s.Deviation, total/float64(count), s.Graded)
+		h.evaluate(s, now)
+	}
+}
+
+// evaluate demotes the source if it crossed any threshold
+func (h *HealthTracker) evaluate(s *SourceHealth, now time.Time) {
+	var reason string
+	t := h.Thresholds
+	switch {
+	case s.Requests >= healthMinSamples && t.MaxErrorRate > 0 && s.ErrorRate > t.MaxErrorRate:
+		reason = fmt.Sprintf("error rate %.2f over %.2f", s.ErrorRate, t.MaxErrorRate)
+	case s.Requests >= healthMinSamples && t.MaxLatency > 0 && s.Latency > t.MaxLatency:
+		reason = fmt.Sprintf("latency %s over %s", s.Latency, t.MaxLatency)
+	case s.Requests >= healthMinSamples && t.MaxStaleRate > 0 && s.StaleRate > t.MaxStaleRate:
+		reason = fmt.Sprintf("stale rate %.2f over %.2f", s.StaleRate, t.MaxStaleRate)
+	case s.Graded > 0 && t.MaxDeviation > 0 && s.Deviation > t.MaxDeviation:
+		reason = fmt.Sprintf("deviation %.2f%% over %.2f%%", s.Deviation, t.MaxDeviation)
+	default:
+		return
+	}
+
+	if now.After(s.DemotedUntil) {
+		dLog.WithField("source", s.Name).Warnf("demoting data source for %s: %s", t.DemoteFor, reason)
+	}
+	s.DemotedUntil = now.Add(t.DemoteFor)
+	s.Reason = reason
+}
+
+// IsDemoted returns true if the source is currently demoted
+func (h *HealthTracker) IsDemoted(name string) bool {
+	h.Lock()
+	defer h.Unlock()
+	s, ok := h.sources[name]
+	return ok && time.Now().Before(s.DemotedUntil)
+}
+
+// Split divides the sources into the healthy and the demoted ones, keeping
+// their priority order.
+func (h *HealthTracker) Split(names []string) (healthy, demoted []string) {
+	for _, name := range names {
+		if h.IsDemoted(name) {
+			demoted = append(demoted, name)
+		} else {
+			healthy = append(healthy, name)
+		}
+	}
+	return
+}
+
+// Report returns the health of every source that has been called, sorted by name
+func (h *HealthTracker) Report() []SourceHealth {
+	h.Lock()
+	defer h.Unlock()
+	now := time.Now()
+
+	report := make([]SourceHealth, 0, len(h.sources))
+	for _, s := range h.sources {
+		c := *s
+		c.last = nil
+		c.Demoted = now.Before(c.DemotedUntil)
+		if !c.Demoted {
+			c.DemotedUntil = time.Time{}
+			c.Reason = ""
+		}
+		report = append(report, c)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Name < report[j].Name })
+	return report
+}
+
+// HealthCheckedDataSource records the latency, errors and quotes of every fetch
+type HealthCheckedDataSource struct {
+	IDataSource
+	health *HealthTracker
+}
+
+func (d *HealthCheckedDataSource) FetchPegPrices() (peg PegAssets, err error) {
+	start := time.Now()
+	peg, err = d.IDataSource.FetchPegPrices()
+	d.health.RecordFetch(d.Name(), time.Since(start), peg, err)
+	return
+}
+
+func (d *HealthCheckedDataSource) FetchPegPrice(peg string) (i PegItem, err error) {
+	return FetchPegPrice(peg, d.FetchPegPrices)
+}
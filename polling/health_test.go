@@ -0,0 +1,72 @@
+package polling_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/pegnet/pegnet/polling"
+)
+
+func TestHealthTracker(t *testing.T) {
+	h := NewHealthTracker(HealthThresholds{
+		MaxLatency:   time.Second,
+		MaxErrorRate: 0.5,
+		MaxStaleRate: 0.5,
+		MaxDeviation: 5,
+		DemoteFor:    time.Hour,
+	}, 10*time.Minute)
+
+	now := time.Now()
+	quote := func(v float64) PegAssets {
+		return PegAssets{"XBT": PegItem{Value: v, When: now, WhenUnix: now.Unix()}}
+	}
+
+	// A few failures are tolerated until there are enough samples
+	for i := 0; i < 4; i++ {
+		h.RecordFetch("Flaky", time.Millisecond, nil, fmt.Errorf("timeout"))
+		h.RecordFetch("Good", time.Millisecond, quote(100), nil)
+		h.RecordFetch("Drifting", time.Millisecond, quote(120), nil)
+		h.RecordFetch("Slow", 2*time.Second, quote(100), nil)
+	}
+	if h.IsDemoted("Flaky") || h.IsDemoted("Slow") {
+		t.Error("exp no demotion before enough samples")
+	}
+
+	h.RecordFetch("Flaky", time.Millisecond, nil, fmt.Errorf("timeout"))
+	h.RecordFetch("Slow", 2*time.Second, quote(100), nil)
+	if !h.IsDemoted("Flaky") {
+		t.Error("exp the failing source to be demoted")
+	}
+	if !h.IsDemoted("Slow") {
+		t.Error("exp the slow source to be demoted")
+	}
+
+	// 120 is 20% off the winning price
+	h.RecordGradedPrices(map[string]float64{"XBT": 100})
+	if !h.IsDemoted("Drifting") {
+		t.Error("exp the deviating source to be demoted")
+	}
+	if h.IsDemoted("Good") {
+		t.Error("exp the good source to not be demoted")
+	}
+
+	healthy, demoted := h.Split([]string{"Drifting", "Good", "Flaky", "Unknown"})
+	if len(healthy) != 2 || healthy[0] != "Good" || healthy[1] != "Unknown" {
+		t.Errorf("unexpected healthy sources %v", healthy)
+	}
+	if len(demoted) != 2 || demoted[0] != "Drifting" || demoted[1] != "Flaky" {
+		t.Errorf("unexpected demoted sources %v", demoted)
+	}
+
+	report := h.Report()
+	if len(report) != 4 || report[0].Name != "Drifting" {
+		t.Fatalf("unexpected report %v", report)
+	}
+	if !report[0].Demoted || report[0].Reason == "" || report[0].Deviation != 20 {
+		t.Errorf("unexpected report for the deviating source %+v", report[0])
+	}
+	if report[1].Errors != 5 || report[1].ErrorRate != 1 {
+		t.Errorf("unexpected report for the failing source %+v", report[1])
+	}
+}
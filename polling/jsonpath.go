@@ -0,0 +1,92 @@
+package polling
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONPath evaluates a subset of JSONPath against json decoded into interface{}.
+// The supported syntax is:
+//	$			The root, optional
+//	.key		An object member
+//	['key']		An object member, for keys with dots or spaces
+//	[n]			An array element
+func JSONPath(data interface{}, path string) (interface{}, error) {
+	rest := strings.TrimPrefix(path, "$")
+	if rest == path && rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest // Without the root, the path starts with a key
+	}
+	cur := data
+	for rest != "" {
+		var key string
+		index := -1
+		switch {
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated key in path %s", path)
+			}
+			key, rest = rest[2:end], rest[end+2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated index in path %s", path)
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("bad index in path %s", path)
+			}
+			index, rest = i, rest[end+1:]
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			key, rest = rest[:end], rest[end:]
+			if key == "" {
+				return nil, fmt.Errorf("empty key in path %s", path)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected '%s' in path %s", rest, path)
+		}
+
+		if index >= 0 {
+			arr, ok := cur.([]interface{})
+			if !ok || index >= len(arr) {
+				return nil, fmt.Errorf("index %d not found for path %s", index, path)
+			}
+			cur = arr[index]
+			continue
+		}
+
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("key %s not found for path %s", key, path)
+		}
+		if cur, ok = obj[key]; !ok {
+			return nil, fmt.Errorf("key %s not found for path %s", key, path)
+		}
+	}
+	return cur, nil
+}
+
+// JSONPathFloat evaluates the path and converts the result to a float. Numbers
+// encoded as strings are accepted, as many apis return prices that way.
+func JSONPathFloat(data interface{}, path string) (float64, error) {
+	v, err := JSONPath(data, path)
+	if err != nil {
+		return 0, err
+	}
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case json.Number:
+		return n.Float64()
+	case string:
+		return strconv.ParseFloat(n, 64)
+	}
+	return 0, fmt.Errorf("value at %s is not a number", path)
+}
@@ -0,0 +1,216 @@
+package polling
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pegnet/pegnet/common"
+	config "github.com/zpatrick/go-config"
+)
+
+// StreamDataSource keeps a long lived connection to a line-delimited json price feed
+// over tcp, and serves the latest tick of each asset. Unlike the rest based sources,
+// the prices are only as old as the last tick.
+// Each line is a single tick:
+//	{"asset":"XBT","price":8123.45,"timestamp":1571234567}
+type StreamDataSource struct {
+	config *config.Config
+
+	address        string
+	reconnectDelay time.Duration
+	firstTickWait  time.Duration
+
+	// ticks is the latest tick of every asset
+	ticks     PegAssets
+	ticksLock sync.Mutex
+	// firstTick is closed when the first tick arrives
+	firstTick chan struct{}
+
+	conn     net.Conn
+	connLock sync.Mutex
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// StreamTick is a single line of the price feed. The timestamp is in unix seconds,
+// and if it is omitted, the time the tick was received is used.
+type StreamTick struct {
+	Asset     string  `json:"asset"`
+	Price     float64 `json:"price"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// NewStreamDataSource connects to the feed in the background. The connection is
+// reestablished whenever it drops until the data source is closed.
+func NewStreamDataSource(config *config.Config) (*StreamDataSource, error) {
+	var err error
+	s := new(StreamDataSource)
+	s.config = config
+
+	s.address, err = config.String(common.ConfigStreamAddress)
+	if err != nil {
+		return nil, err
+	}
+	if s.address == "" {
+		return nil, fmt.Errorf("%s must be set to use the stream data source", common.ConfigStreamAddress)
+	}
+
+	s.reconnectDelay, err = configDuration(config, common.ConfigStreamReconnectDelay)
+	if err != nil {
+		return nil, err
+	}
+	s.firstTickWait, err = configDuration(config, common.ConfigStreamFirstTickWait)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ticks = make(PegAssets)
+	s.firstTick = make(chan struct{})
+	s.stop = make(chan struct{})
+
+	go s.run()
+	return s, nil
+}
+
+func configDuration(config *config.Config, setting string) (time.Duration, error) {
+	str, err := config.String(setting)
+	if err != nil {
+		return 0, err
+	}
+	return time.ParseDuration(str)
+}
+
+func (d *StreamDataSource) Name() string {
+	return "Stream"
+}
+
+func (d *StreamDataSource) Url() string {
+	return "tcp://" + d.address
+}
+
+func (d *StreamDataSource) SupportedPegs() []string {
+	return common.AllAssets
+}
+
+// FetchPegPrices returns the latest tick of every asset. If no tick has arrived yet,
+// it waits up to the configured first tick wait for one.
+func (d *StreamDataSource) FetchPegPrices() (peg PegAssets, err error) {
+	select {
+	case <-d.firstTick:
+	case <-time.After(d.firstTickWait):
+		return nil, fmt.Errorf("no prices received from the stream at %s", d.address)
+	}
+
+	d.ticksLock.Lock()
+	defer d.ticksLock.Unlock()
+	peg = make(PegAssets)
+	for asset, item := range d.ticks {
+		peg[asset] = item
+	}
+	return
+}
+
+func (d *StreamDataSource) FetchPegPrice(peg string) (i PegItem, err error) {
+	return FetchPegPrice(peg, d.FetchPegPrices)
+}
+
+// Close stops the connection to the feed. The last ticks are still served.
+func (d *StreamDataSource) Close() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+		d.connLock.Lock()
+		if d.conn != nil {
+			_ = d.conn.Close()
+		}
+		d.connLock.Unlock()
+	})
+}
+
+func (d *StreamDataSource) run() {
+	sLog := dLog.WithField("source", d.Name())
+	for {
+		err := d.listen()
+		select {
+		case <-d.stop:
+			return
+		default:
+		}
+
+		sLog.WithError(err).Warnf("price stream disconnected, reconnecting in %s", d.reconnectDelay)
+		select {
+		case <-d.stop:
+			return
+		case <-time.After(d.reconnectDelay):
+		}
+	}
+}
+
+// listen reads ticks until the connection drops
+func (d *StreamDataSource) listen() error {
+	conn, err := net.Dial("tcp", d.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	d.connLock.Lock()
+	select {
+	case <-d.stop: // Closed while we were dialing
+		d.connLock.Unlock()
+		return nil
+	default:
+	}
+	d.conn = conn
+	d.connLock.Unlock()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if err := d.handleLine(scanner.Bytes()); err != nil {
+			dLog.WithField("source", d.Name()).WithError(err).Debugf("bad tick")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("connection closed")
+}
+
+func (d *StreamDataSource) handleLine(line []byte) error {
+	var tick StreamTick
+	if err := json.Unmarshal(line, &tick); err != nil {
+		return err
+	}
+
+	asset := strings.ToUpper(tick.Asset)
+	if !common.AssetListContains(d.SupportedPegs(), asset) {
+		return fmt.Errorf("unsupported asset %s", tick.Asset)
+	}
+	if tick.Price <= 0 {
+		return fmt.Errorf("price of %s must be positive, found %f", asset, tick.Price)
+	}
+
+	when := time.Now()
+	if tick.Timestamp != 0 {
+		when = time.Unix(tick.Timestamp, 0)
+	}
+
+	d.ticksLock.Lock()
+	defer d.ticksLock.Unlock()
+	// Ticks can arrive out of order, only keep the newest
+	if prev, ok := d.ticks[asset]; ok && prev.When.After(when) {
+		return nil
+	}
+	d.ticks[asset] = PegItem{Value: tick.Price, WhenUnix: when.Unix(), When: when}
+
+	select {
+	case <-d.firstTick:
+	default:
+		close(d.firstTick)
+	}
+	return nil
+}
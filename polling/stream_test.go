@@ -0,0 +1,112 @@
+package polling_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/polling"
+	"github.com/zpatrick/go-config"
+)
+
+func newStreamTestConfig(address string) *config.Config {
+	return config.NewConfig([]config.Provider{
+		common.NewDefaultConfigOptionsProvider(),
+		common.NewUnitTestConfigProvider(),
+		config.NewStatic(map[string]string{
+			common.ConfigStreamAddress:        address,
+			common.ConfigStreamReconnectDelay: "50ms",
+			common.ConfigStreamFirstTickWait:  "200ms",
+		}),
+	})
+}
+
+// waitForPrice polls the data source until the asset has the expected price
+func waitForPrice(t *testing.T, s polling.IDataSource, asset string, exp float64) polling.PegItem {
+	var item polling.PegItem
+	var err error
+	for i := 0; i < 200; i++ {
+		item, err = s.FetchPegPrice(asset)
+		if err == nil && item.Value == exp {
+			return item
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("exp %s to be %f, found %f (err %v)", asset, exp, item.Value, err)
+	return item
+}
+
+func TestStreamDataSource(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conns := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	s, err := polling.NewDataSource("Stream", newStreamTestConfig(l.Addr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := s.(*polling.StreamDataSource)
+	defer stream.Close()
+
+	conn := <-conns
+	now := time.Now().Unix()
+	fmt.Fprintf(conn, `{"asset":"XBT","price":8000.5,"timestamp":%d}`+"\n", now)
+	fmt.Fprintf(conn, "not json\n")
+	fmt.Fprintf(conn, `{"asset":"NOTANASSET","price":1}`+"\n")
+	fmt.Fprintf(conn, `{"asset":"eth","price":180.25}`+"\n")
+	// Older than the tick we have, so it is ignored
+	fmt.Fprintf(conn, `{"asset":"XBT","price":7000,"timestamp":%d}`+"\n", now-60)
+
+	waitForPrice(t, s, "ETH", 180.25)
+	if item := waitForPrice(t, s, "XBT", 8000.5); item.WhenUnix != now {
+		t.Errorf("exp the tick timestamp %d, found %d", now, item.WhenUnix)
+	}
+
+	prices, err := s.FetchPegPrices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 2 {
+		t.Errorf("exp 2 assets, found %d", len(prices))
+	}
+
+	// The source reconnects when the feed drops, and keeps serving the last ticks meanwhile
+	_ = conn.Close()
+	conn = <-conns
+	waitForPrice(t, s, "XBT", 8000.5)
+	fmt.Fprintf(conn, `{"asset":"XBT","price":8100,"timestamp":%d}`+"\n", now+1)
+	waitForPrice(t, s, "XBT", 8100)
+	_ = conn.Close()
+}
+
+func TestStreamDataSource_NoTicks(t *testing.T) {
+	c := newStreamTestConfig("127.0.0.1:1")
+	if _, err := polling.NewStreamDataSource(newStreamTestConfig("")); err == nil {
+		t.Error("exp an error without an address")
+	}
+
+	s, err := polling.NewStreamDataSource(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.FetchPegPrices(); err == nil {
+		t.Error("exp an error when no ticks were received")
+	}
+}
@@ -230,7 +230,9 @@ func (spr *StakingPriceRecord) GetSPRecord(c *config.Config) error {
 //		Payout Address (string)
 //		Height (int32)
 //		Assets ([]uint64)
-func (spr *StakingPriceRecord) CreateSPREntry() (*factom.Entry, error) {
+//
+// The signer is the wallet holding the key of the coinbase address.
+func (spr *StakingPriceRecord) CreateSPREntry(signer common.FactomClient) (*factom.Entry, error) {
 	e := new(factom.Entry)
 	e.ChainID = hex.EncodeToString(base58.Decode(spr.SPRChainID))
 
@@ -244,9 +246,9 @@ func (spr *StakingPriceRecord) CreateSPREntry() (*factom.Entry, error) {
 		return nil, err
 	}
 
-	signature, errS := factom.SignData(spr.CoinbaseAddress, e.Content)
+	signature, errS := signer.SignData(spr.CoinbaseAddress, e.Content)
 	if errS != nil {
-		return nil, err
+		return nil, errS
 	}
 	pubKey := signature.PubKey
 	sign := signature.Signature
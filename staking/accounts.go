@@ -0,0 +1,115 @@
+package staking
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pegnet/pegnet/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// AddressAccount is what a coinbase address has staked, and what it spent doing it
+type AddressAccount struct {
+	CoinbaseAddress string `json:"coinbase"`
+	Written         int    `json:"written"` // SPRs written to the chain
+	Failed          int    `json:"failed"`  // SPRs that failed the self-check, or failed to be written
+	ECSpent         int64  `json:"ecspent"`
+	LastHeight      int32  `json:"lastheight"` // The height of the last spr written
+}
+
+// StakerAccounts keeps an account for every coinbase address the staker writes sprs for
+type StakerAccounts struct {
+	// DB is where the accounts are persisted, if set. Every change is written,
+	// and Load restores them after a restart.
+	DB database.IDatabase
+
+	accounts map[string]*AddressAccount
+	sync.Mutex
+}
+
+func NewStakerAccounts() *StakerAccounts {
+	a := new(StakerAccounts)
+	a.accounts = make(map[string]*AddressAccount)
+	return a
+}
+
+func (a *StakerAccounts) account(coinbase string) *AddressAccount {
+	acc, ok := a.accounts[coinbase]
+	if !ok {
+		acc = &AddressAccount{CoinbaseAddress: coinbase}
+		a.accounts[coinbase] = acc
+	}
+	return acc
+}
+
+// Load restores the persisted accounts
+func (a *StakerAccounts) Load() error {
+	a.Lock()
+	defer a.Unlock()
+	iter := a.DB.Iterate(database.BUCKET_STAKER_ACCOUNTS)
+	defer iter.Release()
+	for iter.Next() {
+		acc := new(AddressAccount)
+		if err := database.Decode(acc, iter.Value()); err != nil {
+			return err
+		}
+		a.accounts[acc.CoinbaseAddress] = acc
+	}
+	return iter.Error()
+}
+
+// save persists the account. The accounts are only bookkeeping, so a failed
+// write is logged rather than failing the spr.
+func (a *StakerAccounts) save(acc *AddressAccount) {
+	if a.DB == nil {
+		return
+	}
+	data, err := database.Encode(acc)
+	if err == nil {
+		err = a.DB.Put(database.BUCKET_STAKER_ACCOUNTS, []byte(acc.CoinbaseAddress), data)
+	}
+	if err != nil {
+		log.WithError(err).WithField("coinbase", acc.CoinbaseAddress).Error("failed to save the staker account")
+	}
+}
+
+// Written records an spr of the coinbase address was written, and its cost
+func (a *StakerAccounts) Written(coinbase string, dbht int32, cost int64) {
+	a.Lock()
+	defer a.Unlock()
+	acc := a.account(coinbase)
+	acc.Written++
+	acc.ECSpent += cost
+	acc.LastHeight = dbht
+	a.save(acc)
+}
+
+// Failed records an spr of the coinbase address was not written
+func (a *StakerAccounts) Failed(coinbase string) {
+	a.Lock()
+	defer a.Unlock()
+	acc := a.account(coinbase)
+	acc.Failed++
+	a.save(acc)
+}
+
+// Get returns a copy of the account of the coinbase address
+func (a *StakerAccounts) Get(coinbase string) AddressAccount {
+	a.Lock()
+	defer a.Unlock()
+	return *a.account(coinbase)
+}
+
+// Accounts returns a copy of all the accounts, sorted by coinbase address
+func (a *StakerAccounts) Accounts() []AddressAccount {
+	a.Lock()
+	defer a.Unlock()
+	accounts := make([]AddressAccount, 0, len(a.accounts))
+	for _, acc := range a.accounts {
+		accounts = append(accounts, *acc)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].CoinbaseAddress < accounts[j].CoinbaseAddress
+	})
+	return accounts
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/pegnet/pegnet/budget"
 	"github.com/pegnet/pegnet/common"
 	"github.com/pegnet/pegnet/spr"
 	log "github.com/sirupsen/logrus"
@@ -19,14 +20,19 @@ type StakingCoordinator struct {
 	// Factom blockchain related alerts
 	FactomMonitor common.IMonitor
 
-	// Staker generates the spr hashes
-	Staker *ControlledStaker
+	// Stakers generate the spr hashes, one for each coinbase address
+	Stakers []*ControlledStaker
 
 	// FactomEntryWriter writes the sprs to chain
 	FactomEntryWriter IEntryWriter
+	// Budget buys the entry credits the writer spends
+	Budget *budget.ECBudget
 
 	// Used when going over the network
 	SPRMaker ISPRMaker
+
+	// Accounts has what each coinbase address has written and spent
+	Accounts *StakerAccounts
 }
 
 func NewStakingCoordinatorFromConfig(config *config.Config, monitor common.IMonitor) *StakingCoordinator {
@@ -34,21 +40,53 @@ func NewStakingCoordinatorFromConfig(config *config.Config, monitor common.IMoni
 	c.config = config
 	c.FactomMonitor = monitor
 	c.SPRMaker = NewSPRMaker()
-	c.FactomEntryWriter = NewEntryWriter(config)
+	w := NewEntryWriter(config)
+	c.Accounts = w.Accounts
+	c.FactomEntryWriter = w
 
 	err := c.FactomEntryWriter.PopulateECAddress()
 	if err != nil {
 		panic(err)
 	}
 
+	c.Budget, err = budget.NewECBudgetFromConfig(config, "Staker.ECAddress", common.DefaultFactomClient)
+	if err != nil {
+		panic(err)
+	}
+
 	return c
 }
 
+// ecBalance is the balance of the EC address, once entry credits are bought if the
+// budget runs low
+func (c *StakingCoordinator) ecBalance(height int64) (int64, error) {
+	if c.Budget != nil {
+		return c.Budget.Check(height)
+	}
+	return c.FactomEntryWriter.ECBalance()
+}
+
+// InitStaker makes a staker for every coinbase address
 func (c *StakingCoordinator) InitStaker() error {
-	c.Staker = c.NewStaker(1)
+	CheckStakingAddresses(c.config, common.DefaultFactomClient)
+	addresses, err := StakingAddresses(c.config)
+	if err != nil {
+		return err
+	}
+	c.Stakers = make([]*ControlledStaker, 0, len(addresses))
+	for i, addr := range addresses {
+		c.Stakers = append(c.Stakers, c.NewStaker(i+1, addr))
+	}
 	return nil
 }
 
+// SendCommand sends the command to all the stakers
+func (c *StakingCoordinator) SendCommand(command *StakerCommand) {
+	for _, s := range c.Stakers {
+		s.SendCommand(command)
+	}
+}
+
 func (c *StakingCoordinator) LaunchStaker(ctx context.Context) {
 	stakeLog := log.WithFields(log.Fields{"id": "coordinator"})
 
@@ -58,10 +96,12 @@ func (c *StakingCoordinator) LaunchStaker(ctx context.Context) {
 	var sprHash []byte
 
 	// Launch
-	go c.Staker.Staker.Stake(ctx)
+	for _, s := range c.Stakers {
+		go s.Staker.Stake(ctx)
+	}
 
 	first := false
-	stakeLog.Info("Staker launched. Waiting for minute 1 to start staking...")
+	stakeLog.WithField("stakers", len(c.Stakers)).Info("Staker launched. Waiting for minute 1 to start staking...")
 	staking := false
 StakingLoop:
 	for {
@@ -86,7 +126,7 @@ StakingLoop:
 		switch fds.Minute {
 		case 1:
 			// First check if we have the funds to stake
-			bal, err := c.FactomEntryWriter.ECBalance()
+			bal, err := c.ecBalance(int64(fds.Dbht))
 			if err != nil {
 				hLog.WithError(err).WithField("action", "balance-query").Error("failed to stake this block")
 				continue StakingLoop // SPR cancelled
@@ -124,7 +164,7 @@ StakingLoop:
 					NewSPRHash(sprHash).             // New SPR hash to stake
 					ResumeStaking().                 // Start staking
 					Build()
-				c.Staker.SendCommand(command)
+				c.SendCommand(command)
 
 				hLog.Debug("Begin staking new SPR")
 			}
@@ -138,7 +178,7 @@ StakingLoop:
 					Build()
 
 				// Need to send to staker
-				c.Staker.SendCommand(command)
+				c.SendCommand(command)
 
 				// Write to blockchain (this is non blocking)
 				c.FactomEntryWriter.CollectAndWrite(false)
@@ -154,10 +194,10 @@ type ControlledStaker struct {
 	CommandChannel chan *StakerCommand
 }
 
-func (c *StakingCoordinator) NewStaker(id int) *ControlledStaker {
+func (c *StakingCoordinator) NewStaker(id int, coinbase string) *ControlledStaker {
 	m := new(ControlledStaker)
 	channel := make(chan *StakerCommand, 10)
-	m.Staker = NewPegnetStakerFromConfig(c.config, id, channel)
+	m.Staker = NewPegnetStakerFromConfig(c.config, id, coinbase, channel)
 	m.CommandChannel = channel
 	return m
 }
@@ -3,7 +3,6 @@ package staking
 import (
 	"errors"
 	"fmt"
-	"strings"
 	"sync"
 
 	"github.com/pegnet/pegnet/spr"
@@ -12,6 +11,7 @@ import (
 	"github.com/FactomProject/factom"
 	"github.com/cenkalti/backoff"
 	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/modules/graderStake"
 	"github.com/zpatrick/go-config"
 )
 
@@ -30,9 +30,13 @@ type EntryWriter struct {
 
 	ec     *factom.ECAddress
 	config *config.Config
+	Factom common.FactomClient
 
 	Next *EntryWriter
 
+	// Accounts is shared by the writers of all blocks
+	Accounts *StakerAccounts
+
 	EntryWritingFunction func() error
 
 	sync.Mutex
@@ -42,12 +46,14 @@ type EntryWriter struct {
 func NewEntryWriter(config *config.Config) *EntryWriter {
 	w := new(EntryWriter)
 	w.config = config
+	w.Factom = common.DefaultFactomClient
+	w.Accounts = NewStakerAccounts()
 	w.EntryWritingFunction = w.writeStakingRecord
 	return w
 }
 
 func (w *EntryWriter) ECBalance() (int64, error) {
-	return factom.GetECBalance(w.ec.String())
+	return w.Factom.GetECBalance(w.ec.String())
 }
 
 // PopulateECAddress only needs to be called once
@@ -56,7 +62,7 @@ func (w *EntryWriter) PopulateECAddress() error {
 	if ecadrStr, err := w.config.String("Staker.ECAddress"); err != nil {
 		return err
 	} else {
-		ecAdr, err := factom.FetchECAddress(ecadrStr)
+		ecAdr, err := w.Factom.FetchECAddress(ecadrStr)
 		if err != nil {
 			return err
 		}
@@ -72,6 +78,8 @@ func (w *EntryWriter) NextBlockWriter() IEntryWriter {
 	if w.Next == nil {
 		w.Next = NewEntryWriter(w.config)
 		w.Next.ec = w.ec
+		w.Next.Factom = w.Factom
+		w.Next.Accounts = w.Accounts
 	}
 	return w.Next
 }
@@ -115,44 +123,103 @@ func (w *EntryWriter) collectAndWrite() {
 	}).Info("SPR Block Staked")
 }
 
-// writeStakingRecord writes an spr to the blockchain
+// writeStakingRecord writes an spr for every coinbase address to the blockchain.
+// Each address has its own spr, signed with its own key, so one failing does not
+// stop the others from being written.
 func (w *EntryWriter) writeStakingRecord() error {
 	if w.sprTemplate == nil {
 		return fmt.Errorf("no spr template")
 	}
 
-	fctAddresses, err := w.config.String("Staker.CoinbaseAddress")
+	fctAddrs, err := StakingAddresses(w.config)
 	if err != nil { // Not likely to happen since we
 		return errors.New("No fctAddress found") // check for bad addresses earlier
 	}
-	fctAddrs := strings.Split(fctAddresses, ",")
+	failed := 0
 	for _, addr := range fctAddrs {
-		operation := func() error {
-			var err1, err2 error
-
-			network, _ := common.LoadConfigNetwork(w.config)
-			w.sprTemplate.CoinbasePEGAddress, err = common.ConvertFCTtoPegNetAsset(network, "PEG", addr)
-			if err != nil {
-				log.Errorf("invalid fct address in config file: %v", err)
-			}
-
-			w.sprTemplate.CoinbaseAddress = addr
-
-			entry, err := w.sprTemplate.CreateSPREntry()
-			if err != nil {
-				return err
-			}
-			_, err1 = factom.CommitEntry(entry, w.ec)
-			_, err2 = factom.RevealEntry(entry)
-			if err1 == nil && err2 == nil {
-				return nil
-			}
-			return errors.New("failed to write SPR Entry")
+		addrLog := log.WithFields(log.Fields{"height": w.sprTemplate.Dbht, "coinbase": addr})
+		cost, err := w.writeAddressRecord(addr)
+		if err != nil {
+			failed++
+			w.Accounts.Failed(addr)
+			addrLog.WithError(err).Error("Failed to write the SPR of the coinbase address")
+			continue
 		}
-		err = backoff.Retry(operation, common.PegExponentialBackOff())
+		w.Accounts.Written(addr, w.sprTemplate.Dbht, cost)
+		account := w.Accounts.Get(addr)
+		addrLog.WithFields(log.Fields{"ec": cost, "ec_spent": account.ECSpent, "written": account.Written}).Info("SPR written")
+	}
+	if failed == len(fctAddrs) {
+		return fmt.Errorf("failed to write the spr of all %d coinbase addresses", failed)
+	}
+	return nil
+}
+
+// writeAddressRecord writes the spr of the coinbase address, and returns its cost in ECs
+func (w *EntryWriter) writeAddressRecord(addr string) (int64, error) {
+	var cost int8
+	operation := func() error {
+		var err1, err2 error
+
+		entry, err := w.createEntry(addr)
 		if err != nil {
 			return err
 		}
+		// Don't pay for an entry the grader will throw out
+		if err := w.ValidateSPREntry(entry); err != nil {
+			return backoff.Permanent(err)
+		}
+		cost, err = factom.EntryCost(entry)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		_, err1 = w.Factom.CommitEntry(entry, w.ec)
+		_, err2 = w.Factom.RevealEntry(entry)
+		if err1 == nil && err2 == nil {
+			return nil
+		}
+		return errors.New("failed to write SPR Entry")
+	}
+	err := backoff.Retry(operation, common.PegExponentialBackOff())
+	return int64(cost), err
+}
+
+// createEntry makes the spr entry of the coinbase address from the template, signed
+// by the key of the address
+func (w *EntryWriter) createEntry(addr string) (*factom.Entry, error) {
+	record := w.sprTemplate.CloneEntryData()
+
+	network, _ := common.LoadConfigNetwork(w.config)
+	var err error
+	record.CoinbasePEGAddress, err = common.ConvertFCTtoPegNetAsset(network, "PEG", addr)
+	if err != nil {
+		log.Errorf("invalid fct address in config file: %v", err)
+	}
+	record.CoinbaseAddress = addr
+
+	return record.CreateSPREntry(w.Factom)
+}
+
+// ValidateSPREntry runs the entry through the validator of the spr version at its
+// height, the same one the spr chain is graded with
+func (w *EntryWriter) ValidateSPREntry(entry *factom.Entry) error {
+	network, err := common.LoadConfigStakerNetwork(w.config)
+	if err != nil {
+		return err
+	}
+	return ValidateSPREntry(network, int64(w.sprTemplate.Dbht), entry)
+}
+
+// ValidateSPREntry returns why the graders would reject the spr entry at the height,
+// or nil if it is valid
+func ValidateSPREntry(network string, height int64, entry *factom.Entry) error {
+	version := common.SPRVersion(network, height)
+	grader, err := graderStake.NewGrader(version, int32(height))
+	if err != nil {
+		return err
+	}
+	if err := grader.AddSPR(entry.Hash(), entry.ExtIDs, entry.Content); err != nil {
+		return fmt.Errorf("spr entry %x fails the version %d rules: %s", entry.Hash(), version, err.Error())
 	}
 	return nil
 }
@@ -191,6 +258,8 @@ func (w *EntryForwarder) NextBlockWriter() IEntryWriter {
 	defer w.Unlock()
 	if w.Next == nil {
 		w.Next = NewEntryForwarder(w.config, w.entryChannel)
+		w.Next.Factom = w.Factom
+		w.Next.Accounts = w.Accounts
 	}
 	return w.Next
 }
@@ -200,11 +269,21 @@ func (w *EntryForwarder) forwardStakingRecord() error {
 		return fmt.Errorf("no spr template")
 	}
 
-	entry, err := w.sprTemplate.CreateSPREntry()
+	fctAddrs, err := StakingAddresses(w.config)
 	if err != nil {
 		return err
 	}
-
-	w.entryChannel <- entry
+	for _, addr := range fctAddrs {
+		entry, err := w.createEntry(addr)
+		if err == nil {
+			err = w.ValidateSPREntry(entry)
+		}
+		if err != nil {
+			w.Accounts.Failed(addr)
+			log.WithFields(log.Fields{"height": w.sprTemplate.Dbht, "coinbase": addr}).WithError(err).Error("Failed to forward the SPR of the coinbase address")
+			continue
+		}
+		w.entryChannel <- entry
+	}
 	return nil
 }
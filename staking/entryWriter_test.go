@@ -0,0 +1,103 @@
+package staking_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/FactomProject/factom"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+	. "github.com/pegnet/pegnet/staking"
+	"github.com/zpatrick/go-config"
+)
+
+func TestEntryWriter_MultipleAddresses(t *testing.T) {
+	chain := common.NewFakeFactomClient(100)
+	ec, _ := factom.GetECAddress("Es2XT3jSxi1xqrDvS5JERM3W3jh1awRHuyoahn3hbQLyfEi1jvbq")
+	chain.AddECAddress(ec, 1000)
+
+	settings := map[string]string{
+		"Staker.Protocol":  "PegNet",
+		"Staker.Network":   common.TestNetwork,
+		"Miner.Network":    common.TestNetwork,
+		"Staker.ECAddress": ec.PubString(),
+	}
+	g := NewSPRGrader(config.NewConfig([]config.Provider{config.NewStatic(settings)}), database.NewMapDb())
+	g.SetFactomClient(chain)
+
+	// Every address has its own key in the wallet
+	var addresses []string
+	template := newSPR(t, g, chain, 0)
+	for i := 0; i < 3; i++ {
+		addresses = append(addresses, newSPR(t, g, chain, i).CoinbaseAddress)
+	}
+	settings["Staker.CoinbaseAddress"] = strings.Join(addresses, ", ")
+	c := config.NewConfig([]config.Provider{config.NewStatic(settings)})
+
+	w := NewEntryWriter(c)
+	w.Factom = chain
+	w.Accounts.DB = database.NewMapDb()
+	if err := w.PopulateECAddress(); err != nil {
+		t.Fatal(err)
+	}
+	w.SetSPR(template)
+	w.CollectAndWrite(true)
+
+	chain.AdvanceBlock()
+	if err := g.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	block, err := g.BlockStore.FetchSPRBlock(chain.Height() - 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.TotalNumberRecords != len(addresses) {
+		t.Errorf("exp an spr for each of the %d addresses, found %d", len(addresses), block.TotalNumberRecords)
+	}
+
+	var spent int64
+	for _, addr := range addresses {
+		account := w.Accounts.Get(addr)
+		if account.Written != 1 || account.Failed != 0 || account.ECSpent != 1 || account.LastHeight != template.Dbht {
+			t.Errorf("unexpected account %+v", account)
+		}
+		spent += account.ECSpent
+	}
+	if bal, _ := chain.GetECBalance(ec.String()); bal != 1000-spent {
+		t.Errorf("exp %d ecs to be spent, found %d left", spent, bal)
+	}
+
+	// An spr that fails the self check is not written for any of the addresses
+	next := w.NextBlockWriter().(*EntryWriter)
+	if next.Accounts != w.Accounts {
+		t.Fatalf("exp the accounts to be shared by the writers of all blocks")
+	}
+	bad := newSPR(t, g, chain, 0)
+	bad.Assets[common.AssetsV5[1]] = 0
+	next.SetSPR(bad)
+	next.CollectAndWrite(true)
+
+	if bal, _ := chain.GetECBalance(ec.String()); bal != 1000-spent {
+		t.Errorf("exp no ecs to be spent on invalid sprs, found %d left", bal)
+	}
+	for _, a := range w.Accounts.Accounts() {
+		if a.Written != 1 || a.Failed != 1 {
+			t.Errorf("unexpected account %+v", a)
+		}
+	}
+
+	// The accounts carry over a restart
+	restored := NewStakerAccounts()
+	restored.DB = w.Accounts.DB
+	if err := restored.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.Accounts()) != len(addresses) {
+		t.Errorf("exp %d accounts to be restored, found %d", len(addresses), len(restored.Accounts()))
+	}
+	for _, addr := range addresses {
+		if restored.Get(addr) != w.Accounts.Get(addr) {
+			t.Errorf("exp the account of %s to be restored, found %+v", addr, restored.Get(addr))
+		}
+	}
+}
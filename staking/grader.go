@@ -0,0 +1,425 @@
+package staking
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+	"github.com/pegnet/pegnet/modules/graderStake"
+	"github.com/pegnet/pegnet/opr"
+	log "github.com/sirupsen/logrus"
+	"github.com/zpatrick/go-config"
+)
+
+var sgLog = log.WithField("id", "sprgrader")
+
+// SPRGrader syncs the SPR chain and grades each of its blocks. It is the staking
+// counterpart of the opr.QuickGrader, and lets stakers see how their sprs placed.
+type SPRGrader struct {
+	Network          string
+	Protocol         string
+	SPRChainID       []byte
+	SPRChainIDString string
+
+	SPRChain *opr.EntryBlockSync
+
+	Config *config.Config
+	Factom common.FactomClient
+
+	// sprBlks is all the graded sprblocks that have winners
+	sprBlks    []*SprBlock
+	sprBlkLock sync.Mutex
+
+	BlockStore *SPRBlockStore
+
+	alerts      map[string]chan *SPRs
+	alertsMutex sync.Mutex // Maps are not thread safe
+}
+
+func NewSPRGrader(config *config.Config, db database.IDatabase) *SPRGrader {
+	g := new(SPRGrader)
+	g.Config = config
+
+	network, err := common.LoadConfigStakerNetwork(config)
+	common.CheckAndPanic(err)
+	p, err := config.String("Staker.Protocol")
+	common.CheckAndPanic(err)
+
+	g.Network = network
+	g.Protocol = p
+	g.SPRChainID = common.ComputeChainIDFromStrings([]string{p, network, common.SPRChainTag})
+	g.SPRChainIDString = hex.EncodeToString(g.SPRChainID)
+
+	g.alerts = make(map[string]chan *SPRs)
+
+	g.Factom = common.DefaultFactomClient
+	g.SPRChain = opr.NewEntryBlockSync(g.SPRChainIDString)
+	g.SPRChain.DB = db
+	g.SPRChain.Rewound = g.dropSPRBlocks
+	g.sprBlks = make([]*SprBlock, 0)
+
+	g.BlockStore = NewSPRBlockStore(db)
+	common.CheckAndPanic(g.RestoreSPRChain())
+
+	return g
+}
+
+// SetFactomClient sets the client the grader and its chain syncing use
+func (g *SPRGrader) SetFactomClient(client common.FactomClient) {
+	g.Factom = client
+	g.SPRChain.Factom = client
+}
+
+// RestoreSPRChain loads the spr chain cursor, and the sprblocks graded up to it.
+// If a sprblock is missing, the chain is synced and graded again.
+func (g *SPRGrader) RestoreSPRChain() error {
+	if err := g.SPRChain.LoadCursor(); err != nil {
+		return err
+	}
+
+	blocks := make([]*SprBlock, 0, len(g.SPRChain.Heights))
+	for _, height := range g.SPRChain.Heights {
+		sprblock, err := g.BlockStore.FetchSPRBlock(height)
+		if err == database.ErrNotFound {
+			sgLog.WithField("dbht", height).Warn("sprblock is missing, syncing the spr chain again")
+			g.SPRChain.Reset()
+			blocks = make([]*SprBlock, 0)
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if sprblock.EmptySPRBlock {
+			continue
+		}
+		blocks = append(blocks, sprblock)
+	}
+
+	g.sprBlkLock.Lock()
+	g.sprBlks = blocks
+	g.sprBlkLock.Unlock()
+	return nil
+}
+
+// rollbackSync restores the spr chain to what is on disk, after a block failed before
+// it was written
+func (g *SPRGrader) rollbackSync() {
+	g.SPRChain.Reset() // In case nothing is on disk yet
+	if err := g.RestoreSPRChain(); err != nil {
+		sgLog.WithError(err).Fatal("failed to restore the spr chain")
+	}
+}
+
+// dropSPRBlocks removes the sprblocks of the eblocks the spr chain was rolled back past,
+// so they are graded again instead of reused from disk
+func (g *SPRGrader) dropSPRBlocks(dropped []int64) error {
+	batch := database.NewBatch()
+	for _, height := range dropped {
+		batch.Delete(database.BUCKET_SPR_HEIGHT, database.HeightToBytes(height))
+	}
+	if err := g.BlockStore.DB.Write(batch); err != nil {
+		return err
+	}
+
+	g.sprBlkLock.Lock()
+	kept := make([]*SprBlock, 0, len(g.sprBlks))
+	for _, block := range g.sprBlks {
+		if block.Dbht < dropped[0] {
+			kept = append(kept, block)
+		}
+	}
+	g.sprBlks = kept
+	g.sprBlkLock.Unlock()
+	return nil
+}
+
+func (g *SPRGrader) Close() error {
+	log.Info("closing spr grader db")
+	return g.BlockStore.Close()
+}
+
+// GetBlocks returns the graded sprblocks that have winners. It is not thread safe
+func (g *SPRGrader) GetBlocks() []*SprBlock {
+	return g.sprBlks
+}
+
+// GetAlert registers a new request for alerts.
+// Data will be sent when the grades from the last block are ready
+func (g *SPRGrader) GetAlert(id string) (alert chan *SPRs) {
+	g.alertsMutex.Lock()
+	defer g.alertsMutex.Unlock()
+
+	// If the alert already exists for the id, close it.
+	// We only want 1 alert per id
+	alert, ok := g.alerts[id]
+	if ok {
+		close(alert)
+	}
+
+	alert = make(chan *SPRs, 10)
+	g.alerts[id] = alert
+	return g.alerts[id]
+}
+
+// StopAlert allows cleanup of alerts that are no longer used
+func (g *SPRGrader) StopAlert(id string) {
+	g.alertsMutex.Lock()
+	defer g.alertsMutex.Unlock()
+
+	alert, ok := g.alerts[id]
+	if ok {
+		close(alert)
+	}
+	delete(g.alerts, id)
+}
+
+// SendToListeners sends the graded block to everyone waiting on an alert
+func (g *SPRGrader) SendToListeners(graded *SPRs) {
+	g.alertsMutex.Lock() // Lock map to prevent another thread mucking with our loop
+	for _, a := range g.alerts {
+		select { // Don't block if someone isn't pulling from the channel
+		case a <- graded:
+		default:
+			// This means the channel is full
+		}
+	}
+	g.alertsMutex.Unlock()
+}
+
+func (g *SPRGrader) Run(monitor *common.Monitor, ctx context.Context) {
+	sgLog.Info("Running initial sync")
+	for { // We need to first sync our grader before we start syncing new blocks
+		select { // If we get stuck in the sync loop, this is how can cancel it
+		case <-ctx.Done():
+			return // Grader stopped
+		default:
+		}
+		err := g.Sync()
+		if err != nil { // We will try again in a little bit
+			sgLog.WithError(err).Errorf("failed to sync")
+			time.Sleep(2 * time.Second)
+			continue
+		}
+		break // Initial sync done
+	}
+
+	fdAlert := monitor.NewListener()
+	for {
+		var fds common.MonitorEvent
+		select {
+		case fds = <-fdAlert:
+		case <-ctx.Done():
+			return // Grader stopped
+		}
+		if fds.Minute != 1 {
+			continue
+		}
+
+		var err error
+		tries := 0
+		// Try 3 times
+		for tries = 0; tries < 3; tries++ {
+			err = g.Sync()
+			if err == nil {
+				break
+			}
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		if err != nil {
+			sgLog.WithFields(log.Fields{"minute": fds.Minute, "dbht": fds.Dbht}).WithError(err).WithField("tries", tries).Errorf("SPR grader failed to grade blocks. Sitting out this block")
+			g.SendToListeners(&SPRs{Error: fmt.Errorf("failed to grade")})
+			continue
+		}
+
+		// Alert followers that we have graded the previous block
+		g.SendToListeners(NewSPRs(g.GetPreviousSPRBlock(fds.Dbht)))
+	}
+}
+
+// Sync will sync our spr chain to the latest eblock head of the SPR chain,
+// grading every eblock that is not already graded on disk
+func (g *SPRGrader) Sync() error {
+	err := g.SPRChain.SyncBlocks()
+	if err != nil {
+		return err
+	}
+
+	// If the chain was rolled back, the cursor is on disk before anything is graded again
+	batch := database.NewBatch()
+	if err := g.SPRChain.SaveCursor(batch); err != nil {
+		g.rollbackSync()
+		return err
+	}
+	if err := g.BlockStore.DB.Write(batch); err != nil {
+		g.rollbackSync()
+		return err
+	}
+
+	for block := g.SPRChain.NextEBlock(); block != nil; block = g.SPRChain.NextEBlock() {
+		// The sprblock is written along with the cursor
+		batch := database.NewBatch()
+
+		// Before we grade it, we try and fetch from disk
+		sprblock, _ := g.BlockStore.FetchSPRBlock(block.EntryBlock.Header.DBHeight)
+		if sprblock == nil {
+			sprblock, err = g.GradeEBlock(block)
+			if err != nil {
+				return err
+			}
+			err = g.BlockStore.WriteSPRBlock(batch, sprblock)
+			if err != nil {
+				return err
+			}
+		}
+
+		g.SPRChain.BlockParsed(*block)
+		if err := g.SPRChain.SaveCursor(batch); err != nil {
+			g.rollbackSync()
+			return err
+		}
+		if err := g.BlockStore.DB.Write(batch); err != nil {
+			g.rollbackSync()
+			return err
+		}
+
+		if !sprblock.EmptySPRBlock {
+			g.sprBlkLock.Lock()
+			g.sprBlks = append(g.sprBlks, sprblock)
+			g.sprBlkLock.Unlock()
+		}
+	}
+	return nil
+}
+
+// GradeEBlock grades all the sprs in the eblock with the grader of the spr version
+// at its height. Invalid sprs are not graded.
+func (g *SPRGrader) GradeEBlock(block *opr.EntryBlockMarker) (*SprBlock, error) {
+	height := block.EntryBlock.Header.DBHeight
+	sprblock := &SprBlock{Dbht: height, Version: common.SPRVersion(g.Network, height)}
+
+	grader, err := graderStake.NewGrader(sprblock.Version, int32(height))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ebentry := range block.EntryBlock.EntryList {
+		entry, err := g.Factom.GetEntry(ebentry.EntryHash)
+		if err != nil {
+			return nil, common.DetailError(err)
+		}
+		hash, err := hex.DecodeString(ebentry.EntryHash)
+		if err != nil {
+			return nil, err
+		}
+
+		err = grader.AddSPR(hash, entry.ExtIDs, entry.Content)
+		if err != nil {
+			sgLog.WithFields(log.Fields{"dbht": height, "entry": ebentry.EntryHash}).WithError(err).Debug("invalid spr")
+			continue
+		}
+	}
+
+	sprblock.TotalNumberRecords = grader.Count()
+	graded := grader.Grade()
+	if len(graded.Winners()) == 0 {
+		sprblock.EmptySPRBlock = true
+		return sprblock, nil
+	}
+
+	average := AverageAssets(graded.Winners())
+	for _, s := range graded.Graded() {
+		assets := make(map[string]uint64)
+		for _, asset := range s.SPR.GetOrderedAssetsUint() {
+			assets[asset.Name] = asset.Value
+		}
+		sprblock.GradedSPRs = append(sprblock.GradedSPRs, &GradedSPR{
+			EntryHash:       hex.EncodeToString(s.EntryHash),
+			CoinbaseAddress: s.CoinbaseAddress,
+			Grade:           s.Grade,
+			Position:        s.Position(),
+			Payout:          s.Payout(),
+			Distance:        Distance(average, assets),
+			Assets:          assets,
+		})
+	}
+	return sprblock, nil
+}
+
+// AverageAssets returns the average value of each asset of the sprs
+func AverageAssets(sprs []*graderStake.GradingSPR) map[string]float64 {
+	average := make(map[string]float64)
+	if len(sprs) == 0 {
+		return average
+	}
+	for _, s := range sprs {
+		for _, asset := range s.SPR.GetOrderedAssetsUint() {
+			average[asset.Name] += float64(asset.Value)
+		}
+	}
+	for name := range average {
+		average[name] /= float64(len(sprs))
+	}
+	return average
+}
+
+// Distance is the mean relative difference of the assets from the average.
+// 0 is the average itself, 0.01 is 1% away from it on average.
+func Distance(average map[string]float64, assets map[string]uint64) float64 {
+	var sum float64
+	count := 0
+	for name, avg := range average {
+		if avg == 0 {
+			continue
+		}
+		sum += math.Abs(float64(assets[name])-avg) / avg
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// GetPreviousSPRBlock returns the highest graded sprblock below the height
+func (g *SPRGrader) GetPreviousSPRBlock(dbht int32) *SprBlock {
+	g.sprBlkLock.Lock()
+	defer g.sprBlkLock.Unlock()
+	for i := len(g.sprBlks) - 1; i >= 0; i-- {
+		if g.sprBlks[i].Dbht < int64(dbht) {
+			return g.sprBlks[i]
+		}
+	}
+	return nil
+}
+
+// SPRs is the alert sent once an spr block is graded
+type SPRs struct {
+	Dbht       int64
+	ToBePaid   []*GradedSPR
+	GradedSPRs []*GradedSPR
+
+	// Since this is used as a message, we need a way to send an error
+	Error error
+}
+
+// NewSPRs makes the alert for the sprblock. A nil block has no winners
+func NewSPRs(block *SprBlock) *SPRs {
+	sprs := new(SPRs)
+	if block == nil {
+		return sprs
+	}
+	sprs.Dbht = block.Dbht
+	sprs.GradedSPRs = block.GradedSPRs
+	for _, s := range block.GradedSPRs {
+		if s.Payout > 0 {
+			sprs.ToBePaid = append(sprs.ToBePaid, s)
+		}
+	}
+	return sprs
+}
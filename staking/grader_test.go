@@ -0,0 +1,175 @@
+package staking_test
+
+import (
+	"testing"
+
+	"github.com/FactomProject/btcutil/base58"
+	"github.com/FactomProject/factom"
+	"github.com/pegnet/pegnet/common"
+	"github.com/pegnet/pegnet/database"
+	"github.com/pegnet/pegnet/spr"
+	. "github.com/pegnet/pegnet/staking"
+	"github.com/zpatrick/go-config"
+)
+
+func TestSPRGrader_Sync(t *testing.T) {
+	c := config.NewConfig([]config.Provider{
+		config.NewStatic(map[string]string{
+			"Staker.Protocol": "PegNet",
+			"Staker.Network":  common.TestNetwork,
+		}),
+	})
+
+	chain := common.NewFakeFactomClient(100)
+	ec, _ := factom.GetECAddress("Es2XT3jSxi1xqrDvS5JERM3W3jh1awRHuyoahn3hbQLyfEi1jvbq")
+	chain.AddECAddress(ec, 1000)
+
+	db := database.NewMapDb()
+	g := NewSPRGrader(c, db)
+	g.SetFactomClient(chain)
+	alert := g.GetAlert("test")
+
+	// Write a block with an spr from 30 stakers, and one invalid spr
+	for i := 0; i < 30; i++ {
+		writeSPR(t, g, chain, ec, i)
+	}
+	invalid := &factom.Entry{ChainID: g.SPRChainIDString, ExtIDs: [][]byte{{5}}, Content: []byte("invalid")}
+	chain.CommitEntry(invalid, ec)
+	chain.RevealEntry(invalid)
+	chain.AdvanceBlock()
+
+	if err := g.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	blocks := g.GetBlocks()
+	if len(blocks) != 1 {
+		t.Fatalf("exp 1 graded block, found %d", len(blocks))
+	}
+	if blocks[0].TotalNumberRecords != 30 || len(blocks[0].GradedSPRs) != 30 {
+		t.Errorf("exp 30 graded sprs, found %d of %d", len(blocks[0].GradedSPRs), blocks[0].TotalNumberRecords)
+	}
+	sprs := NewSPRs(g.GetPreviousSPRBlock(int32(chain.Height())))
+	if len(sprs.ToBePaid) != 25 || sprs.Dbht != chain.Height()-1 {
+		t.Errorf("exp 25 winners at %d, found %d at %d", chain.Height()-1, len(sprs.ToBePaid), sprs.Dbht)
+	}
+	g.SendToListeners(sprs)
+	if a := <-alert; a != sprs {
+		t.Errorf("exp the graded block to be sent")
+	}
+
+	// The winners are closer to their average than the sprs that did not make the cut
+	graded := blocks[0].GradedSPRs
+	if graded[0].Distance <= 0 || graded[0].Distance >= graded[29].Distance {
+		t.Errorf("exp the winner to be closer to the average than the last spr, found %f and %f", graded[0].Distance, graded[29].Distance)
+	}
+
+	// The status of a staker that was graded, and one that did not submit
+	statuses := g.Status([]string{graded[3].CoinbaseAddress, "FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q"}, 5)
+	if len(statuses) != 2 {
+		t.Fatalf("exp 2 statuses, found %d", len(statuses))
+	}
+	if s := statuses[0]; !s.Included || s.Position != 3 || s.EntryHash != graded[3].EntryHash || s.Distance != graded[3].Distance {
+		t.Errorf("unexpected status %+v", s)
+	}
+	if s := statuses[1]; s.Included || s.Position != -1 || s.Dbht != blocks[0].Dbht {
+		t.Errorf("unexpected status %+v", s)
+	}
+
+	// A restart picks up the graded blocks from the db
+	restored := NewSPRGrader(c, db)
+	if len(restored.GetBlocks()) != 1 || restored.GetBlocks()[0].GradedSPRs[0].EntryHash != blocks[0].GradedSPRs[0].EntryHash {
+		t.Errorf("exp the graded blocks to be restored")
+	}
+
+	// A block without enough sprs has no winners
+	chain.AdvanceBlock()
+	writeSPR(t, g, chain, ec, 0)
+	chain.AdvanceBlock()
+	if err := g.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.GetBlocks()) != 1 {
+		t.Errorf("exp the block without winners to be skipped")
+	}
+	if block, err := g.BlockStore.FetchSPRBlock(chain.Height() - 1); err != nil || !block.EmptySPRBlock {
+		t.Errorf("exp an empty sprblock on disk")
+	}
+}
+
+// writeSPR writes an spr of the i'th staker to the chain
+func writeSPR(t *testing.T, g *SPRGrader, chain *common.FakeFactomClient, ec *factom.ECAddress, i int) {
+	entry, err := newSPR(t, g, chain, i).CreateSPREntry(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.CommitEntry(entry, ec); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.RevealEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newSPR makes an spr of the i'th staker for the current height
+func newSPR(t *testing.T, g *SPRGrader, chain *common.FakeFactomClient, i int) *spr.StakingPriceRecord {
+	sec := make([]byte, 32)
+	sec[0] = byte(i + 1)
+	fa, err := factom.MakeFactoidAddress(sec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.AddFactoidAddress(fa)
+
+	record := spr.NewStakingPriceRecord()
+	record.SPRChainID = base58.Encode(g.SPRChainID)
+	record.CoinbaseAddress = fa.String()
+	record.Dbht = int32(chain.Height())
+	record.Version = common.SPRVersion(g.Network, chain.Height())
+	for j, asset := range common.AssetsV5 {
+		record.Assets[asset] = uint64(1e8 + i*1000 + j)
+	}
+	return record
+}
+
+func TestValidateSPREntry(t *testing.T) {
+	c := config.NewConfig([]config.Provider{
+		config.NewStatic(map[string]string{
+			"Staker.Protocol": "PegNet",
+			"Staker.Network":  common.TestNetwork,
+		}),
+	})
+	g := NewSPRGrader(c, database.NewMapDb())
+
+	// The first and latest spr versions
+	for _, height := range []int64{100, common.V202EnhanceActivation} {
+		chain := common.NewFakeFactomClient(height)
+		record := newSPR(t, g, chain, 0)
+		entry, err := record.CreateSPREntry(chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidateSPREntry(g.Network, height, entry); err != nil {
+			t.Errorf("exp a valid spr at %d, found %s", height, err.Error())
+		}
+		if err := ValidateSPREntry(g.Network, height+1, entry); err == nil {
+			t.Errorf("exp an spr for another height to be invalid at %d", height)
+		}
+
+		record.Assets[common.AssetsV5[1]] = 0
+		entry, err = record.CreateSPREntry(chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidateSPREntry(g.Network, height, entry); err == nil {
+			t.Errorf("exp an spr with a zero price to be invalid at %d", height)
+		}
+	}
+
+	// Signatures are checked since version 7
+	chain := common.NewFakeFactomClient(common.V202EnhanceActivation)
+	entry, _ := newSPR(t, g, chain, 0).CreateSPREntry(chain)
+	entry.ExtIDs[2] = entry.ExtIDs[2][:64]
+	if err := ValidateSPREntry(g.Network, chain.Height(), entry); err == nil {
+		t.Error("exp an spr with a short signature to be invalid")
+	}
+}
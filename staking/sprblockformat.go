@@ -0,0 +1,142 @@
+package staking
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pegnet/pegnet/database"
+	"github.com/pegnet/pegnet/staking/sprencoding"
+)
+
+// SPRBlockFormatVersion is the version of the format sprblocks are written to the
+// database in.
+//
+// A stored sprblock is a zero byte, the version of its format, then the
+// sprencoding.ProtoSPRBlock, the same as an oprblock. Anything else is a gob of the
+// SprBlock from before the format was versioned.
+const SPRBlockFormatVersion = 1
+
+func init() {
+	database.RegisterMigration(database.Migration{
+		Version:     4,
+		Description: "store sprblocks as protobufs",
+		Migrate:     migrateSPRBlocks,
+	})
+}
+
+// EncodeSPRBlock encodes the sprblock in the current format
+func EncodeSPRBlock(block *SprBlock) ([]byte, error) {
+	p := &sprencoding.ProtoSPRBlock{
+		Height:             block.Dbht,
+		Version:            uint32(block.Version),
+		Empty:              block.EmptySPRBlock,
+		TotalNumberRecords: int32(block.TotalNumberRecords),
+		GradedSPRs:         make([]*sprencoding.ProtoGradedSPR, len(block.GradedSPRs)),
+	}
+	for i, s := range block.GradedSPRs {
+		p.GradedSPRs[i] = sprToProto(s)
+	}
+
+	data, err := proto.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{0, SPRBlockFormatVersion}, data...), nil
+}
+
+// DecodeSPRBlock decodes an sprblock of any format version, or a legacy gob
+func DecodeSPRBlock(data []byte) (*SprBlock, error) {
+	if IsLegacySPRBlock(data) {
+		block := new(SprBlock)
+		if err := database.Decode(block, data); err != nil {
+			return nil, err
+		}
+		return block, nil
+	}
+	if len(data) < 2 {
+		return nil, fmt.Errorf("sprblock is corrupt")
+	}
+
+	switch data[1] {
+	case SPRBlockFormatVersion:
+		p := new(sprencoding.ProtoSPRBlock)
+		if err := proto.Unmarshal(data[2:], p); err != nil {
+			return nil, err
+		}
+		block := &SprBlock{
+			Dbht:               p.Height,
+			Version:            uint8(p.Version),
+			EmptySPRBlock:      p.Empty,
+			TotalNumberRecords: int(p.TotalNumberRecords),
+		}
+		for _, s := range p.GradedSPRs {
+			block.GradedSPRs = append(block.GradedSPRs, sprFromProto(s))
+		}
+		return block, nil
+	default:
+		return nil, fmt.Errorf("sprblock format version %d is newer than this build", data[1])
+	}
+}
+
+// IsLegacySPRBlock is true if the stored sprblock is a gob from before the format
+// was versioned
+func IsLegacySPRBlock(data []byte) bool {
+	return len(data) > 0 && data[0] != 0
+}
+
+func sprToProto(s *GradedSPR) *sprencoding.ProtoGradedSPR {
+	p := &sprencoding.ProtoGradedSPR{
+		EntryHash:       s.EntryHash,
+		CoinbaseAddress: s.CoinbaseAddress,
+		Grade:           s.Grade,
+		Position:        int32(s.Position),
+		Payout:          s.Payout,
+		Distance:        s.Distance,
+	}
+	// Sorted, so the same block is always the same bytes
+	for name, price := range s.Assets {
+		p.Assets = append(p.Assets, &sprencoding.ProtoAsset{Name: name, Price: price})
+	}
+	sort.Slice(p.Assets, func(i, j int) bool { return p.Assets[i].Name < p.Assets[j].Name })
+	return p
+}
+
+func sprFromProto(p *sprencoding.ProtoGradedSPR) *GradedSPR {
+	s := &GradedSPR{
+		EntryHash:       p.EntryHash,
+		CoinbaseAddress: p.CoinbaseAddress,
+		Grade:           p.Grade,
+		Position:        int(p.Position),
+		Payout:          p.Payout,
+		Distance:        p.Distance,
+	}
+	if len(p.Assets) > 0 {
+		s.Assets = make(map[string]uint64, len(p.Assets))
+	}
+	for _, asset := range p.Assets {
+		s.Assets[asset.Name] = asset.Price
+	}
+	return s
+}
+
+// migrateSPRBlocks rewrites the legacy gob sprblocks in the current format
+func migrateSPRBlocks(db database.IDatabase, batch *database.Batch) error {
+	iter := db.Iterate(database.BUCKET_SPR_HEIGHT)
+	defer iter.Release()
+	for iter.Next() {
+		if !IsLegacySPRBlock(iter.Value()) {
+			continue
+		}
+		block, err := DecodeSPRBlock(iter.Value())
+		if err != nil {
+			return fmt.Errorf("sprblock %x: %s", iter.Key(), err.Error())
+		}
+		data, err := EncodeSPRBlock(block)
+		if err != nil {
+			return err
+		}
+		batch.Put(database.BUCKET_SPR_HEIGHT, append([]byte{}, iter.Key()...), data)
+	}
+	return iter.Error()
+}
@@ -0,0 +1,109 @@
+package staking_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/pegnet/pegnet/database"
+	. "github.com/pegnet/pegnet/staking"
+)
+
+func randomSPRBlock() *SprBlock {
+	block := &SprBlock{Dbht: rand.Int63n(1e6), Version: 7}
+	block.GradedSPRs = make([]*GradedSPR, rand.Intn(50)+1)
+	for i := range block.GradedSPRs {
+		s := &GradedSPR{
+			EntryHash:       fmt.Sprintf("%064x", rand.Int63()),
+			CoinbaseAddress: fmt.Sprintf("FA%050d", rand.Int63()),
+			Grade:           rand.Float64(),
+			Position:        i,
+			Payout:          rand.Int63n(1e10),
+			Distance:        rand.Float64(),
+			Assets:          make(map[string]uint64),
+		}
+		for _, asset := range []string{"PEG", "pUSD", "pEUR", "pXAU"} {
+			s.Assets[asset] = rand.Uint64()
+		}
+		block.GradedSPRs[i] = s
+	}
+	block.TotalNumberRecords = len(block.GradedSPRs) + 10
+	return block
+}
+
+func TestSPRBlockFormat(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		orig := randomSPRBlock()
+
+		data, err := EncodeSPRBlock(orig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if IsLegacySPRBlock(data) || data[1] != SPRBlockFormatVersion {
+			t.Fatalf("exp format version %d, found %x", SPRBlockFormatVersion, data[:2])
+		}
+		if again, _ := EncodeSPRBlock(orig); !bytes.Equal(data, again) {
+			t.Error("exp the same block to be encoded the same")
+		}
+
+		decoded, err := DecodeSPRBlock(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(orig, decoded) {
+			t.Error("decoded is not the same as the orig")
+		}
+
+		// The gobs written before the format was versioned are still read
+		legacy, err := database.Encode(orig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsLegacySPRBlock(legacy) {
+			t.Fatal("exp a gob to be legacy")
+		}
+		decoded, err = DecodeSPRBlock(legacy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(orig, decoded) {
+			t.Error("legacy decoded is not the same as the orig")
+		}
+	}
+
+	if _, err := DecodeSPRBlock([]byte{0, SPRBlockFormatVersion + 1}); err == nil {
+		t.Error("exp an error for a newer format")
+	}
+}
+
+func TestSPRBlockFormat_Migration(t *testing.T) {
+	db := database.NewMapDb()
+	orig := randomSPRBlock()
+	legacy, err := database.Encode(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(database.BUCKET_SPR_HEIGHT, database.HeightToBytes(orig.Dbht), legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(database.BUCKET_META, []byte("schema"), database.HeightToBytes(3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := db.Get(database.BUCKET_SPR_HEIGHT, database.HeightToBytes(orig.Dbht))
+	if err != nil || IsLegacySPRBlock(data) {
+		t.Fatalf("exp the sprblock in the versioned format, found %v", err)
+	}
+	block, err := NewSPRBlockStore(db).FetchSPRBlock(orig.Dbht)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(orig, block) {
+		t.Error("exp the sprblock to be the same after the migration")
+	}
+}
@@ -0,0 +1,62 @@
+package staking
+
+import (
+	"github.com/pegnet/pegnet/database"
+)
+
+// SprBlock is the graded sprs of a single SPR chain eblock
+type SprBlock struct {
+	Dbht               int64
+	Version            uint8
+	GradedSPRs         []*GradedSPR // In graded order, the winners first
+	TotalNumberRecords int          // The number of valid sprs in the eblock
+	EmptySPRBlock      bool         // The eblock does not have enough valid sprs to have winners
+}
+
+// GradedSPR is an spr and how it placed in the grading of its block
+type GradedSPR struct {
+	EntryHash       string            `json:"entryhash"`
+	CoinbaseAddress string            `json:"coinbase"`
+	Grade           float64           `json:"grade"`
+	Position        int               `json:"position"`
+	Payout          int64             `json:"payout"`
+	Distance        float64           `json:"distance"` // Mean relative distance of the assets from the winners' average
+	Assets          map[string]uint64 `json:"assets"`
+}
+
+// SPRBlockStore is where we store the graded sprblocks
+type SPRBlockStore struct {
+	DB database.IDatabase
+}
+
+func NewSPRBlockStore(db database.IDatabase) *SPRBlockStore {
+	s := new(SPRBlockStore)
+	s.DB = db
+
+	return s
+}
+
+func (d *SPRBlockStore) Close() error {
+	return d.DB.Close()
+}
+
+// WriteSPRBlock adds the sprblock, indexed by its height, to the batch
+func (d *SPRBlockStore) WriteSPRBlock(batch *database.Batch, block *SprBlock) error {
+	data, err := EncodeSPRBlock(block)
+	if err != nil {
+		return err
+	}
+	batch.Put(database.BUCKET_SPR_HEIGHT, database.HeightToBytes(block.Dbht), data)
+	return nil
+}
+
+// FetchSPRBlock returns the sprblock at the height, or database.ErrNotFound if the
+// height has not been graded
+func (d *SPRBlockStore) FetchSPRBlock(height int64) (*SprBlock, error) {
+	data, err := d.DB.Get(database.BUCKET_SPR_HEIGHT, database.HeightToBytes(height))
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeSPRBlock(data)
+}
@@ -0,0 +1,261 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: sprblock.proto
+
+package sprencoding
+
+import (
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// ProtoSPRBlock is a graded sprblock as it is kept in the staker database
+type ProtoSPRBlock struct {
+	Height               int64             `protobuf:"varint,1,opt,name=Height,proto3" json:"Height,omitempty"`
+	Version              uint32            `protobuf:"varint,2,opt,name=Version,proto3" json:"Version,omitempty"`
+	Empty                bool              `protobuf:"varint,3,opt,name=Empty,proto3" json:"Empty,omitempty"`
+	TotalNumberRecords   int32             `protobuf:"varint,4,opt,name=TotalNumberRecords,proto3" json:"TotalNumberRecords,omitempty"`
+	GradedSPRs           []*ProtoGradedSPR `protobuf:"bytes,5,rep,name=GradedSPRs,proto3" json:"GradedSPRs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *ProtoSPRBlock) Reset()         { *m = ProtoSPRBlock{} }
+func (m *ProtoSPRBlock) String() string { return proto.CompactTextString(m) }
+func (*ProtoSPRBlock) ProtoMessage()    {}
+func (*ProtoSPRBlock) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1baa7cda74a1a42d, []int{0}
+}
+
+func (m *ProtoSPRBlock) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProtoSPRBlock.Unmarshal(m, b)
+}
+func (m *ProtoSPRBlock) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProtoSPRBlock.Marshal(b, m, deterministic)
+}
+func (m *ProtoSPRBlock) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProtoSPRBlock.Merge(m, src)
+}
+func (m *ProtoSPRBlock) XXX_Size() int {
+	return xxx_messageInfo_ProtoSPRBlock.Size(m)
+}
+func (m *ProtoSPRBlock) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProtoSPRBlock.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ProtoSPRBlock proto.InternalMessageInfo
+
+func (m *ProtoSPRBlock) GetHeight() int64 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+func (m *ProtoSPRBlock) GetVersion() uint32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *ProtoSPRBlock) GetEmpty() bool {
+	if m != nil {
+		return m.Empty
+	}
+	return false
+}
+
+func (m *ProtoSPRBlock) GetTotalNumberRecords() int32 {
+	if m != nil {
+		return m.TotalNumberRecords
+	}
+	return 0
+}
+
+func (m *ProtoSPRBlock) GetGradedSPRs() []*ProtoGradedSPR {
+	if m != nil {
+		return m.GradedSPRs
+	}
+	return nil
+}
+
+// ProtoGradedSPR is an spr of a block and how it placed in the grading
+type ProtoGradedSPR struct {
+	EntryHash            string        `protobuf:"bytes,1,opt,name=EntryHash,proto3" json:"EntryHash,omitempty"`
+	CoinbaseAddress      string        `protobuf:"bytes,2,opt,name=CoinbaseAddress,proto3" json:"CoinbaseAddress,omitempty"`
+	Grade                float64       `protobuf:"fixed64,3,opt,name=Grade,proto3" json:"Grade,omitempty"`
+	Position             int32         `protobuf:"varint,4,opt,name=Position,proto3" json:"Position,omitempty"`
+	Payout               int64         `protobuf:"varint,5,opt,name=Payout,proto3" json:"Payout,omitempty"`
+	Distance             float64       `protobuf:"fixed64,6,opt,name=Distance,proto3" json:"Distance,omitempty"`
+	Assets               []*ProtoAsset `protobuf:"bytes,7,rep,name=Assets,proto3" json:"Assets,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *ProtoGradedSPR) Reset()         { *m = ProtoGradedSPR{} }
+func (m *ProtoGradedSPR) String() string { return proto.CompactTextString(m) }
+func (*ProtoGradedSPR) ProtoMessage()    {}
+func (*ProtoGradedSPR) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1baa7cda74a1a42d, []int{1}
+}
+
+func (m *ProtoGradedSPR) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProtoGradedSPR.Unmarshal(m, b)
+}
+func (m *ProtoGradedSPR) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProtoGradedSPR.Marshal(b, m, deterministic)
+}
+func (m *ProtoGradedSPR) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProtoGradedSPR.Merge(m, src)
+}
+func (m *ProtoGradedSPR) XXX_Size() int {
+	return xxx_messageInfo_ProtoGradedSPR.Size(m)
+}
+func (m *ProtoGradedSPR) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProtoGradedSPR.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ProtoGradedSPR proto.InternalMessageInfo
+
+func (m *ProtoGradedSPR) GetEntryHash() string {
+	if m != nil {
+		return m.EntryHash
+	}
+	return ""
+}
+
+func (m *ProtoGradedSPR) GetCoinbaseAddress() string {
+	if m != nil {
+		return m.CoinbaseAddress
+	}
+	return ""
+}
+
+func (m *ProtoGradedSPR) GetGrade() float64 {
+	if m != nil {
+		return m.Grade
+	}
+	return 0
+}
+
+func (m *ProtoGradedSPR) GetPosition() int32 {
+	if m != nil {
+		return m.Position
+	}
+	return 0
+}
+
+func (m *ProtoGradedSPR) GetPayout() int64 {
+	if m != nil {
+		return m.Payout
+	}
+	return 0
+}
+
+func (m *ProtoGradedSPR) GetDistance() float64 {
+	if m != nil {
+		return m.Distance
+	}
+	return 0
+}
+
+func (m *ProtoGradedSPR) GetAssets() []*ProtoAsset {
+	if m != nil {
+		return m.Assets
+	}
+	return nil
+}
+
+type ProtoAsset struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Price                uint64   `protobuf:"varint,2,opt,name=Price,proto3" json:"Price,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ProtoAsset) Reset()         { *m = ProtoAsset{} }
+func (m *ProtoAsset) String() string { return proto.CompactTextString(m) }
+func (*ProtoAsset) ProtoMessage()    {}
+func (*ProtoAsset) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1baa7cda74a1a42d, []int{2}
+}
+
+func (m *ProtoAsset) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProtoAsset.Unmarshal(m, b)
+}
+func (m *ProtoAsset) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProtoAsset.Marshal(b, m, deterministic)
+}
+func (m *ProtoAsset) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProtoAsset.Merge(m, src)
+}
+func (m *ProtoAsset) XXX_Size() int {
+	return xxx_messageInfo_ProtoAsset.Size(m)
+}
+func (m *ProtoAsset) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProtoAsset.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ProtoAsset proto.InternalMessageInfo
+
+func (m *ProtoAsset) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *ProtoAsset) GetPrice() uint64 {
+	if m != nil {
+		return m.Price
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*ProtoSPRBlock)(nil), "sprencoding.ProtoSPRBlock")
+	proto.RegisterType((*ProtoGradedSPR)(nil), "sprencoding.ProtoGradedSPR")
+	proto.RegisterType((*ProtoAsset)(nil), "sprencoding.ProtoAsset")
+}
+
+func init() { proto.RegisterFile("sprblock.proto", fileDescriptor_1baa7cda74a1a42d) }
+
+var fileDescriptor_1baa7cda74a1a42d = []byte{
+	// 326 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x92, 0xcd, 0x4e, 0xc2, 0x40,
+	0x10, 0xc7, 0xb3, 0x42, 0x0b, 0x0c, 0x01, 0x93, 0x8d, 0xd1, 0x8d, 0x7a, 0x68, 0x38, 0xf5, 0x54,
+	0x13, 0x4d, 0xbc, 0x78, 0x42, 0x25, 0x72, 0x22, 0xcd, 0x60, 0xbc, 0xf7, 0x63, 0x03, 0x1b, 0xa1,
+	0xdb, 0xec, 0x2c, 0x07, 0xde, 0xcf, 0xf7, 0xf1, 0x15, 0xcc, 0x6e, 0x11, 0xf0, 0xe3, 0xd6, 0xdf,
+	0xcc, 0xbf, 0x93, 0xf9, 0x4d, 0x16, 0x86, 0x54, 0x9b, 0x7c, 0xa5, 0x8b, 0xf7, 0xa4, 0x36, 0xda,
+	0x6a, 0xde, 0xa7, 0xda, 0xc8, 0xaa, 0xd0, 0xa5, 0xaa, 0x16, 0xa3, 0x0f, 0x06, 0x83, 0xd4, 0x95,
+	0xe7, 0x29, 0x3e, 0xba, 0x10, 0x3f, 0x87, 0x70, 0x2a, 0xd5, 0x62, 0x69, 0x05, 0x8b, 0x58, 0xdc,
+	0xc2, 0x1d, 0x71, 0x01, 0x9d, 0x37, 0x69, 0x48, 0xe9, 0x4a, 0x9c, 0x44, 0x2c, 0x1e, 0xe0, 0x37,
+	0xf2, 0x33, 0x08, 0x26, 0xeb, 0xda, 0x6e, 0x45, 0x2b, 0x62, 0x71, 0x17, 0x1b, 0xe0, 0x09, 0xf0,
+	0x57, 0x6d, 0xb3, 0xd5, 0x6c, 0xb3, 0xce, 0xa5, 0x41, 0x59, 0x68, 0x53, 0x92, 0x68, 0x47, 0x2c,
+	0x0e, 0xf0, 0x9f, 0x0e, 0x7f, 0x00, 0x78, 0x31, 0x59, 0x29, 0xcb, 0x79, 0x8a, 0x24, 0x82, 0xa8,
+	0x15, 0xf7, 0x6f, 0xaf, 0x92, 0xa3, 0x5d, 0x13, 0xbf, 0xe7, 0x3e, 0x83, 0x47, 0xf1, 0xd1, 0x27,
+	0x83, 0xe1, 0xcf, 0x36, 0xbf, 0x86, 0xde, 0xa4, 0xb2, 0x66, 0x3b, 0xcd, 0x68, 0xe9, 0x55, 0x7a,
+	0x78, 0x28, 0xf0, 0x18, 0x4e, 0x9f, 0xb4, 0xaa, 0xf2, 0x8c, 0xe4, 0xb8, 0x2c, 0x8d, 0x24, 0xf2,
+	0x56, 0x3d, 0xfc, 0x5d, 0x76, 0x76, 0x7e, 0xa8, 0xb7, 0x63, 0xd8, 0x00, 0xbf, 0x84, 0x6e, 0xaa,
+	0x49, 0x59, 0x77, 0x8e, 0xc6, 0x69, 0xcf, 0xee, 0x82, 0x69, 0xb6, 0xd5, 0x1b, 0x2b, 0x82, 0xe6,
+	0x82, 0x0d, 0xb9, 0x7f, 0x9e, 0x15, 0xd9, 0xac, 0x2a, 0xa4, 0x08, 0xfd, 0xb0, 0x3d, 0xf3, 0x1b,
+	0x08, 0xc7, 0x44, 0xd2, 0x92, 0xe8, 0x78, 0xf3, 0x8b, 0xbf, 0xe6, 0xbe, 0x8f, 0xbb, 0xd8, 0xe8,
+	0x1e, 0xe0, 0x50, 0xe5, 0x1c, 0xda, 0xb3, 0x6c, 0x2d, 0x77, 0x9e, 0xfe, 0xdb, 0x2d, 0x9e, 0x1a,
+	0x55, 0x48, 0x2f, 0xd6, 0xc6, 0x06, 0xf2, 0xd0, 0x3f, 0x82, 0xbb, 0xaf, 0x01, 0x00, 0xc7, 0x64,
+	0xef, 0x84, 0x16, 0x02, 0x00, 0x00,
+}
@@ -11,7 +11,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/FactomProject/factom"
 	"github.com/pegnet/pegnet/common"
 	log "github.com/sirupsen/logrus"
 	"github.com/zpatrick/go-config"
@@ -38,6 +37,9 @@ type PegnetStaker struct {
 	ID     int            `json:"id"`
 	Config *config.Config `json:"-"` //  The config of the staker using the record
 
+	// CoinbaseAddress is the address the staker makes and signs its sprs for
+	CoinbaseAddress string `json:"coinbase"`
+
 	// Staker commands
 	commands <-chan *StakerCommand
 
@@ -54,23 +56,43 @@ type sprStakingState struct {
 	sprhash []byte
 }
 
-func NewPegnetStakerFromConfig(c *config.Config, id int, commands <-chan *StakerCommand) *PegnetStaker {
-	CheckStakingAddresses(c)
+// NewPegnetStakerFromConfig makes a staker for one of the coinbase addresses.
+// The addresses should be checked with CheckStakingAddresses first.
+func NewPegnetStakerFromConfig(c *config.Config, id int, coinbase string, commands <-chan *StakerCommand) *PegnetStaker {
 	p := new(PegnetStaker)
 	p.Config = c
 	p.ID = id
+	p.CoinbaseAddress = coinbase
 	p.commands = commands
 	return p
 }
 
-func CheckStakingAddresses(config *config.Config) {
-	fctList, err := config.String("Staker.CoinbaseAddress")
+// StakingAddresses returns the comma separated list of coinbase addresses to stake
+func StakingAddresses(config *config.Config) ([]string, error) {
+	fctList, err := config.String(common.ConfigCoinbaseStakeAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	for _, addr := range strings.Split(fctList, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addresses = append(addresses, addr)
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no coinbase address in %s", common.ConfigCoinbaseStakeAddress)
+	}
+	return addresses, nil
+}
+
+func CheckStakingAddresses(config *config.Config, client common.FactomClient) {
+	fctSlice, err := StakingAddresses(config)
 	if err != nil {
 		panic(fmt.Sprintf("could not extract the CoinbaseAddress: %s ", err.Error()))
 	}
 
 	// Make sure no addresses are duplicted in the CoinbaseAddress list.
-	fctSlice := strings.Split(fctList, ",")
 	for i, fctAddress1 := range fctSlice {
 		for j, fctAddress2 := range fctSlice {
 			if i == j {
@@ -88,6 +110,10 @@ func CheckStakingAddresses(config *config.Config) {
 		if err != nil {
 			panic(fmt.Sprintf("coinbase address %d [%s] is invalid: %s", i+1, fctAddress, err.Error()))
 		}
+		// Every spr is signed by the key of its coinbase address
+		if _, err := client.SignData(fctAddress, []byte(fctAddress)); err != nil {
+			panic(fmt.Sprintf("coinbase address %d [%s] can not be signed for, is its key in the wallet? %s", i+1, fctAddress, err.Error()))
+		}
 	}
 
 	// Check the EC address and its balance.  We are failing at zero, but maybe we should require 144?
@@ -96,7 +122,7 @@ func CheckStakingAddresses(config *config.Config) {
 	if err != nil {
 		panic("entry credit address is invalid: " + err.Error())
 	}
-	bal, err := factom.GetECBalance(ecAddress)
+	bal, err := client.GetECBalance(ecAddress)
 	if err != nil {
 		panic(fmt.Sprintf("entry credit address [%s] is invalid: %s", ecAddress, err.Error()))
 	}
@@ -114,7 +140,7 @@ func CheckStakingAddresses(config *config.Config) {
 }
 
 func (p *PegnetStaker) Stake(ctx context.Context) {
-	stakeLog := log.WithFields(log.Fields{"staker": p.ID})
+	stakeLog := log.WithFields(log.Fields{"staker": p.ID, "coinbase": p.CoinbaseAddress})
 	var _ = stakeLog
 	select {
 	// Wait for the first command to start
@@ -0,0 +1,43 @@
+package staking
+
+// SPRStatus is how the spr of a coinbase address did in a graded spr block
+type SPRStatus struct {
+	Dbht            int64   `json:"dbht"`
+	CoinbaseAddress string  `json:"coinbase"`
+	Included        bool    `json:"included"` // The spr was valid, and graded in the block
+	EntryHash       string  `json:"entryhash,omitempty"`
+	Position        int     `json:"position"` // 0 is the best spr. -1 if not included
+	Grade           float64 `json:"grade"`
+	Distance        float64 `json:"distance"`
+	Payout          int64   `json:"payout"`
+}
+
+// Status reports how the sprs of the coinbase addresses did in the last graded
+// spr blocks, the newest block first. A coinbase address without a graded spr in a
+// block was either not submitted, or was rejected by the grader.
+func (g *SPRGrader) Status(coinbases []string, blocks int) []*SPRStatus {
+	g.sprBlkLock.Lock()
+	defer g.sprBlkLock.Unlock()
+
+	var statuses []*SPRStatus
+	for i := len(g.sprBlks) - 1; i >= 0 && i >= len(g.sprBlks)-blocks; i-- {
+		block := g.sprBlks[i]
+		for _, coinbase := range coinbases {
+			status := &SPRStatus{Dbht: block.Dbht, CoinbaseAddress: coinbase, Position: -1}
+			for _, s := range block.GradedSPRs {
+				if s.CoinbaseAddress != coinbase {
+					continue
+				}
+				status.Included = true
+				status.EntryHash = s.EntryHash
+				status.Position = s.Position
+				status.Grade = s.Grade
+				status.Distance = s.Distance
+				status.Payout = s.Payout
+				break
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}